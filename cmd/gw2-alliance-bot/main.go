@@ -6,6 +6,8 @@ import (
 	"os/signal"
 
 	"github.com/vennekilde/gw2-alliance-bot/internal"
+	"github.com/vennekilde/gw2-alliance-bot/internal/dashboard"
+	"github.com/vennekilde/gw2-alliance-bot/internal/management"
 	"go.uber.org/zap"
 )
 
@@ -22,8 +24,22 @@ func main() {
 	backendToken := os.Getenv("backendToken")
 	serviceUUID := os.Getenv("serviceUUID")
 	debugUser := os.Getenv("debugUser")
+	// Optional directory where caches are persisted across restarts
+	dataDir := os.Getenv("dataDir")
+	// Optional web dashboard, served if dashboardAddr is set
+	dashboardConfig := dashboard.Config{
+		Addr:         os.Getenv("dashboardAddr"),
+		BaseURL:      os.Getenv("dashboardURL"),
+		ClientID:     os.Getenv("discordClientID"),
+		ClientSecret: os.Getenv("discordClientSecret"),
+	}
+	// Optional management API, served if managementAddr and managementToken are set
+	managementConfig := management.Config{
+		Addr:  os.Getenv("managementAddr"),
+		Token: os.Getenv("managementToken"),
+	}
 
-	bot := internal.NewBot(discordToken, backendURL, serviceUUID, backendToken, debugUser)
+	bot := internal.NewBot(discordToken, backendURL, serviceUUID, backendToken, debugUser, dataDir, dashboardConfig, managementConfig)
 	bot.Start()
 	defer bot.Close()
 
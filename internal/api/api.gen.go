@@ -187,6 +187,12 @@ type VerificationStatus struct {
 // WorldLinks defines model for WorldLinks.
 type WorldLinks = []int
 
+// AccountId defines model for account_id.
+type AccountId = string
+
+// AccountIdent defines model for account_ident.
+type AccountIdent = string
+
 // GuildIdent defines model for guild_ident.
 type GuildIdent = string
 
@@ -205,6 +211,9 @@ type ServiceUuid = string
 // Subject defines model for subject.
 type Subject = string
 
+// TokenId defines model for token_id.
+type TokenId = string
+
 // TraitPlatformUserDisplayName defines model for trait_platform_user_display_name.
 type TraitPlatformUserDisplayName = string
 
@@ -361,6 +370,9 @@ func WithRequestEditorFn(fn RequestEditorFn) ClientOption {
 
 // The interface specification for the client above.
 type ClientInterface interface {
+	// GetAccountUser request
+	GetAccountUser(ctx context.Context, accountIdent AccountIdent, reqEditors ...RequestEditorFn) (*http.Response, error)
+
 	// PostChannelPlatformStatisticsWithBody request with any body
 	PostChannelPlatformStatisticsWithBody(ctx context.Context, platformId PlatformId, channel string, params *PostChannelPlatformStatisticsParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
 
@@ -378,6 +390,9 @@ type ClientInterface interface {
 	// GetPlatformUser request
 	GetPlatformUser(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, params *GetPlatformUserParams, reqEditors ...RequestEditorFn) (*http.Response, error)
 
+	// DeletePlatformUserAccount request
+	DeletePlatformUserAccount(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, accountId AccountId, reqEditors ...RequestEditorFn) (*http.Response, error)
+
 	// PutPlatformUserAPIKeyWithBody request with any body
 	PutPlatformUserAPIKeyWithBody(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, params *PutPlatformUserAPIKeyParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
 
@@ -386,6 +401,9 @@ type ClientInterface interface {
 	// GetPlatformUserAPIKeyName request
 	GetPlatformUserAPIKeyName(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, params *GetPlatformUserAPIKeyNameParams, reqEditors ...RequestEditorFn) (*http.Response, error)
 
+	// DeletePlatformUserAPIKey request
+	DeletePlatformUserAPIKey(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, tokenId TokenId, reqEditors ...RequestEditorFn) (*http.Response, error)
+
 	// PutPlatformUserBanWithBody request with any body
 	PutPlatformUserBanWithBody(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
 
@@ -424,6 +442,18 @@ type ClientInterface interface {
 	PutVerificationPlatformUserTemporary(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, params *PutVerificationPlatformUserTemporaryParams, body PutVerificationPlatformUserTemporaryJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
 }
 
+func (c *Client) GetAccountUser(ctx context.Context, accountIdent AccountIdent, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetAccountUserRequest(c.Server, accountIdent)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
 func (c *Client) PostChannelPlatformStatisticsWithBody(ctx context.Context, platformId PlatformId, channel string, params *PostChannelPlatformStatisticsParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
 	req, err := NewPostChannelPlatformStatisticsRequestWithBody(c.Server, platformId, channel, params, contentType, body)
 	if err != nil {
@@ -496,6 +526,18 @@ func (c *Client) GetPlatformUser(ctx context.Context, platformId PlatformId, pla
 	return c.Client.Do(req)
 }
 
+func (c *Client) DeletePlatformUserAccount(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, accountId AccountId, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewDeletePlatformUserAccountRequest(c.Server, platformId, platformUserId, accountId)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
 func (c *Client) PutPlatformUserAPIKeyWithBody(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, params *PutPlatformUserAPIKeyParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
 	req, err := NewPutPlatformUserAPIKeyRequestWithBody(c.Server, platformId, platformUserId, params, contentType, body)
 	if err != nil {
@@ -532,6 +574,18 @@ func (c *Client) GetPlatformUserAPIKeyName(ctx context.Context, platformId Platf
 	return c.Client.Do(req)
 }
 
+func (c *Client) DeletePlatformUserAPIKey(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, tokenId TokenId, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewDeletePlatformUserAPIKeyRequest(c.Server, platformId, platformUserId, tokenId)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
 func (c *Client) PutPlatformUserBanWithBody(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
 	req, err := NewPutPlatformUserBanRequestWithBody(c.Server, platformId, platformUserId, contentType, body)
 	if err != nil {
@@ -688,6 +742,40 @@ func (c *Client) PutVerificationPlatformUserTemporary(ctx context.Context, platf
 	return c.Client.Do(req)
 }
 
+// NewGetAccountUserRequest generates requests for GetAccountUser
+func NewGetAccountUserRequest(server string, accountIdent AccountIdent) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "account_ident", runtime.ParamLocationPath, accountIdent)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/v1/accounts/%s/user", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
 // NewPostChannelPlatformStatisticsRequest calls the generic PostChannelPlatformStatistics builder with application/json body
 func NewPostChannelPlatformStatisticsRequest(server string, platformId PlatformId, channel string, params *PostChannelPlatformStatisticsParams, body PostChannelPlatformStatisticsJSONRequestBody) (*http.Request, error) {
 	var bodyReader io.Reader
@@ -958,6 +1046,54 @@ func NewGetPlatformUserRequest(server string, platformId PlatformId, platformUse
 	return req, nil
 }
 
+// NewDeletePlatformUserAccountRequest generates requests for DeletePlatformUserAccount
+func NewDeletePlatformUserAccountRequest(server string, platformId PlatformId, platformUserId PlatformUserId, accountId AccountId) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "platform_id", runtime.ParamLocationPath, platformId)
+	if err != nil {
+		return nil, err
+	}
+
+	var pathParam1 string
+
+	pathParam1, err = runtime.StyleParamWithLocation("simple", false, "platform_user_id", runtime.ParamLocationPath, platformUserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var pathParam2 string
+
+	pathParam2, err = runtime.StyleParamWithLocation("simple", false, "account_id", runtime.ParamLocationPath, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/v1/platform/%s/users/%s/accounts/%s", pathParam0, pathParam1, pathParam2)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("DELETE", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
 // NewPutPlatformUserAPIKeyRequest calls the generic PutPlatformUserAPIKey builder with application/json body
 func NewPutPlatformUserAPIKeyRequest(server string, platformId PlatformId, platformUserId PlatformUserId, params *PutPlatformUserAPIKeyParams, body PutPlatformUserAPIKeyJSONRequestBody) (*http.Request, error) {
 	var bodyReader io.Reader
@@ -1113,6 +1249,54 @@ func NewGetPlatformUserAPIKeyNameRequest(server string, platformId PlatformId, p
 	return req, nil
 }
 
+// NewDeletePlatformUserAPIKeyRequest generates requests for DeletePlatformUserAPIKey
+func NewDeletePlatformUserAPIKeyRequest(server string, platformId PlatformId, platformUserId PlatformUserId, tokenId TokenId) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "platform_id", runtime.ParamLocationPath, platformId)
+	if err != nil {
+		return nil, err
+	}
+
+	var pathParam1 string
+
+	pathParam1, err = runtime.StyleParamWithLocation("simple", false, "platform_user_id", runtime.ParamLocationPath, platformUserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var pathParam2 string
+
+	pathParam2, err = runtime.StyleParamWithLocation("simple", false, "token_id", runtime.ParamLocationPath, tokenId)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/v1/platform/%s/users/%s/apikeys/%s", pathParam0, pathParam1, pathParam2)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("DELETE", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
 // NewPutPlatformUserBanRequest calls the generic PutPlatformUserBan builder with application/json body
 func NewPutPlatformUserBanRequest(server string, platformId PlatformId, platformUserId PlatformUserId, body PutPlatformUserBanJSONRequestBody) (*http.Request, error) {
 	var bodyReader io.Reader
@@ -1721,6 +1905,9 @@ func WithBaseURL(baseURL string) ClientOption {
 
 // ClientWithResponsesInterface is the interface specification for the client with responses above.
 type ClientWithResponsesInterface interface {
+	// GetAccountUserWithResponse request
+	GetAccountUserWithResponse(ctx context.Context, accountIdent AccountIdent, reqEditors ...RequestEditorFn) (*GetAccountUserResponse, error)
+
 	// PostChannelPlatformStatisticsWithBodyWithResponse request with any body
 	PostChannelPlatformStatisticsWithBodyWithResponse(ctx context.Context, platformId PlatformId, channel string, params *PostChannelPlatformStatisticsParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*PostChannelPlatformStatisticsResponse, error)
 
@@ -1738,6 +1925,9 @@ type ClientWithResponsesInterface interface {
 	// GetPlatformUserWithResponse request
 	GetPlatformUserWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, params *GetPlatformUserParams, reqEditors ...RequestEditorFn) (*GetPlatformUserResponse, error)
 
+	// DeletePlatformUserAccountWithResponse request
+	DeletePlatformUserAccountWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, accountId AccountId, reqEditors ...RequestEditorFn) (*DeletePlatformUserAccountResponse, error)
+
 	// PutPlatformUserAPIKeyWithBodyWithResponse request with any body
 	PutPlatformUserAPIKeyWithBodyWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, params *PutPlatformUserAPIKeyParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*PutPlatformUserAPIKeyResponse, error)
 
@@ -1746,6 +1936,9 @@ type ClientWithResponsesInterface interface {
 	// GetPlatformUserAPIKeyNameWithResponse request
 	GetPlatformUserAPIKeyNameWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, params *GetPlatformUserAPIKeyNameParams, reqEditors ...RequestEditorFn) (*GetPlatformUserAPIKeyNameResponse, error)
 
+	// DeletePlatformUserAPIKeyWithResponse request
+	DeletePlatformUserAPIKeyWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, tokenId TokenId, reqEditors ...RequestEditorFn) (*DeletePlatformUserAPIKeyResponse, error)
+
 	// PutPlatformUserBanWithBodyWithResponse request with any body
 	PutPlatformUserBanWithBodyWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*PutPlatformUserBanResponse, error)
 
@@ -1784,6 +1977,29 @@ type ClientWithResponsesInterface interface {
 	PutVerificationPlatformUserTemporaryWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, params *PutVerificationPlatformUserTemporaryParams, body PutVerificationPlatformUserTemporaryJSONRequestBody, reqEditors ...RequestEditorFn) (*PutVerificationPlatformUserTemporaryResponse, error)
 }
 
+type GetAccountUserResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *User
+	JSON500      *TraitErrorResp
+}
+
+// Status returns HTTPResponse.Status
+func (r GetAccountUserResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetAccountUserResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
 type PostChannelPlatformStatisticsResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
@@ -1898,6 +2114,28 @@ func (r GetPlatformUserResponse) StatusCode() int {
 	return 0
 }
 
+type DeletePlatformUserAccountResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON500      *TraitErrorResp
+}
+
+// Status returns HTTPResponse.Status
+func (r DeletePlatformUserAccountResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r DeletePlatformUserAccountResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
 type PutPlatformUserAPIKeyResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
@@ -1943,6 +2181,28 @@ func (r GetPlatformUserAPIKeyNameResponse) StatusCode() int {
 	return 0
 }
 
+type DeletePlatformUserAPIKeyResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON500      *TraitErrorResp
+}
+
+// Status returns HTTPResponse.Status
+func (r DeletePlatformUserAPIKeyResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r DeletePlatformUserAPIKeyResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
 type PutPlatformUserBanResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
@@ -2198,6 +2458,15 @@ func (r PutVerificationPlatformUserTemporaryResponse) StatusCode() int {
 	return 0
 }
 
+// GetAccountUserWithResponse request returning *GetAccountUserResponse
+func (c *ClientWithResponses) GetAccountUserWithResponse(ctx context.Context, accountIdent AccountIdent, reqEditors ...RequestEditorFn) (*GetAccountUserResponse, error) {
+	rsp, err := c.GetAccountUser(ctx, accountIdent, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetAccountUserResponse(rsp)
+}
+
 // PostChannelPlatformStatisticsWithBodyWithResponse request with arbitrary body returning *PostChannelPlatformStatisticsResponse
 func (c *ClientWithResponses) PostChannelPlatformStatisticsWithBodyWithResponse(ctx context.Context, platformId PlatformId, channel string, params *PostChannelPlatformStatisticsParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*PostChannelPlatformStatisticsResponse, error) {
 	rsp, err := c.PostChannelPlatformStatisticsWithBody(ctx, platformId, channel, params, contentType, body, reqEditors...)
@@ -2251,6 +2520,15 @@ func (c *ClientWithResponses) GetPlatformUserWithResponse(ctx context.Context, p
 	return ParseGetPlatformUserResponse(rsp)
 }
 
+// DeletePlatformUserAccountWithResponse request returning *DeletePlatformUserAccountResponse
+func (c *ClientWithResponses) DeletePlatformUserAccountWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, accountId AccountId, reqEditors ...RequestEditorFn) (*DeletePlatformUserAccountResponse, error) {
+	rsp, err := c.DeletePlatformUserAccount(ctx, platformId, platformUserId, accountId, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDeletePlatformUserAccountResponse(rsp)
+}
+
 // PutPlatformUserAPIKeyWithBodyWithResponse request with arbitrary body returning *PutPlatformUserAPIKeyResponse
 func (c *ClientWithResponses) PutPlatformUserAPIKeyWithBodyWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, params *PutPlatformUserAPIKeyParams, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*PutPlatformUserAPIKeyResponse, error) {
 	rsp, err := c.PutPlatformUserAPIKeyWithBody(ctx, platformId, platformUserId, params, contentType, body, reqEditors...)
@@ -2277,6 +2555,15 @@ func (c *ClientWithResponses) GetPlatformUserAPIKeyNameWithResponse(ctx context.
 	return ParseGetPlatformUserAPIKeyNameResponse(rsp)
 }
 
+// DeletePlatformUserAPIKeyWithResponse request returning *DeletePlatformUserAPIKeyResponse
+func (c *ClientWithResponses) DeletePlatformUserAPIKeyWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, tokenId TokenId, reqEditors ...RequestEditorFn) (*DeletePlatformUserAPIKeyResponse, error) {
+	rsp, err := c.DeletePlatformUserAPIKey(ctx, platformId, platformUserId, tokenId, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDeletePlatformUserAPIKeyResponse(rsp)
+}
+
 // PutPlatformUserBanWithBodyWithResponse request with arbitrary body returning *PutPlatformUserBanResponse
 func (c *ClientWithResponses) PutPlatformUserBanWithBodyWithResponse(ctx context.Context, platformId PlatformId, platformUserId PlatformUserId, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*PutPlatformUserBanResponse, error) {
 	rsp, err := c.PutPlatformUserBanWithBody(ctx, platformId, platformUserId, contentType, body, reqEditors...)
@@ -2392,6 +2679,39 @@ func (c *ClientWithResponses) PutVerificationPlatformUserTemporaryWithResponse(c
 	return ParsePutVerificationPlatformUserTemporaryResponse(rsp)
 }
 
+// ParseGetAccountUserResponse parses an HTTP response from a GetAccountUserWithResponse call
+func ParseGetAccountUserResponse(rsp *http.Response) (*GetAccountUserResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetAccountUserResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest User
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 500:
+		var dest TraitErrorResp
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON500 = &dest
+
+	}
+
+	return response, nil
+}
+
 // ParsePostChannelPlatformStatisticsResponse parses an HTTP response from a PostChannelPlatformStatisticsWithResponse call
 func ParsePostChannelPlatformStatisticsResponse(rsp *http.Response) (*PostChannelPlatformStatisticsResponse, error) {
 	bodyBytes, err := io.ReadAll(rsp.Body)
@@ -2550,6 +2870,32 @@ func ParseGetPlatformUserResponse(rsp *http.Response) (*GetPlatformUserResponse,
 	return response, nil
 }
 
+// ParseDeletePlatformUserAccountResponse parses an HTTP response from a DeletePlatformUserAccountWithResponse call
+func ParseDeletePlatformUserAccountResponse(rsp *http.Response) (*DeletePlatformUserAccountResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DeletePlatformUserAccountResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 500:
+		var dest TraitErrorResp
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON500 = &dest
+
+	}
+
+	return response, nil
+}
+
 // ParsePutPlatformUserAPIKeyResponse parses an HTTP response from a PutPlatformUserAPIKeyWithResponse call
 func ParsePutPlatformUserAPIKeyResponse(rsp *http.Response) (*PutPlatformUserAPIKeyResponse, error) {
 	bodyBytes, err := io.ReadAll(rsp.Body)
@@ -2609,6 +2955,32 @@ func ParseGetPlatformUserAPIKeyNameResponse(rsp *http.Response) (*GetPlatformUse
 	return response, nil
 }
 
+// ParseDeletePlatformUserAPIKeyResponse parses an HTTP response from a DeletePlatformUserAPIKeyWithResponse call
+func ParseDeletePlatformUserAPIKeyResponse(rsp *http.Response) (*DeletePlatformUserAPIKeyResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DeletePlatformUserAPIKeyResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 500:
+		var dest TraitErrorResp
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON500 = &dest
+
+	}
+
+	return response, nil
+}
+
 // ParsePutPlatformUserBanResponse parses an HTTP response from a PutPlatformUserBanWithResponse call
 func ParsePutPlatformUserBanResponse(rsp *http.Response) (*PutPlatformUserBanResponse, error) {
 	bodyBytes, err := io.ReadAll(rsp.Body)
@@ -2989,58 +3361,62 @@ func ParsePutVerificationPlatformUserTemporaryResponse(rsp *http.Response) (*Put
 // Base64 encoded, gzipped, json marshaled Swagger object
 var swaggerSpec = []string{
 
-	"H4sIAAAAAAAC/+xc6Y/buBX/Vwi1wH6Rx9lsWhQD5IMTu6mxiTOdY6dFNhBo6dnmWiK1JOWJO/D/XvDQ",
-	"TdtS5srs5ttYIvkO/vguPs2tF7IkZRSoFN7prZdijhOQwPWvZUbiKCARUKl+RiBCTlJJGPVOvaur6Rgx",
-	"jihOALEF0oM93yPqZYrlyvM99c47ra3jexx+zwiHyDuVPAPfE+EKEqwIyG2qhgvJCV16u53vpTGWC8aT",
-	"gERtDl6g1+ga5oJI8NGP6DW6BJyIFPDaRy/RazQmImR8D0/VlTvwRKiEJfA6U5kAbjk7RCEf1lN0zlLg",
-	"chuY5dwkamP6rS+Ab0gIQZa5dJtR8nsGiERqa+UKkB3uVmZtrZ5sZPPfIJR7BMzf9ltTckxkUNd/REQa",
-	"41KbdXHH5m0BZiWxmpb/na+lH56gaxLHaA5ISMYhQljoQTGWIKQaEqGouuB8i+QK6zc8V+DvGfBtKWiN",
-	"vS7SCQgzDlGAM7kCKkmIjShWjSvAkSZm1x/Vh32NPm8Yj6NgQ+CmoNIQQo/oe5qaiwdMbwqOj1E5sOpO",
-	"8SBSRgVoQ2ZoAOeMB+qFehYyKq1hw2kaW80MfxNGi+Xqf+Ww8E69vwxLUzk0b8VwopY0BOuAmtAoZYRK",
-	"dIMFyiiex4AkQ2qJGCSgLcs4UnoCIb3Wpr568VMbo6MwBCGQZGugiNANjknkNRTIOAEq9Qov2itMzSSk",
-	"x6qznXK2IRFE5iQamdS00dn0Z9iOsdQKsFaGGF3ilKxh2178cgUIp0RJKUCiBePFKfL8JqiUeSMJ5o51",
-	"LkAiUjmBYsWyOFKnTR9EM61yOLFEKeaShFmMeXFQT9DlCjigEFPEaLxV8xkFlEI5Rv/AYcgyKk/QBUhJ",
-	"6BJhROGmTudGHXe2Ac5JZNhgcaSWKwWbMxYDpp6BXg7/T7m2Snk/F1OYMW0736p7Zi1TXd1ue2WVvQZr",
-	"YQptrZQtYsVDwvNhZFGbQAQCumA8hKi9Ow0ZNAtOvjUiL/XjWw9olqjh//r4YRJcfzx/P/Z87/109vNk",
-	"bH9+blLyvS8DhlMyCFkES6AD+CI5Hki81LLPMyXrQDM0MvvkwKNmQhsLCYlwWLCCKuYcb9VvvASX3fDV",
-	"dgVr2NaXO2QALtVpnNIFa5FRsi3ZQD0biDVJB7ldG2jDADy3jh1UwCE+XWExSDDd+r8xQk9J9NoiV0UW",
-	"SkEhSxJMldEvJStQ6XshByxBe3qFfSyV08ESBpIk4DqgESbxNsCpW1HRPOi34n2qw6dZHP8POPMpk+pv",
-	"P4IFzmJ5GmacA5WBYkFInKS+CDFVBkDrKJoHWRp9+1xrZuFLak5gazt7HJsFx6HEcRDDBmL3VproPDYB",
-	"Q69jpGf2PHokag+zWrb+fTruJqCfrrWIMRYySFhEFqQPvhNG5eoAwnPD25pYifoLSoTKv78qqeTL1AW7",
-	"EsCnY7WECWGcZI0fFxLL7KjxuTCj1KzNTZBnWcf0e725fqeGdtVzbe2dJcYxXTsEaFE6V+M6k9Gr5iQk",
-	"4KQuzl4qKvHrI06+9K7p6nT6YmNw5ST8ItrMrV3V0JZYqCilznzFpbg86BtM2x6NA7ZBaBt7VJK4O8bv",
-	"DNWGekpxDSN+zqtLtrcrTCnEH0DiyBlJHjxh3V2wpaNYLmi1DI8rpMkJHWC+tmhLgAjwAqjTRO+xdMru",
-	"ZHLfjL0KEZIDTtQPx7wDEDa0/JLR6lJOsRldkGXGi2SyLrB2Sfqd9lVuCyYhSRnHfBuY0CzoNMvYvZjQ",
-	"tYnqoogYT3tW4+AQEK7VEu/1Cq187D0RUuULmoxAhk5LAQ1VNhnvIFtdEJeKJ+kKEuA4HgnBQrJH03Z5",
-	"aWPrQ2JXovDHtxAdA6RDPm/nUpLOq9v4yx+3TwhewMAWUQb7hjW3Vw9zznVt3JlNGxXCHLagUV9qJ7yH",
-	"SpnTcavSVKR0RCW/MaNLldkd25acyb5BlKumeSiIyOlUYNCdVjX11xFwHkW3TeJ9ezBHUbZeCc6ZK0k7",
-	"sWALrz2cWqXQ2Xq3wXEGxwFrrboZ7WLroggb82R89Pbt5OIiGE9m08k4uJr9PPt4PfP8/Pm789HscjIO",
-	"ajl7410thT8wM7icfDj7eD46/+/hNVzjLH+jt28/Xs0ug9nHSzulNWTyn7PpueP5dPbL6P20xaZ9+2Y0",
-	"mzkmnU/+fTU9n3yYWJofJpd3KlKU1QCXQc+zdRcCvufTD55P79G8Th9FVlSR7k+KQxFdCjwhQhBG++TP",
-	"XQkfympKHNa5cNkTZUT3Qrl7hJ7X7h69RJabcKWQOabdOX5jvM/TcfvdHjx8fS0PxANcRuLdIeKM458U",
-	"M93DpC6hmo8zyQgNOSRAZT1ILNK0TpqqBc5PqKG2VXTZvF+Ak4W9DSzjqboFnJuyTQcLUlNZX0X1qwI2",
-	"xLOTXSJWEmWH76mm8s0air6gJHJ7oWhbXQDmwEeZXBXXpjqG149L+K2kTM0eEBsfSSJj9UYXI9E15gK9",
-	"RFXto9HZVIW7wIXJkjYvFVMsBYpT4p16P528OHmh3BiWK83LcPPjMDSVGzG8rQT2u+Gtfb4bKsUQIUnY",
-	"6nj55OxBsBP73Zm7t6wkNqxmHR2Gt67gd599L2XC0ZjzlsUxhBKVcqI5FhAhRu0Vqrn0ReXyCNMICbzR",
-	"d4aJvrtdESEZJyGOUZrxlAkQnta9qXZMI5UEMiFtoSyH7kWpXKMvEPINi7b3duPerCo2jrWNu2q3/y9d",
-	"d+EKSfaS/GE7AQyhn/bNLzgdtlsAdr73N8Nil5mV9oad5kOfhmZBbwkOyLwDiTCqjVW/JCaU0CXiEMMG",
-	"U4nU0VXeRb1XIOEZpebO3HYAoTmTLZi8A/nLj/XKonuH7gcgNUJ7N6SzWh2NFXfYUe1G6yan58kv+2N2",
-	"n+0mm3u44W2lz243LIro7h3naj+xqTAVVU3bGcIh1to7QaOiDBtvfW09ftU10MBeTv7qobwHzXRJzAFx",
-	"SNgGIrTgrKxi/SBQxYU6EKK9wJXm+QHBoRMaByZiWx7eaPcDkeZZIGIspmltfErY3MEQ9MVbtVmzQFju",
-	"rRpOVWtpaEL+/Vh7z+gSpSyOjS0REkHeHaWNCIRANuqdBmO+mgMj1aLjVTHs0cHyxEh49eIfR3Ss8hyW",
-	"SR9RhmCj1kR4g0msu9CijJt90L4ZpcAJi+6CMN8zUfin/DqtN+TuHgt1gelts/a7O+IPa02fPwgUgcQk",
-	"PorMPyEkH8049URKq9rfGV0Hmoe/Fm3DsnPyGxXaHWT4XppJd59m+4yMzqbINDw2UoWsdkZMx6PX2v4G",
-	"iTVJtQPeYE4yUbQ82nA/0ZZNd4AmZLmSKvggVLFU9qk3eod1haE63dVHXN6sf36YHKbSXnsP6cuzOvB3",
-	"OjrDvJzew2g3umS3CHPIARQhydS4ZnOsilE4CXWaU2+UPWj4K228D+gCKlS+O4KnsolfCWNbN3xkUfdZ",
-	"8DeY2gzwB4GWNy/zXniTuc1BhYl5QnTMoL/B9IEKPrqQ+r3Ic5/WlMOCg1g9ERSdRct/KgsrEEaWt7wd",
-	"RsUTEZZYVyg5yIxT87EVhRuTL5q3Cwm8PmGFBZoD0HxFiE7QjEnlBYjQ34VIvAaE0QJukICQ0chd4azC",
-	"/Nxq7slC/KeCmK3vieFt9Vu/3bB+L7LfL8dxUSI8XAe6MKPOqoPupOtuV1R5P0/70uOQi/1DGpW+rrj2",
-	"8WfhGo8DZnhrW6KO5eF22NESooXOhRn+zSPo6+s/rxxfY2tTyEAgyiRa2aucvMoDUVGmfUJoHHcYeY/c",
-	"kaSzEyDOsucGiD98nNLHJgxvax+397YR284WYvvdPjw7+9Ah9qz9a4S+BmXb2Zx0QI+EL1LFwqSBm2bT",
-	"wJ/VLGwqPR+PdNNUJXnoxqnajvLIt0+OPqTvd1HP6C6qO6p7X0yZy+kahm23Vw8IX+Qz/twI/iNXLO/3",
-	"uusugH7CktO99tZ9VZnKcVAftGC178TfU/GqU7jrOvu98qDneKt1pxNSNGE9ozOSffOdZWfZ3uNwWSj8",
-	"YS4u3B8IdL7J6MyD679f1bfEqDQ3OkuyAYpwoq962KIwJc/17FXa0vVhqTakf/qscKrSzPwoZTy23eji",
-	"dDjEKTlZYC5WZAM8BbwWJyFLlM/7fwAAAP//DMpS0BpRAAA=",
+	"H4sIAAAAAAAC/+wca2/bOPKvELoD+kWJ027vcAjQD27j2wu2TXN5bO7QLQRaGtvcSKSWpJz6Av/3A196",
+	"0rbUvJpuv8USOTMczntGuQ1iluWMApUiOLwNcsxxBhK4/oXjmBVURiRRvxIQMSe5JIwGh8HxEWIzhNHP",
+	"BUkTdIW5QK+Q3RCEAVFrciwXQRhQnEFwWIcWBhz+KAiHJDiUvIAwEPECMqzQyFWuVgvJCZ0H63VY2whU",
+	"+inhSCHZTFGIYH++j8bm1/7LVz+93kUkUDmQzrlCvInKy8smnXqxn4Y6nGEU5CmWM8Yz740doDfoCqaC",
+	"SAjRS/QGXQDORA74OkSv0Bt0RETM+Aaa6pB70ESohDnwJlGFAG4p24bBLRt4dM5y4HIVGXB+FI01w+AL",
+	"4EsSQ1QUPt4WlPxRACKJulq5AGSX+5nZgDWQjGL6O8RywwHd22EwJbsG2l/Jx6fH6BpW/qOVsAaSwDGR",
+	"UVMEEiLyFFcX2iTtyLwt9UkxXW1zfztY+uE+uiJpiqaAhGQcEoSFXpRiCUKqJQlK6gCnKyQXWL/h7qB/",
+	"FMBX1Ukb5PU5nYC44JBEuJALoJLE2BzF3uQCcKKRWfjj5rKv4ecN42kSLQnclFhah9Arhip0G3jE9KXg",
+	"dBeWLVDXigaRMypAux6DAzhnPFIv1LOYUWltK87z1HJm9LswXKyg/5XDLDgM/jKqnNvIvBWjiQJpEDYF",
+	"akKTnBEq0Q0WqKB4mgKSDCkQKUhAK1ZwpPgEQgadS3198FNXRsdxDEIgrROI0CVOSRK0GMg4ASo1hAOP",
+	"AppNSK9V5iXnbEkSSIwxMGdS28anx7/A6ghLzQBr6IjhJc6J0tcO8IsFIJwTdUoBEs0YL7UoCNtCpSws",
+	"yTD3wDkHiUhNA8WCFWmitE09sttqyoklyjGXJC5SzEtF3UcXC+CAYkwRo+lK7WcUUA7VGv3Duuh9dA5S",
+	"EjpHGFG4aeK5UerOlsA5SQwZLE0UuOpgU8ZSwDRYr+vi/8lxqzrv53ILM9Z1HVp2n1jL1GS3315ZZl+D",
+	"tTAltxbKFrHyIeFuGZk1NhCBgM4YjyHp3k7rDJoEL91aIi/049sAaJGp5f/6+GESXX08e38UhMH745Nf",
+	"Jkf25+c2pjD4ssdwTvZilsAc6B58kRzvSTzXZ58W6qx7miAbbHnkUROh/iISMuGxYCVWzDleqd94Dj67",
+	"Earriq5h1QS3zQBcKG08pjPWQaPONmd76tmeuCb5nrNre9owAHfWsQcLOKSHCyz2MkxX4e+M0EOSvKlF",
+	"wIpBMcsyTJXRP7ztSGUYxBywBO2VlexjqZwOlrAnSQY+BU0wSVcRzv2MSqbRMIj3yY6QFmn6P+AspEyq",
+	"v8MEZrhI5WFccA5URooEIXGWhyLGVBkAzaNkGhV58u1TrYmFL7nRwM51DlCbGcexxGmUwhJS/1WaBCE1",
+	"AcMgNdI7B6oeSbrLLJetfz8+6nfAML/WR0yxkFHGEjIjQ+Q7Y1Qutki4M7ydjbXEo8REqPz76yBsg2ke",
+	"7FIAPz5SIEwI40WrX0VCYlnsND7nZpXatbyJXKK3i79XyysdgfflcwP22iLjmF57DtDBdKbW9UajoToU",
+	"EnDWPM5GLCr3HHIcB3rddnU61bAxuHISYRltOmtXN7SVLNSY0iS+5lJ8HvQtpl2PxgHbILQre1SStL+M",
+	"31lUW+ypjmsICR2tvrO9W2BKIf0AEifeSHKrhvV3wRaPIrnE1TE8vpDGIdpCfANo5wAJ4BlQr4neYOmU",
+	"3Snkph0bGSIkB5ypH559W0TY4AorQuugvMdmdEbmBS+TyeaBtUvS77Sv8lswCVnOOOaryIRmUa9dxu6l",
+	"hF5rTDhJiPG0pw0KtgnClQLxXkPo5GPviZAqX9BoBDJ4OgxosbJNeI+zNQ/iY/EkX0AGHKdjIVhMNnDa",
+	"gpc2tt527FoU/vgWomeAtM3nrX1M0nl1V/7c466G4Bns2SLK3qZl7evVy7x7fRd3atNGJWEeW9CqL3UT",
+	"3m3VVFMaa1SaypSOqOQ3ZXSuMrtd1+KIHBpE+cqq24IIh6cmBv1x1VN/HQG7KLprEu/bg3nqws1itCOu",
+	"Qu2VBVv7HeDUarXWzrslTgvYLbDWqpvVPrLOy7DRJePjd+8m5+fR0eTkeHIUXZ78cvLx6iQI3fOfz8Yn",
+	"F5OjqJGzt941UvgtO6OLyYfTj2fjs/9uh+FbZ+kbv3v38fLkIjr5eGG3dJZM/nN6fOZ5fnzy6/j9cYdM",
+	"+/bt+OTEs+ls8u/L47PJh4nF+WFycaciRVUN8Bn0Wverm23/yKcfOp/ewHmdPoqirCLd3ym2RXQ58IwI",
+	"QRgdkj/3Rbwtq6n3TetU+OyJMqIbRbl/hO5qd49eInMmXDFkiml/it8a7/N01P6wBw9fX3OBeISrSLy/",
+	"iHjj+CeVmf5hUp9QLcSFZITGHDKgshkklmlaL041Aucn5FDXKvps3q/Aycx2A6t4qmkBp5juOrS1IA2W",
+	"DWXUsCpg63h2s++ItUTZ43vqqXy7hqIblESuzhVuywvAHLjqL5dtUx3D68eV+C2kzM0dEBsfSSJT9aYx",
+	"DlDnvpoNUOEucGGypOUrRRTLgeKcBIfBT/sH+wdBqIcGNC2j5cuR806j28b0zXpUWGc2B89Azc8gq4xL",
+	"NxVVJ01dGiT6xZwsgW6aT1KyoUk+Tgws6/EuTfOz0Yt+dXBwb+1nDd/TfVZssj1k3/aSnlG37ax3vu4y",
+	"6IRVDcYaW3Dl2v92cNAXYa0Tr6mvD4p98oOolowa9xqsP69DffGxKdmJ0W0to1uPbu3z9UhpBBGSxJ3h",
+	"tE/e+Re7cdiwxE7qa8QFPZZ3Zi/Wn8MgZ8Ijw+9YmkIsUXVONMVqGIVR2zs33X5UgUeYJkjgpW4WZ7pp",
+	"vyBCMk5inKK84DkTIDoSfsqEtBVSZ7POK+YafoGQb1myujdZb5eTW/bcBtw+VfPpxsHDj4DcTQm/Wpuc",
+	"NrQruRvNHkaNteqXxISqWQgOKSwxlUjZbJ6Z90pIeEGpGZaw02doyryG8NeXzZLyAxrDJqKNF9KbrZ6J",
+	"mjvc6HAzt3kwqjR5pgE7uq3NeBo/JzbfOFf3ia2jc+VsOxLEIdXc20fjsv6erkJtPX7Txe/IdqV/C5Cb",
+	"fzTjMVNAHDK2hATNOKvKly8EqsVOHgnRLvVS0/wEnjK1fYGljjsg0TQLRIzF1Hx9UrF5RLdaE6JKwpy3",
+	"ajlVzaWRyfU2y9p7RucoZ2lqbImQCNxYnDYiEANZqndaGB00j4zUq82X5bInCqueTBJeH/xjB49VgssK",
+	"GSLKECwVTISXmKR6/DApuLkH7ZtRDpyw5C4SFgYm/frk+qiDRe7usVAfMb1tF/3XO/xhY9r3hUAJSEzS",
+	"nZL5JxTJRzNOAyWlfeP9pWvL1PjXSps3JV0b4UtBesY7L6lKsTZ8fWL8K27PpI/T1A3Ti3L61m1pu2gs",
+	"0A2kaUeijzRBdaEel0lu39D6XtPOi9ohiECUSZd93hC56M7mf29CWR/y/GrxKye2v1Gd88e4YZAX0j8f",
+	"3jXR1WckrUy1aJhoM2kddC66heKa5Fq0lpiTQpSj1jbbzLRj1UWijMwXUikWoYqk6hOd1jcLurJZ3+77",
+	"fqGa6Pn8MCl0baz/HrLnZ+Vv7qQ6I9fGGxAztKbzVwhzcAKUqBF9JVetoXwOQnIS6yy7OaC/Ne6ofT7w",
+	"gBFIDcuPOOSpbOKdxFiMbt0HdVujjzMdJCBMnVXdEHHUfbOQeFUWhlWJWKUlWCBiCulMLoA7cKJP2OEM",
+	"9ZNFHe7sCQMTd5ghLKW6333U4cTk6yXOdsge+WSbYoa3mNqS1wuB5jetUHoKKi92FaBdIcRbTB+owv0W",
+	"0x9V7fv13xxmHMTiiUTR26X5p/LpAmFkaXODn8reqMaGbslwkAWn5rNi9TmiAmvfziTw5gZlYKcA1EGE",
+	"ZB+dMKniDiL0F5ASXwPCaAY3SEDMaOJv6dTF/Mxy7tl1L+8qYrahIUa39Q/r16PmBMDmSDBNy57I9sL3",
+	"uVl1Wl90J173G8Zwk6vd9v62oO67NCpDPW9dICrXuFtgRrd2+HdX4dEueyH6ic65Wf7NS9C9xmaX2hS6",
+	"oGxhe9eurA1J2Zd6QtHY7TDsTe8qc/QSiNPiuQnEdx+nDLEJo9vGf5IZbCNWvS3E6od9eHb2YffShvQM",
+	"Niir3uakh/RI+CJVLExactOekvqzmoVlbbrxkVrrdZTbWuz1wctHbrd7Jm5/NN+fUfO9v1QP7sTrbU0Z",
+	"tnPNA0T43O34c0vw91wjv9/+/l0E+glLTvc6TPxVZSqPoj5owWqTxt9T8apXuOvT/UF50HPso95JQ8qp",
+	"02ekI8U3P0p7WmxUh4uS4Q/TuPB/Cte7k9GbBt//eWxeiWGpMzrmmx2c6VYPm5Wm5LnqXu0DLK0s9U+v",
+	"Pn1WcqrSTKdKBU/td1ficKRawPszzMWCLIGrf9Mr9mOWKZ/3/wEACcxi9LZZAAA=",
 }
 
 // GetSwagger returns the content of the embedded swagger specification file
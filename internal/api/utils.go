@@ -91,3 +91,14 @@ func ActiveBan(bans []Ban) *Ban {
 	}
 	return activeBan
 }
+
+// ActiveAccounts returns the accounts that have not expired
+func ActiveAccounts(accounts []Account) []Account {
+	active := make([]Account, 0, len(accounts))
+	for _, account := range accounts {
+		if account.Expired == nil || !*account.Expired {
+			active = append(active, account)
+		}
+	}
+	return active
+}
@@ -0,0 +1,245 @@
+package audit
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxEmbedsPerMessage is the maximum number of embeds discord allows in a single message
+	maxEmbedsPerMessage = 10
+	// maxPendingPerServer caps how many changes are kept for a server between flushes, in case the audit channel is unreachable
+	maxPendingPerServer = 500
+	// maxRecentPerServer caps how many changes are kept per server for Recent
+	maxRecentPerServer = 100
+	flushInterval      = 5 * time.Second
+)
+
+type Action string
+
+const (
+	ActionRoleAdded   Action = "role_added"
+	ActionRoleRemoved Action = "role_removed"
+	ActionNickChanged Action = "nick_changed"
+	ActionKicked      Action = "kicked"
+)
+
+// Change is an automated change the bot made to a member
+type Change struct {
+	GuildID string
+	UserID  string
+	Action  Action
+	// RoleID is the role that was added or removed
+	RoleID string
+	// Before and After are the nicknames before and after the change
+	Before string
+	After  string
+	// Reason is the translation key explaining why the change was made, with ReasonData as template data
+	Reason     string
+	ReasonData map[string]interface{}
+	Time       time.Time
+}
+
+// Log posts the changes the bot makes to members in the audit channel of the server.
+// Changes are batched, to stay within the rate limits of discord. A nil Log discards all changes
+type Log struct {
+	m       sync.Mutex
+	discord *discordgo.Session
+	service *backend.Service
+	pending map[string][]Change
+	dropped map[string]int
+	recent  map[string][]Change
+	// listeners are called for every recorded change
+	listeners []func(change Change)
+}
+
+func NewLog(discord *discordgo.Session, service *backend.Service) *Log {
+	return &Log{
+		discord: discord,
+		service: service,
+		pending: make(map[string][]Change),
+		dropped: make(map[string]int),
+		recent:  make(map[string][]Change),
+	}
+}
+
+// Start periodically posts the recorded changes
+func (l *Log) Start() {
+	go func() {
+		for {
+			time.Sleep(flushInterval)
+			l.Flush()
+		}
+	}()
+}
+
+// Record queues a change to be posted in the audit channel of the server, if the server has one.
+// The most recent changes are kept regardless, see Recent
+func (l *Log) Record(change Change) {
+	if l == nil {
+		return
+	}
+	if change.Time.IsZero() {
+		change.Time = time.Now()
+	}
+
+	l.m.Lock()
+	listeners := l.listeners
+	l.m.Unlock()
+	for _, listener := range listeners {
+		listener(change)
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	recent := append(l.recent[change.GuildID], change)
+	if len(recent) > maxRecentPerServer {
+		recent = slices.Clone(recent[len(recent)-maxRecentPerServer:])
+	}
+	l.recent[change.GuildID] = recent
+
+	if l.service.GetSetting(change.GuildID, backend.SettingAuditChannel) == "" {
+		return
+	}
+	if len(l.pending[change.GuildID]) >= maxPendingPerServer {
+		l.dropped[change.GuildID]++
+		return
+	}
+	l.pending[change.GuildID] = append(l.pending[change.GuildID], change)
+}
+
+// OnRecord registers fn to be called for every change recorded, whether or not the server has an audit channel
+func (l *Log) OnRecord(fn func(change Change)) {
+	if l == nil {
+		return
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.listeners = append(l.listeners, fn)
+}
+
+// Recent returns the most recent changes made to members of the server, newest first
+func (l *Log) Recent(guildID string) []Change {
+	if l == nil {
+		return nil
+	}
+
+	l.m.Lock()
+	recent := slices.Clone(l.recent[guildID])
+	l.m.Unlock()
+	slices.Reverse(recent)
+	return recent
+}
+
+// RoleAdded records that the role was added to the member
+func (l *Log) RoleAdded(guildID string, userID string, roleID string, reason string, reasonData ...map[string]interface{}) {
+	l.Record(Change{GuildID: guildID, UserID: userID, Action: ActionRoleAdded, RoleID: roleID, Reason: reason, ReasonData: first(reasonData)})
+}
+
+// RoleRemoved records that the role was removed from the member
+func (l *Log) RoleRemoved(guildID string, userID string, roleID string, reason string, reasonData ...map[string]interface{}) {
+	l.Record(Change{GuildID: guildID, UserID: userID, Action: ActionRoleRemoved, RoleID: roleID, Reason: reason, ReasonData: first(reasonData)})
+}
+
+// NickChanged records that the nickname of the member was changed
+func (l *Log) NickChanged(guildID string, userID string, before string, after string, reason string, reasonData ...map[string]interface{}) {
+	l.Record(Change{GuildID: guildID, UserID: userID, Action: ActionNickChanged, Before: before, After: after, Reason: reason, ReasonData: first(reasonData)})
+}
+
+// Kicked records that the member was kicked from the server
+func (l *Log) Kicked(guildID string, userID string, reason string, reasonData ...map[string]interface{}) {
+	l.Record(Change{GuildID: guildID, UserID: userID, Action: ActionKicked, Reason: reason, ReasonData: first(reasonData)})
+}
+
+// Flush posts all recorded changes
+func (l *Log) Flush() {
+	if l == nil {
+		return
+	}
+
+	l.m.Lock()
+	pending := l.pending
+	dropped := l.dropped
+	l.pending = make(map[string][]Change)
+	l.dropped = make(map[string]int)
+	l.m.Unlock()
+
+	for guildID, changes := range pending {
+		channelID := l.service.GetSetting(guildID, backend.SettingAuditChannel)
+		if channelID == "" {
+			continue
+		}
+		locale := discord.GuildLocale(l.discord, guildID)
+
+		for i := 0; i < len(changes); i += maxEmbedsPerMessage {
+			batch := changes[i:min(i+maxEmbedsPerMessage, len(changes))]
+			embeds := make([]*discordgo.MessageEmbed, len(batch))
+			for j, change := range batch {
+				embeds[j] = BuildEmbed(change, locale)
+			}
+
+			message := &discordgo.MessageSend{
+				Embeds: embeds,
+				// Never ping anyone from the audit channel
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			}
+			if i+maxEmbedsPerMessage >= len(changes) && dropped[guildID] > 0 {
+				message.Content = resources.TL(locale, "audit.dropped", resources.TData("count", dropped[guildID]))
+			}
+
+			_, err := l.discord.ChannelMessageSendComplex(channelID, message)
+			if err != nil {
+				zap.L().Error("unable to post audit log", zap.String("guild id", guildID), zap.String("channel id", channelID), zap.Error(err))
+				break
+			}
+		}
+	}
+}
+
+// BuildEmbed creates a compact embed describing the change
+func BuildEmbed(change Change, locale discordgo.Locale) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:     resources.TL(locale, "audit.actions."+string(change.Action)),
+		Timestamp: change.Time.Format(time.RFC3339),
+	}
+
+	switch change.Action {
+	case ActionRoleAdded:
+		embed.Color = 0x57F287 // green
+		embed.Description = fmt.Sprintf("<@%s> + <@&%s>", change.UserID, change.RoleID)
+	case ActionRoleRemoved:
+		embed.Color = 0xED4245 // red
+		embed.Description = fmt.Sprintf("<@%s> - <@&%s>", change.UserID, change.RoleID)
+	case ActionNickChanged:
+		embed.Color = 0x3498DB // blue
+		embed.Description = fmt.Sprintf("<@%s>: `%s` → `%s`", change.UserID, change.Before, change.After)
+	case ActionKicked:
+		embed.Color = 0x992D22 // dark red
+		embed.Description = fmt.Sprintf("<@%s>", change.UserID)
+	}
+
+	if change.Reason != "" {
+		embed.Fields = []*discordgo.MessageEmbedField{
+			{
+				Name:  resources.TL(locale, "audit.reason"),
+				Value: resources.TL(locale, change.Reason, change.ReasonData),
+			},
+		}
+	}
+	return embed
+}
+
+func first(data []map[string]interface{}) map[string]interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return data[0]
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+)
+
+func TestBuildEmbedRoleRemoved(t *testing.T) {
+	g := NewGomegaWithT(t)
+	embed := BuildEmbed(Change{
+		UserID: "1",
+		Action: ActionRoleRemoved,
+		RoleID: "2",
+		Reason: "audit.reasons.not_in_guild",
+		Time:   time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+	}, discordgo.EnglishUS)
+	g.Expect(embed.Title).To(Equal("Role removed"))
+	g.Expect(embed.Description).To(Equal("<@1> - <@&2>"))
+	g.Expect(embed.Fields).To(HaveLen(1))
+	g.Expect(embed.Fields[0].Value).To(Equal("no linked account is in the guild"))
+	g.Expect(embed.Timestamp).To(Equal("2024-06-01T12:00:00Z"))
+}
+
+func TestBuildEmbedNickChanged(t *testing.T) {
+	g := NewGomegaWithT(t)
+	embed := BuildEmbed(Change{
+		UserID:     "1",
+		Action:     ActionNickChanged,
+		Before:     "Cinder",
+		After:      "Cinder | Cinder.1234",
+		Reason:     "audit.reasons.primary_world",
+		ReasonData: resources.TData("account", "Cinder.1234"),
+	}, discordgo.EnglishUS)
+	g.Expect(embed.Description).To(Equal("<@1>: `Cinder` → `Cinder | Cinder.1234`"))
+	g.Expect(embed.Fields[0].Value).To(Equal("Cinder.1234 is on the server's world"))
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	l.RoleAdded("1", "2", "3", "audit.reasons.verified")
+	l.Flush()
+}
+
+func TestRecent(t *testing.T) {
+	g := NewGomegaWithT(t)
+	l := NewLog(nil, backend.NewService(nil, "", nil))
+	for i := 0; i < maxRecentPerServer+5; i++ {
+		l.RoleAdded("1", "2", "3", "audit.reasons.verified")
+	}
+	l.NickChanged("1", "2", "Cinder", "Cinder.1234", "audit.reasons.account_rep")
+	l.Kicked("other", "2", "audit.reasons.verified")
+
+	recent := l.Recent("1")
+	g.Expect(recent).To(HaveLen(maxRecentPerServer))
+	g.Expect(recent[0].Action).To(Equal(ActionNickChanged))
+	g.Expect(l.Recent("other")).To(HaveLen(1))
+
+	// Changes are only posted if the server has an audit channel
+	g.Expect(l.pending).To(BeEmpty())
+}
+
+func TestOnRecord(t *testing.T) {
+	g := NewGomegaWithT(t)
+	l := NewLog(nil, backend.NewService(nil, "", nil))
+	var changes []Change
+	l.OnRecord(func(change Change) {
+		changes = append(changes, change)
+	})
+	l.NickChanged("1", "2", "Cinder", "Cinder.1234", "audit.reasons.account_rep")
+
+	g.Expect(changes).To(HaveLen(1))
+	g.Expect(changes[0].After).To(Equal("Cinder.1234"))
+	g.Expect(changes[0].Time).ToNot(BeZero())
+}
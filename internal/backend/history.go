@@ -0,0 +1,115 @@
+package backend
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vennekilde/gw2-alliance-bot/internal/store"
+	"go.uber.org/zap"
+)
+
+// historyLimit is the number of changes kept per subject. Older changes are forgotten
+const historyLimit = 500
+
+// HistoryEntry is a recorded change of a setting
+type HistoryEntry struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	OldValue string    `json:"old_value"`
+	NewValue string    `json:"new_value"`
+	Actor    string    `json:"actor,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// History records the changes of settings, along with who made them
+type History struct {
+	m     sync.Mutex
+	store *store.Store[[]HistoryEntry]
+}
+
+// NewHistory creates a settings history, persisted in dataDir. If dataDir is empty, the history is only kept in memory
+func NewHistory(dataDir string) *History {
+	path := ""
+	if dataDir != "" {
+		path = filepath.Join(dataDir, "settings_history.json")
+	}
+	history, err := store.Open[[]HistoryEntry](path, 0)
+	if err != nil {
+		zap.L().Error("unable to load settings history, starting with an empty history", zap.String("path", path), zap.Error(err))
+		history, _ = store.Open[[]HistoryEntry]("", 0)
+	}
+	return &History{store: history}
+}
+
+// Record adds a change of the setting to the history of the subject
+func (h *History) Record(subject string, name string, oldValue string, newValue string, actor string) {
+	if h == nil {
+		return
+	}
+
+	h.m.Lock()
+	entries, _, _ := h.store.Get(subject)
+	id := 1
+	if len(entries) > 0 {
+		id = entries[len(entries)-1].ID + 1
+	}
+	entries = append(slices.Clone(entries), HistoryEntry{
+		ID:       id,
+		Name:     name,
+		OldValue: oldValue,
+		NewValue: newValue,
+		Actor:    actor,
+		Time:     time.Now(),
+	})
+	if len(entries) > historyLimit {
+		entries = entries[len(entries)-historyLimit:]
+	}
+	h.store.Set(subject, entries)
+	h.m.Unlock()
+
+	err := h.store.Save()
+	if err != nil {
+		zap.L().Error("unable to save settings history", zap.Error(err))
+	}
+}
+
+// Entries returns the history of the subject, newest first
+func (h *History) Entries(subject string) []HistoryEntry {
+	if h == nil {
+		return nil
+	}
+	entries, _, _ := h.store.Get(subject)
+	entries = slices.Clone(entries)
+	slices.Reverse(entries)
+	return entries
+}
+
+// Entry returns the change with the id from the history of the subject
+func (h *History) Entry(subject string, id int) (HistoryEntry, bool) {
+	if h == nil {
+		return HistoryEntry{}, false
+	}
+	entries, _, _ := h.store.Get(subject)
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+type actorKey struct{}
+
+// WithActor returns a context for changing settings on behalf of the user, who is recorded in the history
+func WithActor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+// actorFrom returns the user the settings are changed on behalf of, if any
+func actorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
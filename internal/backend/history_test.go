@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestHistory(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dataDir := t.TempDir()
+	history := NewHistory(dataDir)
+
+	history.Record("guild", SettingGuildCommonRole, "", "1", "alice")
+	history.Record("guild", SettingGuildCommonRole, "1", "2", "bob")
+	history.Record("other", SettingAccRepEnabled, "", "true", "")
+
+	entries := history.Entries("guild")
+	g.Expect(entries).To(HaveLen(2))
+	g.Expect(entries[0].ID).To(Equal(2))
+	g.Expect(entries[0].Actor).To(Equal("bob"))
+	g.Expect(entries[1].ID).To(Equal(1))
+
+	entry, ok := history.Entry("guild", 2)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(entry.OldValue).To(Equal("1"))
+	_, ok = history.Entry("other", 2)
+	g.Expect(ok).To(BeFalse())
+
+	// The history is kept across restarts
+	g.Expect(filepath.Join(dataDir, "settings_history.json")).To(BeAnExistingFile())
+	reloaded := NewHistory(dataDir).Entries("guild")
+	g.Expect(reloaded).To(HaveLen(2))
+	g.Expect(reloaded[0].Actor).To(Equal("bob"))
+	g.Expect(reloaded[0].Time.Equal(entries[0].Time)).To(BeTrue())
+}
+
+func TestHistoryLimit(t *testing.T) {
+	g := NewGomegaWithT(t)
+	history := NewHistory("")
+	for range historyLimit + 10 {
+		history.Record("guild", SettingPolicyUnverifiedDays, "1", "2", "")
+	}
+
+	entries := history.Entries("guild")
+	g.Expect(entries).To(HaveLen(historyLimit))
+	g.Expect(entries[0].ID).To(Equal(historyLimit + 10))
+}
+
+func TestActor(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(actorFrom(context.Background())).To(BeEmpty())
+	g.Expect(actorFrom(WithActor(context.Background(), "123"))).To(Equal("123"))
+}
@@ -1,12 +1,17 @@
 package backend
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/vennekilde/gw2-alliance-bot/internal/api"
 	"go.uber.org/zap"
@@ -26,6 +31,25 @@ const (
 	SettingGuildVerifyRoles            = "guild_verify_roles"
 	SettingGuildRequiredPermissions    = "guild_required_permissions"
 	SettingRolesToRemoveWhenNotInGuild = "roles_to_remove_when_not_in_guild"
+	SettingOnboardingChannel           = "onboarding_channel"
+	SettingOnboardingMessage           = "onboarding_message"
+	SettingOnboardingWelcome           = "onboarding_welcome"
+	SettingOnboardingWelcomeChannel    = "onboarding_welcome_channel"
+	SettingOnboardingReminderInterval  = "onboarding_reminder_interval"
+	SettingOnboardingReminderCount     = "onboarding_reminder_count"
+	SettingOnboardingUnverifiedRole    = "onboarding_unverified_role"
+	SettingPolicyAction                = "policy_action"
+	SettingPolicyUnverifiedDays        = "policy_unverified_days"
+	SettingPolicyExpired               = "policy_expired"
+	SettingPolicyQuarantineRole        = "policy_quarantine_role"
+	SettingPolicyExemptRoles           = "policy_exempt_roles"
+	SettingPolicyGraceHours            = "policy_grace_hours"
+	SettingExpiredLogChannel           = "expired_log_channel"
+	SettingAuditChannel                = "audit_channel"
+	SettingCommandsDisabled            = "commands_disabled"
+	SettingCommandsAdminRoles          = "commands_admin_roles"
+	SettingWebhookURLs                 = "webhook_urls"
+	SettingWebhookSecret               = "webhook_secret"
 )
 
 type Service struct {
@@ -33,16 +57,26 @@ type Service struct {
 	backend     *api.ClientWithResponses
 	settings    map[string]map[string]string
 	serviceUUID string
+	listeners   []func(ctx context.Context, subject string, name string, oldValue string, newValue string)
+	history     *History
+	syncedAt    time.Time
 }
 
-func NewService(backend *api.ClientWithResponses, serviceUUID string) *Service {
+// NewService creates the settings service. Changes of settings are recorded in history, if it is not nil
+func NewService(backend *api.ClientWithResponses, serviceUUID string, history *History) *Service {
 	return &Service{
 		backend:     backend,
 		serviceUUID: serviceUUID,
 		settings:    make(map[string]map[string]string),
+		history:     history,
 	}
 }
 
+// History returns the recorded changes of settings
+func (s *Service) History() *History {
+	return s.history
+}
+
 func (s *Service) Synchronize() error {
 	// settings
 	ctx := context.Background()
@@ -68,48 +102,143 @@ func (s *Service) Synchronize() error {
 	s.m.Lock()
 	defer s.m.Unlock()
 	s.settings = settings
+	s.syncedAt = time.Now()
 	return nil
 }
 
-func (s *Service) GetSetting(subject string, name string) string {
+// SynchronizedAt returns when the settings were last synchronized with the backend
+func (s *Service) SynchronizedAt() time.Time {
 	s.m.Lock()
 	defer s.m.Unlock()
+	return s.syncedAt
+}
 
-	subjectSettings, ok := s.settings[subject]
-	if !ok {
-		return ""
+// GetSetting returns the value of the setting, or its default if it is not set
+func (s *Service) GetSetting(subject string, name string) string {
+	value := s.getSetting(subject, name)
+	if value != "" {
+		return value
+	}
+	definition, _ := LookupSetting(name)
+	return definition.Default
+}
+
+// GetSettingDefault returns the value of the setting, or def if it is not set
+func (s *Service) GetSettingDefault(subject string, name string, def string) string {
+	value := s.getSetting(subject, name)
+	if value == "" {
+		return def
 	}
-	return subjectSettings[name]
+	return value
+}
+
+// GetBool returns the value of a bool setting
+func (s *Service) GetBool(subject string, name string) bool {
+	return s.GetSetting(subject, name) == "true"
+}
+
+// GetInt returns the value of an int setting, or its default if the stored value is not a number
+func (s *Service) GetInt(subject string, name string) int {
+	value, err := strconv.Atoi(s.GetSetting(subject, name))
+	if err != nil {
+		zap.L().Warn("invalid int setting", zap.String("subject", subject), zap.String("setting", name), zap.Error(err))
+		definition, _ := LookupSetting(name)
+		value, _ = strconv.Atoi(definition.Default)
+	}
+	return value
+}
+
+// GetRoles returns the role ids of a role or role list setting
+func (s *Service) GetRoles(subject string, name string) []string {
+	return splitList(s.GetSetting(subject, name))
+}
+
+// GetPermissions returns the API key permissions of a permission list setting
+func (s *Service) GetPermissions(subject string, name string) []string {
+	return splitList(s.GetSetting(subject, name))
+}
+
+// GetCommands returns the command names of a command list setting
+func (s *Service) GetCommands(subject string, name string) []string {
+	return splitList(s.GetSetting(subject, name))
 }
 
-func (s *Service) GetSettingSlice(subject string, name string) []string {
+// GetURLs returns the urls of a url list setting
+func (s *Service) GetURLs(subject string, name string) []string {
+	return splitList(s.GetSetting(subject, name))
+}
+
+// GetWorld returns the id of the world members are verified against, if world verification is turned on
+func (s *Service) GetWorld(subject string) (int, bool) {
+	value := s.GetSetting(subject, SettingWvWWorld)
+	if value == "" || value == WorldDisabled {
+		return 0, false
+	}
+	worldID, err := strconv.Atoi(value)
+	if err != nil {
+		zap.L().Warn("invalid world setting", zap.String("subject", subject), zap.Error(err))
+		return 0, false
+	}
+	return worldID, true
+}
+
+func (s *Service) getSetting(subject string, name string) string {
 	s.m.Lock()
 	defer s.m.Unlock()
+	return s.settings[subject][name]
+}
 
-	subjectSettings, ok := s.settings[subject]
-	if !ok {
+func splitList(value string) []string {
+	if value == "" {
 		return nil
 	}
+	return strings.Split(value, ",")
+}
 
-	if subjectSettings[name] == "" {
-		return nil
-	}
+// GetSettings returns a copy of all settings of the subject
+func (s *Service) GetSettings(subject string) map[string]string {
+	s.m.Lock()
+	defer s.m.Unlock()
 
-	return strings.Split(subjectSettings[name], ",")
+	settings := make(map[string]string, len(s.settings[subject]))
+	for name, value := range s.settings[subject] {
+		settings[name] = value
+	}
+	return settings
 }
 
-func (s *Service) GetSettingDefault(subject string, name string, def string) string {
+// OnChange registers fn to be called whenever a setting is changed through SetSetting, with the context of the change
+func (s *Service) OnChange(fn func(ctx context.Context, subject string, name string, oldValue string, newValue string)) {
 	s.m.Lock()
 	defer s.m.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
 
-	subjectSettings, ok := s.settings[subject]
-	if !ok {
-		return def
+// SetSetting stores the setting, if the value is accepted by its definition
+func (s *Service) SetSetting(ctx context.Context, subject string, name string, value string) error {
+	if err := ValidateSetting(name, value); err != nil {
+		return err
 	}
-	return subjectSettings[name]
+
+	oldValue, err := s.setSetting(ctx, subject, name, value)
+	if err != nil {
+		return err
+	}
+	if oldValue != value {
+		s.recordChange(ctx, subject, name, oldValue, value)
+	}
+
+	s.m.Lock()
+	listeners := s.listeners
+	s.m.Unlock()
+	for _, listener := range listeners {
+		listener(ctx, subject, name, oldValue, value)
+	}
+	return nil
 }
 
-func (s *Service) SetSetting(ctx context.Context, subject string, name string, value string) error {
+// setSetting stores the setting, and returns its previous value
+func (s *Service) setSetting(ctx context.Context, subject string, name string, value string) (string, error) {
 	s.m.Lock()
 	defer s.m.Unlock()
 
@@ -118,7 +247,7 @@ func (s *Service) SetSetting(ctx context.Context, subject string, name string, v
 		return nil
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	subjectSettings, ok := s.settings[subject]
@@ -126,6 +255,91 @@ func (s *Service) SetSetting(ctx context.Context, subject string, name string, v
 		subjectSettings = make(map[string]string)
 		s.settings[subject] = subjectSettings
 	}
+	oldValue := subjectSettings[name]
 	subjectSettings[name] = value
+	return oldValue, nil
+}
+
+// SetSettings stores multiple settings of the subject in a single request, if all values are accepted. Settings left out are not changed
+func (s *Service) SetSettings(ctx context.Context, subject string, values map[string]string) error {
+	var errs []error
+	for name, value := range values {
+		errs = append(errs, ValidateSetting(name, value))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	oldValues, err := s.setSettings(ctx, subject, values)
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	listeners := s.listeners
+	s.m.Unlock()
+	for name, value := range values {
+		if oldValues[name] == value {
+			continue
+		}
+		s.recordChange(ctx, subject, name, oldValues[name], value)
+		for _, listener := range listeners {
+			listener(ctx, subject, name, oldValues[name], value)
+		}
+	}
 	return nil
 }
+
+// setSettings stores the settings, and returns the previous settings of the subject
+func (s *Service) setSettings(ctx context.Context, subject string, values map[string]string) (map[string]string, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Send every setting of the subject, so settings left out are kept, regardless of whether the backend replaces or merges them
+	oldValues := s.settings[subject]
+	merged := make(map[string]string, len(oldValues)+len(values))
+	for name, value := range oldValues {
+		merged[name] = value
+	}
+	for name, value := range values {
+		merged[name] = value
+	}
+
+	properties := make([]api.Property, 0, len(merged))
+	for name, value := range merged {
+		properties = append(properties, api.Property{
+			Name:    name,
+			Value:   value,
+			Subject: &subject,
+		})
+	}
+
+	body, err := json.Marshal(properties)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.backend.PutServiceSubjectPropertiesWithResponse(ctx, s.serviceUUID, subject, func(ctx context.Context, req *http.Request) error {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Set("Content-Type", "application/json")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode() != http.StatusOK {
+		zap.L().Error("unexpected response", zap.Any("response", resp))
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status())
+	}
+
+	s.settings[subject] = merged
+	return oldValues, nil
+}
+
+// recordChange adds the change to the history. Internal settings, maintained by the bot itself, are not recorded
+func (s *Service) recordChange(ctx context.Context, subject string, name string, oldValue string, newValue string) {
+	if definition, ok := LookupSetting(name); ok && definition.Internal {
+		return
+	}
+	s.history.Record(subject, name, oldValue, newValue, actorFrom(ctx))
+}
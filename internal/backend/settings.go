@@ -0,0 +1,449 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+)
+
+var (
+	ErrUnknownSetting = errors.New("unknown setting")
+	ErrInvalidSetting = errors.New("invalid setting value")
+)
+
+// SettingType is the kind of value a setting holds
+type SettingType int
+
+const (
+	// SettingTypeBool is "true" or "false"
+	SettingTypeBool SettingType = iota
+	// SettingTypeInt is a whole number, no smaller than the Min of the setting
+	SettingTypeInt
+	// SettingTypeEnum is one of the Values of the setting
+	SettingTypeEnum
+	// SettingTypeRole is the id of a role
+	SettingTypeRole
+	// SettingTypeRoleList is a comma separated list of role ids
+	SettingTypeRoleList
+	// SettingTypeChannel is the id of a channel
+	SettingTypeChannel
+	// SettingTypeMessage is the id of a message
+	SettingTypeMessage
+	// SettingTypeWorld is the id of a world, or WorldDisabled
+	SettingTypeWorld
+	// SettingTypePermissionList is a comma separated list of APIKeyPermissions
+	SettingTypePermissionList
+	// SettingTypeCommandList is a comma separated list of command names
+	SettingTypeCommandList
+	// SettingTypeURLList is a comma separated list of https urls, no longer than MaxURLs
+	SettingTypeURLList
+	// SettingTypeSecret is a random, url safe secret of at least MinSecretLength characters
+	SettingTypeSecret
+)
+
+var settingTypeNames = map[SettingType]string{
+	SettingTypeBool:           "bool",
+	SettingTypeInt:            "int",
+	SettingTypeEnum:           "enum",
+	SettingTypeRole:           "role",
+	SettingTypeRoleList:       "role_list",
+	SettingTypeChannel:        "channel",
+	SettingTypeMessage:        "message",
+	SettingTypeWorld:          "world",
+	SettingTypePermissionList: "permission_list",
+	SettingTypeCommandList:    "command_list",
+	SettingTypeURLList:        "url_list",
+	SettingTypeSecret:         "secret",
+}
+
+// String returns the name of the type, e.g. "role_list"
+func (t SettingType) String() string {
+	if name, ok := settingTypeNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+// MaxURLs is the most urls a url list setting accepts
+const MaxURLs = 5
+
+// MinSecretLength is the shortest secret a secret setting accepts
+const MinSecretLength = 32
+
+// WorldDisabled is the value of SettingWvWWorld when world verification is turned off
+const WorldDisabled = "disabled"
+
+// API key permissions that can be required with SettingGuildRequiredPermissions
+const (
+	PermissionAccount      = "account"
+	PermissionInventiories = "inventories"
+	PermissionCharacters   = "characters"
+	PermissionTradingPost  = "tradingpost"
+	PermissionWallet       = "wallet"
+	PermissionUnlocks      = "unlocks"
+	PermissionPvP          = "pvp"
+	PermissionWvW          = "wvw"
+	PermissionBuilds       = "builds"
+	PermissionProgression  = "progression"
+	PermissionGuilds       = "guilds"
+)
+
+var APIKeyPermissions = []string{
+	PermissionAccount,
+	PermissionInventiories,
+	PermissionCharacters,
+	PermissionTradingPost,
+	PermissionWallet,
+	PermissionUnlocks,
+	PermissionPvP,
+	PermissionWvW,
+	PermissionBuilds,
+	PermissionProgression,
+	PermissionGuilds,
+}
+
+// Values of SettingPolicyAction
+const (
+	PolicyActionOff        = "off"
+	PolicyActionQuarantine = "quarantine"
+	PolicyActionKick       = "kick"
+)
+
+// Values of SettingOnboardingWelcome
+const (
+	OnboardingWelcomeOff     = "off"
+	OnboardingWelcomeDM      = "dm"
+	OnboardingWelcomeChannel = "channel"
+)
+
+// DefaultPolicyGraceHours is the time between warning a member and acting on them, if not configured
+const DefaultPolicyGraceHours = 24
+
+// SettingDefinition describes a setting, and which values it accepts.
+// An empty value means the setting is not set, and its Default is used instead
+type SettingDefinition struct {
+	Name        string
+	Type        SettingType
+	Default     string
+	Description string
+	// Values are the accepted values of an enum setting
+	Values []string
+	// Min is the smallest accepted value of an int setting
+	Min int
+	// Internal settings are maintained by the bot itself, and are not exported or imported
+	Internal bool
+	// AffectsMembers is set for settings that change which roles or nick a member should have
+	AffectsMembers bool
+}
+
+// settingDefinitions are all known settings, in the order they are listed to users
+var settingDefinitions = []SettingDefinition{
+	{
+		Name:           SettingWvWWorld,
+		Type:           SettingTypeWorld,
+		Description:    "World members are verified against",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingPrimaryRole,
+		Type:           SettingTypeRole,
+		Description:    "Role of members on the world",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingLinkedRole,
+		Type:           SettingTypeRole,
+		Description:    "Role of members on a world linked with the world",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingAssociatedRoles,
+		Type:           SettingTypeRoleList,
+		Description:    "Roles only members on the world or a linked world can have",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingAccRepEnabled,
+		Type:           SettingTypeBool,
+		Default:        "false",
+		Description:    "Add the account name to the nick of members",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingGuildTagRepEnabled,
+		Type:           SettingTypeBool,
+		Default:        "false",
+		Description:    "Add the tag of the represented guild to the nick of members",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingEnforceGuildRep,
+		Type:           SettingTypeBool,
+		Default:        "false",
+		Description:    "Only give members the role of the guild they represent",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingGuildCommonRole,
+		Type:           SettingTypeRole,
+		Description:    "Role of members in a guild with a role on the server",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingGuildVerifyRoles,
+		Type:           SettingTypeRoleList,
+		Description:    "Guild roles that give the verification role, instead of every guild role",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingGuildRequiredPermissions,
+		Type:           SettingTypePermissionList,
+		Description:    "API key permissions required for the verification role",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingRolesToRemoveWhenNotInGuild,
+		Type:           SettingTypeRoleList,
+		Description:    "Roles removed from members not in a guild with a role on the server",
+		AffectsMembers: true,
+	},
+	{
+		Name:        SettingOnboardingChannel,
+		Type:        SettingTypeChannel,
+		Description: "Channel of the onboarding message",
+		Internal:    true,
+	},
+	{
+		Name:        SettingOnboardingMessage,
+		Type:        SettingTypeMessage,
+		Description: "Onboarding message posted by the bot",
+		Internal:    true,
+	},
+	{
+		Name:        SettingOnboardingWelcome,
+		Type:        SettingTypeEnum,
+		Default:     OnboardingWelcomeOff,
+		Description: "How new members are welcomed",
+		Values:      []string{OnboardingWelcomeOff, OnboardingWelcomeDM, OnboardingWelcomeChannel},
+	},
+	{
+		Name:        SettingOnboardingWelcomeChannel,
+		Type:        SettingTypeChannel,
+		Description: "Channel new members are welcomed in",
+	},
+	{
+		Name:        SettingOnboardingReminderInterval,
+		Type:        SettingTypeInt,
+		Default:     "0",
+		Description: "Hours between reminding unverified members",
+	},
+	{
+		Name:        SettingOnboardingReminderCount,
+		Type:        SettingTypeInt,
+		Default:     "0",
+		Description: "Number of reminders sent to unverified members",
+	},
+	{
+		Name:           SettingOnboardingUnverifiedRole,
+		Type:           SettingTypeRole,
+		Description:    "Role of members who have not verified",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingPolicyAction,
+		Type:           SettingTypeEnum,
+		Default:        PolicyActionOff,
+		Description:    "Action taken against members violating the verification policy",
+		Values:         []string{PolicyActionOff, PolicyActionQuarantine, PolicyActionKick},
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingPolicyUnverifiedDays,
+		Type:           SettingTypeInt,
+		Default:        "0",
+		Description:    "Days members have to verify, before violating the verification policy",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingPolicyExpired,
+		Type:           SettingTypeBool,
+		Default:        "false",
+		Description:    "Members whose linked accounts have all expired violate the verification policy",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingPolicyQuarantineRole,
+		Type:           SettingTypeRole,
+		Description:    "Role of quarantined members",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingPolicyExemptRoles,
+		Type:           SettingTypeRoleList,
+		Description:    "Roles exempt from the verification policy",
+		AffectsMembers: true,
+	},
+	{
+		Name:           SettingPolicyGraceHours,
+		Type:           SettingTypeInt,
+		Default:        strconv.Itoa(DefaultPolicyGraceHours),
+		Description:    "Hours between warning a member and acting on them",
+		AffectsMembers: true,
+	},
+	{
+		Name:        SettingExpiredLogChannel,
+		Type:        SettingTypeChannel,
+		Description: "Channel expired API keys are reported in",
+	},
+	{
+		Name:        SettingAuditChannel,
+		Type:        SettingTypeChannel,
+		Description: "Channel role and nick changes are logged in",
+	},
+	{
+		Name:        SettingCommandsDisabled,
+		Type:        SettingTypeCommandList,
+		Description: "Commands that are not available on the server",
+	},
+	{
+		Name:        SettingCommandsAdminRoles,
+		Type:        SettingTypeRoleList,
+		Description: "Roles allowed to use the admin commands, besides administrators",
+	},
+	{
+		Name:        SettingWebhookURLs,
+		Type:        SettingTypeURLList,
+		Description: "URLs verification and role events are sent to",
+	},
+	{
+		Name:        SettingWebhookSecret,
+		Type:        SettingTypeSecret,
+		Description: "Secret webhook events are signed with",
+		Internal:    true,
+	},
+}
+
+// SettingDefinitions returns the definitions of all known settings, in the order they are listed to users
+func SettingDefinitions() []SettingDefinition {
+	return slices.Clone(settingDefinitions)
+}
+
+// LookupSetting returns the definition of the setting
+func LookupSetting(name string) (SettingDefinition, bool) {
+	for _, definition := range settingDefinitions {
+		if definition.Name == name {
+			return definition, true
+		}
+	}
+	return SettingDefinition{}, false
+}
+
+// ValidateSetting checks if value is accepted by the setting
+func ValidateSetting(name string, value string) error {
+	definition, ok := LookupSetting(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSetting, name)
+	}
+	return definition.Validate(value)
+}
+
+// HoldsRoles checks if the setting holds one or more role ids
+func (d SettingDefinition) HoldsRoles() bool {
+	return d.Type == SettingTypeRole || d.Type == SettingTypeRoleList
+}
+
+// Validate checks if value is accepted by the setting
+func (d SettingDefinition) Validate(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	invalid := func(reason string, args ...any) error {
+		return fmt.Errorf("%w for %s: %s", ErrInvalidSetting, d.Name, fmt.Sprintf(reason, args...))
+	}
+	switch d.Type {
+	case SettingTypeBool:
+		if value != "true" && value != "false" {
+			return invalid("%q is not true or false", value)
+		}
+	case SettingTypeInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return invalid("%q is not a number", value)
+		} else if n < d.Min {
+			return invalid("%d is less than %d", n, d.Min)
+		}
+	case SettingTypeEnum:
+		if !slices.Contains(d.Values, value) {
+			return invalid("%q is not one of %s", value, strings.Join(d.Values, ", "))
+		}
+	case SettingTypeRole, SettingTypeChannel, SettingTypeMessage:
+		if !discord.IsSnowflake(value) {
+			return invalid("%q is not an id", value)
+		}
+	case SettingTypeRoleList:
+		for _, roleID := range strings.Split(value, ",") {
+			if !discord.IsSnowflake(roleID) {
+				return invalid("%q is not a role id", roleID)
+			}
+		}
+	case SettingTypeWorld:
+		if value == WorldDisabled {
+			return nil
+		}
+		if worldID, err := strconv.Atoi(value); err != nil || worldID <= 0 {
+			return invalid("%q is not a world id", value)
+		}
+	case SettingTypePermissionList:
+		for _, permission := range strings.Split(value, ",") {
+			if !slices.Contains(APIKeyPermissions, permission) {
+				return invalid("%q is not an API key permission", permission)
+			}
+		}
+	case SettingTypeCommandList:
+		for _, command := range strings.Split(value, ",") {
+			if !isCommandName(command) {
+				return invalid("%q is not a command name", command)
+			}
+		}
+	case SettingTypeURLList:
+		urls := strings.Split(value, ",")
+		if len(urls) > MaxURLs {
+			return invalid("more than %d urls", MaxURLs)
+		}
+		for _, rawURL := range urls {
+			parsed, err := url.Parse(rawURL)
+			if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+				return invalid("%q is not an https url", rawURL)
+			}
+		}
+	case SettingTypeSecret:
+		if len(value) < MinSecretLength {
+			return invalid("shorter than %d characters", MinSecretLength)
+		}
+		for _, r := range value {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+				return invalid("only letters, digits, - and _ are allowed")
+			}
+		}
+	}
+	return nil
+}
+
+// isCommandName checks if the value is the name of a command, which discord limits to 32 lowercase letters, digits, - and _
+func isCommandName(value string) bool {
+	if value == "" || len(value) > 32 {
+		return false
+	}
+	for _, r := range value {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
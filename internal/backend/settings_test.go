@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestValidateSetting(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(ValidateSetting(SettingAccRepEnabled, "true")).To(Succeed())
+	g.Expect(ValidateSetting(SettingAccRepEnabled, "yes")).To(MatchError(ErrInvalidSetting))
+	g.Expect(ValidateSetting(SettingPolicyGraceHours, "12")).To(Succeed())
+	g.Expect(ValidateSetting(SettingPolicyGraceHours, "twelve")).To(MatchError(ErrInvalidSetting))
+	g.Expect(ValidateSetting(SettingPolicyAction, PolicyActionKick)).To(Succeed())
+	g.Expect(ValidateSetting(SettingPolicyAction, "ban")).To(MatchError(ErrInvalidSetting))
+	g.Expect(ValidateSetting(SettingGuildCommonRole, "123")).To(Succeed())
+	g.Expect(ValidateSetting(SettingGuildCommonRole, "<@&123>")).To(MatchError(ErrInvalidSetting))
+	g.Expect(ValidateSetting(SettingGuildVerifyRoles, "123,456")).To(Succeed())
+	g.Expect(ValidateSetting(SettingGuildVerifyRoles, "123,")).To(MatchError(ErrInvalidSetting))
+	g.Expect(ValidateSetting(SettingWvWWorld, WorldDisabled)).To(Succeed())
+	g.Expect(ValidateSetting(SettingWvWWorld, "2301")).To(Succeed())
+	g.Expect(ValidateSetting(SettingWvWWorld, "-1")).To(MatchError(ErrInvalidSetting))
+	g.Expect(ValidateSetting(SettingGuildRequiredPermissions, "account,wvw")).To(Succeed())
+	g.Expect(ValidateSetting(SettingGuildRequiredPermissions, "account,admin")).To(MatchError(ErrInvalidSetting))
+	g.Expect(ValidateSetting(SettingCommandsDisabled, "rep,verify")).To(Succeed())
+	g.Expect(ValidateSetting(SettingCommandsDisabled, "rep,/verify")).To(MatchError(ErrInvalidSetting))
+	g.Expect(ValidateSetting(SettingWebhookURLs, "https://example.com/hook,https://example.org")).To(Succeed())
+	g.Expect(ValidateSetting(SettingWebhookURLs, "http://example.com/hook")).To(MatchError(ErrInvalidSetting))
+	g.Expect(ValidateSetting(SettingWebhookURLs, "https://a.com,https://b.com,https://c.com,https://d.com,https://e.com,https://f.com")).To(MatchError(ErrInvalidSetting))
+	g.Expect(ValidateSetting(SettingWebhookSecret, "abcdefghijklmnopqrstuvwxyz0123456789-_")).To(Succeed())
+	g.Expect(ValidateSetting(SettingWebhookSecret, "short")).To(MatchError(ErrInvalidSetting))
+
+	// An empty value unsets the setting
+	g.Expect(ValidateSetting(SettingPolicyAction, "")).To(Succeed())
+	g.Expect(ValidateSetting("unknown", "")).To(MatchError(ErrUnknownSetting))
+}
+
+func TestServiceTypedSettings(t *testing.T) {
+	g := NewGomegaWithT(t)
+	service := &Service{
+		settings: map[string]map[string]string{
+			"guild": {
+				SettingAccRepEnabled:            "true",
+				SettingPolicyUnverifiedDays:     "7",
+				SettingGuildVerifyRoles:         "1,2",
+				SettingGuildRequiredPermissions: "",
+				SettingWvWWorld:                 "2301",
+			},
+			"disabled": {
+				SettingWvWWorld: WorldDisabled,
+			},
+		},
+	}
+
+	g.Expect(service.GetBool("guild", SettingAccRepEnabled)).To(BeTrue())
+	g.Expect(service.GetBool("guild", SettingEnforceGuildRep)).To(BeFalse())
+	g.Expect(service.GetInt("guild", SettingPolicyUnverifiedDays)).To(Equal(7))
+	g.Expect(service.GetRoles("guild", SettingGuildVerifyRoles)).To(Equal([]string{"1", "2"}))
+	g.Expect(service.GetPermissions("guild", SettingGuildRequiredPermissions)).To(BeEmpty())
+
+	worldID, ok := service.GetWorld("guild")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(worldID).To(Equal(2301))
+	_, ok = service.GetWorld("disabled")
+	g.Expect(ok).To(BeFalse())
+
+	// Defaults apply to settings that are not set, even if the subject has other settings
+	g.Expect(service.GetInt("guild", SettingPolicyGraceHours)).To(Equal(DefaultPolicyGraceHours))
+	g.Expect(service.GetSetting("guild", SettingPolicyAction)).To(Equal(PolicyActionOff))
+	g.Expect(service.GetSetting("unknown", SettingOnboardingWelcome)).To(Equal(OnboardingWelcomeOff))
+	g.Expect(service.GetSettingDefault("guild", SettingAuditChannel, "fallback")).To(Equal("fallback"))
+}
@@ -11,15 +11,31 @@ import (
 	"github.com/MrGunflame/gw2api"
 	"github.com/bwmarrin/discordgo"
 	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
 	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/dashboard"
+	"github.com/vennekilde/gw2-alliance-bot/internal/diagnose"
 	discord_internal "github.com/vennekilde/gw2-alliance-bot/internal/discord"
+	"github.com/vennekilde/gw2-alliance-bot/internal/expiry"
 	"github.com/vennekilde/gw2-alliance-bot/internal/guild"
 	"github.com/vennekilde/gw2-alliance-bot/internal/interaction"
+	"github.com/vennekilde/gw2-alliance-bot/internal/management"
 	"github.com/vennekilde/gw2-alliance-bot/internal/nick"
+	"github.com/vennekilde/gw2-alliance-bot/internal/onboarding"
+	"github.com/vennekilde/gw2-alliance-bot/internal/policy"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+	"github.com/vennekilde/gw2-alliance-bot/internal/webhook"
 	"github.com/vennekilde/gw2-alliance-bot/internal/world"
 	"go.uber.org/zap"
 )
 
+const (
+	// reconcileWorkers is the number of members reconciled concurrently
+	reconcileWorkers = 4
+	// webhookWorkers is the number of webhook deliveries sent concurrently
+	webhookWorkers = 2
+)
+
 type Bot struct {
 	cache        *discord_internal.Cache
 	interactions *interaction.Interactions
@@ -31,13 +47,25 @@ type Bot struct {
 	token            string
 	guilds           *guild.Guilds
 	guildRoleHandler *guild.GuildRoleHandler
+	audit            *audit.Log
+	onboarding       *onboarding.Onboarding
+	policy           *policy.Policy
+	expiry           *expiry.Notifier
 	discord          *discordgo.Session
+	queue            *reconcile.Queue
+	diagnoser        *diagnose.Diagnoser
+	dashboard        *dashboard.Dashboard
+	management       *management.API
+	webhooks         *webhook.Dispatcher
 
 	// Debug
 	debugUser string
 }
 
-func NewBot(discordToken string, backendURL string, serviceUUID string, backendToken string, debugUser string) *Bot {
+func NewBot(discordToken string, backendURL string, serviceUUID string, backendToken string, debugUser string, dataDir string, dashboardConfig dashboard.Config, managementConfig management.Config) *Bot {
+	if err := dashboardConfig.Validate(); err != nil {
+		panic(fmt.Errorf("invalid dashboard config: %w", err))
+	}
 	client, _ := api.NewClientWithResponses(
 		backendURL,
 		api.WithBaseURL(backendURL),
@@ -54,11 +82,14 @@ func NewBot(discordToken string, backendURL string, serviceUUID string, backendT
 	}
 
 	cache := discord_internal.NewCache(discord)
-	service := backend.NewService(client, serviceUUID)
+	service := backend.NewService(client, serviceUUID, backend.NewHistory(dataDir))
 	worlds := world.NewWorlds(gw2api.New())
-	wvw := world.NewWvW(discord, service, worlds)
-	guilds := guild.NewGuilds()
-	guildRoleHandler := guild.NewGuildRoleHandler(discord, cache, guilds, service)
+	auditLog := audit.NewLog(discord, service)
+	webhooks := webhook.NewDispatcher(discord, service, dataDir)
+	wvw := world.NewWvW(discord, service, worlds, auditLog, webhooks)
+	guilds := guild.NewGuilds(dataDir)
+	guildRoleHandler := guild.NewGuildRoleHandler(discord, cache, guilds, service, auditLog, webhooks)
+	diagnoser := diagnose.NewDiagnoser(service, cache, guilds, worlds, dataDir)
 
 	b := &Bot{
 		discord:          discord,
@@ -71,8 +102,35 @@ func NewBot(discordToken string, backendURL string, serviceUUID string, backendT
 		wvw:              wvw,
 		guilds:           guilds,
 		guildRoleHandler: guildRoleHandler,
+		audit:            auditLog,
+		diagnoser:        diagnoser,
+		webhooks:         webhooks,
+	}
+	b.expiry = expiry.NewNotifier(discord, service, dataDir)
+	b.onboarding = onboarding.NewOnboarding(discord, service, client, b.ActiveForUser, auditLog, dataDir)
+	b.policy = policy.NewPolicy(discord, service, func(guildID string, userID string) ([]*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+		return interaction.BuildVerifyInstructions(discord_internal.GuildLocale(discord, guildID), interaction.APIKeyNamePrefix(discord, guildID), userID)
+	}, auditLog, dataDir)
+	b.interactions = interaction.NewInteractions(b.discord, b.cache, b.service, b.backend, guilds, guildRoleHandler, wvw, b.policy, auditLog, b.ActiveForUser, b.EnqueueMember, diagnoser, webhooks)
+	b.queue = reconcile.NewQueue(b.reconcileMember)
+	if dashboardConfig.Addr != "" {
+		b.dashboard = dashboard.NewDashboard(dashboardConfig, discord, service, cache, guilds, auditLog, webhooks, b.ReconcileServer, b.PendingMembers, b.interactions.CommandNames)
+	}
+	if managementConfig.Enabled() {
+		b.management = management.NewAPI(managementConfig, discord, service, cache, guilds, b.ReconcileServer, b.EnqueueMember, b.PendingMembers, b.PlanMember)
 	}
-	b.interactions = interaction.NewInteractions(b.discord, b.cache, b.service, b.backend, guilds, guildRoleHandler, wvw, b.ActiveForUser)
+
+	service.OnChange(b.onSettingChanged)
+	auditLog.OnRecord(func(change audit.Change) {
+		if change.Action == audit.ActionNickChanged {
+			webhooks.Send(webhook.NickChanged(change.GuildID, change.UserID, change.Before, change.After, change.Reason, change.ReasonData))
+		}
+	})
+	cache.OnRoleDelete(func(guildID string, roleID string, userIDs []string) {
+		for _, userID := range userIDs {
+			b.EnqueueMember(guildID, userID)
+		}
+	})
 
 	return b
 }
@@ -92,12 +150,27 @@ func (b *Bot) Start() {
 			err := b.service.Synchronize()
 			if err != nil {
 				log.Printf("unable to synchronize service settings: %v", err)
+			} else {
+				// Commands may have been enabled or disabled outside the bot
+				b.interactions.RegisterCommands()
 			}
 			time.Sleep(5 * time.Minute)
 		}
 	}()
 
 	b.worlds.Start()
+	b.guilds.Start()
+	b.audit.Start()
+	b.diagnoser.Verification().Start()
+	b.expiry.Start()
+	b.queue.Start(reconcileWorkers)
+	b.webhooks.Start(webhookWorkers)
+	if b.dashboard != nil {
+		b.dashboard.Start()
+	}
+	if b.management != nil {
+		b.management.Start()
+	}
 
 	b.discord.Identify.Intents = discordgo.IntentDirectMessages | discordgo.IntentGuildMembers | discordgo.IntentsGuilds
 	b.discord.StateEnabled = true
@@ -109,22 +182,20 @@ func (b *Bot) Start() {
 
 	b.discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildMemberUpdate) {
 		zap.L().Info("member update", zap.Any("event", event))
-		ctx := context.Background()
-		resp, err := b.backend.GetPlatformUserWithResponse(ctx, backend.PlatformID, event.Member.User.ID, &api.GetPlatformUserParams{})
-		if err != nil {
-			zap.L().Error("unable to get verification status for member", zap.Any("member", event.Member), zap.Any("resp", resp), zap.Error(err))
-			return
-		} else if resp.JSON200 == nil {
-			return
-		}
+		// Handlers run concurrently, so ensure the queue does not read the member from the cache before it is updated
+		b.cache.UpdateMember(event.Member)
 
-		var optAddedRole string
+		task := reconcile.Task{GuildID: event.GuildID, UserID: event.User.ID}
 		if event.BeforeUpdate != nil {
-			optAddedRole = findAddedRole(event.BeforeUpdate.Roles, event.Roles)
+			task.PreferredRole = findAddedRole(event.BeforeUpdate.Roles, event.Roles)
+		}
+		b.queue.Enqueue(task)
+	})
+
+	b.discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildMemberRemove) {
+		if event.Member != nil && event.Member.User != nil {
+			b.diagnoser.Verification().Forget(event.GuildID, event.Member.User.ID)
 		}
-		b.guildRoleHandler.CheckRoles(event.GuildID, event.Member, event.Roles, resp.JSON200.Accounts, optAddedRole)
-		b.guildRoleHandler.CheckGuildTags(event.GuildID, event.Member)
-		b.wvw.VerifyWvWWorldRoles(event.GuildID, event.Member, resp.JSON200.Accounts, resp.JSON200.Bans)
 	})
 
 	err := b.discord.Open()
@@ -168,78 +239,183 @@ func (b *Bot) beginBackendSync() {
 	}()
 
 	for {
-		for _, guild := range b.discord.State.Guilds {
-			var lastMemberID string
-			for {
-				ctx := context.Background()
-
-				limit := 25
-				zap.L().Info("fetching guild members scheduled for refresh", zap.String("guild id", guild.ID), zap.String("guild name", guild.Name), zap.Int("limit", limit))
-				members, err := b.discord.GuildMembers(guild.ID, lastMemberID, limit)
-				if err != nil {
-					zap.L().Error("unable to fetch guild members from server", zap.String("guild id", guild.ID), zap.String("guild name", guild.Name), zap.Error(err))
-				}
+		for _, guild := range discord_internal.Guilds(b.discord) {
+			b.forEachMemberPage(guild, 25, func(members []*discordgo.Member) {
 				for _, member := range members {
-					lastMemberID = member.User.ID
-					if !b.ActiveForUser(member.User.ID) {
-						continue
-					}
-
-					resp, err := b.backend.GetPlatformUserWithResponse(ctx, backend.PlatformID, member.User.ID, &api.GetPlatformUserParams{})
-					if err != nil {
-						zap.L().Error("unable to get verification status for member", zap.Any("member", member), zap.Any("resp", resp), zap.Error(err))
-						continue
-					} else if resp.JSON200 == nil {
-						continue
-					}
-
-					// Cache guildID in member struct, as it is not by default
-					member.GuildID = guild.ID
-					err = b.RefreshMember(resp.JSON200, member)
-					if err != nil {
-						zap.L().Error("unable to refresh member", zap.Any("member", member), zap.Error(err))
-					}
+					b.EnqueueMember(guild.ID, member.User.ID)
 				}
 				time.Sleep(time.Second * 5)
+			})
+		}
+	}
+}
 
-				// Check if we should fetch more members
-				if len(members) == 0 || len(members) < limit {
-					break
-				}
-			}
+// forEachMemberPage calls fn with the members of the server, limit at a time.
+// Members are read from the cache, or fetched from discord if the cache has not been populated yet
+func (b *Bot) forEachMemberPage(guild *discordgo.Guild, limit int, fn func(members []*discordgo.Member)) {
+	if members, ok := b.cache.Members(guild.ID); ok {
+		zap.L().Info("refreshing cached guild members", zap.String("guild id", guild.ID), zap.String("guild name", guild.Name), zap.Int("members", len(members)))
+		if len(members) == 0 {
+			fn(members)
+			return
+		}
+		for page := range slices.Chunk(members, limit) {
+			fn(page)
+		}
+		return
+	}
+
+	var lastMemberID string
+	for {
+		zap.L().Info("fetching guild members scheduled for refresh", zap.String("guild id", guild.ID), zap.String("guild name", guild.Name), zap.Int("limit", limit))
+		members, err := b.discord.GuildMembers(guild.ID, lastMemberID, limit)
+		if err != nil {
+			zap.L().Error("unable to fetch guild members from server", zap.String("guild id", guild.ID), zap.String("guild name", guild.Name), zap.Error(err))
+		}
+		if len(members) > 0 {
+			lastMemberID = members[len(members)-1].User.ID
+		}
+		fn(members)
+
+		// Check if we should fetch more members
+		if len(members) == 0 || len(members) < limit {
+			break
 		}
 	}
 }
 
+// RefreshUser reconciles the user in every server they are a member of
 func (b *Bot) RefreshUser(user *api.User) error {
 	for _, platformLink := range user.PlatformLinks {
 		if platformLink.PlatformID != backend.PlatformID {
 			continue
 		}
 
-		for _, guild := range b.discord.State.Guilds {
-			member, err := b.discord.GuildMember(guild.ID, platformLink.PlatformUserID)
-			if err != nil {
-				zap.L().Error("unable to get member", zap.String("guild id", guild.ID), zap.String("user id", platformLink.PlatformUserID), zap.Error(err))
-				continue
-			}
+		for _, guild := range discord_internal.Guilds(b.discord) {
+			b.EnqueueMember(guild.ID, platformLink.PlatformUserID)
+		}
+	}
+	return nil
+}
 
-			if member == nil {
-				continue
-			}
+// EnqueueMember schedules the member to be reconciled, unless it already is
+func (b *Bot) EnqueueMember(guildID string, userID string) {
+	b.queue.Enqueue(reconcile.Task{GuildID: guildID, UserID: userID})
+}
 
-			err = b.RefreshMember(user, member)
-			if err != nil {
-				zap.L().Error("unable to refresh member", zap.Any("member", member), zap.Error(err))
-			}
-		}
+// ReconcileServer schedules every member of the server to be reconciled
+func (b *Bot) ReconcileServer(guildID string) error {
+	guild, err := b.discord.State.Guild(guildID)
+	if err != nil {
+		return err
 	}
+	go b.forEachMemberPage(guild, 1000, func(members []*discordgo.Member) {
+		for _, member := range members {
+			b.EnqueueMember(guild.ID, member.User.ID)
+		}
+	})
 	return nil
 }
 
-func (b *Bot) RefreshMember(user *api.User, member *discordgo.Member) error {
+// PlanMember decides which guild and world roles the member should have, and why, without changing anything
+func (b *Bot) PlanMember(member *discordgo.Member) ([]reconcile.Decision, error) {
+	resp, err := b.backend.GetPlatformUserWithResponse(context.Background(), backend.PlatformID, member.User.ID, &api.GetPlatformUserParams{})
+	if err != nil {
+		return nil, err
+	} else if resp.JSON200 == nil && resp.StatusCode() != http.StatusNotFound {
+		return nil, fmt.Errorf("unexpected response from backend: %s", resp.Status())
+	}
+
+	// Members without a linked account are planned as such
+	var accounts []api.Account
+	var bans []api.Ban
+	if resp.JSON200 != nil {
+		accounts = resp.JSON200.Accounts
+		bans = resp.JSON200.Bans
+	}
+
+	decisions, err := b.guildRoleHandler.PlanRoles(member.GuildID, member, member.Roles, accounts, "")
+	if err != nil {
+		return nil, err
+	}
+	worldDecisions, err := b.wvw.PlanWvWWorldRoles(member.GuildID, member, accounts, bans)
+	if err != nil {
+		return nil, err
+	}
+	return append(decisions, worldDecisions...), nil
+}
+
+// PendingMembers returns the number of members of the server waiting to be reconciled
+func (b *Bot) PendingMembers(guildID string) int {
+	return b.queue.Pending(guildID)
+}
+
+// onSettingChanged reconciles the cached members of the server that are affected by the change. The members are added
+// to the batch of the change, if any, so its progress can be reported
+func (b *Bot) onSettingChanged(ctx context.Context, guildID string, name string, oldValue string, newValue string) {
+	// Members that are not cached yet are reconciled by the sweep
+	members, _ := b.cache.Members(guildID)
+	userIDs := reconcile.Targets(members, name, oldValue, newValue, func(name string) string {
+		return b.service.GetSetting(guildID, name)
+	})
+	if len(userIDs) == 0 {
+		return
+	}
+
+	zap.L().Info("setting changed, reconciling affected members", zap.String("guild id", guildID), zap.String("setting", name), zap.Int("members", len(userIDs)))
+	batch := reconcile.BatchFrom(ctx)
+	for _, userID := range userIDs {
+		b.queue.EnqueueBatch(batch, reconcile.Task{GuildID: guildID, UserID: userID})
+	}
+}
+
+// reconcileMember fetches the current state of the member and their linked accounts, and ensures their roles and nick reflect it.
+// It is only called by the queue, which ensures a member is never reconciled by two workers at once
+func (b *Bot) reconcileMember(task reconcile.Task) {
+	if !b.ActiveForUser(task.UserID) {
+		return
+	}
+
+	member, err := b.cache.GetMember(task.GuildID, task.UserID)
+	if err != nil {
+		zap.L().Error("unable to get member", zap.String("guild id", task.GuildID), zap.String("user id", task.UserID), zap.Error(err))
+		return
+	} else if member == nil {
+		// No longer a member of the server
+		return
+	} else if member.User.Bot {
+		// Bots cannot verify, so they are neither onboarded, nor subject to the policy or expiry
+		return
+	}
+	// Cache guildID in member struct, as it is not by default
+	member.GuildID = task.GuildID
+
+	ctx := context.Background()
+	resp, err := b.backend.GetPlatformUserWithResponse(ctx, backend.PlatformID, task.UserID, &api.GetPlatformUserParams{})
+	if err != nil {
+		zap.L().Error("unable to get verification status for member", zap.Any("member", member), zap.Any("resp", resp), zap.Error(err))
+		return
+	}
+
+	if resp.JSON200 == nil {
+		if resp.StatusCode() == http.StatusNotFound {
+			// Member has never verified
+			b.diagnoser.Verification().Set(member.GuildID, task.UserID, false)
+			b.onboarding.CheckMember(member, nil)
+			b.policy.Enforce(member, nil)
+		}
+		return
+	}
+
+	if b.diagnoser.Verification().Set(member.GuildID, task.UserID, onboarding.IsVerified(resp.JSON200)) {
+		b.webhooks.Send(webhook.MemberVerified(member.GuildID, task.UserID, resp.JSON200.Accounts))
+	}
+	b.refreshMember(resp.JSON200, member, task.PreferredRole)
+}
+
+func (b *Bot) refreshMember(user *api.User, member *discordgo.Member, preferredRole string) {
 	// Ensure user has correct roles
-	b.guildRoleHandler.CheckRoles(member.GuildID, member, member.Roles, user.Accounts, "")
+	b.guildRoleHandler.CheckRoles(member.GuildID, member, member.Roles, user.Accounts, preferredRole)
 
 	err := b.wvw.VerifyWvWWorldRoles(member.GuildID, member, user.Accounts, user.Bans)
 	if err != nil {
@@ -248,16 +424,18 @@ func (b *Bot) RefreshMember(user *api.User, member *discordgo.Member) error {
 
 	b.guildRoleHandler.CheckGuildTags(member.GuildID, member)
 
-	if b.service.GetSetting(member.GuildID, backend.SettingAccRepEnabled) == "true" {
+	b.onboarding.CheckMember(member, user)
+	b.policy.Enforce(member, user)
+	for _, account := range b.expiry.Check(member, user) {
+		b.webhooks.Send(webhook.AccountExpired(member.GuildID, member.User.ID, account))
+	}
+
+	if b.service.GetBool(member.GuildID, backend.SettingAccRepEnabled) {
 		var accName string
 		repGuild := b.guildRoleHandler.GetMemberGuildFromRoles(member)
 
 		// Determine member name
-		name, err := nick.GetNickname(b.discord, member)
-		if err != nil {
-			zap.L().Error("unable to check if account name is already in nick", zap.Any("member", member), zap.Error(err))
-			goto skipAccName
-		}
+		name := nick.GetNickname(member)
 		// Check if account name is already in nick
 		if nick.HasAccountAsName(name, user.Accounts) {
 			goto skipAccName
@@ -274,18 +452,29 @@ func (b *Bot) RefreshMember(user *api.User, member *discordgo.Member) error {
 			}
 		}
 		if len(accName) > 0 {
-			err := nick.SetAccAsNick(b.discord, member, accName)
+			err := nick.SetAccAsNick(b.discord, b.audit, member, accName, "audit.reasons.account_rep")
 			if err != nil {
 				zap.L().Error("unable to set nick name", zap.Any("member", member), zap.Error(err))
 			}
 		}
 	skipAccName:
 	}
-
-	return nil
 }
 
 func (b *Bot) Close() error {
+	if b.dashboard != nil {
+		if err := b.dashboard.Close(); err != nil {
+			zap.L().Error("unable to close dashboard", zap.Error(err))
+		}
+	}
+	if b.management != nil {
+		if err := b.management.Close(); err != nil {
+			zap.L().Error("unable to close management api", zap.Error(err))
+		}
+	}
+	b.guilds.Save()
+	b.diagnoser.Verification().Save()
+	b.expiry.Save()
 	return b.discord.Close()
 }
 
@@ -0,0 +1,278 @@
+package dashboard
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	discordAuthorizeURL = "https://discord.com/oauth2/authorize"
+	discordTokenURL     = "https://discord.com/api/oauth2/token"
+	discordUserURL      = "https://discord.com/api/users/@me"
+
+	sessionCookie = "gw2ab_session"
+	stateCookie   = "gw2ab_oauth_state"
+	// sessionLifetime is how long a user stays logged in
+	sessionLifetime = 12 * time.Hour
+	// stateLifetime is how long a user has to log in with discord
+	stateLifetime = 10 * time.Minute
+)
+
+// session is a user logged in with discord
+type session struct {
+	UserID   string
+	Username string
+	// CSRF is sent with every form, so forms cannot be submitted from other sites
+	CSRF    string
+	Expires time.Time
+	// Flash is shown on the next page, e.g. whether a setting was saved
+	Flash      string
+	FlashError bool
+}
+
+// sessions are the users logged in to the dashboard, by the id stored in their session cookie
+type sessions struct {
+	m        sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessions() *sessions {
+	return &sessions{
+		sessions: make(map[string]*session),
+	}
+}
+
+// create logs the user in, and returns the id of the new session
+func (s *sessions) create(userID string, username string) string {
+	id := randomToken()
+	s.m.Lock()
+	defer s.m.Unlock()
+	now := time.Now()
+	for id, session := range s.sessions {
+		if now.After(session.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[id] = &session{
+		UserID:   userID,
+		Username: username,
+		CSRF:     randomToken(),
+		Expires:  now.Add(sessionLifetime),
+	}
+	return id
+}
+
+// get returns a copy of the session, if it exists and has not expired
+func (s *sessions) get(id string) (session, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	current, ok := s.sessions[id]
+	if !ok || time.Now().After(current.Expires) {
+		return session{}, false
+	}
+	return *current, true
+}
+
+// flash stores a message shown on the next page of the session
+func (s *sessions) flash(id string, message string, isError bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if current, ok := s.sessions[id]; ok {
+		current.Flash = message
+		current.FlashError = isError
+	}
+}
+
+// takeFlash returns the message stored for the next page of the session, and forgets it
+func (s *sessions) takeFlash(id string) (string, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	current, ok := s.sessions[id]
+	if !ok {
+		return "", false
+	}
+	message, isError := current.Flash, current.FlashError
+	current.Flash, current.FlashError = "", false
+	return message, isError
+}
+
+func (s *sessions) delete(id string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.sessions, id)
+}
+
+// validCSRF checks if the token submitted with a form matches the session
+func (s session) validCSRF(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.CSRF)) == 1
+}
+
+// randomToken returns a random, url safe token
+func randomToken() string {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		panic(fmt.Errorf("unable to generate token: %w", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// discordUser is the part of the discord user, the dashboard needs
+type discordUser struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+}
+
+// authorizeURL returns the url users are sent to, to log in with discord
+func (d *Dashboard) authorizeURL(state string) string {
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {d.config.ClientID},
+		"scope":         {"identify"},
+		"state":         {state},
+		"redirect_uri":  {d.redirectURL()},
+		"prompt":        {"none"},
+	}
+	return discordAuthorizeURL + "?" + query.Encode()
+}
+
+func (d *Dashboard) redirectURL() string {
+	return strings.TrimSuffix(d.config.BaseURL, "/") + "/callback"
+}
+
+// exchange exchanges the code discord redirected the user with, for the user who logged in
+func (d *Dashboard) exchange(ctx context.Context, code string) (*discordUser, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {d.redirectURL()},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discordTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(d.config.ClientID, d.config.ClientSecret)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}
+	if err := d.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("unable to exchange code: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("discord returned no access token")
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, discordUserURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	var user discordUser
+	if err := d.doJSON(req, &user); err != nil {
+		return nil, fmt.Errorf("unable to fetch user: %w", err)
+	}
+	return &user, nil
+}
+
+// doJSON sends the request, and decodes the JSON response into v
+func (d *Dashboard) doJSON(req *http.Request, v any) error {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// handleLogin sends the user to discord to log in
+func (d *Dashboard) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(stateLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   d.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, d.authorizeURL(state), http.StatusFound)
+}
+
+// handleCallback logs the user in, once discord redirects them back
+func (d *Dashboard) handleCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil || r.URL.Query().Get("state") == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.URL.Query().Get("state"))) != 1 {
+		http.Error(w, "Login expired, try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/", MaxAge: -1})
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		// The user declined to log in
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	user, err := d.exchange(r.Context(), code)
+	if err != nil {
+		d.logError("unable to log in with discord", err)
+		http.Error(w, "Unable to log in with Discord, try again", http.StatusBadGateway)
+		return
+	}
+
+	username := user.GlobalName
+	if username == "" {
+		username = user.Username
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    d.sessions.create(user.ID, username),
+		Path:     "/",
+		MaxAge:   int(sessionLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   d.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// handleLogout logs the user out
+func (d *Dashboard) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if id, current, ok := d.session(r); ok && current.validCSRF(r.PostFormValue("csrf")) {
+		d.sessions.delete(id)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// session returns the session of the request, if the user is logged in
+func (d *Dashboard) session(r *http.Request) (string, session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", session{}, false
+	}
+	current, ok := d.sessions.get(cookie.Value)
+	return cookie.Value, current, ok
+}
+
+// secureCookies checks if cookies should only be sent over https
+func (d *Dashboard) secureCookies() bool {
+	return strings.HasPrefix(d.config.BaseURL, "https://")
+}
@@ -0,0 +1,280 @@
+// Package dashboard is a web dashboard for server admins, who log in with discord to manage the settings of their servers
+package dashboard
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+	"github.com/vennekilde/gw2-alliance-bot/internal/guild"
+	"github.com/vennekilde/gw2-alliance-bot/internal/webhook"
+	"go.uber.org/zap"
+)
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+// Config configures the dashboard
+type Config struct {
+	// Addr is the address the dashboard listens on, e.g. ":8080". The dashboard is disabled if empty
+	Addr string
+	// BaseURL is the public url of the dashboard, which discord redirects users to after logging in
+	BaseURL string
+	// ClientID and ClientSecret are the OAuth2 credentials of the discord application
+	ClientID     string
+	ClientSecret string
+}
+
+// Validate checks if the settings needed to log in with discord are set, when the dashboard is enabled
+func (c Config) Validate() error {
+	if c.Addr == "" {
+		return nil
+	}
+	var missing []string
+	if c.BaseURL == "" {
+		missing = append(missing, "BaseURL")
+	}
+	if c.ClientID == "" {
+		missing = append(missing, "ClientID")
+	}
+	if c.ClientSecret == "" {
+		missing = append(missing, "ClientSecret")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("dashboard is enabled, but %s is not set", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Dashboard serves the web dashboard
+type Dashboard struct {
+	config       Config
+	discord      *discordgo.Session
+	service      *backend.Service
+	cache        *discord.Cache
+	guilds       *guild.Guilds
+	audit        *audit.Log
+	webhooks     *webhook.Dispatcher
+	reconcile    func(guildID string) error
+	pending      func(guildID string) int
+	commandNames func() []string
+
+	sessions  *sessions
+	client    *http.Client
+	server    *http.Server
+	templates map[string]*template.Template
+}
+
+// NewDashboard creates the dashboard. reconcile schedules every member of a server to be reconciled, and pending returns
+// the number of members of a server waiting to be reconciled
+func NewDashboard(config Config, discord *discordgo.Session, service *backend.Service, cache *discord.Cache, guilds *guild.Guilds, auditLog *audit.Log, webhooks *webhook.Dispatcher, reconcile func(guildID string) error, pending func(guildID string) int, commandNames func() []string) *Dashboard {
+	d := &Dashboard{
+		config:       config,
+		discord:      discord,
+		service:      service,
+		cache:        cache,
+		guilds:       guilds,
+		audit:        auditLog,
+		webhooks:     webhooks,
+		reconcile:    reconcile,
+		pending:      pending,
+		commandNames: commandNames,
+		sessions:     newSessions(),
+		client:       &http.Client{Timeout: 10 * time.Second},
+		templates:    parseTemplates("index.html", "server.html"),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", d.handleIndex)
+	mux.HandleFunc("GET /login", d.handleLogin)
+	mux.HandleFunc("GET /callback", d.handleCallback)
+	mux.HandleFunc("POST /logout", d.handleLogout)
+	mux.HandleFunc("GET /servers/{guildID}", d.handleServer)
+	mux.HandleFunc("POST /servers/{guildID}/settings/{name}", d.handleSetting)
+	mux.HandleFunc("POST /servers/{guildID}/reconcile", d.handleReconcile)
+	mux.HandleFunc("POST /servers/{guildID}/webhooks/secret", d.handleWebhookSecret)
+
+	d.server = &http.Server{
+		Addr:              config.Addr,
+		Handler:           securityHeaders(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return d
+}
+
+// parseTemplates parses each page along with the layout it is rendered in
+func parseTemplates(pages ...string) map[string]*template.Template {
+	templates := make(map[string]*template.Template, len(pages))
+	for _, page := range pages {
+		templates[page] = template.Must(template.New("").Funcs(template.FuncMap{
+			"formatTime": func(t time.Time) string {
+				return t.UTC().Format("2006-01-02 15:04 UTC")
+			},
+		}).ParseFS(templatesFS, "templates/layout.html", "templates/"+page))
+	}
+	return templates
+}
+
+// Start serves the dashboard in the background
+func (d *Dashboard) Start() {
+	go func() {
+		zap.L().Info("serving dashboard", zap.String("addr", d.config.Addr), zap.String("url", d.config.BaseURL))
+		err := d.server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Error("unable to serve dashboard", zap.Error(err))
+		}
+	}()
+}
+
+// Close stops serving the dashboard, waiting shortly for requests being handled
+func (d *Dashboard) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return d.server.Shutdown(ctx)
+}
+
+// securityHeaders keeps the dashboard from being framed by other sites, and from loading scripts
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src https://cdn.discordapp.com; form-action 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "same-origin")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// page is the data every page is rendered with
+type page struct {
+	Username   string
+	CSRF       string
+	Flash      string
+	FlashError bool
+}
+
+// serverLink is a server listed on the front page
+type serverLink struct {
+	ID   string
+	Name string
+	Icon string
+}
+
+type indexPage struct {
+	page
+	LoggedIn bool
+	Servers  []serverLink
+}
+
+// handleIndex lists the servers the user administers, or asks them to log in
+func (d *Dashboard) handleIndex(w http.ResponseWriter, r *http.Request) {
+	id, current, ok := d.session(r)
+	if !ok {
+		d.render(w, "index.html", indexPage{})
+		return
+	}
+
+	data := indexPage{
+		page:     d.page(id, current),
+		LoggedIn: true,
+	}
+	for _, server := range discord.Guilds(d.discord) {
+		if !d.canManage(server, current.UserID) {
+			continue
+		}
+		data.Servers = append(data.Servers, serverLink{
+			ID:   server.ID,
+			Name: server.Name,
+			Icon: server.IconURL("64"),
+		})
+	}
+	sort.Slice(data.Servers, func(i, j int) bool {
+		return data.Servers[i].Name < data.Servers[j].Name
+	})
+	d.render(w, "index.html", data)
+}
+
+// page returns the data every page is rendered with, taking the flash message of the session
+func (d *Dashboard) page(id string, current session) page {
+	flash, isError := d.sessions.takeFlash(id)
+	return page{
+		Username:   current.Username,
+		CSRF:       current.CSRF,
+		Flash:      flash,
+		FlashError: isError,
+	}
+}
+
+func (d *Dashboard) render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	err := d.templates[name].ExecuteTemplate(w, "layout", data)
+	if err != nil {
+		zap.L().Error("unable to render dashboard page", zap.String("page", name), zap.Error(err))
+	}
+}
+
+// authorize returns the session and server of the request, if the user is logged in and may manage the server.
+// Otherwise an error is written, and ok is false
+func (d *Dashboard) authorize(w http.ResponseWriter, r *http.Request) (id string, current session, server *discordgo.Guild, ok bool) {
+	id, current, ok = d.session(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return "", session{}, nil, false
+	}
+	server, err := d.discord.State.Guild(r.PathValue("guildID"))
+	if err != nil || !d.canManage(server, current.UserID) {
+		// Do not reveal which servers the bot is a member of
+		http.NotFound(w, r)
+		return "", session{}, nil, false
+	}
+	if r.Method == http.MethodPost && !current.validCSRF(r.PostFormValue("csrf")) {
+		http.Error(w, "Form expired, reload the page and try again", http.StatusForbidden)
+		return "", session{}, nil, false
+	}
+	return id, current, server, true
+}
+
+// canManage checks if the user may manage the settings of the server, which is looked up live,
+// so users lose access as soon as they lose their roles
+func (d *Dashboard) canManage(server *discordgo.Guild, userID string) bool {
+	if server.OwnerID == userID {
+		return true
+	}
+	member, err := d.cache.GetMember(server.ID, userID)
+	if err != nil || member == nil {
+		return false
+	}
+	return CanManage(server, member, d.service.GetRoles(server.ID, backend.SettingCommandsAdminRoles))
+}
+
+// CanManage checks if the member is the owner or an administrator of the server, or has one of the admin roles
+func CanManage(server *discordgo.Guild, member *discordgo.Member, adminRoles []string) bool {
+	if member.User != nil && member.User.ID == server.OwnerID {
+		return true
+	}
+	for _, role := range server.Roles {
+		// The @everyone role has the id of the server
+		if role.ID != server.ID && !slices.Contains(member.Roles, role.ID) {
+			continue
+		}
+		if role.Permissions&discordgo.PermissionAdministrator != 0 || slices.Contains(adminRoles, role.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dashboard) logError(msg string, err error) {
+	zap.L().Error(msg, zap.Error(err))
+}
@@ -0,0 +1,143 @@
+package dashboard
+
+import (
+	"io"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/diagnose"
+	"github.com/vennekilde/gw2-alliance-bot/internal/webhook"
+)
+
+func TestCanManage(t *testing.T) {
+	g := NewGomegaWithT(t)
+	server := &discordgo.Guild{
+		ID:      "1",
+		OwnerID: "10",
+		Roles: []*discordgo.Role{
+			{ID: "1"},
+			{ID: "2", Permissions: discordgo.PermissionAdministrator},
+			{ID: "3"},
+		},
+	}
+
+	g.Expect(CanManage(server, &discordgo.Member{User: &discordgo.User{ID: "10"}}, nil)).To(BeTrue())
+	g.Expect(CanManage(server, &discordgo.Member{User: &discordgo.User{ID: "11"}, Roles: []string{"2"}}, nil)).To(BeTrue())
+	g.Expect(CanManage(server, &discordgo.Member{User: &discordgo.User{ID: "11"}, Roles: []string{"3"}}, nil)).To(BeFalse())
+	g.Expect(CanManage(server, &discordgo.Member{User: &discordgo.User{ID: "11"}, Roles: []string{"3"}}, []string{"3"})).To(BeTrue())
+
+	// Administrator granted to @everyone applies to every member
+	server.Roles[0].Permissions = discordgo.PermissionAdministrator
+	g.Expect(CanManage(server, &discordgo.Member{User: &discordgo.User{ID: "11"}}, nil)).To(BeTrue())
+}
+
+func TestConfigValidate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// A disabled dashboard needs nothing else
+	g.Expect(Config{}.Validate()).To(Succeed())
+
+	config := Config{Addr: ":8080", BaseURL: "https://example.com", ClientID: "id", ClientSecret: "secret"}
+	g.Expect(config.Validate()).To(Succeed())
+
+	config.ClientSecret = ""
+	config.BaseURL = ""
+	err := config.Validate()
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("BaseURL, ClientSecret"))
+}
+
+func TestBuildField(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := fieldContext{
+		ServerID: "1",
+		Roles: []*discordgo.Role{
+			{ID: "1", Name: "@everyone"},
+			{ID: "2", Name: "[TEST] Test Guild", Position: 1},
+			{ID: "3", Name: "Verified", Position: 2},
+			{ID: "4", Name: "Bot", Position: 3, Managed: true},
+		},
+	}
+
+	definition, _ := backend.LookupSetting(backend.SettingAssociatedRoles)
+	f := buildField(definition, "3,5", ctx)
+	g.Expect(f.Kind).To(Equal(fieldMultiSelect))
+	g.Expect(f.Options).To(Equal([]option{
+		{Value: "3", Label: "Verified", Selected: true},
+		{Value: "2", Label: "[TEST] Test Guild"},
+		// Deleted roles are kept, so saving does not drop them
+		{Value: "5", Label: "5 (unknown)", Selected: true},
+	}))
+
+	definition, _ = backend.LookupSetting(backend.SettingGuildVerifyRoles)
+	f = buildField(definition, "", ctx)
+	g.Expect(f.Options).To(Equal([]option{{Value: "2", Label: "[TEST] Test Guild"}}))
+
+	definition, _ = backend.LookupSetting(backend.SettingAccRepEnabled)
+	f = buildField(definition, "true", ctx)
+	g.Expect(f.Kind).To(Equal(fieldSelect))
+	g.Expect(f.Options).To(HaveLen(3))
+	g.Expect(f.Options[1]).To(Equal(option{Value: "true", Label: "Yes", Selected: true}))
+
+	definition, _ = backend.LookupSetting(backend.SettingPolicyGraceHours)
+	g.Expect(buildField(definition, "", ctx).Kind).To(Equal(fieldNumber))
+}
+
+func TestParseValue(t *testing.T) {
+	g := NewGomegaWithT(t)
+	definition, _ := backend.LookupSetting(backend.SettingAssociatedRoles)
+	g.Expect(parseValue(definition, url.Values{"value": {"3", " 2 ", "", "3"}})).To(Equal("3,2"))
+	g.Expect(parseValue(definition, url.Values{})).To(Equal(""))
+
+	definition, _ = backend.LookupSetting(backend.SettingPolicyGraceHours)
+	g.Expect(parseValue(definition, url.Values{"value": {" 12 "}})).To(Equal("12"))
+}
+
+func TestReplaceMentions(t *testing.T) {
+	g := NewGomegaWithT(t)
+	lookup := func(kind string, id string) string {
+		return kind + "name" + id
+	}
+	g.Expect(replaceMentions("Drag <@&1> above <@&2> for <@!3> in <#4>", lookup)).To(Equal("Drag @&name1 above @&name2 for @name3 in #name4"))
+}
+
+func TestSessionFlash(t *testing.T) {
+	g := NewGomegaWithT(t)
+	s := newSessions()
+	id := s.create("1", "user")
+
+	current, ok := s.get(id)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(current.validCSRF(current.CSRF)).To(BeTrue())
+	g.Expect(current.validCSRF("")).To(BeFalse())
+
+	s.flash(id, "Saved", false)
+	message, isError := s.takeFlash(id)
+	g.Expect(message).To(Equal("Saved"))
+	g.Expect(isError).To(BeFalse())
+	message, _ = s.takeFlash(id)
+	g.Expect(message).To(BeEmpty())
+
+	s.delete(id)
+	_, ok = s.get(id)
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestTemplates(t *testing.T) {
+	g := NewGomegaWithT(t)
+	templates := parseTemplates("index.html", "server.html")
+
+	g.Expect(templates["index.html"].ExecuteTemplate(io.Discard, "layout", indexPage{LoggedIn: true, Servers: []serverLink{{ID: "1", Name: "Server"}}})).To(Succeed())
+	g.Expect(templates["server.html"].ExecuteTemplate(io.Discard, "layout", serverPage{
+		page:     page{Username: "user", Flash: "Saved"},
+		Fields:   []field{{Name: "name", Kind: fieldMultiSelect, Options: []option{{Value: "1", Label: "Role"}}}, {Name: "hours", Kind: fieldNumber}},
+		Mappings: []diagnose.GuildRoleMapping{{RoleName: "[TEST] Test Guild"}},
+		History:  []historyEntry{{Time: time.Now(), Name: "name"}},
+		Audit:    []auditEntry{{Time: time.Now(), Action: "Role added"}},
+		Webhooks: webhooks{URLs: []string{"https://example.com/hook"}, Secret: "secret", DeadLetters: []webhook.DeadLetter{{EventType: webhook.EventNickChanged}}},
+	})).To(Succeed())
+}
@@ -0,0 +1,441 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/diagnose"
+	"github.com/vennekilde/gw2-alliance-bot/internal/webhook"
+	"github.com/vennekilde/gw2-alliance-bot/internal/world"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+// Kinds of form fields settings are edited with
+const (
+	fieldSelect      = "select"
+	fieldMultiSelect = "multiselect"
+	fieldNumber      = "number"
+	fieldText        = "text"
+)
+
+// option is an option of a select field
+type option struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+// field is the form field a setting is edited with
+type field struct {
+	Name        string
+	Description string
+	Kind        string
+	Value       string
+	Min         int
+	Options     []option
+}
+
+// fieldContext is what is known about the server, needed to list the options of fields
+type fieldContext struct {
+	ServerID     string
+	Roles        []*discordgo.Role
+	Channels     []*discordgo.Channel
+	CommandNames []string
+}
+
+// buildField returns the form field the setting is edited with, with value selected
+func buildField(definition backend.SettingDefinition, value string, ctx fieldContext) field {
+	f := field{
+		Name:        definition.Name,
+		Description: definition.Description,
+		Kind:        fieldSelect,
+		Value:       value,
+		Min:         definition.Min,
+	}
+	selected := strings.Split(value, ",")
+	add := func(value string, label string) {
+		f.Options = append(f.Options, option{Value: value, Label: label, Selected: slices.Contains(selected, value)})
+	}
+	// Single value settings may be unset, which uses their default
+	unset := func() {
+		label := "Not set"
+		if definition.Default != "" {
+			label = fmt.Sprintf("Default (%s)", definition.Default)
+		}
+		add("", label)
+	}
+
+	switch definition.Type {
+	case backend.SettingTypeBool:
+		unset()
+		add("true", "Yes")
+		add("false", "No")
+	case backend.SettingTypeEnum:
+		unset()
+		for _, value := range definition.Values {
+			add(value, value)
+		}
+	case backend.SettingTypeInt:
+		f.Kind = fieldNumber
+	case backend.SettingTypeRole, backend.SettingTypeRoleList:
+		roles := assignableRoles(ctx.ServerID, ctx.Roles)
+		if definition.Name == backend.SettingGuildVerifyRoles {
+			roles = diagnose.GuildRoles(roles)
+		}
+		if definition.Type == backend.SettingTypeRole {
+			unset()
+		} else {
+			f.Kind = fieldMultiSelect
+		}
+		for _, role := range roles {
+			add(role.ID, role.Name)
+		}
+	case backend.SettingTypeChannel:
+		unset()
+		for _, channel := range ctx.Channels {
+			if channel.Type == discordgo.ChannelTypeGuildText || channel.Type == discordgo.ChannelTypeGuildNews {
+				add(channel.ID, "#"+channel.Name)
+			}
+		}
+	case backend.SettingTypeWorld:
+		unset()
+		add(backend.WorldDisabled, "Disabled")
+		for _, w := range world.WorldsSorted() {
+			add(strconv.Itoa(w.ID), w.Name)
+		}
+		teams := make([]world.Team, 0, len(world.TeamNames))
+		for _, team := range world.TeamNames {
+			teams = append(teams, team)
+		}
+		sort.Slice(teams, func(i, j int) bool {
+			return teams[i].Name < teams[j].Name
+		})
+		for _, team := range teams {
+			add(strconv.Itoa(team.WorldEquivalentID), fmt.Sprintf("%s (%s)", team.Name, world.WorldNames[team.WorldEquivalentID].Name))
+		}
+	case backend.SettingTypePermissionList:
+		f.Kind = fieldMultiSelect
+		for _, permission := range backend.APIKeyPermissions {
+			add(permission, permission)
+		}
+	case backend.SettingTypeCommandList:
+		f.Kind = fieldMultiSelect
+		for _, name := range ctx.CommandNames {
+			add(name, "/"+name)
+		}
+	default:
+		f.Kind = fieldText
+	}
+
+	// Keep values that are no longer listed, e.g. deleted roles, so saving the form does not silently drop them
+	if f.Kind == fieldSelect || f.Kind == fieldMultiSelect {
+		for _, value := range selected {
+			if value != "" && !slices.ContainsFunc(f.Options, func(o option) bool { return o.Value == value }) {
+				add(value, value+" (unknown)")
+			}
+		}
+	}
+	return f
+}
+
+// assignableRoles returns the roles of the server that can be given to members, highest first
+func assignableRoles(serverID string, roles []*discordgo.Role) []*discordgo.Role {
+	assignable := make([]*discordgo.Role, 0, len(roles))
+	for _, role := range roles {
+		// The @everyone role has the id of the server
+		if role.ID != serverID && !role.Managed {
+			assignable = append(assignable, role)
+		}
+	}
+	sort.Slice(assignable, func(i, j int) bool {
+		return assignable[i].Position > assignable[j].Position
+	})
+	return assignable
+}
+
+// parseValue returns the value of the setting submitted with the form. Lists are stored comma separated
+func parseValue(definition backend.SettingDefinition, form url.Values) string {
+	switch definition.Type {
+	case backend.SettingTypeRoleList, backend.SettingTypePermissionList, backend.SettingTypeCommandList:
+		values := make([]string, 0, len(form["value"]))
+		for _, value := range form["value"] {
+			value = strings.TrimSpace(value)
+			if value != "" && !slices.Contains(values, value) {
+				values = append(values, value)
+			}
+		}
+		return strings.Join(values, ",")
+	default:
+		return strings.TrimSpace(form.Get("value"))
+	}
+}
+
+// mentionRegex matches user, role and channel mentions
+var mentionRegex = regexp.MustCompile(`<(@&|@!?|#)(\d+)>`)
+
+// replaceMentions replaces the mentions in text with the names lookup returns for them
+func replaceMentions(text string, lookup func(kind string, id string) string) string {
+	return mentionRegex.ReplaceAllStringFunc(text, func(mention string) string {
+		match := mentionRegex.FindStringSubmatch(mention)
+		kind := match[1]
+		if kind == "@!" {
+			kind = "@"
+		}
+		return lookup(kind, match[2])
+	})
+}
+
+// names looks up the names of the roles, channels and members of a server
+type names struct {
+	session *discordgo.Session
+	server  *discordgo.Guild
+}
+
+// lookup returns the name of the role, channel or member, as shown in discord
+func (n names) lookup(kind string, id string) string {
+	switch kind {
+	case "@&":
+		for _, role := range n.server.Roles {
+			if role.ID == id {
+				return "@" + role.Name
+			}
+		}
+	case "#":
+		for _, channel := range n.server.Channels {
+			if channel.ID == id {
+				return "#" + channel.Name
+			}
+		}
+	case "@":
+		if member, err := n.session.State.Member(n.server.ID, id); err == nil && member.User != nil {
+			if member.Nick != "" {
+				return "@" + member.Nick
+			}
+			return "@" + member.User.Username
+		}
+	}
+	return kind + id
+}
+
+func (n names) text(text string) string {
+	return replaceMentions(text, n.lookup)
+}
+
+// value formats the value of the setting, showing names instead of ids
+func (n names) value(name string, value string) string {
+	if value == "" {
+		return "not set"
+	}
+	definition, _ := backend.LookupSetting(name)
+	switch definition.Type {
+	case backend.SettingTypeRole, backend.SettingTypeRoleList:
+		ids := strings.Split(value, ",")
+		for i, id := range ids {
+			ids[i] = n.lookup("@&", id)
+		}
+		return strings.Join(ids, ", ")
+	case backend.SettingTypeChannel:
+		return n.lookup("#", value)
+	case backend.SettingTypeWorld:
+		if worldID, err := strconv.Atoi(value); err == nil {
+			if w, ok := world.WorldNames[worldID]; ok {
+				return w.Name
+			}
+		}
+	}
+	return value
+}
+
+// historyEntry is a change of a setting, as shown on the server page
+type historyEntry struct {
+	Time     time.Time
+	Name     string
+	OldValue string
+	NewValue string
+	Actor    string
+}
+
+// auditEntry is a change made to a member, as shown on the server page
+type auditEntry struct {
+	Time   time.Time
+	Action string
+	Member string
+	Detail string
+	Reason string
+}
+
+type serverPage struct {
+	page
+	ID       string
+	Name     string
+	Icon     string
+	Pending  int
+	Fields   []field
+	Mappings []diagnose.GuildRoleMapping
+	History  []historyEntry
+	Audit    []auditEntry
+	Webhooks webhooks
+}
+
+// webhooks are the webhooks of the server, the secret events are signed with and the deliveries that were given up
+type webhooks struct {
+	URLs        []string
+	Secret      string
+	DeadLetters []webhook.DeadLetter
+}
+
+// handleServer shows the settings, guild role mappings and recent changes of the server
+func (d *Dashboard) handleServer(w http.ResponseWriter, r *http.Request) {
+	id, current, server, ok := d.authorize(w, r)
+	if !ok {
+		return
+	}
+	n := names{session: d.discord, server: server}
+
+	data := serverPage{
+		page:    d.page(id, current),
+		ID:      server.ID,
+		Name:    server.Name,
+		Icon:    server.IconURL("64"),
+		Pending: d.pending(server.ID),
+	}
+
+	ctx := fieldContext{
+		ServerID:     server.ID,
+		Roles:        server.Roles,
+		Channels:     server.Channels,
+		CommandNames: d.commandNames(),
+	}
+	settings := d.service.GetSettings(server.ID)
+	for _, definition := range backend.SettingDefinitions() {
+		if definition.Internal {
+			continue
+		}
+		data.Fields = append(data.Fields, buildField(definition, settings[definition.Name], ctx))
+	}
+
+	data.Mappings = diagnose.GuildRoleMappings(d.service, d.guilds, server.ID, server.Roles)
+	data.Webhooks = webhooks{
+		URLs: d.service.GetURLs(server.ID, backend.SettingWebhookURLs),
+		// Read the setting, rather than generating a secret just by looking at the page
+		Secret:      d.service.GetSetting(server.ID, backend.SettingWebhookSecret),
+		DeadLetters: d.webhooks.DeadLetters(server.ID),
+	}
+
+	for _, entry := range d.service.History().Entries(server.ID) {
+		actor := "the bot"
+		if entry.Actor != "" {
+			actor = n.lookup("@", entry.Actor)
+		}
+		data.History = append(data.History, historyEntry{
+			Time:     entry.Time,
+			Name:     entry.Name,
+			OldValue: n.value(entry.Name, entry.OldValue),
+			NewValue: n.value(entry.Name, entry.NewValue),
+			Actor:    actor,
+		})
+	}
+
+	for _, change := range d.audit.Recent(server.ID) {
+		entry := auditEntry{
+			Time:   change.Time,
+			Action: resources.T("audit.actions." + string(change.Action)),
+			Member: n.lookup("@", change.UserID),
+		}
+		switch change.Action {
+		case audit.ActionRoleAdded, audit.ActionRoleRemoved:
+			entry.Detail = n.lookup("@&", change.RoleID)
+		case audit.ActionNickChanged:
+			entry.Detail = fmt.Sprintf("%s → %s", change.Before, change.After)
+		}
+		if change.Reason != "" {
+			entry.Reason = n.text(resources.T(change.Reason, change.ReasonData))
+		}
+		data.Audit = append(data.Audit, entry)
+	}
+
+	d.render(w, "server.html", data)
+}
+
+// handleSetting saves a setting of the server, after the same checks as the settings command
+func (d *Dashboard) handleSetting(w http.ResponseWriter, r *http.Request) {
+	id, current, server, ok := d.authorize(w, r)
+	if !ok {
+		return
+	}
+	redirect := fmt.Sprintf("/servers/%s#%s", server.ID, url.PathEscape(r.PathValue("name")))
+	defer http.Redirect(w, r, redirect, http.StatusSeeOther)
+
+	definition, ok := backend.LookupSetting(r.PathValue("name"))
+	if !ok || definition.Internal {
+		d.sessions.flash(id, "Unknown setting", true)
+		return
+	}
+	value := parseValue(definition, r.PostForm)
+	if err := definition.Validate(value); err != nil {
+		d.sessions.flash(id, err.Error(), true)
+		return
+	}
+	n := names{session: d.discord, server: server}
+	if problems := diagnose.CheckSetting(d.discord, server.ID, definition.Name, value); len(problems) > 0 {
+		var sb strings.Builder
+		sb.WriteString("The setting was not saved. ")
+		for _, problem := range problems {
+			sb.WriteString(n.text(resources.T(problem.Reason, problem.Data)) + ": " + n.text(resources.T(problem.Fix, problem.Data)) + ". ")
+		}
+		d.sessions.flash(id, strings.TrimSpace(sb.String()), true)
+		return
+	}
+
+	ctx := backend.WithActor(context.Background(), current.UserID)
+	if err := d.service.SetSetting(ctx, server.ID, definition.Name, value); err != nil {
+		zap.L().Error("unable to save setting from dashboard", zap.String("guild id", server.ID), zap.String("setting", definition.Name), zap.Error(err))
+		d.sessions.flash(id, "Unable to save the setting, try again", true)
+		return
+	}
+	zap.L().Info("setting changed from dashboard", zap.String("guild id", server.ID), zap.String("user id", current.UserID), zap.String("setting", definition.Name), zap.String("value", value))
+	d.sessions.flash(id, fmt.Sprintf("Saved %s: %s", definition.Name, n.value(definition.Name, value)), false)
+}
+
+// handleReconcile schedules every member of the server to be reconciled
+func (d *Dashboard) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	id, _, server, ok := d.authorize(w, r)
+	if !ok {
+		return
+	}
+	if err := d.reconcile(server.ID); err != nil {
+		zap.L().Error("unable to reconcile server from dashboard", zap.String("guild id", server.ID), zap.Error(err))
+		d.sessions.flash(id, "Unable to reconcile the members, try again", true)
+	} else {
+		d.sessions.flash(id, "Every member is being reconciled", false)
+	}
+	http.Redirect(w, r, "/servers/"+server.ID, http.StatusSeeOther)
+}
+
+// handleWebhookSecret replaces the secret webhook events of the server are signed with
+func (d *Dashboard) handleWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	id, current, server, ok := d.authorize(w, r)
+	if !ok {
+		return
+	}
+	_, err := d.webhooks.RotateSecret(backend.WithActor(context.Background(), current.UserID), server.ID)
+	if err != nil {
+		zap.L().Error("unable to rotate webhook secret from dashboard", zap.String("guild id", server.ID), zap.Error(err))
+		d.sessions.flash(id, "Unable to generate a new webhook secret, try again", true)
+	} else {
+		d.sessions.flash(id, "Generated a new webhook secret. Update your webhooks, as events are no longer signed with the old one", false)
+	}
+	http.Redirect(w, r, "/servers/"+server.ID+"#webhooks", http.StatusSeeOther)
+}
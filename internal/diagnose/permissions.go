@@ -0,0 +1,244 @@
+package diagnose
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"go.uber.org/zap"
+)
+
+// Problem is something keeping the bot from managing the members of a server.
+// Reason and Fix are translation keys explaining the problem and how to fix it, with Data as template data
+type Problem struct {
+	Reason string
+	Fix    string
+	Data   map[string]interface{}
+}
+
+// allPermissions are the permissions of administrators and the owner of a server.
+// discordgo.PermissionAll leaves out permissions like Manage Nicknames
+const allPermissions = ^int64(0)
+
+// Server is what is known about a server, needed to check if the bot can manage its members
+type Server struct {
+	ID      string
+	OwnerID string
+	Roles   []*discordgo.Role
+	// Bot is the member of the bot on the server
+	Bot *discordgo.Member
+}
+
+// LoadServer looks up the roles of the server and the member of the bot, preferring the state of the session over requests to discord
+func LoadServer(s *discordgo.Session, guildID string) (*Server, error) {
+	server, err := s.State.Guild(guildID)
+	if err != nil {
+		server, err = s.Guild(guildID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	roles := server.Roles
+	if len(roles) == 0 {
+		roles, err = s.GuildRoles(guildID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	bot, err := s.State.Member(guildID, s.State.User.ID)
+	if err != nil {
+		bot, err = s.GuildMember(guildID, s.State.User.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Server{
+		ID:      guildID,
+		OwnerID: server.OwnerID,
+		Roles:   roles,
+		Bot:     bot,
+	}, nil
+}
+
+func (s *Server) role(roleID string) *discordgo.Role {
+	for _, role := range s.Roles {
+		if role.ID == roleID {
+			return role
+		}
+	}
+	return nil
+}
+
+// Permissions returns the server wide permissions of the bot
+func (s *Server) Permissions() int64 {
+	if s.Bot.User != nil && s.Bot.User.ID == s.OwnerID {
+		return allPermissions
+	}
+
+	var permissions int64
+	for _, role := range s.Roles {
+		// The @everyone role has the id of the server
+		if role.ID == s.ID || slices.Contains(s.Bot.Roles, role.ID) {
+			permissions |= role.Permissions
+		}
+	}
+	if permissions&discordgo.PermissionAdministrator != 0 {
+		return allPermissions
+	}
+	return permissions
+}
+
+// HighestRole returns the highest role of the bot, which roles have to be below to be managed by the bot
+func (s *Server) HighestRole() *discordgo.Role {
+	var highest *discordgo.Role
+	for _, roleID := range s.Bot.Roles {
+		role := s.role(roleID)
+		if role != nil && (highest == nil || role.Position > highest.Position) {
+			highest = role
+		}
+	}
+	return highest
+}
+
+// CheckPermissions checks if the bot has the permissions needed to manage roles, and nicks if nicks is true
+func (s *Server) CheckPermissions(nicks bool) []Problem {
+	var problems []Problem
+	permissions := s.Permissions()
+	if permissions&discordgo.PermissionManageRoles == 0 {
+		problems = append(problems, Problem{
+			Reason: "diagnose.problems.manage_roles",
+			Fix:    "diagnose.fixes.grant_permission",
+			Data:   map[string]interface{}{"permission": "Manage Roles"},
+		})
+	}
+	if nicks && permissions&discordgo.PermissionManageNicknames == 0 {
+		problems = append(problems, Problem{
+			Reason: "diagnose.problems.manage_nicknames",
+			Fix:    "diagnose.fixes.grant_permission",
+			Data:   map[string]interface{}{"permission": "Manage Nicknames"},
+		})
+	}
+	return problems
+}
+
+// CheckRoles checks if the bot is able to add and remove the roles. Roles that do not exist are skipped
+func (s *Server) CheckRoles(roleIDs []string) []Problem {
+	var problems []Problem
+	highest := s.HighestRole()
+	for _, roleID := range roleIDs {
+		role := s.role(roleID)
+		if role == nil {
+			continue
+		}
+
+		switch {
+		case role.Managed:
+			problems = append(problems, Problem{
+				Reason: "diagnose.problems.managed_role",
+				Fix:    "diagnose.fixes.pick_other_role",
+				Data:   map[string]interface{}{"role": role.ID},
+			})
+		case highest == nil || role.Position >= highest.Position:
+			data := map[string]interface{}{"role": role.ID}
+			fix := "diagnose.fixes.add_bot_role"
+			if highest != nil {
+				data["botRole"] = highest.ID
+				fix = "diagnose.fixes.move_bot_role"
+			}
+			problems = append(problems, Problem{
+				Reason: "diagnose.problems.role_above_bot",
+				Fix:    fix,
+				Data:   data,
+			})
+		}
+	}
+	return problems
+}
+
+// ManagedRoles returns the roles the bot adds to or removes from members, based on the settings and guild roles of the server
+func (s *Server) ManagedRoles(service *backend.Service) []string {
+	var roleIDs []string
+	for _, definition := range backend.SettingDefinitions() {
+		// Exempt and admin roles are only read, never added or removed
+		if !definition.HoldsRoles() || definition.Name == backend.SettingPolicyExemptRoles || definition.Name == backend.SettingCommandsAdminRoles {
+			continue
+		}
+		for _, roleID := range service.GetRoles(s.ID, definition.Name) {
+			if !slices.Contains(roleIDs, roleID) {
+				roleIDs = append(roleIDs, roleID)
+			}
+		}
+	}
+	for _, role := range GuildRoles(s.Roles) {
+		if !slices.Contains(roleIDs, role.ID) {
+			roleIDs = append(roleIDs, role.ID)
+		}
+	}
+	return roleIDs
+}
+
+// NeedsNicks checks if the bot changes the nicks of members on the server
+func NeedsNicks(service *backend.Service, guildID string) bool {
+	return service.GetBool(guildID, backend.SettingAccRepEnabled) || service.GetBool(guildID, backend.SettingGuildTagRepEnabled)
+}
+
+// Check checks the permissions of the bot and every role it manages on the server
+func (s *Server) Check(service *backend.Service) []Problem {
+	problems := s.CheckPermissions(NeedsNicks(service, s.ID))
+	return append(problems, s.CheckRoles(s.ManagedRoles(service))...)
+}
+
+// SettingNeeds returns the roles the bot adds to or removes from members if the setting has the value,
+// and if it makes the bot set the nicks of members
+func SettingNeeds(name string, value string) (roleIDs []string, nicks bool) {
+	definition, ok := backend.LookupSetting(name)
+	if !ok || value == "" {
+		return nil, false
+	}
+	// Exempt and admin roles are only read, never added or removed
+	if definition.HoldsRoles() && name != backend.SettingPolicyExemptRoles && name != backend.SettingCommandsAdminRoles {
+		roleIDs = strings.Split(value, ",")
+	}
+	nicks = (name == backend.SettingAccRepEnabled || name == backend.SettingGuildTagRepEnabled) && value == "true"
+	return roleIDs, nicks
+}
+
+// CheckChannel checks if the channel belongs to the server, as settings are only validated to hold an id
+func CheckChannel(channel *discordgo.Channel, guildID string, channelID string) []Problem {
+	if channel != nil && channel.GuildID == guildID {
+		return nil
+	}
+	return []Problem{{
+		Reason: "diagnose.problems.foreign_channel",
+		Fix:    "diagnose.fixes.pick_other_channel",
+		Data:   map[string]interface{}{"channel": channelID},
+	}}
+}
+
+// CheckSetting checks if the bot is able to manage the roles and nicks the setting makes it manage, if it has the value,
+// and if a channel in the setting belongs to the server.
+// The server is only looked up if the setting needs checking, and is not checked if it cannot be looked up
+func CheckSetting(s *discordgo.Session, guildID string, name string, value string) []Problem {
+	if definition, ok := backend.LookupSetting(name); ok && definition.Type == backend.SettingTypeChannel && value != "" {
+		channel, err := s.State.Channel(value)
+		if err != nil {
+			channel, _ = s.Channel(value)
+		}
+		return CheckChannel(channel, guildID, value)
+	}
+
+	roleIDs, nicks := SettingNeeds(name, value)
+	if len(roleIDs) == 0 && !nicks {
+		return nil
+	}
+
+	server, err := LoadServer(s, guildID)
+	if err != nil {
+		zap.L().Warn("unable to check role hierarchy", zap.String("guild id", guildID), zap.Error(err))
+		return nil
+	}
+	problems := server.CheckPermissions(nicks)
+	return append(problems, server.CheckRoles(roleIDs)...)
+}
@@ -0,0 +1,93 @@
+package diagnose
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+)
+
+func testServer() *Server {
+	return &Server{
+		ID:      "guild",
+		OwnerID: "owner",
+		Roles: []*discordgo.Role{
+			{ID: "guild", Name: "@everyone", Position: 0},
+			{ID: "low", Name: "Verified", Position: 1},
+			{ID: "bot", Name: "Bot", Position: 2, Permissions: discordgo.PermissionManageRoles},
+			{ID: "high", Name: "Admin", Position: 3},
+			{ID: "integration", Name: "Integration", Position: 1, Managed: true},
+		},
+		Bot: &discordgo.Member{
+			User:  &discordgo.User{ID: "bot user"},
+			Roles: []string{"bot"},
+		},
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	g := NewGomegaWithT(t)
+	server := testServer()
+
+	g.Expect(server.CheckPermissions(false)).To(BeEmpty())
+
+	problems := server.CheckPermissions(true)
+	g.Expect(problems).To(HaveLen(1))
+	g.Expect(problems[0].Reason).To(Equal("diagnose.problems.manage_nicknames"))
+
+	// Administrators have every permission
+	server.Roles[0].Permissions = discordgo.PermissionAdministrator
+	g.Expect(server.CheckPermissions(true)).To(BeEmpty())
+}
+
+func TestCheckRoles(t *testing.T) {
+	g := NewGomegaWithT(t)
+	server := testServer()
+
+	problems := server.CheckRoles([]string{"low", "bot", "high", "integration", "deleted"})
+	g.Expect(problems).To(HaveLen(3))
+	g.Expect(problems[0].Reason).To(Equal("diagnose.problems.role_above_bot"))
+	g.Expect(problems[0].Data).To(HaveKeyWithValue("role", "bot"))
+	g.Expect(problems[0].Fix).To(Equal("diagnose.fixes.move_bot_role"))
+	g.Expect(problems[1].Data).To(HaveKeyWithValue("role", "high"))
+	g.Expect(problems[2].Reason).To(Equal("diagnose.problems.managed_role"))
+
+	// Without a role, the bot is unable to manage any role
+	server.Bot.Roles = nil
+	problems = server.CheckRoles([]string{"low"})
+	g.Expect(problems).To(HaveLen(1))
+	g.Expect(problems[0].Fix).To(Equal("diagnose.fixes.add_bot_role"))
+}
+
+func TestSettingNeeds(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	roleIDs, nicks := SettingNeeds(backend.SettingAssociatedRoles, "1,2")
+	g.Expect(roleIDs).To(Equal([]string{"1", "2"}))
+	g.Expect(nicks).To(BeFalse())
+
+	// Exempt roles are never given to or removed from members
+	roleIDs, _ = SettingNeeds(backend.SettingPolicyExemptRoles, "1")
+	g.Expect(roleIDs).To(BeEmpty())
+
+	roleIDs, nicks = SettingNeeds(backend.SettingAccRepEnabled, "true")
+	g.Expect(roleIDs).To(BeEmpty())
+	g.Expect(nicks).To(BeTrue())
+	_, nicks = SettingNeeds(backend.SettingAccRepEnabled, "false")
+	g.Expect(nicks).To(BeFalse())
+}
+
+func TestCheckChannel(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(CheckChannel(&discordgo.Channel{ID: "channel", GuildID: "guild"}, "guild", "channel")).To(BeEmpty())
+
+	problems := CheckChannel(&discordgo.Channel{ID: "channel", GuildID: "other guild"}, "guild", "channel")
+	g.Expect(problems).To(HaveLen(1))
+	g.Expect(problems[0].Reason).To(Equal("diagnose.problems.foreign_channel"))
+	g.Expect(problems[0].Data).To(HaveKeyWithValue("channel", "channel"))
+
+	// Channels that cannot be looked up are rejected as well
+	g.Expect(CheckChannel(nil, "guild", "channel")).To(HaveLen(1))
+}
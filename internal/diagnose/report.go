@@ -0,0 +1,280 @@
+package diagnose
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MrGunflame/gw2api"
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+	"github.com/vennekilde/gw2-alliance-bot/internal/guild"
+	"github.com/vennekilde/gw2-alliance-bot/internal/store"
+	"github.com/vennekilde/gw2-alliance-bot/internal/world"
+	"go.uber.org/zap"
+)
+
+// settingsStaleAfter is how long after the last synchronization the settings are reported as out of date.
+// Settings are synchronized every 5 minutes
+const settingsStaleAfter = 15 * time.Minute
+
+// verificationSaveInterval is how often changes to the verification status are written to disk.
+// Saving on every change would rewrite the whole file for every member while a server is reconciled
+const verificationSaveInterval = time.Minute
+
+// MissingRole is a role configured in a setting, that no longer exists on the server
+type MissingRole struct {
+	Setting string
+	RoleID  string
+}
+
+// Report is the health of the bot on a server
+type Report struct {
+	// Problems keep the bot from managing roles or nicks
+	Problems               []Problem
+	WorldEnabled           bool
+	WorldLinksSynchronized bool
+	SettingsSynchronizedAt time.Time
+	SettingsStale          bool
+	// UnknownGuildRoles are guild roles that match no guild known to the bot
+	UnknownGuildRoles  []string
+	MissingRoles       []MissingRole
+	MultipleGuildRoles []string
+	MembersLoaded      bool
+	Members            int
+	Verified           int
+	Unverified         int
+}
+
+// Diagnoser builds health reports of servers
+type Diagnoser struct {
+	service      *backend.Service
+	cache        *discord.Cache
+	guilds       *guild.Guilds
+	worlds       *world.Worlds
+	verification *VerificationStatus
+}
+
+// NewDiagnoser creates a diagnoser, with the verification status of members persisted in dataDir.
+// If dataDir is empty, it is only kept in memory
+func NewDiagnoser(service *backend.Service, cache *discord.Cache, guilds *guild.Guilds, worlds *world.Worlds, dataDir string) *Diagnoser {
+	return &Diagnoser{
+		service:      service,
+		cache:        cache,
+		guilds:       guilds,
+		worlds:       worlds,
+		verification: NewVerificationStatus(dataDir),
+	}
+}
+
+// Verification returns the verification status of members, as last seen when they were reconciled
+func (d *Diagnoser) Verification() *VerificationStatus {
+	return d.verification
+}
+
+// Report checks the health of the bot on the server
+func (d *Diagnoser) Report(s *discordgo.Session, guildID string) (*Report, error) {
+	server, err := LoadServer(s, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Problems:               server.Check(d.service),
+		WorldLinksSynchronized: d.worlds.IsWorldLinksSynchronized(),
+		SettingsSynchronizedAt: d.service.SynchronizedAt(),
+	}
+	_, report.WorldEnabled = d.service.GetWorld(guildID)
+	report.SettingsStale = time.Since(report.SettingsSynchronizedAt) > settingsStaleAfter
+
+	guildRoles := GuildRoles(server.Roles)
+	for _, role := range guildRoles {
+		if !d.guilds.IsKnownTagAndName(role.Name) {
+			report.UnknownGuildRoles = append(report.UnknownGuildRoles, role.ID)
+		}
+	}
+
+	serverCache := d.cache.Server(guildID)
+	report.MissingRoles = MissingRoles(d.service, guildID, func(roleID string) bool {
+		return serverCache.GetRole(roleID) != nil
+	})
+
+	members, loaded := d.cache.Members(guildID)
+	report.MembersLoaded = loaded
+	if loaded {
+		guildRoleIDs := make([]string, len(guildRoles))
+		for i, role := range guildRoles {
+			guildRoleIDs[i] = role.ID
+		}
+		report.MultipleGuildRoles = MembersWithMultipleRoles(members, guildRoleIDs)
+		report.Members, report.Verified, report.Unverified = d.verification.Count(guildID, members)
+	}
+	return report, nil
+}
+
+// GuildRoles returns the roles named after a guild, in the format "[TAG] Name"
+func GuildRoles(roles []*discordgo.Role) []*discordgo.Role {
+	var guildRoles []*discordgo.Role
+	for _, role := range roles {
+		if guild.RegexRoleNameMatcher.MatchString(role.Name) {
+			guildRoles = append(guildRoles, role)
+		}
+	}
+	return guildRoles
+}
+
+// GuildRoleMapping is a role named after a guild, and the guild it is matched with
+type GuildRoleMapping struct {
+	RoleID   string
+	RoleName string
+	// Guild is nil if no known guild has the tag and name of the role
+	Guild *gw2api.Guild
+	// Verifies is set if members with the role are given the guild verification role
+	Verifies bool
+}
+
+// GuildRoleMappings returns the roles of the server named after a guild, sorted by name, along with the guilds they are matched with
+func GuildRoleMappings(service *backend.Service, guilds *guild.Guilds, guildID string, roles []*discordgo.Role) []GuildRoleMapping {
+	commonRole := service.GetSetting(guildID, backend.SettingGuildCommonRole)
+	verifyRoles := service.GetRoles(guildID, backend.SettingGuildVerifyRoles)
+
+	var mappings []GuildRoleMapping
+	for _, role := range GuildRoles(roles) {
+		info, _ := guilds.GetGuildInfoByTagAndName(role.Name)
+		mappings = append(mappings, GuildRoleMapping{
+			RoleID:   role.ID,
+			RoleName: role.Name,
+			Guild:    info,
+			// Every guild role verifies, unless specific guild roles are picked
+			Verifies: commonRole != "" && (len(verifyRoles) == 0 || slices.Contains(verifyRoles, role.ID)),
+		})
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].RoleName < mappings[j].RoleName
+	})
+	return mappings
+}
+
+// MissingRoles returns the roles configured in the settings of the server, which exists reports as deleted
+func MissingRoles(service *backend.Service, guildID string, exists func(roleID string) bool) []MissingRole {
+	var missing []MissingRole
+	for _, definition := range backend.SettingDefinitions() {
+		if !definition.HoldsRoles() {
+			continue
+		}
+		for _, roleID := range service.GetRoles(guildID, definition.Name) {
+			if !exists(roleID) {
+				missing = append(missing, MissingRole{Setting: definition.Name, RoleID: roleID})
+			}
+		}
+	}
+	return missing
+}
+
+// MembersWithMultipleRoles returns the ids of the members holding more than one of the roles
+func MembersWithMultipleRoles(members []*discordgo.Member, roleIDs []string) []string {
+	var userIDs []string
+	for _, member := range members {
+		held := 0
+		for _, roleID := range member.Roles {
+			if slices.Contains(roleIDs, roleID) {
+				held++
+			}
+		}
+		if held > 1 {
+			userIDs = append(userIDs, member.User.ID)
+		}
+	}
+	return userIDs
+}
+
+// VerificationStatus remembers whether members were verified, when they were last reconciled.
+// It is persisted, so members verifying while the bot was restarted are still seen becoming verified
+type VerificationStatus struct {
+	m        sync.Mutex
+	verified *store.Store[bool]
+}
+
+// NewVerificationStatus loads the verification status persisted in dataDir. If dataDir is empty, it is only kept in memory
+func NewVerificationStatus(dataDir string) *VerificationStatus {
+	path := ""
+	if dataDir != "" {
+		path = filepath.Join(dataDir, "verification_status.json")
+	}
+	verified, err := store.Open[bool](path, 0)
+	if err != nil {
+		zap.L().Error("unable to load verification status, starting without any", zap.String("path", path), zap.Error(err))
+		verified, _ = store.Open[bool]("", 0)
+	}
+	return &VerificationStatus{
+		verified: verified,
+	}
+}
+
+// Set records whether the member of the server is verified, and returns whether the member was known to be unverified
+// before. Members seen for the first time never became verified, as it is unknown when they verified
+func (v *VerificationStatus) Set(guildID string, userID string, verified bool) (becameVerified bool) {
+	v.m.Lock()
+	defer v.m.Unlock()
+	key := verificationKey(guildID, userID)
+	wasVerified, known, _ := v.verified.Get(key)
+	if known && wasVerified == verified {
+		return false
+	}
+	v.verified.Set(key, verified)
+	return known && !wasVerified && verified
+}
+
+// Forget removes the member of the server, e.g. when they leave it
+func (v *VerificationStatus) Forget(guildID string, userID string) {
+	v.m.Lock()
+	defer v.m.Unlock()
+	v.verified.Delete(verificationKey(guildID, userID))
+}
+
+// Start periodically saves the verification status
+func (v *VerificationStatus) Start() {
+	go func() {
+		ticker := time.NewTicker(verificationSaveInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			v.Save()
+		}
+	}()
+}
+
+// Save writes the verification status to disk, if it changed since it was last saved
+func (v *VerificationStatus) Save() {
+	if err := v.verified.Save(); err != nil {
+		zap.L().Error("unable to save verification status", zap.Error(err))
+	}
+}
+
+func verificationKey(guildID string, userID string) string {
+	return guildID + ":" + userID
+}
+
+// Count returns the number of members, excluding bots, and how many of them are known to be verified or unverified.
+// Members that have not been reconciled yet are neither
+func (v *VerificationStatus) Count(guildID string, members []*discordgo.Member) (total int, verified int, unverified int) {
+	v.m.Lock()
+	defer v.m.Unlock()
+	for _, member := range members {
+		if member.User == nil || member.User.Bot {
+			continue
+		}
+		total++
+		isVerified, ok, _ := v.verified.Get(verificationKey(guildID, member.User.ID))
+		switch {
+		case !ok:
+		case isVerified:
+			verified++
+		default:
+			unverified++
+		}
+	}
+	return total, verified, unverified
+}
@@ -0,0 +1,68 @@
+package diagnose
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+)
+
+func testMembers() []*discordgo.Member {
+	return []*discordgo.Member{
+		{User: &discordgo.User{ID: "a"}, Roles: []string{"guild1", "guild2"}},
+		{User: &discordgo.User{ID: "b"}, Roles: []string{"guild1", "other"}},
+		{User: &discordgo.User{ID: "c"}},
+		{User: &discordgo.User{ID: "bot", Bot: true}, Roles: []string{"guild1", "guild2"}},
+	}
+}
+
+func TestGuildRoles(t *testing.T) {
+	g := NewGomegaWithT(t)
+	roles := GuildRoles([]*discordgo.Role{
+		{ID: "1", Name: "[TAG] Some Guild"},
+		{ID: "2", Name: "Verified"},
+		{ID: "3", Name: "[AB] Other Guild"},
+	})
+	g.Expect(roles).To(HaveLen(2))
+	g.Expect(roles[0].ID).To(Equal("1"))
+	g.Expect(roles[1].ID).To(Equal("3"))
+}
+
+func TestMembersWithMultipleRoles(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(MembersWithMultipleRoles(testMembers(), []string{"guild1", "guild2"})).To(Equal([]string{"a", "bot"}))
+	g.Expect(MembersWithMultipleRoles(testMembers(), []string{"guild1"})).To(BeEmpty())
+}
+
+func TestVerificationStatus(t *testing.T) {
+	g := NewGomegaWithT(t)
+	status := NewVerificationStatus("")
+	g.Expect(status.Set("guild", "a", true)).To(BeFalse())
+	g.Expect(status.Set("guild", "b", true)).To(BeFalse())
+	g.Expect(status.Set("guild", "b", false)).To(BeFalse())
+	g.Expect(status.Set("other", "c", true)).To(BeFalse())
+
+	total, verified, unverified := status.Count("guild", testMembers())
+	g.Expect(total).To(Equal(3))
+	g.Expect(verified).To(Equal(1))
+	g.Expect(unverified).To(Equal(1))
+
+	// Only members known to be unverified become verified
+	g.Expect(status.Set("guild", "b", true)).To(BeTrue())
+	g.Expect(status.Set("guild", "b", true)).To(BeFalse())
+}
+
+func TestVerificationStatusPersisted(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+	status := NewVerificationStatus(dir)
+	g.Expect(status.Set("guild", "a", false)).To(BeFalse())
+	g.Expect(status.Set("guild", "b", false)).To(BeFalse())
+	status.Forget("guild", "b")
+	status.Save()
+
+	// Members unverified before a restart are seen becoming verified after it, unless they left
+	status = NewVerificationStatus(dir)
+	g.Expect(status.Set("guild", "a", true)).To(BeTrue())
+	g.Expect(status.Set("guild", "b", true)).To(BeFalse())
+}
@@ -1,6 +1,8 @@
 package discord
 
 import (
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/bwmarrin/discordgo"
@@ -8,68 +10,143 @@ import (
 )
 
 type Cache struct {
-	discord *discordgo.Session
-	Servers map[string]*ServerCache
+	m                   sync.RWMutex
+	discord             *discordgo.Session
+	servers             map[string]*ServerCache
+	roleDeleteListeners []func(serverID string, roleID string, userIDs []string)
 }
 
 func NewCache(discord *discordgo.Session) *Cache {
 	cache := &Cache{
 		discord: discord,
-		Servers: make(map[string]*ServerCache),
+		servers: make(map[string]*ServerCache),
 	}
 
-	discord.AddHandler(func(s *discordgo.Session, event *discordgo.Ready) {
-		cache.CacheAll()
-	})
-	discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildCreate) {
-		zap.L().Info("guild joined", zap.Any("event", event))
-		cache.CacheAll()
-	})
+	discord.AddHandler(cache.onGuildCreate)
 	discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildDelete) {
-		zap.L().Info("guild left", zap.Any("event", event))
-		cache.CacheAll()
+		zap.L().Info("guild left", zap.String("guild id", event.ID))
+		cache.m.Lock()
+		delete(cache.servers, event.ID)
+		cache.m.Unlock()
 	})
 	discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildRoleCreate) {
 		zap.L().Info("role created", zap.Any("event", event))
-		server := cache.Servers[event.GuildID]
+		server := cache.server(event.GuildID, false)
 		if server != nil {
 			server.UpdateRole(event.Role)
 		}
 	})
 	discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildRoleUpdate) {
 		zap.L().Info("role updated", zap.Any("event", event))
-		server := cache.Servers[event.GuildID]
+		server := cache.server(event.GuildID, false)
 		if server != nil {
 			server.UpdateRole(event.Role)
 		}
 	})
 	discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildRoleDelete) {
 		zap.L().Info("role deleted", zap.Any("event", event))
-		server := cache.Servers[event.GuildID]
+		server := cache.server(event.GuildID, false)
+		if server == nil {
+			return
+		}
+		userIDs := server.DeleteRole(event.RoleID)
+
+		cache.m.RLock()
+		listeners := cache.roleDeleteListeners
+		cache.m.RUnlock()
+		for _, listener := range listeners {
+			listener(event.GuildID, event.RoleID, userIDs)
+		}
+	})
+	discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildMembersChunk) {
+		server := cache.server(event.GuildID, true)
+		for _, member := range event.Members {
+			member.GuildID = event.GuildID
+			server.UpdateMember(member)
+		}
+		if event.ChunkIndex == event.ChunkCount-1 {
+			server.setMembersLoaded()
+			zap.L().Info("cached guild members", zap.String("guild id", event.GuildID), zap.Int("members", server.MemberCount()))
+		}
+	})
+	discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildMemberAdd) {
+		server := cache.server(event.GuildID, false)
 		if server != nil {
-			server.DeleteRole(event.RoleID)
+			server.UpdateMember(event.Member)
+		}
+	})
+	discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildMemberUpdate) {
+		server := cache.server(event.GuildID, false)
+		if server != nil {
+			server.UpdateMember(event.Member)
+		}
+	})
+	discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildMemberRemove) {
+		server := cache.server(event.GuildID, false)
+		if server != nil && event.Member.User != nil {
+			server.RemoveMember(event.Member.User.ID)
 		}
 	})
 
 	return cache
 }
 
-func (r *Cache) CacheAll() {
-	zap.L().Info("caching servers")
-	for _, guild := range r.discord.State.Guilds {
-		s := r.Servers[guild.ID]
-		if s == nil {
-			s = &ServerCache{
-				roles: make(map[string]*discordgo.Role),
-			}
-			r.Servers[guild.ID] = s
-		}
-		err := r.Cache(guild.ID, s)
-		if err != nil {
-			zap.L().Error("unable to cache server roles", zap.String("server", guild.ID), zap.String("server name", guild.Name), zap.Error(err))
-		}
+// onGuildCreate is called for every server once connected, and whenever the bot joins a server.
+// The members are requested again, as members may have left while the bot was disconnected
+func (c *Cache) onGuildCreate(s *discordgo.Session, event *discordgo.GuildCreate) {
+	zap.L().Info("guild joined", zap.String("guild id", event.ID), zap.String("guild name", event.Name))
+	server := c.server(event.ID, true)
+	server.SetRoles(event.Roles)
+	server.resetMembers()
+
+	// Members are sent in chunks, see GuildMembersChunk
+	err := s.RequestGuildMembers(event.ID, "", 0, "", false)
+	if err != nil {
+		zap.L().Error("unable to request guild members", zap.String("guild id", event.ID), zap.Error(err))
 	}
-	zap.L().Info("cached servers")
+}
+
+// OnRoleDelete registers fn to be called when a role is deleted, with the members that had the role.
+// The role has already been removed from the cached members when fn is called
+func (r *Cache) OnRoleDelete(fn func(serverID string, roleID string, userIDs []string)) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.roleDeleteListeners = append(r.roleDeleteListeners, fn)
+}
+
+// server returns the cache of the server, optionally creating it if it does not exist
+func (r *Cache) server(serverID string, create bool) *ServerCache {
+	r.m.RLock()
+	server := r.servers[serverID]
+	r.m.RUnlock()
+	if server != nil || !create {
+		return server
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	server = r.servers[serverID]
+	if server == nil {
+		server = newServerCache()
+		r.servers[serverID] = server
+	}
+	return server
+}
+
+// Server returns the cache of the server, fetching its roles if the server has not been cached yet
+func (r *Cache) Server(serverID string) *ServerCache {
+	server := r.server(serverID, false)
+	if server != nil {
+		return server
+	}
+
+	zap.L().Warn("server not found in cache", zap.String("server", serverID))
+	server = r.server(serverID, true)
+	err := r.Cache(serverID, server)
+	if err != nil {
+		zap.L().Error("unable to cache server roles", zap.String("server", serverID), zap.Error(err))
+	}
+	return server
 }
 
 func (r *Cache) Cache(serverID string, server *ServerCache) error {
@@ -78,29 +155,12 @@ func (r *Cache) Cache(serverID string, server *ServerCache) error {
 		return err
 	}
 
-	for _, role := range roles {
-		server.UpdateRole(role)
-	}
-
+	server.SetRoles(roles)
 	return nil
 }
 
 func (r *Cache) GetRole(serverID, roleID string) *discordgo.Role {
-	server := r.Servers[serverID]
-	if server == nil {
-		zap.L().Warn("server not found in cache", zap.String("server", serverID))
-		err := r.Cache(serverID, server)
-		if err != nil {
-			zap.L().Error("unable to cache server roles", zap.String("server", serverID), zap.Error(err))
-			return nil
-		}
-		server = r.Servers[serverID]
-		if server == nil {
-			zap.L().Error("unable to cache server roles", zap.String("server", serverID))
-			return nil
-		}
-	}
-
+	server := r.Server(serverID)
 	role := server.GetRole(roleID)
 	if role == nil {
 		err := r.Cache(serverID, server)
@@ -114,25 +174,10 @@ func (r *Cache) GetRole(serverID, roleID string) *discordgo.Role {
 }
 
 func (r *Cache) GetRoleByName(serverID string, roleName string) *discordgo.Role {
-	server := r.Servers[serverID]
-	if server == nil {
-		zap.L().Warn("server not found in cache", zap.String("server", serverID))
-		err := r.Cache(serverID, server)
-		if err != nil {
-			zap.L().Error("unable to cache server roles", zap.String("server", serverID), zap.Error(err))
-			return nil
-		}
-		server = r.Servers[serverID]
-		if server == nil {
-			zap.L().Error("unable to cache server roles", zap.String("server", serverID))
-			return nil
-		}
-	}
-
-	for _, role := range server.roles {
-		if role.Name == roleName {
-			return role
-		}
+	server := r.Server(serverID)
+	role := server.FindRoleByTagAndName(roleName)
+	if role != nil {
+		return role
 	}
 
 	err := r.Cache(serverID, server)
@@ -140,19 +185,82 @@ func (r *Cache) GetRoleByName(serverID string, roleName string) *discordgo.Role
 		zap.L().Error("unable to cache server roles", zap.String("server", serverID), zap.Error(err))
 		return nil
 	}
+	return server.FindRoleByTagAndName(roleName)
+}
 
-	for _, role := range server.roles {
-		if role.Name == roleName {
-			return role
+// GetMember returns the member from the cache, falling back to fetching it from discord on a cache miss.
+// Once all members of the server have been cached, a cache miss means the user is not a member, and nil is returned.
+// The returned member is a copy, which may be modified by the caller
+func (r *Cache) GetMember(serverID string, userID string) (*discordgo.Member, error) {
+	server := r.server(serverID, false)
+	if server != nil {
+		member, loaded := server.GetMember(userID)
+		if member != nil {
+			return member, nil
+		} else if loaded {
+			return nil, nil
 		}
 	}
 
-	return nil
+	member, err := r.discord.GuildMember(serverID, userID)
+	if err != nil {
+		return nil, err
+	}
+	member.GuildID = serverID
+	if server != nil {
+		server.UpdateMember(member)
+	}
+	return member, nil
+}
+
+// UpdateMember stores the member in the cache, if the server is cached
+func (r *Cache) UpdateMember(member *discordgo.Member) {
+	server := r.server(member.GuildID, false)
+	if server != nil {
+		server.UpdateMember(member)
+	}
+}
+
+// Members returns a copy of all cached members of the server, ordered by user id, or false if the members are not cached yet
+func (r *Cache) Members(serverID string) ([]*discordgo.Member, bool) {
+	server := r.server(serverID, false)
+	if server == nil {
+		return nil, false
+	}
+	return server.Members()
+}
+
+// MightBeMember checks if the user may be a member of the server. Until all members of the server have been cached,
+// any user might be a member
+func (r *Cache) MightBeMember(serverID string, userID string) bool {
+	server := r.server(serverID, false)
+	if server == nil {
+		return true
+	}
+	member, loaded := server.GetMember(userID)
+	return member != nil || !loaded
+}
+
+// Guilds returns a copy of the servers in the state of the session. The state is locked while copying,
+// as it is updated by the gateway
+func Guilds(s *discordgo.Session) []*discordgo.Guild {
+	s.State.RLock()
+	defer s.State.RUnlock()
+	return slices.Clone(s.State.Guilds)
 }
 
 type ServerCache struct {
-	m     sync.Mutex
-	roles map[string]*discordgo.Role
+	m             sync.Mutex
+	roles         map[string]*discordgo.Role
+	members       map[string]*discordgo.Member
+	membersLoaded bool
+}
+
+func newServerCache() *ServerCache {
+	return &ServerCache{
+		roles:   make(map[string]*discordgo.Role),
+		members: make(map[string]*discordgo.Member),
+	}
 }
 
 func (c *ServerCache) FindRoleByTagAndName(tagAndName string) *discordgo.Role {
@@ -172,14 +280,120 @@ func (c *ServerCache) GetRole(roleID string) *discordgo.Role {
 	return c.roles[roleID]
 }
 
+// Roles returns all cached roles of the server
+func (c *ServerCache) Roles() []*discordgo.Role {
+	c.m.Lock()
+	defer c.m.Unlock()
+	roles := make([]*discordgo.Role, 0, len(c.roles))
+	for _, role := range c.roles {
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// SetRoles replaces all cached roles of the server
+func (c *ServerCache) SetRoles(roles []*discordgo.Role) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.roles = make(map[string]*discordgo.Role, len(roles))
+	for _, role := range roles {
+		c.roles[role.ID] = role
+	}
+}
+
 func (c *ServerCache) UpdateRole(role *discordgo.Role) {
 	c.m.Lock()
 	defer c.m.Unlock()
 	c.roles[role.ID] = role
 }
 
-func (c *ServerCache) DeleteRole(roleID string) {
+// DeleteRole removes the role from the server and its cached members, and returns the ids of the members that had it
+func (c *ServerCache) DeleteRole(roleID string) []string {
 	c.m.Lock()
 	defer c.m.Unlock()
 	delete(c.roles, roleID)
+
+	var userIDs []string
+	for userID, member := range c.members {
+		if i := slices.Index(member.Roles, roleID); i >= 0 {
+			member.Roles = slices.Delete(member.Roles, i, i+1)
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs
+}
+
+// GetMember returns a copy of the cached member, if any, and whether all members of the server have been cached
+func (c *ServerCache) GetMember(userID string) (member *discordgo.Member, loaded bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if cached, ok := c.members[userID]; ok {
+		member = copyMember(cached)
+	}
+	return member, c.membersLoaded
+}
+
+// Members returns a copy of all cached members, ordered by user id, or false if the members are not cached yet
+func (c *ServerCache) Members() ([]*discordgo.Member, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if !c.membersLoaded {
+		return nil, false
+	}
+
+	members := make([]*discordgo.Member, 0, len(c.members))
+	for _, member := range c.members {
+		members = append(members, copyMember(member))
+	}
+	slices.SortFunc(members, func(a, b *discordgo.Member) int {
+		// Snowflakes sort numerically, so compare length first
+		if len(a.User.ID) != len(b.User.ID) {
+			return len(a.User.ID) - len(b.User.ID)
+		}
+		return strings.Compare(a.User.ID, b.User.ID)
+	})
+	return members, true
+}
+
+// MemberCount returns the number of cached members
+func (c *ServerCache) MemberCount() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return len(c.members)
+}
+
+// UpdateMember stores a copy of the member
+func (c *ServerCache) UpdateMember(member *discordgo.Member) {
+	if member == nil || member.User == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.members[member.User.ID] = copyMember(member)
+}
+
+func (c *ServerCache) RemoveMember(userID string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.members, userID)
+}
+
+// resetMembers removes all cached members, until they have been received again
+func (c *ServerCache) resetMembers() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.members = make(map[string]*discordgo.Member)
+	c.membersLoaded = false
+}
+
+func (c *ServerCache) setMembersLoaded() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.membersLoaded = true
+}
+
+func copyMember(member *discordgo.Member) *discordgo.Member {
+	cp := *member
+	cp.Roles = slices.Clone(member.Roles)
+	return &cp
 }
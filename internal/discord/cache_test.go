@@ -0,0 +1,109 @@
+package discord
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+)
+
+func testMember(id string, roles ...string) *discordgo.Member {
+	return &discordgo.Member{
+		User:  &discordgo.User{ID: id},
+		Roles: roles,
+	}
+}
+
+func TestServerCacheMembers(t *testing.T) {
+	g := NewGomegaWithT(t)
+	server := newServerCache()
+
+	server.UpdateMember(testMember("20", "a"))
+	server.UpdateMember(testMember("3"))
+
+	// Not every member is known until all chunks have been received
+	member, loaded := server.GetMember("20")
+	g.Expect(member).ToNot(BeNil())
+	g.Expect(loaded).To(BeFalse())
+	_, ok := server.Members()
+	g.Expect(ok).To(BeFalse())
+
+	server.setMembersLoaded()
+	members, ok := server.Members()
+	g.Expect(ok).To(BeTrue())
+	g.Expect(members).To(HaveLen(2))
+	g.Expect(members[0].User.ID).To(Equal("3"))
+	g.Expect(members[1].User.ID).To(Equal("20"))
+
+	server.RemoveMember("3")
+	member, loaded = server.GetMember("3")
+	g.Expect(member).To(BeNil())
+	g.Expect(loaded).To(BeTrue())
+}
+
+func TestServerCacheReturnsCopies(t *testing.T) {
+	g := NewGomegaWithT(t)
+	server := newServerCache()
+	server.UpdateMember(testMember("1", "a"))
+
+	member, _ := server.GetMember("1")
+	member.Roles[0] = "b"
+	member.Nick = "changed"
+
+	member, _ = server.GetMember("1")
+	g.Expect(member.Roles).To(Equal([]string{"a"}))
+	g.Expect(member.Nick).To(BeEmpty())
+}
+
+func TestServerCacheDeleteRole(t *testing.T) {
+	g := NewGomegaWithT(t)
+	server := newServerCache()
+	server.UpdateRole(&discordgo.Role{ID: "a"})
+	server.UpdateMember(testMember("1", "a", "b"))
+	server.UpdateMember(testMember("2", "b"))
+
+	userIDs := server.DeleteRole("a")
+	g.Expect(userIDs).To(Equal([]string{"1"}))
+	g.Expect(server.GetRole("a")).To(BeNil())
+
+	member, _ := server.GetMember("1")
+	g.Expect(member.Roles).To(Equal([]string{"b"}))
+}
+
+func TestMightBeMember(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cache := &Cache{servers: map[string]*ServerCache{"1": newServerCache()}}
+	cache.servers["1"].UpdateMember(testMember("20"))
+
+	// Anyone might be a member until all members are cached
+	g.Expect(cache.MightBeMember("1", "3")).To(BeTrue())
+	g.Expect(cache.MightBeMember("2", "3")).To(BeTrue())
+
+	cache.servers["1"].setMembersLoaded()
+	g.Expect(cache.MightBeMember("1", "20")).To(BeTrue())
+	g.Expect(cache.MightBeMember("1", "3")).To(BeFalse())
+}
+
+func TestGuildCreateResetsMembers(t *testing.T) {
+	g := NewGomegaWithT(t)
+	cache := &Cache{servers: map[string]*ServerCache{"1": newServerCache()}}
+	cache.servers["1"].UpdateMember(testMember("20"))
+	cache.servers["1"].setMembersLoaded()
+
+	// Sent again when the bot reconnects, members that left in the meantime must not stay cached
+	cache.onGuildCreate(&discordgo.Session{State: discordgo.NewState()}, &discordgo.GuildCreate{Guild: &discordgo.Guild{ID: "1"}})
+	member, loaded := cache.servers["1"].GetMember("20")
+	g.Expect(member).To(BeNil())
+	g.Expect(loaded).To(BeFalse())
+}
+
+func TestGuilds(t *testing.T) {
+	g := NewGomegaWithT(t)
+	session := &discordgo.Session{State: discordgo.NewState()}
+	_ = session.State.GuildAdd(&discordgo.Guild{ID: "1"})
+
+	guilds := Guilds(session)
+	g.Expect(guilds).To(HaveLen(1))
+	_ = session.State.GuildAdd(&discordgo.Guild{ID: "2"})
+	g.Expect(guilds).To(HaveLen(1))
+}
@@ -0,0 +1,34 @@
+package discord
+
+import "github.com/bwmarrin/discordgo"
+
+// GuildLocale returns the preferred locale of the server, used for messages not sent in response to an interaction
+func GuildLocale(s *discordgo.Session, guildID string) discordgo.Locale {
+	guild, err := s.State.Guild(guildID)
+	if err != nil || guild.PreferredLocale == "" {
+		return discordgo.EnglishUS
+	}
+	return discordgo.Locale(guild.PreferredLocale)
+}
+
+// GuildName returns the name of the server, or an empty string if the server is not in the state
+func GuildName(s *discordgo.Session, guildID string) string {
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		return ""
+	}
+	return guild.Name
+}
+
+// IsSnowflake checks if the value is a discord id
+func IsSnowflake(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,247 @@
+package expiry
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+	"github.com/vennekilde/gw2-alliance-bot/internal/interaction"
+	"github.com/vennekilde/gw2-alliance-bot/internal/store"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+// userNotificationCooldown prevents users from being told about the same expired account once for every server they are on
+const userNotificationCooldown = 24 * time.Hour
+
+// saveInterval is how often the state is written to disk. Saving on every check would rewrite the whole file for
+// every member while a server is reconciled
+const saveInterval = time.Minute
+
+// Notifier detects when linked accounts expire, e.g. because the api key was deleted, and tells the user how to add a new api key
+type Notifier struct {
+	m       sync.Mutex
+	discord *discordgo.Session
+	service *backend.Service
+
+	// expired keeps track of the last known expired state of each account, per member of each server.
+	// It is persisted, so accounts that expire while the bot is offline are still reported
+	expired *store.Store[bool]
+	// accounts indexes the keys of the expired states by member, see memberPrefix
+	accounts map[string][]string
+	// notified keeps track of when users were last told about each expired account. Entries become stale once the
+	// cooldown is over, and are then pruned
+	notified *store.Store[time.Time]
+}
+
+// NewNotifier creates an expiry notifier, with the last known state of accounts persisted in dataDir.
+// If dataDir is empty, the state is only kept in memory
+func NewNotifier(discord *discordgo.Session, service *backend.Service, dataDir string) *Notifier {
+	n := &Notifier{
+		discord:  discord,
+		service:  service,
+		expired:  open[bool](dataDir, "expiry_accounts.json", 0),
+		notified: open[time.Time](dataDir, "expiry_notified.json", userNotificationCooldown),
+		accounts: make(map[string][]string),
+	}
+	n.expired.Range(func(key string, entry store.Entry[bool]) bool {
+		if parts := strings.SplitN(key, ":", 3); len(parts) == 3 {
+			prefix := memberPrefix(parts[0], parts[1])
+			n.accounts[prefix] = append(n.accounts[prefix], key)
+		}
+		return true
+	})
+	if discord != nil {
+		discord.AddHandler(n.onGuildMemberRemove)
+	}
+	return n
+}
+
+func open[V any](dataDir string, name string, ttl time.Duration) *store.Store[V] {
+	path := ""
+	if dataDir != "" {
+		path = filepath.Join(dataDir, name)
+	}
+	s, err := store.Open[V](path, ttl)
+	if err != nil {
+		zap.L().Error("unable to load expiry state, starting without any", zap.String("path", path), zap.Error(err))
+		s, _ = store.Open[V]("", ttl)
+	}
+	return s
+}
+
+// Check notifies the user and the server admins, if any of the accounts of the user have expired since the last check.
+// Accounts seen for the first time are only remembered, as it is unknown when they expired.
+// The accounts that have expired since the last check are returned
+func (n *Notifier) Check(member *discordgo.Member, user *api.User) []api.Account {
+	expiredAccounts := n.update(member, user)
+	for _, account := range expiredAccounts {
+		zap.L().Info("account expired", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.String("account", account.Name))
+		if n.shouldNotify(member.User.ID, account.ID) {
+			n.notifyUser(member, account)
+		}
+		n.notifyAdmins(member, account)
+	}
+	return expiredAccounts
+}
+
+// update records the expired state of the accounts of the member, and returns the accounts that have expired since the
+// last check. Accounts the member no longer has linked are forgotten
+func (n *Notifier) update(member *discordgo.Member, user *api.User) []api.Account {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	prefix := memberPrefix(member.GuildID, member.User.ID)
+	linked := make([]string, 0, len(user.Accounts))
+	var expiredAccounts []api.Account
+	for _, account := range user.Accounts {
+		expired := account.Expired != nil && *account.Expired
+		key := prefix + account.ID
+		linked = append(linked, key)
+
+		wasExpired, known, _ := n.expired.Get(key)
+		if !known || wasExpired != expired {
+			n.expired.Set(key, expired)
+		}
+		if known && !wasExpired && expired {
+			expiredAccounts = append(expiredAccounts, account)
+		}
+	}
+
+	for _, key := range n.accounts[prefix] {
+		if !slices.Contains(linked, key) {
+			n.expired.Delete(key)
+		}
+	}
+	if len(linked) > 0 {
+		n.accounts[prefix] = linked
+	} else {
+		delete(n.accounts, prefix)
+	}
+	return expiredAccounts
+}
+
+// shouldNotify checks if the user has not been told about the expired account recently, and records that they are
+func (n *Notifier) shouldNotify(userID string, accountID string) bool {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	key := userID + ":" + accountID
+	if _, ok, stale := n.notified.Get(key); ok && !stale {
+		return false
+	}
+	n.notified.Set(key, time.Now())
+	for _, key := range n.notified.Stale() {
+		n.notified.Delete(key)
+	}
+	return true
+}
+
+// onGuildMemberRemove forgets the accounts of members who leave the server
+func (n *Notifier) onGuildMemberRemove(s *discordgo.Session, event *discordgo.GuildMemberRemove) {
+	if event.Member == nil || event.Member.User == nil {
+		return
+	}
+	n.m.Lock()
+	defer n.m.Unlock()
+	prefix := memberPrefix(event.GuildID, event.Member.User.ID)
+	for _, key := range n.accounts[prefix] {
+		n.expired.Delete(key)
+	}
+	delete(n.accounts, prefix)
+}
+
+// Start periodically saves the state
+func (n *Notifier) Start() {
+	go func() {
+		ticker := time.NewTicker(saveInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n.Save()
+		}
+	}()
+}
+
+// Save writes the state to disk, if it changed since it was last saved
+func (n *Notifier) Save() {
+	if err := n.expired.Save(); err != nil {
+		zap.L().Error("unable to save expired accounts", zap.Error(err))
+	}
+	if err := n.notified.Save(); err != nil {
+		zap.L().Error("unable to save expiry notifications", zap.Error(err))
+	}
+}
+
+func memberPrefix(guildID string, userID string) string {
+	return guildID + ":" + userID + ":"
+}
+
+func (n *Notifier) notifyUser(member *discordgo.Member, account api.Account) {
+	channel, err := n.discord.UserChannelCreate(member.User.ID)
+	if err != nil {
+		zap.L().Warn("unable to notify user about expired account", zap.String("user id", member.User.ID), zap.Error(err))
+		return
+	}
+
+	locale := discord.GuildLocale(n.discord, member.GuildID)
+	embeds, components := interaction.BuildVerifyInstructions(locale, interaction.APIKeyNamePrefix(n.discord, member.GuildID), member.User.ID)
+	_, err = n.discord.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+		Content:    resources.TL(locale, "expiry.dm", resources.TData("account", account.Name, "server", discord.GuildName(n.discord, member.GuildID))),
+		Embeds:     embeds,
+		Components: components,
+	})
+	if err != nil {
+		zap.L().Warn("unable to notify user about expired account", zap.String("user id", member.User.ID), zap.Error(err))
+	}
+}
+
+func (n *Notifier) notifyAdmins(member *discordgo.Member, account api.Account) {
+	channelID := n.service.GetSetting(member.GuildID, backend.SettingExpiredLogChannel)
+	if channelID == "" {
+		return
+	}
+
+	locale := discord.GuildLocale(n.discord, member.GuildID)
+	lastSuccess := resources.TL(locale, "expiry.log.never")
+	if t := LastSuccess(account); !t.IsZero() {
+		lastSuccess = fmt.Sprintf("<t:%d:R>", t.Unix())
+	}
+
+	_, err := n.discord.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       resources.TL(locale, "expiry.log.title"),
+				Description: resources.TL(locale, "expiry.log.description", resources.TData("user", member.User.ID, "account", account.Name)),
+				Color:       0xE67E22, // orange
+				Fields: []*discordgo.MessageEmbedField{
+					{
+						Name:  resources.TL(locale, "expiry.log.last_success"),
+						Value: lastSuccess,
+					},
+				},
+			},
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		zap.L().Error("unable to notify admins about expired account", zap.String("guild id", member.GuildID), zap.String("channel id", channelID), zap.Error(err))
+	}
+}
+
+// LastSuccess returns the last time any api key of the account was successfully used
+func LastSuccess(account api.Account) time.Time {
+	var last time.Time
+	for _, token := range account.ApiKeys {
+		if token.LastSuccess.After(last) {
+			last = token.LastSuccess
+		}
+	}
+	return last
+}
@@ -0,0 +1,90 @@
+package expiry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+)
+
+func testMember(guildID string) *discordgo.Member {
+	return &discordgo.Member{GuildID: guildID, User: &discordgo.User{ID: "1"}}
+}
+
+func testUser(expired ...bool) *api.User {
+	user := &api.User{}
+	for i, e := range expired {
+		user.Accounts = append(user.Accounts, api.Account{ID: string(rune('a' + i)), Name: "Account", Expired: &e})
+	}
+	return user
+}
+
+func TestUpdate(t *testing.T) {
+	g := NewGomegaWithT(t)
+	n := NewNotifier(nil, nil, "")
+
+	// Accounts seen for the first time are only remembered
+	g.Expect(n.update(testMember("1"), testUser(true, false))).To(BeEmpty())
+
+	expired := n.update(testMember("1"), testUser(true, true))
+	g.Expect(expired).To(HaveLen(1))
+	g.Expect(expired[0].ID).To(Equal("b"))
+
+	// Accounts are only reported once, and again if they expire after working again
+	g.Expect(n.update(testMember("1"), testUser(true, true))).To(BeEmpty())
+	g.Expect(n.update(testMember("1"), testUser(true, false))).To(BeEmpty())
+	g.Expect(n.update(testMember("1"), testUser(true, true))).To(HaveLen(1))
+
+	// Servers are tracked separately
+	g.Expect(n.update(testMember("2"), testUser(true, true))).To(BeEmpty())
+}
+
+func TestUpdatePersisted(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dataDir := t.TempDir()
+	n := NewNotifier(nil, nil, dataDir)
+	g.Expect(n.update(testMember("1"), testUser(false, false))).To(BeEmpty())
+	n.Save()
+
+	// Accounts that expire while the bot is offline are reported once it is back
+	n = NewNotifier(nil, nil, dataDir)
+	g.Expect(n.update(testMember("1"), testUser(true))).To(HaveLen(1))
+
+	// Accounts loaded from disk are forgotten once unlinked
+	g.Expect(n.expired.Len()).To(Equal(1))
+}
+
+func TestPrune(t *testing.T) {
+	g := NewGomegaWithT(t)
+	n := NewNotifier(nil, nil, "")
+	n.update(testMember("1"), testUser(false, false))
+	n.update(testMember("2"), testUser(false))
+	g.Expect(n.expired.Len()).To(Equal(3))
+
+	// Unlinked accounts are forgotten
+	n.update(testMember("1"), testUser(false))
+	g.Expect(n.expired.Len()).To(Equal(2))
+
+	// Members who leave are forgotten
+	n.onGuildMemberRemove(nil, &discordgo.GuildMemberRemove{Member: &discordgo.Member{GuildID: "1", User: &discordgo.User{ID: "1"}}})
+	g.Expect(n.expired.Len()).To(Equal(1))
+	g.Expect(n.update(testMember("1"), testUser(true))).To(BeEmpty())
+}
+
+func TestShouldNotify(t *testing.T) {
+	g := NewGomegaWithT(t)
+	n := NewNotifier(nil, nil, "")
+	g.Expect(n.shouldNotify("1", "a")).To(BeTrue())
+	g.Expect(n.shouldNotify("1", "a")).To(BeFalse())
+	g.Expect(n.shouldNotify("1", "b")).To(BeTrue())
+}
+
+func TestLastSuccess(t *testing.T) {
+	g := NewGomegaWithT(t)
+	last := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	account := api.Account{ApiKeys: []api.TokenInfo{{LastSuccess: last.Add(-time.Hour)}, {LastSuccess: last}}}
+	g.Expect(LastSuccess(account)).To(Equal(last))
+	g.Expect(LastSuccess(api.Account{})).To(BeZero())
+}
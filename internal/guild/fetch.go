@@ -0,0 +1,173 @@
+package guild
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrGunflame/gw2api"
+)
+
+var (
+	// ErrRateLimited means the GW2 API rejected the request, or the request would exceed the rate budget of the bot
+	ErrRateLimited = errors.New("gw2 api rate limit exceeded")
+	// ErrGuildNotFound means the GW2 API does not know the guild, e.g. because it was disbanded
+	ErrGuildNotFound = errors.New("guild not found")
+)
+
+// FetchError is returned when guild info could not be fetched from the GW2 API
+type FetchError struct {
+	GuildID string
+	Err     error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("unable to fetch guild %s: %v", e.GuildID, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Texts of the errors returned by the GW2 API, which does not expose the status code of the response through the client
+const (
+	gw2TextTooManyRequests = "too many requests"
+	gw2TextNoSuchID        = "no such id"
+)
+
+// classifyError translates errors from the GW2 API into ErrRateLimited or ErrGuildNotFound, where possible.
+// Only the exact error texts of the GW2 API are matched, as other errors, e.g. an invalid api key, say nothing about
+// whether the guild exists
+func classifyError(err error) error {
+	if errors.Is(err, gw2api.ErrNotFound) {
+		return ErrGuildNotFound
+	}
+	var apiErr *gw2api.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(apiErr.Error())) {
+	case gw2TextTooManyRequests:
+		return ErrRateLimited
+	case gw2TextNoSuchID:
+		return ErrGuildNotFound
+	default:
+		return err
+	}
+}
+
+const (
+	// The GW2 API allows bursts of 300 requests, refilled at 5 requests per second.
+	// Stay below that, as the backend and other tools may share the same address
+	gw2RequestBurst      = 200
+	gw2RequestsPerSecond = 4
+	// gw2MaxWait is the longest a request waits for the rate budget, before giving up with ErrRateLimited
+	gw2MaxWait = 5 * time.Second
+	// gw2Backoff is how long all requests are paused, once the GW2 API reports too many requests
+	gw2Backoff = 30 * time.Second
+)
+
+// rateLimiter is a token bucket shared by all requests to the GW2 API
+type rateLimiter struct {
+	m            sync.Mutex
+	tokens       float64
+	burst        float64
+	rate         float64
+	last         time.Time
+	blockedUntil time.Time
+	now          func() time.Time
+}
+
+func newRateLimiter(burst int, perSecond float64) *rateLimiter {
+	return &rateLimiter{
+		tokens: float64(burst),
+		burst:  float64(burst),
+		rate:   perSecond,
+		now:    time.Now,
+	}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+// If the wait would be longer than maxWait, no token is taken and ok is false
+func (r *rateLimiter) reserve(maxWait time.Duration) (wait time.Duration, ok bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	now := r.now()
+	if !r.last.IsZero() {
+		r.tokens = min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	}
+	r.last = now
+
+	if r.blockedUntil.After(now) {
+		wait = r.blockedUntil.Sub(now)
+	}
+	if r.tokens < 1 {
+		wait = max(wait, time.Duration((1-r.tokens)/r.rate*float64(time.Second)))
+	}
+	if wait > maxWait {
+		return wait, false
+	}
+	r.tokens--
+	return wait, true
+}
+
+// wait blocks until a request may be sent, or returns ErrRateLimited if that takes longer than maxWait
+func (r *rateLimiter) wait(maxWait time.Duration) error {
+	wait, ok := r.reserve(maxWait)
+	if !ok {
+		return ErrRateLimited
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+// backoff pauses all requests for the duration, after the GW2 API reported too many requests
+func (r *rateLimiter) backoff(d time.Duration) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.tokens = 0
+	r.blockedUntil = r.now().Add(d)
+}
+
+// flight is a fetch in progress, which concurrent fetches of the same guild wait for
+type flight struct {
+	done  chan struct{}
+	guild gw2api.Guild
+	err   error
+}
+
+// flightGroup ensures only one fetch is in progress for each guild at a time
+type flightGroup struct {
+	m       sync.Mutex
+	flights map[string]*flight
+}
+
+// do calls fn, unless a call for the same key is already in progress, in which case its result is shared
+func (f *flightGroup) do(key string, fn func() (gw2api.Guild, error)) (gw2api.Guild, error) {
+	f.m.Lock()
+	if f.flights == nil {
+		f.flights = make(map[string]*flight)
+	}
+	if existing, ok := f.flights[key]; ok {
+		f.m.Unlock()
+		<-existing.done
+		return existing.guild, existing.err
+	}
+	current := &flight{done: make(chan struct{})}
+	f.flights[key] = current
+	f.m.Unlock()
+
+	current.guild, current.err = fn()
+
+	f.m.Lock()
+	delete(f.flights, key)
+	f.m.Unlock()
+	close(current.done)
+	return current.guild, current.err
+}
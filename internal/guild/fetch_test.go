@@ -0,0 +1,96 @@
+package guild
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MrGunflame/gw2api"
+	. "github.com/onsi/gomega"
+)
+
+func TestClassifyError(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(classifyError(&gw2api.Error{Text: "too many requests"})).To(MatchError(ErrRateLimited))
+	g.Expect(classifyError(&gw2api.Error{Text: "no such id"})).To(MatchError(ErrGuildNotFound))
+	g.Expect(classifyError(gw2api.ErrNotFound)).To(MatchError(ErrGuildNotFound))
+
+	// Other errors of the GW2 API must not remove the guild from the cache
+	for _, text := range []string{"invalid key", "Invalid access token", "ErrBadRequest: invalid request", "endpoint not found"} {
+		apiErr := &gw2api.Error{Text: text}
+		g.Expect(classifyError(apiErr)).To(Equal(error(apiErr)), text)
+	}
+
+	other := errors.New("connection refused")
+	g.Expect(classifyError(other)).To(Equal(other))
+
+	err := error(&FetchError{GuildID: "1", Err: ErrRateLimited})
+	g.Expect(errors.Is(err, ErrRateLimited)).To(BeTrue())
+}
+
+func TestRateLimiter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(2, 1)
+	limiter.now = func() time.Time { return now }
+
+	// Burst
+	wait, ok := limiter.reserve(0)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(wait).To(BeZero())
+	_, ok = limiter.reserve(0)
+	g.Expect(ok).To(BeTrue())
+
+	// Budget exhausted
+	_, ok = limiter.reserve(0)
+	g.Expect(ok).To(BeFalse())
+	wait, ok = limiter.reserve(time.Second)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(wait).To(Equal(time.Second))
+
+	// Refilled
+	now = now.Add(3 * time.Second)
+	wait, ok = limiter.reserve(0)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(wait).To(BeZero())
+
+	// Backoff pauses everything
+	limiter.backoff(time.Minute)
+	now = now.Add(10 * time.Second)
+	_, ok = limiter.reserve(time.Second)
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var group flightGroup
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]gw2api.Guild, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = group.do("1", func() (gw2api.Guild, error) {
+				calls.Add(1)
+				<-release
+				return gw2api.Guild{ID: "1"}, nil
+			})
+		}()
+	}
+
+	g.Eventually(calls.Load).Should(Equal(int32(1)))
+	// Give the other callers time to join the flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	g.Expect(calls.Load()).To(Equal(int32(1)))
+	for _, result := range results {
+		g.Expect(result.ID).To(Equal("1"))
+	}
+}
@@ -1,18 +1,26 @@
 package guild
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/MrGunflame/gw2api"
 	"github.com/bwmarrin/discordgo"
 	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
 	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
 	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
 	"github.com/vennekilde/gw2-alliance-bot/internal/nick"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+	"github.com/vennekilde/gw2-alliance-bot/internal/store"
+	"github.com/vennekilde/gw2-alliance-bot/internal/webhook"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
 	"go.uber.org/zap"
 )
 
@@ -22,18 +30,22 @@ var (
 )
 
 type GuildRoleHandler struct {
-	discord *discordgo.Session
-	cache   *discord.Cache
-	guilds  *Guilds
-	service *backend.Service
+	discord  *discordgo.Session
+	cache    *discord.Cache
+	guilds   *Guilds
+	service  *backend.Service
+	audit    *audit.Log
+	webhooks *webhook.Dispatcher
 }
 
-func NewGuildRoleHandler(discord *discordgo.Session, cache *discord.Cache, guilds *Guilds, service *backend.Service) *GuildRoleHandler {
+func NewGuildRoleHandler(discord *discordgo.Session, cache *discord.Cache, guilds *Guilds, service *backend.Service, auditLog *audit.Log, webhooks *webhook.Dispatcher) *GuildRoleHandler {
 	return &GuildRoleHandler{
-		discord: discord,
-		cache:   cache,
-		guilds:  guilds,
-		service: service,
+		discord:  discord,
+		cache:    cache,
+		guilds:   guilds,
+		service:  service,
+		audit:    auditLog,
+		webhooks: webhooks,
 	}
 }
 
@@ -55,9 +67,8 @@ func (g *GuildRoleHandler) GetMemberGuildFromRoles(member *discordgo.Member) *gw
 			continue
 		}
 
-		matches := RegexRoleNameMatcher.FindStringSubmatch(role.Name)
-		if len(matches) > 1 {
-			guild, _ = g.guilds.GetGuildInfoByName(matches[1])
+		if RegexRoleNameMatcher.MatchString(role.Name) {
+			guild, _ = g.guilds.GetGuildInfoByTagAndName(role.Name)
 			// Return early, if the role name matches the guild tag in the nickname
 			if guild != nil && guild.Tag == tag {
 				break
@@ -69,7 +80,7 @@ func (g *GuildRoleHandler) GetMemberGuildFromRoles(member *discordgo.Member) *gw
 }
 
 func (g *GuildRoleHandler) CheckGuildTags(guildID string, member *discordgo.Member) {
-	if g.service.GetSetting(guildID, backend.SettingGuildTagRepEnabled) != "true" {
+	if !g.service.GetBool(guildID, backend.SettingGuildTagRepEnabled) {
 		return
 	}
 
@@ -97,7 +108,7 @@ func (g *GuildRoleHandler) CheckGuildTags(guildID string, member *discordgo.Memb
 	if len(guildRoleTags) == 0 {
 		if guildTag != "" {
 			// Remove guild tag from member
-			err := nick.RemoveGuildTagFromNick(g.discord, member)
+			err := nick.RemoveGuildTagFromNick(g.discord, g.audit, member, "audit.reasons.no_guild_role")
 			if err != nil {
 				zap.L().Warn("unable to remove guild tag from member", zap.Any("member", member), zap.Error(err))
 			}
@@ -120,7 +131,7 @@ func (g *GuildRoleHandler) CheckGuildTags(guildID string, member *discordgo.Memb
 	for _, tag := range guildRoleTags {
 		// Just need to pick one
 		if tag != "" {
-			err := nick.SetGuildTagAsNick(g.discord, member, tag)
+			err := nick.SetGuildTagAsNick(g.discord, g.audit, member, tag, "audit.reasons.guild_tag")
 			if err != nil {
 				zap.L().Warn("unable to set guild tag as nickname", zap.Any("member", member), zap.Error(err))
 				continue
@@ -130,24 +141,29 @@ func (g *GuildRoleHandler) CheckGuildTags(guildID string, member *discordgo.Memb
 	}
 }
 
-func (g *GuildRoleHandler) CheckRoles(guildID string, member *discordgo.Member, roles []string, accounts []api.Account, addedRole string) {
-	verificationRole := g.service.GetSetting(guildID, backend.SettingGuildCommonRole)
-	verifiedRoles := g.service.GetSettingSlice(guildID, backend.SettingGuildVerifyRoles)
-	isVerified := false
-	hasVerifiedRole := false
-
-	var fallbackGuildRole string
-	assignAddedRoleIfNeeded := false
+// CheckRoles ensures the member has the guild roles and the guild verification role they are entitled to
+func (g *GuildRoleHandler) CheckRoles(guildID string, member *discordgo.Member, roles []string, accounts []api.Account, preferredRole string) {
+	decisions, err := g.PlanRoles(guildID, member, roles, accounts, preferredRole)
+	if err != nil {
+		zap.L().Warn("unable to plan guild roles", zap.Any("guilds", accounts), zap.Error(err))
+		return // Partial failure, try again later
+	}
 
-	assignedGuildRoles := make(map[string]bool, 8)
-	// Ensure at least a role is evaluated, in case multiple role updates are sent that overwrite each other
-	if addedRole != "" && !slices.Contains(roles, addedRole) {
-		// Add the added role to the list of roles
-		roles = append(roles, addedRole)
-		assignAddedRoleIfNeeded = true
+	applied, err := reconcile.Apply(g.discord, g.audit, guildID, member.User.ID, decisions)
+	if err != nil {
+		zap.L().Warn("unable to update guild roles of member", zap.Any("member", member), zap.Error(err))
 	}
+	g.webhooks.SendAll(webhook.RoleEvents(webhook.EventGuildRoleGranted, webhook.EventGuildRoleRemoved, guildID, member.User.ID, applied))
+}
+
+// PlanRoles decides which guild roles, guild verification role and associated roles the member should have, and why, without changing anything.
+// preferredRole is a guild role the member picked themselves, which is kept if only one guild role can be represented
+func (g *GuildRoleHandler) PlanRoles(guildID string, member *discordgo.Member, roles []string, accounts []api.Account, preferredRole string) ([]reconcile.Decision, error) {
+	verificationRole := g.service.GetSetting(guildID, backend.SettingGuildCommonRole)
+	verifiedRoles := g.service.GetRoles(guildID, backend.SettingGuildVerifyRoles)
 
-	// Check if user is a member of the guild that they have a role for¨
+	hasVerifiedRole := false
+	var memberGuildRoles []string
 	for _, roleID := range roles {
 		// Flag if user has a the common guild verification role
 		if roleID == verificationRole {
@@ -160,11 +176,20 @@ func (g *GuildRoleHandler) CheckRoles(guildID string, member *discordgo.Member,
 		if role == nil || !RegexRoleNameMatcher.MatchString(role.Name) {
 			continue
 		}
-
-		assignedGuildRoles[role.ID] = false
+		memberGuildRoles = append(memberGuildRoles, roleID)
 	}
 
-	serverCache := g.cache.Servers[guildID]
+	serverCache := g.cache.Server(guildID)
+
+	// Guild roles on the server for the guilds the accounts are in, with the first account in each guild
+	guildRoleAccounts := make(map[string]string)
+	var availableGuildRoles []string
+	isVerified := false
+	verifiedReason := "audit.reasons.no_linked_account"
+	var verifiedReasonData map[string]interface{}
+	if len(accounts) > 0 {
+		verifiedReason = "audit.reasons.not_in_server_guild"
+	}
 
 	for _, account := range accounts {
 		if account.Guilds == nil {
@@ -173,110 +198,132 @@ func (g *GuildRoleHandler) CheckRoles(guildID string, member *discordgo.Member,
 
 		gw2Guilds, partial := g.guilds.GetGuildsInfo(account.Guilds)
 		if partial {
-			zap.L().Warn("partial failure fetching guilds", zap.Any("guilds", account.Guilds))
-			return // Partial failure, try again later
+			return nil, errors.New("partial failure fetching guilds")
 		}
 		for _, guild := range gw2Guilds {
 			guildFQDN := fmt.Sprintf("[%s] %s", guild.Tag, guild.Name)
 			role := serverCache.FindRoleByTagAndName(guildFQDN)
-			if role != nil {
-				if fallbackGuildRole == "" {
-					// Keep role as backup
-					fallbackGuildRole = role.ID
-				}
+			if role == nil {
+				continue
+			}
 
-				if _, ok := assignedGuildRoles[role.ID]; ok {
-					// Mark the role as permitted
-					assignedGuildRoles[role.ID] = true
-				}
+			if _, ok := guildRoleAccounts[role.ID]; !ok {
+				guildRoleAccounts[role.ID] = account.Name
+				availableGuildRoles = append(availableGuildRoles, role.ID)
+			}
 
-				if !isVerified && (len(verifiedRoles) == 0 || slices.Contains(verifiedRoles, role.ID)) {
-					// Ensure they are allowed to be verified
-					if g.CanHaveGuildVerifiedRole(guildID, account.ApiKeys) {
-						isVerified = true
-					}
+			if isVerified {
+				continue
+			}
+			// Ensure they are allowed to be verified
+			if len(verifiedRoles) > 0 && !slices.Contains(verifiedRoles, role.ID) {
+				if verifiedReason == "audit.reasons.not_in_server_guild" {
+					verifiedReason = "audit.reasons.not_in_verified_guild"
 				}
+				continue
+			}
+			missing := g.MissingPermissions(guildID, account.ApiKeys)
+			if len(missing) > 0 {
+				verifiedReason = "audit.reasons.missing_permission"
+				verifiedReasonData = resources.TData("account", account.Name, "permissions", strings.Join(missing, "`, `"))
+				continue
 			}
+			isVerified = true
+			verifiedReason = "audit.reasons.verified"
+			verifiedReasonData = resources.TData("account", account.Name, "guild", guildFQDN)
 		}
 	}
 
+	decisions := []reconcile.Decision{}
+
 	// Remove guild roles not allowed
-	for roleID, allowed := range assignedGuildRoles {
-		if !allowed {
-			err := g.discord.GuildMemberRoleRemove(guildID, member.User.ID, roleID)
-			if err != nil {
-				zap.L().Warn("unable to remove role from member", zap.Any("role", roleID), zap.Any("member", member), zap.Error(err))
-			}
-			delete(assignedGuildRoles, roleID)
+	var allowedGuildRoles []string
+	for _, roleID := range memberGuildRoles {
+		if _, ok := guildRoleAccounts[roleID]; ok {
+			allowedGuildRoles = append(allowedGuildRoles, roleID)
+			continue
 		}
-	}
-
-	// Check if user should have a guild role
-	enforceGuildRep := g.service.GetSetting(guildID, backend.SettingEnforceGuildRep) == "true"
-	if enforceGuildRep && len(assignedGuildRoles) == 0 && fallbackGuildRole != "" {
-		// Add fallback guild role, if user does not have any guild roles assigned
-		err := g.discord.GuildMemberRoleAdd(guildID, member.User.ID, fallbackGuildRole)
-		if err != nil {
-			zap.L().Warn("unable to add role to member", zap.Any("role", fallbackGuildRole), zap.Any("member", member), zap.Error(err))
+		decisions = append(decisions, reconcile.Decision{
+			RoleID: roleID,
+			Has:    true,
+			Want:   false,
+			Reason: "audit.reasons.not_in_guild",
+		})
+	}
+
+	// Only one guild role can be represented, preferring the role the member picked
+	var roleToKeep string
+	if slices.Contains(allowedGuildRoles, preferredRole) {
+		roleToKeep = preferredRole
+	} else if len(allowedGuildRoles) > 0 {
+		roleToKeep = allowedGuildRoles[0]
+	}
+	for _, roleID := range allowedGuildRoles {
+		decision := reconcile.Decision{
+			RoleID:     roleID,
+			Has:        true,
+			Want:       roleID == roleToKeep,
+			Reason:     "audit.reasons.in_guild",
+			ReasonData: resources.TData("account", guildRoleAccounts[roleID]),
 		}
-	} else if assignAddedRoleIfNeeded && len(assignedGuildRoles) == 1 {
-		// Due to multiple role updates, the added role is not in the list of assigned roles
-		if assignedGuildRoles[addedRole] {
-			// Add the added role to the list of assigned roles
-			err := g.discord.GuildMemberRoleAdd(guildID, member.User.ID, addedRole)
-			if err != nil {
-				zap.L().Warn("unable to add role to member", zap.Any("role", addedRole), zap.Any("member", member), zap.Error(err))
-			}
+		if roleID != roleToKeep {
+			decision.Reason = "audit.reasons.multiple_guild_roles"
+			decision.ReasonData = nil
+		} else if roleID == preferredRole {
+			decision.Reason = "audit.reasons.picked_guild"
+			decision.ReasonData = nil
 		}
+		decisions = append(decisions, decision)
 	}
 
-	// Check if user has too many guild roles
-	if len(assignedGuildRoles) > 1 {
-		var roleToKeep string
-		// Check if addedRole is in the list of assigned roles
-		if addedRole != "" {
-			if allowed := assignedGuildRoles[addedRole]; allowed {
-				// Keep the added role
-				roleToKeep = addedRole
-			}
+	// Check if user should have a guild role
+	enforceGuildRep := g.service.GetBool(guildID, backend.SettingEnforceGuildRep)
+	for _, roleID := range availableGuildRoles {
+		if slices.Contains(memberGuildRoles, roleID) {
+			continue
 		}
-
-		for roleID := range assignedGuildRoles {
-			if roleToKeep == "" {
-				// Keep the first role we find
-				roleToKeep = roleID
-				continue
-			}
-			if roleID == roleToKeep {
-				// Skip the role we want to keep
-				continue
-			}
-
-			err := g.discord.GuildMemberRoleRemove(guildID, member.User.ID, roleID)
-			if err != nil {
-				zap.L().Warn("unable to remove role from member", zap.Any("role", roleID), zap.Any("member", member), zap.Error(err))
-			}
+		decision := reconcile.Decision{
+			RoleID:     roleID,
+			Has:        false,
+			Want:       false,
+			Reason:     "audit.reasons.guild_available",
+			ReasonData: resources.TData("account", guildRoleAccounts[roleID]),
+		}
+		if enforceGuildRep && roleToKeep == "" {
+			// Add fallback guild role, if user does not have any guild roles assigned
+			roleToKeep = roleID
+			decision.Want = true
+			decision.Reason = "audit.reasons.enforce_guild_rep"
 		}
+		decisions = append(decisions, decision)
 	}
 
 	if verificationRole != "" {
-		if !isVerified && hasVerifiedRole {
-			// Remove verified role, if user was not verified above
-			err := g.discord.GuildMemberRoleRemove(guildID, member.User.ID, verificationRole)
-			if err != nil {
-				zap.L().Warn("unable to remove role from member", zap.Any("role", verificationRole), zap.Any("member", member), zap.Error(err))
+		decisions = append(decisions, reconcile.Decision{
+			RoleID:     verificationRole,
+			Has:        hasVerifiedRole,
+			Want:       isVerified,
+			Reason:     verifiedReason,
+			ReasonData: verifiedReasonData,
+		})
+
+		// Additional associated roles are removed together with the verification role
+		for _, roleID := range g.service.GetRoles(guildID, backend.SettingRolesToRemoveWhenNotInGuild) {
+			hasRole := slices.Contains(member.Roles, roleID)
+			decision := reconcile.Decision{
+				RoleID: roleID,
+				Has:    hasRole,
+				Want:   hasRole,
+				Reason: "audit.reasons.associated_unchanged",
 			}
-
-			// Remove additional associated roles, if the setting is enabled
-			g.RemoveAssociatedRolesIfNeeded(guildID, member.User.ID)
-		} else if isVerified && !hasVerifiedRole {
-			// Add verified role, if user is verified, but does not have it
-			err := g.discord.GuildMemberRoleAdd(guildID, member.User.ID, verificationRole)
-			if err != nil {
-				zap.L().Warn("unable to add role to member", zap.Any("role", verificationRole), zap.Any("member", member), zap.Error(err))
+			if !isVerified && hasVerifiedRole {
+				decision.Want = false
+				decision.Reason = "audit.reasons.not_verified"
 			}
+			decisions = append(decisions, decision)
 		}
 	}
+	return decisions, nil
 }
 
 // CanHaveGuildVerifiedRoleAccounts returns true if just one of the accounts has the required API Key permissions to have the guild verification role on this server
@@ -291,9 +338,14 @@ func (g *GuildRoleHandler) CanHaveGuildVerifiedRoleAccounts(guildID string, acco
 
 // CanHaveGuildVerifiedRole check if the user has the required API Key permissions to have the guild verification role on this server
 func (g *GuildRoleHandler) CanHaveGuildVerifiedRole(guildID string, apiKeys []api.TokenInfo) bool {
-	requiredPermissions := g.service.GetSettingSlice(guildID, backend.SettingGuildRequiredPermissions)
+	return len(g.MissingPermissions(guildID, apiKeys)) == 0
+}
+
+// MissingPermissions returns the API Key permissions required by this server, that none of the api keys have
+func (g *GuildRoleHandler) MissingPermissions(guildID string, apiKeys []api.TokenInfo) []string {
+	requiredPermissions := g.service.GetPermissions(guildID, backend.SettingGuildRequiredPermissions)
 	if len(requiredPermissions) == 0 {
-		return true
+		return nil
 	}
 
 	apiPermissions := make(map[string]struct{})
@@ -306,22 +358,21 @@ func (g *GuildRoleHandler) CanHaveGuildVerifiedRole(guildID string, apiKeys []ap
 		}
 	}
 
-outer:
+	var missing []string
 	for _, requiredPermission := range requiredPermissions {
-		for permission := range apiPermissions {
-			if permission == requiredPermission {
-				continue outer
-			}
+		if _, ok := apiPermissions[requiredPermission]; !ok {
+			missing = append(missing, requiredPermission)
 		}
-		return false
 	}
-	return true
+	return missing
 }
 
 func (g *GuildRoleHandler) SetGuildRole(guildID string, userID string, roleID string) error {
-	member, err := g.discord.GuildMember(guildID, userID)
+	member, err := g.cache.GetMember(guildID, userID)
 	if err != nil {
 		return err
+	} else if member == nil {
+		return fmt.Errorf("user %s is not a member of the server", userID)
 	}
 
 	verificationRole := g.service.GetSetting(guildID, backend.SettingGuildCommonRole)
@@ -338,6 +389,8 @@ func (g *GuildRoleHandler) SetGuildRole(guildID string, userID string, roleID st
 			err := g.discord.GuildMemberRoleRemove(guildID, userID, memberRoleID)
 			if err != nil {
 				zap.L().Error("unable to remove role from member", zap.String("guildID", guildID), zap.String("userID", userID), zap.Error(err))
+			} else {
+				g.audit.RoleRemoved(guildID, userID, memberRoleID, "audit.reasons.rep_other_guild")
 			}
 		}
 	}
@@ -347,36 +400,173 @@ func (g *GuildRoleHandler) SetGuildRole(guildID string, userID string, roleID st
 		if err != nil {
 			return err
 		}
+		if !slices.Contains(member.Roles, verificationRole) {
+			g.audit.RoleAdded(guildID, userID, verificationRole, "audit.reasons.verified")
+		}
 	}
 
 	err = g.discord.GuildMemberRoleAdd(guildID, userID, roleID)
 	if err != nil {
 		return err
 	}
+	if !slices.Contains(member.Roles, roleID) {
+		g.audit.RoleAdded(guildID, userID, roleID, "audit.reasons.rep_guild")
+	}
 
 	return nil
 }
 
-func (g *GuildRoleHandler) RemoveAssociatedRolesIfNeeded(guildID string, userID string) {
-	rolesToRemove := g.service.GetSettingSlice(guildID, backend.SettingRolesToRemoveWhenNotInGuild)
-	for _, roleID := range rolesToRemove {
-		err := g.discord.GuildMemberRoleRemove(guildID, userID, roleID)
+const (
+	// guildCacheTTL is how long guild info is used before it is fetched again, to pick up tag and name changes
+	guildCacheTTL = 24 * time.Hour
+	// guildRefreshInterval is how often stale guilds are refreshed and the cache is saved
+	guildRefreshInterval = 10 * time.Minute
+	// guildRefreshBatchSize limits how many stale guilds are refreshed at a time, to stay within the rate limits of the GW2 API
+	guildRefreshBatchSize = 100
+)
+
+type Guilds struct {
+	m       sync.RWMutex
+	gw2API  *gw2api.Session
+	cache   *store.Store[gw2api.Guild]
+	limiter *rateLimiter
+	flights flightGroup
+
+	// byName and byTagAndName index the cached guilds by name and by "[TAG] Name"
+	byName       map[string]string
+	byTagAndName map[string]string
+	// indexed keeps the indexed name and "[TAG] Name" of each guild, so they can be removed from the index if they change
+	indexed map[string][2]string
+}
+
+// NewGuilds creates a guild info cache, persisted in dataDir. If dataDir is empty, the cache is only kept in memory
+func NewGuilds(dataDir string) *Guilds {
+	var path string
+	if dataDir != "" {
+		path = filepath.Join(dataDir, "guilds.json")
+	}
+	cache, err := store.Open[gw2api.Guild](path, guildCacheTTL)
+	if err != nil {
+		zap.L().Error("unable to load guild cache, starting with an empty cache", zap.String("path", path), zap.Error(err))
+		cache, _ = store.Open[gw2api.Guild]("", guildCacheTTL)
+	}
+
+	g := &Guilds{
+		cache:        cache,
+		gw2API:       gw2api.New(),
+		limiter:      newRateLimiter(gw2RequestBurst, gw2RequestsPerSecond),
+		byName:       make(map[string]string),
+		byTagAndName: make(map[string]string),
+		indexed:      make(map[string][2]string),
+	}
+	cache.Range(func(key string, entry store.Entry[gw2api.Guild]) bool {
+		g.index(entry.Value)
+		return true
+	})
+	zap.L().Info("loaded guild cache", zap.Int("guilds", cache.Len()))
+	return g
+}
+
+// Start periodically refreshes stale guilds and saves the cache
+func (g *Guilds) Start() {
+	go func() {
+		ticker := time.NewTicker(guildRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			g.refreshStale()
+			g.Save()
+		}
+	}()
+}
+
+// Save writes the cache to disk
+func (g *Guilds) Save() {
+	err := g.cache.Save()
+	if err != nil {
+		zap.L().Error("unable to save guild cache", zap.Error(err))
+	}
+}
+
+func (g *Guilds) refreshStale() {
+	stale := g.cache.Stale()
+	if len(stale) > guildRefreshBatchSize {
+		stale = stale[:guildRefreshBatchSize]
+	}
+
+	for _, guildID := range stale {
+		_, err := g.fetch(guildID)
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrGuildNotFound):
+			// The guild no longer exists
+			zap.L().Info("removing guild from cache", zap.String("guild id", guildID), zap.Error(err))
+			g.cache.Delete(guildID)
+			g.unindex(guildID)
+		case errors.Is(err, ErrRateLimited):
+			// Try again later
+			return
+		default:
+			// Keep using the stale guild info, and try again later
+			zap.L().Warn("unable to refresh guild", zap.String("guild id", guildID), zap.Error(err))
+		}
+	}
+}
+
+// fetch gets the guild from the GW2 API and caches it. Concurrent fetches of the same guild share a single request
+func (g *Guilds) fetch(guildID string) (*gw2api.Guild, error) {
+	guild, err := g.flights.do(guildID, func() (gw2api.Guild, error) {
+		err := g.limiter.wait(gw2MaxWait)
 		if err != nil {
-			zap.L().Warn("unable to remove associated role from member", zap.String("guildID", guildID), zap.String("userID", userID), zap.String("roleID", roleID), zap.Error(err))
+			return gw2api.Guild{}, err
 		}
+
+		guild, err := g.gw2API.Guild(guildID, false)
+		if err != nil {
+			err = classifyError(err)
+			if errors.Is(err, ErrRateLimited) {
+				g.limiter.backoff(gw2Backoff)
+			}
+			return guild, err
+		}
+		g.cache.Set(guildID, guild)
+		g.index(guild)
+		return guild, nil
+	})
+	if err != nil {
+		return nil, &FetchError{GuildID: guildID, Err: err}
 	}
+	return &guild, nil
 }
 
-type Guilds struct {
-	gw2API *gw2api.Session
-	cache  map[string]*gw2api.Guild
+func (g *Guilds) index(guild gw2api.Guild) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.unindexLocked(guild.ID)
+
+	tagAndName := fmt.Sprintf("[%s] %s", guild.Tag, guild.Name)
+	g.byName[guild.Name] = guild.ID
+	g.byTagAndName[tagAndName] = guild.ID
+	g.indexed[guild.ID] = [2]string{guild.Name, tagAndName}
+}
+
+func (g *Guilds) unindex(guildID string) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.unindexLocked(guildID)
 }
 
-func NewGuilds() *Guilds {
-	return &Guilds{
-		cache:  make(map[string]*gw2api.Guild),
-		gw2API: gw2api.New(),
+func (g *Guilds) unindexLocked(guildID string) {
+	previous, ok := g.indexed[guildID]
+	if !ok {
+		return
+	}
+	if g.byName[previous[0]] == guildID {
+		delete(g.byName, previous[0])
+	}
+	if g.byTagAndName[previous[1]] == guildID {
+		delete(g.byTagAndName, previous[1])
 	}
+	delete(g.indexed, guildID)
 }
 
 func (g *Guilds) GetGuildsInfo(guildIds *[]string) (guilds []*gw2api.Guild, partial bool) {
@@ -398,42 +588,65 @@ func (g *Guilds) GetGuildsInfo(guildIds *[]string) (guilds []*gw2api.Guild, part
 	return guilds, partial
 }
 
+// FetchGuild returns the guild info, fetching it from the GW2 API if it is not cached.
+// Stale guild info is returned as is, as it is refreshed in the background.
+// Errors wrap ErrRateLimited or ErrGuildNotFound, where applicable
+func (g *Guilds) FetchGuild(guildID string) (*gw2api.Guild, error) {
+	cached, ok, _ := g.cache.Get(guildID)
+	if ok {
+		return &cached, nil
+	}
+	return g.fetch(guildID)
+}
+
+// GetGuildInfo returns the guild info, or partial if it could not be fetched right now
 func (g *Guilds) GetGuildInfo(guildId string) (guild *gw2api.Guild, partial bool) {
 	if guildId == "" {
 		return nil, false
 	}
 
-	guild, ok := g.cache[guildId]
-	if !ok {
-		// Fetch guild from gw2api
-		gw2ApiGuild, err := g.gw2API.Guild(guildId, false)
-		if err != nil {
-			guild = &gw2api.Guild{
-				ID: guildId,
-			}
-			zap.L().Warn("unable to fetch guild", zap.String("guild id", guildId), zap.Error(err))
-			if err.Error() == "too many requests" {
-				time.Sleep(5 * time.Second)
-			}
-			return guild, true
-		}
-		g.cache[guildId] = &gw2ApiGuild
-		guild = &gw2ApiGuild
+	guild, err := g.FetchGuild(guildId)
+	if errors.Is(err, ErrGuildNotFound) {
+		return nil, false
+	} else if err != nil {
+		zap.L().Warn("unable to fetch guild", zap.String("guild id", guildId), zap.Error(err))
+		return &gw2api.Guild{
+			ID: guildId,
+		}, true
 	}
-
-	return guild, partial
+	return guild, false
 }
 
 // GetGuildInfoByName returns the guild info by guild name
 // will only return a guild, if the guild has been fetched before
 func (g *Guilds) GetGuildInfoByName(guildName string) (guild *gw2api.Guild, partial bool) {
-	for _, guild := range g.cache {
-		if guild.Name == guildName {
-			return guild, false
-		}
+	g.m.RLock()
+	guildID, ok := g.byName[guildName]
+	g.m.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return g.GetGuildInfo(guildID)
+}
+
+// GetGuildInfoByTagAndName returns the guild info by guild tag and name, in the format "[TAG] Name" used for guild roles
+// will only return a guild, if the guild has been fetched before
+func (g *Guilds) GetGuildInfoByTagAndName(tagAndName string) (guild *gw2api.Guild, partial bool) {
+	g.m.RLock()
+	guildID, ok := g.byTagAndName[tagAndName]
+	g.m.RUnlock()
+	if !ok {
+		return nil, false
 	}
+	return g.GetGuildInfo(guildID)
+}
 
-	return nil, false
+// IsKnownTagAndName checks if a guild with the tag and name, in the format "[TAG] Name" used for guild roles, has been fetched before
+func (g *Guilds) IsKnownTagAndName(tagAndName string) bool {
+	g.m.RLock()
+	defer g.m.RUnlock()
+	_, ok := g.byTagAndName[tagAndName]
+	return ok
 }
 
 // GetServerGuilds returns a list of guilds that the server has
@@ -442,12 +655,9 @@ func (g *Guilds) GetServerGuilds(server *discordgo.Guild) (guilds []*gw2api.Guil
 
 	for _, role := range server.Roles {
 		if RegexRoleNameMatcher.MatchString(role.Name) {
-			matches := RegexGuildTagMatcher.FindStringSubmatch(role.Name)
-			if len(matches) > 1 {
-				guild, _ := g.GetGuildInfoByName(matches[1])
-				if guild != nil {
-					guilds = append(guilds, guild)
-				}
+			guild, _ := g.GetGuildInfoByTagAndName(role.Name)
+			if guild != nil {
+				guilds = append(guilds, guild)
 			}
 		}
 	}
@@ -0,0 +1,32 @@
+package guild
+
+import (
+	"testing"
+
+	"github.com/MrGunflame/gw2api"
+	. "github.com/onsi/gomega"
+)
+
+func TestGuildIndexFollowsRenames(t *testing.T) {
+	g := NewGomegaWithT(t)
+	guilds := NewGuilds("")
+
+	guild := gw2api.Guild{ID: "1", Tag: "PYRE", Name: "Cinder Ashes"}
+	guilds.cache.Set(guild.ID, guild)
+	guilds.index(guild)
+
+	found, _ := guilds.GetGuildInfoByTagAndName("[PYRE] Cinder Ashes")
+	g.Expect(found).ToNot(BeNil())
+	g.Expect(found.ID).To(Equal("1"))
+
+	guild.Tag = "ASH"
+	guilds.cache.Set(guild.ID, guild)
+	guilds.index(guild)
+
+	found, _ = guilds.GetGuildInfoByTagAndName("[PYRE] Cinder Ashes")
+	g.Expect(found).To(BeNil())
+	found, _ = guilds.GetGuildInfoByTagAndName("[ASH] Cinder Ashes")
+	g.Expect(found).ToNot(BeNil())
+	found, _ = guilds.GetGuildInfoByName("Cinder Ashes")
+	g.Expect(found).ToNot(BeNil())
+}
@@ -0,0 +1,92 @@
+package interaction
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/world"
+	"go.uber.org/zap"
+)
+
+// autocompleteLimit is the most choices discord accepts in an autocomplete response
+const autocompleteLimit = 25
+
+// focusedOption returns the option the user is typing in, looking into subcommands
+func focusedOption(options []*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, option := range options {
+		if option.Focused {
+			return option
+		}
+		if focused := focusedOption(option.Options); focused != nil {
+			return focused
+		}
+	}
+	return nil
+}
+
+// filterChoices returns the choices with a name containing query, ignoring case.
+// Choices starting with query are listed first, and no more than autocompleteLimit choices are returned
+func filterChoices(choices []*discordgo.ApplicationCommandOptionChoice, query string) []*discordgo.ApplicationCommandOptionChoice {
+	query = strings.ToLower(strings.TrimSpace(query))
+	var prefixed, contained []*discordgo.ApplicationCommandOptionChoice
+	for _, choice := range choices {
+		name := strings.ToLower(choice.Name)
+		switch {
+		case strings.HasPrefix(name, query):
+			prefixed = append(prefixed, choice)
+		case strings.Contains(name, query):
+			contained = append(contained, choice)
+		}
+	}
+	filtered := append(prefixed, contained...)
+	if len(filtered) > autocompleteLimit {
+		filtered = filtered[:autocompleteLimit]
+	}
+	return filtered
+}
+
+// respondChoices answers an autocomplete interaction with the choices
+func respondChoices(s *discordgo.Session, event *discordgo.InteractionCreate, choices []*discordgo.ApplicationCommandOptionChoice) {
+	if choices == nil {
+		// Discord rejects a missing list of choices
+		choices = []*discordgo.ApplicationCommandOptionChoice{}
+	}
+	err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		zap.L().Warn("unable to respond with autocomplete choices", zap.Error(err))
+	}
+}
+
+// worldChoices returns a choice for every world and WvW team, sorted by name. Teams are valued by the id of their equivalent world
+func worldChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(world.WorldNames)+len(world.TeamNames))
+	for _, w := range world.WorldsSorted() {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  w.Name,
+			Value: strconv.Itoa(w.ID),
+		})
+	}
+
+	teams := make([]world.Team, 0, len(world.TeamNames))
+	for _, team := range world.TeamNames {
+		teams = append(teams, team)
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		return teams[i].Name < teams[j].Name
+	})
+	for _, team := range teams {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  fmt.Sprintf("%s (%s)", team.Name, world.WorldNames[team.WorldEquivalentID].Name),
+			Value: strconv.Itoa(team.WorldEquivalentID),
+		})
+	}
+	return choices
+}
@@ -0,0 +1,60 @@
+package interaction
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFilterChoices(t *testing.T) {
+	g := NewGomegaWithT(t)
+	choices := []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "Fort Aspenwood", Value: "1009"},
+		{Name: "Far Shiverpeaks", Value: "2007"},
+		{Name: "Aurora Glade", Value: "2013"},
+	}
+
+	filtered := filterChoices(choices, " A")
+	g.Expect(filtered).To(HaveLen(3))
+	// Choices starting with the query come first
+	g.Expect(filtered[0].Name).To(Equal("Aurora Glade"))
+	g.Expect(filtered[1].Name).To(Equal("Fort Aspenwood"))
+	g.Expect(filtered[2].Name).To(Equal("Far Shiverpeaks"))
+
+	g.Expect(filterChoices(choices, "GLADE")).To(HaveLen(1))
+	g.Expect(filterChoices(choices, "kaineng")).To(BeEmpty())
+
+	many := make([]*discordgo.ApplicationCommandOptionChoice, 40)
+	for i := range many {
+		many[i] = &discordgo.ApplicationCommandOptionChoice{Name: fmt.Sprintf("choice %d", i)}
+	}
+	g.Expect(filterChoices(many, "")).To(HaveLen(autocompleteLimit))
+}
+
+func TestFocusedOption(t *testing.T) {
+	g := NewGomegaWithT(t)
+	options := []*discordgo.ApplicationCommandInteractionDataOption{
+		{
+			Name: "world",
+			Type: discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "world", Type: discordgo.ApplicationCommandOptionString, Value: "gan", Focused: true},
+			},
+		},
+	}
+	focused := focusedOption(options)
+	g.Expect(focused).ToNot(BeNil())
+	g.Expect(focused.StringValue()).To(Equal("gan"))
+	g.Expect(focusedOption(nil)).To(BeNil())
+}
+
+func TestWorldChoices(t *testing.T) {
+	g := NewGomegaWithT(t)
+	// Teams are valued by the world they are equivalent to
+	choices := filterChoices(worldChoices(), "Skrittsburgh")
+	g.Expect(choices).To(HaveLen(1))
+	g.Expect(choices[0].Name).To(Equal("Skrittsburgh (Fissure of Woe)"))
+	g.Expect(choices[0].Value).To(Equal("2001"))
+}
@@ -0,0 +1,248 @@
+package interaction
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/diagnose"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+)
+
+const (
+	InteractionIDDiagnoseRefresh = "diagnose-refresh"
+)
+
+// diagnoseMentionLimit is how many roles or members are mentioned in a single field of the report
+const diagnoseMentionLimit = 15
+
+type DiagnoseCmd struct {
+	diagnoser *diagnose.Diagnoser
+}
+
+func NewDiagnoseCmd(diagnoser *diagnose.Diagnoser) *DiagnoseCmd {
+	return &DiagnoseCmd{
+		diagnoser: diagnoser,
+	}
+}
+
+func (c *DiagnoseCmd) Register(i *Interactions) {
+	var permission int64 = discordgo.PermissionAdministrator
+	var permissionDM bool = false
+
+	// Diagnose cmd
+	i.addCommand(&Command{
+		command: &discordgo.ApplicationCommand{
+			Name:                     resources.T("cmd.diagnose.name"),
+			Description:              resources.T("cmd.diagnose.description"),
+			NameLocalizations:        resources.GetLocalizations("cmd.diagnose.name"),
+			DescriptionLocalizations: resources.GetLocalizations("cmd.diagnose.description"),
+			DefaultMemberPermissions: &permission,
+			DMPermission:             &permissionDM,
+		},
+		handler: c.onCommandDiagnose,
+	})
+
+	i.router.HandleFunc(InteractionIDDiagnoseRefresh, c.InteractRefresh)
+}
+
+func (c *DiagnoseCmd) onCommandDiagnose(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	if event.GuildID == "" {
+		onError(s, event, errors.New(resources.TL(locale, "settings.errors.server_only")))
+		return
+	}
+
+	report, err := c.diagnoser.Report(s, event.GuildID)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:           discordgo.MessageFlagsEphemeral,
+		Embeds:          []*discordgo.MessageEmbed{buildDiagnoseReport(report, locale)},
+		Components:      diagnoseComponents(locale),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// InteractRefresh replaces the report with a new one, e.g. after fixing the problems it listed
+func (c *DiagnoseCmd) InteractRefresh(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	report, err := c.diagnoser.Report(s, event.GuildID)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	err = s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Flags:           discordgo.MessageFlagsEphemeral,
+			Embeds:          []*discordgo.MessageEmbed{buildDiagnoseReport(report, locale)},
+			Components:      diagnoseComponents(locale),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+func diagnoseComponents(locale discordgo.Locale) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    resources.TL(locale, "diagnose.report.refresh"),
+					Style:    discordgo.SecondaryButton,
+					CustomID: InteractionIDDiagnoseRefresh,
+				},
+			},
+		},
+	}
+}
+
+// buildDiagnoseReport renders the report as an embed. It is red if the bot is unable to manage members,
+// orange if something else needs attention and green otherwise
+func buildDiagnoseReport(report *diagnose.Report, locale discordgo.Locale) *discordgo.MessageEmbed {
+	warnings := false
+	embed := &discordgo.MessageEmbed{
+		Title:       resources.TL(locale, "diagnose.report.title"),
+		Description: "**" + resources.TL(locale, "diagnose.permissions.title") + "**\n" + resources.TL(locale, "diagnose.permissions.ok"),
+	}
+	if len(report.Problems) > 0 {
+		embed.Description = "**" + resources.TL(locale, "diagnose.permissions.title") + "**\n" + formatProblems(report.Problems, locale)
+	}
+
+	// World links
+	if report.WorldEnabled {
+		value := "✅ " + resources.TL(locale, "diagnose.report.world_links.ok")
+		if !report.WorldLinksSynchronized {
+			value = "⚠️ " + resources.TL(locale, "diagnose.report.world_links.not_synchronized")
+			warnings = true
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  resources.TL(locale, "diagnose.report.world_links.name"),
+			Value: value,
+		})
+	}
+
+	// Settings
+	var settings string
+	switch {
+	case report.SettingsSynchronizedAt.IsZero():
+		settings = "⚠️ " + resources.TL(locale, "diagnose.report.settings.never")
+		warnings = true
+	case report.SettingsStale:
+		settings = "⚠️ " + resources.TL(locale, "diagnose.report.settings.stale", resources.TData("time", report.SettingsSynchronizedAt.Unix()))
+		warnings = true
+	default:
+		settings = "✅ " + resources.TL(locale, "diagnose.report.settings.ok", resources.TData("time", report.SettingsSynchronizedAt.Unix()))
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+		Name:  resources.TL(locale, "diagnose.report.settings.name"),
+		Value: settings,
+	})
+
+	// Configured roles that were deleted
+	if len(report.MissingRoles) > 0 {
+		lines := make([]string, len(report.MissingRoles))
+		for i, missing := range report.MissingRoles {
+			lines[i] = fmt.Sprintf("`%s`: `%s`", missing.Setting, missing.RoleID)
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  resources.TL(locale, "diagnose.report.missing_roles.name"),
+			Value: "⚠️ " + resources.TL(locale, "diagnose.report.missing_roles.description") + "\n" + joinLimited(lines, "\n", locale),
+		})
+		warnings = true
+	}
+
+	// Guild roles matching no known guild
+	if len(report.UnknownGuildRoles) > 0 {
+		mentions := make([]string, len(report.UnknownGuildRoles))
+		for i, roleID := range report.UnknownGuildRoles {
+			mentions[i] = "<@&" + roleID + ">"
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  resources.TL(locale, "diagnose.report.unknown_guild_roles.name"),
+			Value: "⚠️ " + resources.TL(locale, "diagnose.report.unknown_guild_roles.description") + "\n" + joinLimited(mentions, " ", locale),
+		})
+		warnings = true
+	}
+
+	// Members
+	var members string
+	if report.MembersLoaded {
+		members = resources.TL(locale, "diagnose.report.members.count", resources.TData(
+			"total", report.Members,
+			"verified", report.Verified,
+			"unverified", report.Unverified,
+			"unchecked", report.Members-report.Verified-report.Unverified,
+		))
+		if len(report.MultipleGuildRoles) > 0 {
+			mentions := make([]string, len(report.MultipleGuildRoles))
+			for i, userID := range report.MultipleGuildRoles {
+				mentions[i] = "<@" + userID + ">"
+			}
+			members += "\n⚠️ " + resources.TL(locale, "diagnose.report.members.multiple_guild_roles", resources.TData("count", len(report.MultipleGuildRoles))) +
+				"\n" + joinLimited(mentions, " ", locale)
+			warnings = true
+		}
+	} else {
+		members = resources.TL(locale, "diagnose.report.members.loading")
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+		Name:  resources.TL(locale, "diagnose.report.members.name"),
+		Value: members,
+	})
+
+	switch {
+	case len(report.Problems) > 0:
+		embed.Color = 0xE74C3C // red
+	case warnings:
+		embed.Color = 0xE67E22 // orange
+	default:
+		embed.Color = 0x2ECC71 // green
+	}
+	return embed
+}
+
+// joinLimited joins at most diagnoseMentionLimit items, noting how many were left out
+func joinLimited(items []string, sep string, locale discordgo.Locale) string {
+	if len(items) <= diagnoseMentionLimit {
+		return strings.Join(items, sep)
+	}
+	return strings.Join(items[:diagnoseMentionLimit], sep) + sep + resources.TL(locale, "diagnose.report.more", resources.TData("count", len(items)-diagnoseMentionLimit))
+}
+
+// formatProblems lists the problems, each followed by how to fix it
+func formatProblems(problems []diagnose.Problem, locale discordgo.Locale) string {
+	var sb strings.Builder
+	for _, problem := range problems {
+		line := "⚠️ " + resources.TL(locale, problem.Reason, problem.Data) + "\n↳ " + resources.TL(locale, problem.Fix, problem.Data) + "\n"
+		// Embed descriptions are limited to 4096 characters
+		if sb.Len()+len(line) > 4000 {
+			sb.WriteString("…")
+			break
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// checkSettings checks if the bot is able to manage the roles, nicks and channels of the settings, before they are saved
+func checkSettings(s *discordgo.Session, guildID string, values map[string]string) []diagnose.Problem {
+	var problems []diagnose.Problem
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		problems = append(problems, diagnose.CheckSetting(s, guildID, name, values[name])...)
+	}
+	return problems
+}
@@ -0,0 +1,524 @@
+package interaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/diagnose"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+const (
+	InteractionIDOnboardingVerify = "onboarding-verify"
+	InteractionIDOnboardingStatus = "onboarding-status"
+	InteractionIDOnboardingRep    = "onboarding-rep"
+
+	// onboardingMessageCheckInterval is how often the onboarding message is checked when members join
+	onboardingMessageCheckInterval = 10 * time.Minute
+)
+
+type OnboardingCmd struct {
+	m         sync.Mutex
+	service   *backend.Service
+	verifyCmd *VerifyCmd
+	statusCmd *StatusCmd
+	repCmd    *RepCmd
+	// checked is when the onboarding message of each server was last checked
+	checked map[string]time.Time
+}
+
+func NewOnboardingCmd(service *backend.Service, verifyCmd *VerifyCmd, statusCmd *StatusCmd, repCmd *RepCmd) *OnboardingCmd {
+	return &OnboardingCmd{
+		service:   service,
+		verifyCmd: verifyCmd,
+		statusCmd: statusCmd,
+		repCmd:    repCmd,
+		checked:   make(map[string]time.Time),
+	}
+}
+
+func (c *OnboardingCmd) Register(i *Interactions) {
+	i.router.HandleFunc(InteractionIDOnboardingVerify, c.deferred(c.verifyCmd.onCommandVerify))
+	i.router.HandleFunc(InteractionIDOnboardingStatus, c.deferred(c.statusCmd.onCommandStatus))
+	i.router.HandleFunc(InteractionIDOnboardingRep, c.deferred(c.repCmd.onCommandRep))
+
+	var permission int64 = discordgo.PermissionAdministrator
+	var permissionDM bool = false
+
+	// Onboarding cmd
+	i.addCommand(&Command{
+		command: &discordgo.ApplicationCommand{
+			Name:                     resources.T("cmd.onboarding.name"),
+			Description:              resources.T("cmd.onboarding.description"),
+			NameLocalizations:        resources.GetLocalizations("cmd.onboarding.name"),
+			DescriptionLocalizations: resources.GetLocalizations("cmd.onboarding.description"),
+			DefaultMemberPermissions: &permission,
+			DMPermission:             &permissionDM,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.onboarding.options.message.name"),
+					Description:              resources.T("cmd.onboarding.options.message.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.onboarding.options.message.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.onboarding.options.message.description"),
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:                     discordgo.ApplicationCommandOptionChannel,
+							Name:                     resources.T("cmd.onboarding.options.message.channel.name"),
+							Description:              resources.T("cmd.onboarding.options.message.channel.description"),
+							NameLocalizations:        resources.GetOptionLocalizations("cmd.onboarding.options.message.channel.name"),
+							DescriptionLocalizations: resources.GetOptionLocalizations("cmd.onboarding.options.message.channel.description"),
+							ChannelTypes:             []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+							Required:                 true,
+						},
+					},
+				},
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.onboarding.options.configure.name"),
+					Description:              resources.T("cmd.onboarding.options.configure.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.onboarding.options.configure.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.onboarding.options.configure.description"),
+					Options:                  buildOnboardingConfigureOptions(),
+				},
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.onboarding.options.remove.name"),
+					Description:              resources.T("cmd.onboarding.options.remove.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.onboarding.options.remove.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.onboarding.options.remove.description"),
+				},
+			},
+		},
+		handler: c.onCommandOnboarding,
+	})
+
+	// Keep the onboarding message up to date with the current texts, and re-create it if it was deleted. The message
+	// is checked when the bot joins the server, and again when a new member, who needs the message, joins
+	i.discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildCreate) {
+		c.EnsureMessage(s, event.ID)
+	})
+	i.discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildMemberAdd) {
+		if c.checkDue(event.GuildID) {
+			c.EnsureMessage(s, event.GuildID)
+		}
+	})
+}
+
+// checkDue returns whether the onboarding message of the server has not been checked recently, and marks it as checked.
+// Servers with many members joining would otherwise fetch the message for every one of them
+func (c *OnboardingCmd) checkDue(guildID string) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if time.Since(c.checked[guildID]) < onboardingMessageCheckInterval {
+		return false
+	}
+	c.checked[guildID] = time.Now()
+	return true
+}
+
+// deferred wraps a command handler, so it can be used by a button, as command handlers expect the response to be deferred already
+func (c *OnboardingCmd) deferred(handler InteractionHandler) InteractionHandler {
+	return func(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+		err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags: discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
+		handler(s, event, user)
+	}
+}
+
+func (c *OnboardingCmd) onCommandOnboarding(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	if event.GuildID == "" {
+		onError(s, event, errors.New(resources.TL(locale, "settings.errors.server_only")))
+		return
+	}
+
+	options := event.ApplicationCommandData().Options
+	if len(options) == 0 {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+
+	var content string
+	switch options[0].Name {
+	case resources.T("cmd.onboarding.options.message.name"):
+		channel := options[0].Options[0].ChannelValue(nil)
+		err := c.PostMessage(s, event.GuildID, channel.ID)
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
+		content = resources.TL(locale, "onboarding.posted", resources.TData("channel", channel.ID))
+	case resources.T("cmd.onboarding.options.configure.name"):
+		problems, err := c.configure(backend.WithActor(context.Background(), user.ID), s, event.GuildID, options[0].Options)
+		if err != nil {
+			onError(s, event, err)
+			return
+		} else if len(problems) > 0 {
+			reportProblems(s, event, problems)
+			return
+		}
+
+		_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+			Flags:  discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{c.buildConfigurationEmbed(event.GuildID, locale)},
+		})
+		if err != nil {
+			onError(s, event, err)
+		}
+		return
+	case resources.T("cmd.onboarding.options.remove.name"):
+		err := c.RemoveMessage(s, event.GuildID)
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
+		content = resources.TL(locale, "onboarding.removed")
+	default:
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+
+	_, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:   discordgo.MessageFlagsEphemeral,
+		Content: content,
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+func buildOnboardingConfigureOptions() []*discordgo.ApplicationCommandOption {
+	minValue := float64(0)
+	const key = "cmd.onboarding.options.configure."
+
+	welcome := commandOption(discordgo.ApplicationCommandOptionString, key+"welcome")
+	welcome.Choices = []*discordgo.ApplicationCommandOptionChoice{
+		{
+			Name:              resources.T("onboarding.welcome_modes.off"),
+			NameLocalizations: resources.GetOptionLocalizations("onboarding.welcome_modes.off"),
+			Value:             backend.OnboardingWelcomeOff,
+		},
+		{
+			Name:              resources.T("onboarding.welcome_modes.dm"),
+			NameLocalizations: resources.GetOptionLocalizations("onboarding.welcome_modes.dm"),
+			Value:             backend.OnboardingWelcomeDM,
+		},
+		{
+			Name:              resources.T("onboarding.welcome_modes.channel"),
+			NameLocalizations: resources.GetOptionLocalizations("onboarding.welcome_modes.channel"),
+			Value:             backend.OnboardingWelcomeChannel,
+		},
+	}
+
+	channel := commandOption(discordgo.ApplicationCommandOptionChannel, key+"channel")
+	channel.ChannelTypes = []discordgo.ChannelType{discordgo.ChannelTypeGuildText}
+
+	reminderInterval := commandOption(discordgo.ApplicationCommandOptionInteger, key+"reminder_interval")
+	reminderInterval.MinValue = &minValue
+
+	reminders := commandOption(discordgo.ApplicationCommandOptionInteger, key+"reminders")
+	reminders.MinValue = &minValue
+	reminders.MaxValue = 10
+
+	return []*discordgo.ApplicationCommandOption{
+		welcome,
+		channel,
+		reminderInterval,
+		reminders,
+		commandOption(discordgo.ApplicationCommandOptionRole, key+"unverified_role"),
+		commandOption(discordgo.ApplicationCommandOptionBoolean, key+"clear_unverified_role"),
+	}
+}
+
+// configure stores the onboarding settings provided in the command options. Options that are left out are not changed.
+// Nothing is stored if the bot is unable to manage a role picked in the options, which are returned as problems instead
+func (c *OnboardingCmd) configure(ctx context.Context, s *discordgo.Session, guildID string, options []*discordgo.ApplicationCommandInteractionDataOption) ([]diagnose.Problem, error) {
+	values := make(map[string]string, len(options))
+	for _, option := range options {
+		var name, value string
+		switch option.Name {
+		case resources.T("cmd.onboarding.options.configure.welcome.name"):
+			name, value = backend.SettingOnboardingWelcome, option.StringValue()
+		case resources.T("cmd.onboarding.options.configure.channel.name"):
+			name, value = backend.SettingOnboardingWelcomeChannel, option.ChannelValue(nil).ID
+		case resources.T("cmd.onboarding.options.configure.reminder_interval.name"):
+			name, value = backend.SettingOnboardingReminderInterval, strconv.FormatInt(option.IntValue(), 10)
+		case resources.T("cmd.onboarding.options.configure.reminders.name"):
+			name, value = backend.SettingOnboardingReminderCount, strconv.FormatInt(option.IntValue(), 10)
+		case resources.T("cmd.onboarding.options.configure.unverified_role.name"):
+			name, value = backend.SettingOnboardingUnverifiedRole, option.RoleValue(nil, guildID).ID
+		case resources.T("cmd.onboarding.options.configure.clear_unverified_role.name"):
+			if !option.BoolValue() {
+				continue
+			}
+			name, value = backend.SettingOnboardingUnverifiedRole, ""
+		default:
+			continue
+		}
+
+		values[name] = value
+	}
+	if problems := checkSettings(s, guildID, values); len(problems) > 0 {
+		return problems, nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		zap.L().Info("updating onboarding setting", zap.String("guild id", guildID), zap.String("setting", name), zap.String("value", values[name]))
+		err := c.service.SetSetting(ctx, guildID, name, values[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (c *OnboardingCmd) buildConfigurationEmbed(guildID string, locale discordgo.Locale) *discordgo.MessageEmbed {
+	notSet := resources.TL(locale, "onboarding.configuration.not_set")
+
+	welcome := resources.TL(locale, "onboarding.welcome_modes.off")
+	switch c.service.GetSetting(guildID, backend.SettingOnboardingWelcome) {
+	case backend.OnboardingWelcomeDM:
+		welcome = resources.TL(locale, "onboarding.welcome_modes.dm")
+	case backend.OnboardingWelcomeChannel:
+		welcome = resources.TL(locale, "onboarding.welcome_modes.channel")
+	}
+
+	channel := notSet
+	if channelID := c.service.GetSetting(guildID, backend.SettingOnboardingWelcomeChannel); channelID != "" {
+		channel = fmt.Sprintf("<#%s>", channelID)
+	}
+
+	reminders := resources.TL(locale, "onboarding.configuration.reminders_disabled")
+	interval := c.service.GetInt(guildID, backend.SettingOnboardingReminderInterval)
+	count := c.service.GetInt(guildID, backend.SettingOnboardingReminderCount)
+	if interval > 0 && count > 0 {
+		reminders = resources.TL(locale, "onboarding.configuration.reminders_value", resources.TData("count", count, "hours", interval))
+	}
+
+	role := notSet
+	if roleID := c.service.GetSetting(guildID, backend.SettingOnboardingUnverifiedRole); roleID != "" {
+		role = fmt.Sprintf("<@&%s>", roleID)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: resources.TL(locale, "onboarding.configuration.title"),
+		Color: 0x3498DB, // blue
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   resources.TL(locale, "onboarding.configuration.welcome"),
+				Value:  welcome,
+				Inline: true,
+			},
+			{
+				Name:   resources.TL(locale, "onboarding.configuration.channel"),
+				Value:  channel,
+				Inline: true,
+			},
+			{
+				Name:   resources.TL(locale, "onboarding.configuration.reminders"),
+				Value:  reminders,
+				Inline: false,
+			},
+			{
+				Name:   resources.TL(locale, "onboarding.configuration.unverified_role"),
+				Value:  role,
+				Inline: false,
+			},
+		},
+	}
+}
+
+// PostMessage posts the onboarding message in the given channel, replacing any previously posted onboarding message
+func (c *OnboardingCmd) PostMessage(s *discordgo.Session, guildID string, channelID string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.deleteMessage(s, guildID)
+
+	ctx := context.Background()
+	err := c.service.SetSetting(ctx, guildID, backend.SettingOnboardingChannel, channelID)
+	if err != nil {
+		return err
+	}
+
+	return c.sendMessage(s, guildID, channelID)
+}
+
+// RemoveMessage deletes the onboarding message and stops it from being re-created
+func (c *OnboardingCmd) RemoveMessage(s *discordgo.Session, guildID string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.deleteMessage(s, guildID)
+
+	ctx := context.Background()
+	err := c.service.SetSetting(ctx, guildID, backend.SettingOnboardingChannel, "")
+	if err != nil {
+		return err
+	}
+	return c.service.SetSetting(ctx, guildID, backend.SettingOnboardingMessage, "")
+}
+
+// EnsureMessage re-creates the onboarding message if it no longer exists, or updates it if the texts have changed
+func (c *OnboardingCmd) EnsureMessage(s *discordgo.Session, guildID string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	channelID := c.service.GetSetting(guildID, backend.SettingOnboardingChannel)
+	if channelID == "" {
+		return
+	}
+
+	messageID := c.service.GetSetting(guildID, backend.SettingOnboardingMessage)
+	if messageID != "" {
+		message, err := s.ChannelMessage(channelID, messageID)
+		if err == nil {
+			embeds, components := c.buildMessage(discord.GuildLocale(s, guildID))
+			if !onboardingMessageOutdated(message, embeds[0], components) {
+				return
+			}
+
+			zap.L().Info("updating onboarding message", zap.String("guild id", guildID), zap.String("message id", messageID))
+			_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+				ID:         messageID,
+				Channel:    channelID,
+				Embeds:     &embeds,
+				Components: &components,
+			})
+			if err != nil {
+				zap.L().Error("unable to update onboarding message", zap.String("guild id", guildID), zap.String("message id", messageID), zap.Error(err))
+			}
+			return
+		}
+
+		var restErr *discordgo.RESTError
+		if !errors.As(err, &restErr) || restErr.Response == nil || restErr.Response.StatusCode != http.StatusNotFound {
+			zap.L().Error("unable to fetch onboarding message", zap.String("guild id", guildID), zap.String("message id", messageID), zap.Error(err))
+			return
+		}
+	}
+
+	zap.L().Info("re-creating onboarding message", zap.String("guild id", guildID), zap.String("channel id", channelID))
+	err := c.sendMessage(s, guildID, channelID)
+	if err != nil {
+		zap.L().Error("unable to re-create onboarding message", zap.String("guild id", guildID), zap.String("channel id", channelID), zap.Error(err))
+	}
+}
+
+func (c *OnboardingCmd) sendMessage(s *discordgo.Session, guildID string, channelID string) error {
+	embeds, components := c.buildMessage(discord.GuildLocale(s, guildID))
+	message, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Embeds:     embeds,
+		Components: components,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return c.service.SetSetting(ctx, guildID, backend.SettingOnboardingMessage, message.ID)
+}
+
+func (c *OnboardingCmd) deleteMessage(s *discordgo.Session, guildID string) {
+	channelID := c.service.GetSetting(guildID, backend.SettingOnboardingChannel)
+	messageID := c.service.GetSetting(guildID, backend.SettingOnboardingMessage)
+	if channelID == "" || messageID == "" {
+		return
+	}
+
+	err := s.ChannelMessageDelete(channelID, messageID)
+	if err != nil {
+		zap.L().Warn("unable to delete previous onboarding message", zap.String("guild id", guildID), zap.String("message id", messageID), zap.Error(err))
+	}
+}
+
+func (c *OnboardingCmd) buildMessage(locale discordgo.Locale) ([]*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	embeds := []*discordgo.MessageEmbed{
+		{
+			Title:       resources.TL(locale, "onboarding.message.title"),
+			Description: resources.TL(locale, "onboarding.message.description"),
+			Color:       0x3498DB, // blue
+		},
+	}
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Style:    discordgo.SuccessButton,
+					Label:    resources.TL(locale, "onboarding.buttons.verify"),
+					CustomID: InteractionIDOnboardingVerify,
+				},
+				discordgo.Button{
+					Style:    discordgo.SecondaryButton,
+					Label:    resources.TL(locale, "onboarding.buttons.status"),
+					CustomID: InteractionIDOnboardingStatus,
+				},
+				discordgo.Button{
+					Style:    discordgo.SecondaryButton,
+					Label:    resources.TL(locale, "onboarding.buttons.rep"),
+					CustomID: InteractionIDOnboardingRep,
+				},
+			},
+		},
+	}
+	return embeds, components
+}
+
+// onboardingMessageOutdated checks if the posted message differs from the message the bot would post now
+func onboardingMessageOutdated(message *discordgo.Message, embed *discordgo.MessageEmbed, components []discordgo.MessageComponent) bool {
+	if len(message.Embeds) != 1 || message.Embeds[0].Title != embed.Title || message.Embeds[0].Description != embed.Description {
+		return true
+	}
+
+	var expected []discordgo.Button
+	for _, row := range components {
+		if actionsRow, ok := row.(discordgo.ActionsRow); ok {
+			for _, component := range actionsRow.Components {
+				if button, ok := component.(discordgo.Button); ok {
+					expected = append(expected, button)
+				}
+			}
+		}
+	}
+
+	var actual []*discordgo.Button
+	for _, row := range message.Components {
+		if actionsRow, ok := row.(*discordgo.ActionsRow); ok {
+			for _, component := range actionsRow.Components {
+				if button, ok := component.(*discordgo.Button); ok {
+					actual = append(actual, button)
+				}
+			}
+		}
+	}
+
+	if len(expected) != len(actual) {
+		return true
+	}
+	for i := range expected {
+		if expected[i].Label != actual[i].Label || expected[i].CustomID != actual[i].CustomID {
+			return true
+		}
+	}
+	return false
+}
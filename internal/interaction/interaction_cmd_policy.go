@@ -0,0 +1,306 @@
+package interaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/diagnose"
+	"github.com/vennekilde/gw2-alliance-bot/internal/policy"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+type PolicyCmd struct {
+	service *backend.Service
+	policy  *policy.Policy
+}
+
+func NewPolicyCmd(service *backend.Service, policy *policy.Policy) *PolicyCmd {
+	return &PolicyCmd{
+		service: service,
+		policy:  policy,
+	}
+}
+
+func (c *PolicyCmd) Register(i *Interactions) {
+	var permission int64 = discordgo.PermissionAdministrator
+	var permissionDM bool = false
+
+	// Policy cmd
+	i.addCommand(&Command{
+		command: &discordgo.ApplicationCommand{
+			Name:                     resources.T("cmd.policy.name"),
+			Description:              resources.T("cmd.policy.description"),
+			NameLocalizations:        resources.GetLocalizations("cmd.policy.name"),
+			DescriptionLocalizations: resources.GetLocalizations("cmd.policy.description"),
+			DefaultMemberPermissions: &permission,
+			DMPermission:             &permissionDM,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.policy.options.configure.name"),
+					Description:              resources.T("cmd.policy.options.configure.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.policy.options.configure.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.policy.options.configure.description"),
+					Options:                  buildPolicyConfigureOptions(),
+				},
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.policy.options.exempt.name"),
+					Description:              resources.T("cmd.policy.options.exempt.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.policy.options.exempt.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.policy.options.exempt.description"),
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:                     discordgo.ApplicationCommandOptionRole,
+							Name:                     resources.T("cmd.policy.options.exempt.role.name"),
+							Description:              resources.T("cmd.policy.options.exempt.role.description"),
+							NameLocalizations:        resources.GetOptionLocalizations("cmd.policy.options.exempt.role.name"),
+							DescriptionLocalizations: resources.GetOptionLocalizations("cmd.policy.options.exempt.role.description"),
+							Required:                 true,
+						},
+					},
+				},
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.policy.options.report.name"),
+					Description:              resources.T("cmd.policy.options.report.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.policy.options.report.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.policy.options.report.description"),
+				},
+			},
+		},
+		handler: c.onCommandPolicy,
+	})
+}
+
+func buildPolicyConfigureOptions() []*discordgo.ApplicationCommandOption {
+	minValue := float64(0)
+	const key = "cmd.policy.options.configure."
+
+	action := commandOption(discordgo.ApplicationCommandOptionString, key+"action")
+	for _, value := range []string{policy.ActionOff, policy.ActionQuarantine, policy.ActionKick} {
+		action.Choices = append(action.Choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:              resources.T("policy.actions." + value),
+			NameLocalizations: resources.GetOptionLocalizations("policy.actions." + value),
+			Value:             value,
+		})
+	}
+
+	unverifiedDays := commandOption(discordgo.ApplicationCommandOptionInteger, key+"unverified_days")
+	unverifiedDays.MinValue = &minValue
+
+	graceHours := commandOption(discordgo.ApplicationCommandOptionInteger, key+"grace_hours")
+	graceHours.MinValue = &minValue
+
+	return []*discordgo.ApplicationCommandOption{
+		action,
+		unverifiedDays,
+		commandOption(discordgo.ApplicationCommandOptionBoolean, key+"expired"),
+		commandOption(discordgo.ApplicationCommandOptionRole, key+"quarantine_role"),
+		graceHours,
+	}
+}
+
+func (c *PolicyCmd) onCommandPolicy(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	if event.GuildID == "" {
+		onError(s, event, errors.New(resources.TL(locale, "settings.errors.server_only")))
+		return
+	}
+
+	options := event.ApplicationCommandData().Options
+	if len(options) == 0 {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+
+	var embed *discordgo.MessageEmbed
+	switch options[0].Name {
+	case resources.T("cmd.policy.options.configure.name"):
+		problems, err := c.configure(backend.WithActor(context.Background(), user.ID), s, event.GuildID, options[0].Options)
+		if err != nil {
+			onError(s, event, err)
+			return
+		} else if len(problems) > 0 {
+			reportProblems(s, event, problems)
+			return
+		}
+		embed = c.buildConfigurationEmbed(event.GuildID, locale)
+	case resources.T("cmd.policy.options.exempt.name"):
+		err := c.toggleExemptRole(backend.WithActor(context.Background(), user.ID), event.GuildID, options[0].Options[0].RoleValue(nil, event.GuildID).ID)
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
+		embed = c.buildConfigurationEmbed(event.GuildID, locale)
+	case resources.T("cmd.policy.options.report.name"):
+		violations, checked := c.policy.Report(event.GuildID)
+		embed = buildPolicyReportEmbed(violations, checked, c.policy.Rules(event.GuildID).Enabled(), locale)
+	default:
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+
+	_, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:  discordgo.MessageFlagsEphemeral,
+		Embeds: []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// configure stores the policy settings provided in the command options. Options that are left out are not changed.
+// Nothing is stored if the bot is unable to manage a role picked in the options, which are returned as problems instead
+func (c *PolicyCmd) configure(ctx context.Context, s *discordgo.Session, guildID string, options []*discordgo.ApplicationCommandInteractionDataOption) ([]diagnose.Problem, error) {
+	values := make(map[string]string, len(options))
+	for _, option := range options {
+		var name, value string
+		switch option.Name {
+		case resources.T("cmd.policy.options.configure.action.name"):
+			name, value = backend.SettingPolicyAction, option.StringValue()
+		case resources.T("cmd.policy.options.configure.unverified_days.name"):
+			name, value = backend.SettingPolicyUnverifiedDays, strconv.FormatInt(option.IntValue(), 10)
+		case resources.T("cmd.policy.options.configure.expired.name"):
+			name, value = backend.SettingPolicyExpired, strconv.FormatBool(option.BoolValue())
+		case resources.T("cmd.policy.options.configure.quarantine_role.name"):
+			name, value = backend.SettingPolicyQuarantineRole, option.RoleValue(nil, guildID).ID
+		case resources.T("cmd.policy.options.configure.grace_hours.name"):
+			name, value = backend.SettingPolicyGraceHours, strconv.FormatInt(option.IntValue(), 10)
+		default:
+			continue
+		}
+
+		values[name] = value
+	}
+	if problems := checkSettings(s, guildID, values); len(problems) > 0 {
+		return problems, nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		zap.L().Info("updating policy setting", zap.String("guild id", guildID), zap.String("setting", name), zap.String("value", values[name]))
+		err := c.service.SetSetting(ctx, guildID, name, values[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// toggleExemptRole adds the role to the exempt roles, or removes it if it is already exempt
+func (c *PolicyCmd) toggleExemptRole(ctx context.Context, guildID string, roleID string) error {
+	exemptRoles := c.service.GetRoles(guildID, backend.SettingPolicyExemptRoles)
+	if idx := slices.Index(exemptRoles, roleID); idx >= 0 {
+		exemptRoles = slices.Delete(exemptRoles, idx, idx+1)
+	} else {
+		exemptRoles = append(exemptRoles, roleID)
+	}
+
+	return c.service.SetSetting(ctx, guildID, backend.SettingPolicyExemptRoles, strings.Join(exemptRoles, ","))
+}
+
+func (c *PolicyCmd) buildConfigurationEmbed(guildID string, locale discordgo.Locale) *discordgo.MessageEmbed {
+	rules := c.policy.Rules(guildID)
+	notSet := resources.TL(locale, "policy.configuration.not_set")
+
+	action := rules.Action
+	unverified := notSet
+	if rules.UnverifiedDays > 0 {
+		unverified = resources.TL(locale, "policy.configuration.days", resources.TData("days", rules.UnverifiedDays))
+	}
+
+	expired := resources.TL(locale, "policy.configuration.no")
+	if rules.Expired {
+		expired = resources.TL(locale, "policy.configuration.yes")
+	}
+
+	quarantineRole := notSet
+	if rules.QuarantineRole != "" {
+		quarantineRole = fmt.Sprintf("<@&%s>", rules.QuarantineRole)
+	}
+
+	exemptRoles := notSet
+	if len(rules.ExemptRoles) > 0 {
+		exemptRoles = fmt.Sprintf("<@&%s>", strings.Join(rules.ExemptRoles, "> <@&"))
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: resources.TL(locale, "policy.configuration.title"),
+		Color: 0x3498DB, // blue
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   resources.TL(locale, "policy.configuration.action"),
+				Value:  resources.TL(locale, "policy.actions."+action),
+				Inline: true,
+			},
+			{
+				Name:   resources.TL(locale, "policy.configuration.unverified"),
+				Value:  unverified,
+				Inline: true,
+			},
+			{
+				Name:   resources.TL(locale, "policy.configuration.expired"),
+				Value:  expired,
+				Inline: true,
+			},
+			{
+				Name:   resources.TL(locale, "policy.configuration.quarantine_role"),
+				Value:  quarantineRole,
+				Inline: true,
+			},
+			{
+				Name:   resources.TL(locale, "policy.configuration.grace"),
+				Value:  resources.TL(locale, "policy.configuration.hours", resources.TData("hours", rules.GraceHours)),
+				Inline: true,
+			},
+			{
+				Name:   resources.TL(locale, "policy.configuration.exempt_roles"),
+				Value:  exemptRoles,
+				Inline: false,
+			},
+		},
+	}
+	if !rules.Enabled() {
+		embed.Description = resources.TL(locale, "policy.configuration.disabled")
+	}
+	return embed
+}
+
+func buildPolicyReportEmbed(violations []policy.Violation, checked int, enabled bool, locale discordgo.Locale) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: resources.TL(locale, "policy.report.title"),
+		Color: 0xE67E22, // orange
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: resources.TL(locale, "policy.report.footer", resources.TData("count", len(violations), "checked", checked)),
+		},
+	}
+	if !enabled {
+		embed.Description = resources.TL(locale, "policy.configuration.disabled")
+		return embed
+	}
+	if len(violations) == 0 {
+		embed.Description = resources.TL(locale, "policy.report.none")
+		return embed
+	}
+
+	var sb strings.Builder
+	for idx, violation := range violations {
+		line := fmt.Sprintf("<@%s> - %s\n", violation.Member.User.ID, resources.TL(locale, policy.ReasonKey(violation.Reason)))
+		// Embed descriptions are limited to 4096 characters
+		if sb.Len()+len(line) > 4000 {
+			sb.WriteString(resources.TL(locale, "policy.report.more", resources.TData("count", len(violations)-idx)))
+			break
+		}
+		sb.WriteString(line)
+	}
+	embed.Description = sb.String()
+	return embed
+}
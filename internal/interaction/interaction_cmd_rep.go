@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"slices"
+	"time"
 
 	"github.com/MrGunflame/gw2api"
 	"github.com/bwmarrin/discordgo"
 	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
 	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
 	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
 	"github.com/vennekilde/gw2-alliance-bot/internal/guild"
@@ -30,22 +32,30 @@ type RepCmd struct {
 	guildRoleHandler *guild.GuildRoleHandler
 	service          *backend.Service
 	wvw              *world.WvW
+	audit            *audit.Log
+
+	guildSelect   *PagedSelect
+	accountSelect *PagedSelect
 }
 
-func NewRepCmd(backend *api.ClientWithResponses, cache *discord.Cache, guilds *guild.Guilds, guildRoleHandler *guild.GuildRoleHandler, service *backend.Service, wvw *world.WvW) *RepCmd {
-	return &RepCmd{
+func NewRepCmd(backend *api.ClientWithResponses, cache *discord.Cache, guilds *guild.Guilds, guildRoleHandler *guild.GuildRoleHandler, service *backend.Service, wvw *world.WvW, auditLog *audit.Log) *RepCmd {
+	c := &RepCmd{
 		backend:          backend,
 		cache:            cache,
 		guilds:           guilds,
 		guildRoleHandler: guildRoleHandler,
 		service:          service,
 		wvw:              wvw,
+		audit:            auditLog,
 	}
+	c.guildSelect = NewPagedSelect(InteractionIDRepGuild, "rep.guild_placeholder", true, false, c.loadGuildOptions, c.onSelectGuild)
+	c.accountSelect = NewPagedSelect(InteractionIDSRepAcc, "rep.account_rep.placeholder", false, false, c.loadAccountOptions, c.onSelectAccount)
+	return c
 }
 
 func (c *RepCmd) Register(i *Interactions) {
-	i.interactions[InteractionIDRepGuild] = c.onSetRole
-	i.interactions[InteractionIDSRepAcc] = c.InteractSetNickByAccount
+	c.guildSelect.Register(i)
+	c.accountSelect.Register(i)
 
 	// Represent
 	i.addCommand(&Command{
@@ -54,10 +64,71 @@ func (c *RepCmd) Register(i *Interactions) {
 			Description:              resources.T("cmd.rep.description"),
 			NameLocalizations:        resources.GetLocalizations("cmd.rep.name"),
 			DescriptionLocalizations: resources.GetLocalizations("cmd.rep.description"),
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:                     discordgo.ApplicationCommandOptionString,
+					Name:                     resources.T("cmd.rep.options.guild.name"),
+					Description:              resources.T("cmd.rep.options.guild.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.rep.options.guild.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.rep.options.guild.description"),
+					Autocomplete:             true,
+				},
+				{
+					Type:                     discordgo.ApplicationCommandOptionString,
+					Name:                     resources.T("cmd.rep.options.account.name"),
+					Description:              resources.T("cmd.rep.options.account.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.rep.options.account.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.rep.options.account.description"),
+					Autocomplete:             true,
+				},
+			},
 		},
-		handler: c.onCommandRep,
+		handler:      c.onCommandRep,
+		autocomplete: c.onAutocompleteRep,
 	})
+}
+
+// onAutocompleteRep suggests the guilds with a role on the server, and the accounts linked by the user
+func (c *RepCmd) onAutocompleteRep(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	focused := focusedOption(event.ApplicationCommandData().Options)
+	if focused == nil || event.GuildID == "" {
+		respondChoices(s, event, nil)
+		return
+	}
 
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	switch focused.Name {
+	case resources.T("cmd.rep.options.guild.name"):
+		for _, role := range c.cache.Server(event.GuildID).Roles() {
+			if !guild.RegexRoleNameMatcher.MatchString(role.Name) {
+				continue
+			}
+			gw2Guild, partial := c.guilds.GetGuildInfoByTagAndName(role.Name)
+			if gw2Guild == nil || partial {
+				continue
+			}
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+				Name:  role.Name,
+				Value: gw2Guild.ID,
+			})
+		}
+	case resources.T("cmd.rep.options.account.name"):
+		// Autocomplete has to be answered within 3 seconds
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		resp, err := c.backend.GetPlatformUserWithResponse(ctx, backend.PlatformID, user.ID, &api.GetPlatformUserParams{})
+		if err != nil || resp.JSON200 == nil {
+			zap.L().Warn("unable to fetch accounts to autocomplete", zap.String("user", user.ID), zap.Error(err))
+			break
+		}
+		for _, account := range resp.JSON200.Accounts {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+				Name:  account.Name,
+				Value: account.Name,
+			})
+		}
+	}
+	respondChoices(s, event, filterChoices(choices, focused.StringValue()))
 }
 func (c *RepCmd) onCommandRep(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
 	ctx := context.Background()
@@ -80,14 +151,75 @@ func (c *RepCmd) onCommandRep(s *discordgo.Session, event *discordgo.Interaction
 	// We have the data, so might as well verify the roles, but ignore the error atm.
 	_ = c.wvw.VerifyWvWWorldRoles(event.GuildID, event.Member, resp.JSON200.Accounts, resp.JSON200.Bans)
 
-	c.handleRepFromStatus(s, event, user, resp.JSON200.Accounts, locale)
+	// The rep button of the onboarding message shares this handler, but carries no command data
+	var guildID, accountName string
+	if event.Type == discordgo.InteractionApplicationCommand {
+		for _, option := range event.ApplicationCommandData().Options {
+			switch option.Name {
+			case resources.T("cmd.rep.options.guild.name"):
+				guildID = option.StringValue()
+			case resources.T("cmd.rep.options.account.name"):
+				accountName = option.StringValue()
+			}
+		}
+	}
+	if guildID == "" && accountName == "" {
+		c.handleRepFromStatus(s, event, user, resp.JSON200.Accounts, locale)
+		return
+	}
+
+	if guildID != "" {
+		c.repGuild(s, event, user, resp.JSON200.Accounts, guildID, locale)
+	}
+	if accountName != "" {
+		c.repAccount(s, event, resp.JSON200.Accounts, accountName, locale)
+	}
 }
 
-func (c *RepCmd) buildOverviewGuildComponents(guildID string, accounts []api.Account) (components []discordgo.MessageComponent, lastRole *discordgo.Role, err error) {
-	return c.buildGuildComponentsFromAccounts(guildID, accounts)
+// repAccount sets the account as the nick of the member, if it is linked to the member
+func (c *RepCmd) repAccount(s *discordgo.Session, event *discordgo.InteractionCreate, accounts []api.Account, accountName string, locale discordgo.Locale) {
+	if !c.service.GetBool(event.GuildID, backend.SettingAccRepEnabled) {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.account_rep_disabled")))
+		return
+	}
+	if !slices.ContainsFunc(accounts, func(account api.Account) bool { return account.Name == accountName }) {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.account_not_linked", resources.TData("accountName", accountName))))
+		return
+	}
+
+	err := nick.SetAccAsNick(s, c.audit, event.Member, accountName, "audit.reasons.rep_account")
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags: discordgo.MessageFlagsEphemeral,
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       resources.TL(locale, "rep.account_updated.title"),
+				Description: resources.TL(locale, "rep.account_updated.description", resources.TData("accountName", accountName)),
+				Color:       0x57F287, // green
+			},
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
 }
 
-func (c *RepCmd) buildGuildComponentsFromAccounts(guildID string, accounts []api.Account) (components []discordgo.MessageComponent, lastRole *discordgo.Role, err error) {
+// fetchAccounts returns the accounts linked by the user
+func (c *RepCmd) fetchAccounts(ctx context.Context, userID string) ([]api.Account, error) {
+	resp, err := c.backend.GetPlatformUserWithResponse(ctx, backend.PlatformID, userID, &api.GetPlatformUserParams{})
+	if err != nil {
+		return nil, err
+	} else if resp.JSON200 == nil {
+		return nil, errors.New("unexpected response from the server")
+	}
+	return resp.JSON200.Accounts, nil
+}
+
+func (c *RepCmd) buildGuildOptionsFromAccounts(guildID string, accounts []api.Account) (options []discordgo.SelectMenuOption, lastRole *discordgo.Role, err error) {
 	if len(accounts) == 0 {
 		return nil, nil, nil
 	}
@@ -97,7 +229,27 @@ func (c *RepCmd) buildGuildComponentsFromAccounts(guildID string, accounts []api
 		return nil, nil, err
 	}
 
-	return c.buildGuildComponents(guildID, guilds)
+	options, lastRole = c.buildGuildOptions(guildID, guilds)
+	return options, lastRole, nil
+}
+
+// loadGuildOptions loads the guilds the user may represent, for the guild picker
+func (c *RepCmd) loadGuildOptions(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) ([]discordgo.SelectMenuOption, error) {
+	accounts, err := c.fetchAccounts(context.Background(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	options, _, err := c.buildGuildOptionsFromAccounts(event.GuildID, accounts)
+	return options, err
+}
+
+// loadAccountOptions loads the accounts linked by the user, for the account picker
+func (c *RepCmd) loadAccountOptions(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) ([]discordgo.SelectMenuOption, error) {
+	accounts, err := c.fetchAccounts(context.Background(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return accountOptions(accounts), nil
 }
 
 func (c *RepCmd) GetAllGuildsFromAccounts(accounts []api.Account) ([]*gw2api.Guild, error) {
@@ -122,66 +274,52 @@ func (c *RepCmd) GetAllGuildsFromAccounts(accounts []api.Account) ([]*gw2api.Gui
 	return guilds, nil
 }
 
-func (c *RepCmd) buildGuildComponents(guildID string, guilds []*gw2api.Guild) (components []discordgo.MessageComponent, lastRole *discordgo.Role, err error) {
-	if len(guilds) == 0 {
-		return nil, nil, nil
-	}
-
-	roles := c.cache.Servers[guildID]
+// buildGuildOptions returns an option for each of the guilds with a role on the server, valued by the id of the guild
+func (c *RepCmd) buildGuildOptions(guildID string, guilds []*gw2api.Guild) (options []discordgo.SelectMenuOption, lastRole *discordgo.Role) {
+	roles := c.cache.Server(guildID)
 
-	components = make([]discordgo.MessageComponent, 0, len(guilds))
+	options = make([]discordgo.SelectMenuOption, 0, len(guilds))
 	for _, guild := range guilds {
 		role := roles.FindRoleByTagAndName(fmt.Sprintf("[%s] %s", guild.Tag, guild.Name))
 		if role != nil {
 			lastRole = role
-			components = append(components, discordgo.Button{
-				// Label is what the user will see on the button.
+			options = append(options, discordgo.SelectMenuOption{
 				Label: fmt.Sprintf("[%s] %s", guild.Tag, guild.Name),
-				// Style provides coloring of the button. There are not so many styles tho.
-				Style: discordgo.PrimaryButton,
-				// CustomID is a thing telling Discord which data to send when this button will be pressed.
-				CustomID: fmt.Sprintf("%s:%s:%s", InteractionIDRepGuild, guild.ID, role.ID),
+				Value: guild.ID,
 			})
 		}
 	}
 
-	return components, lastRole, nil
+	return options, lastRole
 }
 
-func (c *RepCmd) buildAccRepSelectMenu(accounts []api.Account) []discordgo.MessageComponent {
-	components := make([]discordgo.MessageComponent, 0, len(accounts))
+// accountOptions returns an option for each of the accounts, valued by the name of the account
+func accountOptions(accounts []api.Account) []discordgo.SelectMenuOption {
+	options := make([]discordgo.SelectMenuOption, 0, len(accounts))
 	for _, acc := range accounts {
-		components = append(components, discordgo.Button{
-			// Label is what the user will see on the button.
+		options = append(options, discordgo.SelectMenuOption{
 			Label: fmt.Sprintf("%s (%s)", acc.Name, world.WorldNames[acc.World].Name),
-			// Style provides coloring of the button. There are not so many styles tho.
-			Style: discordgo.PrimaryButton,
-			// CustomID is a thing telling Discord which data to send when this button will be pressed.
-			CustomID: fmt.Sprintf("%s:%s", InteractionIDSRepAcc, acc.Name),
+			Value: acc.Name,
 		})
 	}
-	return []discordgo.MessageComponent{
-		discordgo.ActionsRow{
-			Components: components,
-		},
-	}
+	return options
 }
 
 func (c *RepCmd) handleRepFromStatus(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, accounts []api.Account, locale discordgo.Locale) {
-	components, lastRole, err := c.buildOverviewGuildComponents(event.GuildID, accounts)
+	options, lastRole, err := c.buildGuildOptionsFromAccounts(event.GuildID, accounts)
 	if err != nil {
 		onError(s, event, err)
 		return
 	}
 
-	enforceGuildRep := c.service.GetSetting(event.GuildID, backend.SettingEnforceGuildRep) == "true"
+	enforceGuildRep := c.service.GetBool(event.GuildID, backend.SettingEnforceGuildRep)
 
 	// Just set role
-	if len(components) == 1 && enforceGuildRep {
+	if len(options) == 1 && enforceGuildRep {
 		c.setRoleByName(s, event, user, lastRole.Name, locale)
-	} else if len(components) == 0 {
-		// Only show if /rep was called directly
-		if event.Type == discordgo.InteractionApplicationCommand || event.Type == discordgo.InteractionApplicationCommandAutocomplete {
+	} else if len(options) == 0 {
+		// Only show if /rep or the onboarding button was used directly
+		if event.Type == discordgo.InteractionApplicationCommand || event.Type == discordgo.InteractionApplicationCommandAutocomplete || event.Type == discordgo.InteractionMessageComponent {
 			_, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
 				Flags: discordgo.MessageFlagsEphemeral,
 				Embeds: []*discordgo.MessageEmbed{
@@ -197,32 +335,37 @@ func (c *RepCmd) handleRepFromStatus(s *discordgo.Session, event *discordgo.Inte
 			}
 		}
 	} else {
+		components, err := c.guildSelect.Components(options, 0, "", locale)
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
 		_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
-			Content: resources.TL(locale, "rep.content"),
-			Flags:   discordgo.MessageFlagsEphemeral,
-			Components: []discordgo.MessageComponent{
-				discordgo.ActionsRow{
-					Components: components,
-				},
-			},
+			Content:    resources.TL(locale, "rep.content"),
+			Flags:      discordgo.MessageFlagsEphemeral,
+			Components: components,
 		})
 		if err != nil {
 			onError(s, event, err)
 		}
 	}
 
-	accRepEnabled := c.service.GetSetting(event.GuildID, backend.SettingAccRepEnabled)
-	if accRepEnabled == "true" {
+	if c.service.GetBool(event.GuildID, backend.SettingAccRepEnabled) {
 		if len(accounts) == 1 {
-			err := nick.SetAccAsNick(s, event.Member, accounts[0].Name)
+			err := nick.SetAccAsNick(s, c.audit, event.Member, accounts[0].Name, "audit.reasons.rep_account")
 			if err != nil {
 				onError(s, event, err)
 			}
 		} else if len(accounts) > 1 {
-			_, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+			components, err := c.accountSelect.Components(accountOptions(accounts), 0, "", locale)
+			if err != nil {
+				onError(s, event, err)
+				return
+			}
+			_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
 				Flags:      discordgo.MessageFlagsEphemeral,
 				Content:    resources.TL(locale, "rep.account_rep.content"),
-				Components: c.buildAccRepSelectMenu(accounts),
+				Components: components,
 			})
 			if err != nil {
 				onError(s, event, err)
@@ -231,7 +374,8 @@ func (c *RepCmd) handleRepFromStatus(s *discordgo.Session, event *discordgo.Inte
 	}
 }
 
-func (c *RepCmd) onSetRole(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+// onSelectGuild gives the member the role of the guild picked in the guild picker
+func (c *RepCmd) onSelectGuild(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, selection PagedSelection) {
 	ctx := context.Background()
 	locale := GetInteractionLocale(event)
 
@@ -245,34 +389,31 @@ func (c *RepCmd) onSetRole(s *discordgo.Session, event *discordgo.InteractionCre
 		zap.L().Error("unable to respond to interaction", zap.Any("session", s), zap.Any("event", event), zap.Error(err))
 	}
 
-	resp, err := c.backend.GetPlatformUserWithResponse(ctx, backend.PlatformID, user.ID, &api.GetPlatformUserParams{})
+	if len(selection.Values) == 0 {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+
+	accounts, err := c.fetchAccounts(ctx, user.ID)
 	if err != nil {
 		onError(s, event, err)
 		return
-	} else if resp.JSON200 == nil {
-		onError(s, event, errors.New("unexpected response from the server"))
-		return
 	}
 
-	parts := strings.Split(event.MessageComponentData().CustomID, ":")
-	guildID := parts[1]
+	c.repGuild(s, event, user, accounts, selection.Values[0], locale)
+}
 
+// repGuild gives the member the role of the guild, if one of the accounts of the member is in the guild
+func (c *RepCmd) repGuild(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, accounts []api.Account, guildID string, locale discordgo.Locale) {
 	// Ensure user still has the guild
-	for _, account := range resp.JSON200.Accounts {
-		if account.Guilds == nil {
-			continue
-		}
-		for _, accGuildID := range *account.Guilds {
-			if accGuildID == guildID {
-				goto setRole
-			}
-		}
+	eligible := slices.ContainsFunc(accounts, func(account api.Account) bool {
+		return account.Guilds != nil && slices.Contains(*account.Guilds, guildID)
+	})
+	if !eligible {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.unable_to_verify_eligible")))
+		return
 	}
 
-	onError(s, event, errors.New(resources.TL(locale, "rep.errors.unable_to_verify_eligible")))
-	return
-
-setRole:
 	guild, partial := c.guilds.GetGuildInfo(guildID)
 	if partial || guild == nil {
 		onError(s, event, errors.New(resources.TL(locale, "rep.errors.unable_to_fetch_guild_info")))
@@ -297,10 +438,10 @@ func (c *RepCmd) setRoleByName(s *discordgo.Session, event *discordgo.Interactio
 		return
 	}
 
-	if c.service.GetSetting(event.GuildID, backend.SettingGuildTagRepEnabled) == "true" {
+	if c.service.GetBool(event.GuildID, backend.SettingGuildTagRepEnabled) {
 		// Set guild tag as nickname
 		tag := guild.RegexGuildTagMatcher.FindStringSubmatch(roleName)[1]
-		err = nick.SetGuildTagAsNick(s, event.Member, tag)
+		err = nick.SetGuildTagAsNick(s, c.audit, event.Member, tag, "audit.reasons.rep_guild")
 		if err != nil {
 			onError(s, event, err)
 			return
@@ -323,7 +464,8 @@ func (c *RepCmd) setRoleByName(s *discordgo.Session, event *discordgo.Interactio
 	}
 }
 
-func (c *RepCmd) InteractSetNickByAccount(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+// onSelectAccount sets the account picked in the account picker as the nick of the member
+func (c *RepCmd) onSelectAccount(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, selection PagedSelection) {
 	locale := GetInteractionLocale(event)
 	if event.GuildID == "" {
 		s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
@@ -332,16 +474,13 @@ func (c *RepCmd) InteractSetNickByAccount(s *discordgo.Session, event *discordgo
 		return
 	}
 
-	parts := strings.Split(event.MessageComponentData().CustomID, ":")
-	if len(parts) != 2 {
-		s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
-			Content: resources.TL(locale, "rep.errors.invalid_command"),
-		})
+	if len(selection.Values) == 0 {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
 		return
 	}
-	accName := parts[1]
+	accName := selection.Values[0]
 
-	err := nick.SetAccAsNick(s, event.Member, accName)
+	err := nick.SetAccAsNick(s, c.audit, event.Member, accName, "audit.reasons.rep_account")
 	if err != nil {
 		onError(s, event, err)
 		return
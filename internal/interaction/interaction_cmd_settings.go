@@ -2,51 +2,29 @@ package interaction
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/diagnose"
 	"github.com/vennekilde/gw2-alliance-bot/internal/guild"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+	"github.com/vennekilde/gw2-alliance-bot/internal/webhook"
 	"github.com/vennekilde/gw2-alliance-bot/internal/world"
 	"github.com/vennekilde/gw2-alliance-bot/resources"
 	"go.uber.org/zap"
 )
 
-const (
-	PermissionAccount      = "account"
-	PermissionInventiories = "inventories"
-	PermissionCharacters   = "characters"
-	PermissionTradingPost  = "tradingpost"
-	PermissionWallet       = "wallet"
-	PermissionUnlocks      = "unlocks"
-	PermissionPvP          = "pvp"
-	PermissionWvW          = "wvw"
-	PermissionBuilds       = "builds"
-	PermissionProgression  = "progression"
-	PermissionGuilds       = "guilds"
-)
-
-var Permissions = []string{
-	PermissionAccount,
-	PermissionInventiories,
-	PermissionCharacters,
-	PermissionTradingPost,
-	PermissionWallet,
-	PermissionUnlocks,
-	PermissionPvP,
-	PermissionWvW,
-	PermissionBuilds,
-	PermissionProgression,
-	PermissionGuilds,
-}
-
 const (
 	InteractionIDSettingsSetWvWWorldDisable             = "setting-set-wvw-world-disable"
-	InteractionIDSettingsSetWvWWorldEU                  = "setting-set-wvw-world-eu"
-	InteractionIDSettingsSetWvWWorldEUNational          = "setting-set-wvw-world-eu-national"
-	InteractionIDSettingsSetWvWWorldNA                  = "setting-set-wvw-world-na"
+	InteractionIDSettingsSetWvWWorld                    = "setting-set-wvw-world"
 	InteractionIDSettingsSetPrimaryWorldRole            = "setting-set-prmary-world-role"
 	InteractionIDSettingsSetLinkedWorldRole             = "setting-set-linked-world-role"
 	InteractionIDSettingsSetWvWAssociatedRoles          = "setting-set-wvw-associated-roles"
@@ -60,41 +38,72 @@ const (
 	InteractionIDSettingsSetGuildVerifyRoles            = "setting-set-guild-verify-roles"
 	InteractionIDSettingsSetRolesToRemoveWhenNotInGuild = "setting-set-roles-to-remove-when-not-in-guild"
 	InteractionIDSettingsSetAPIKeyPermissions           = "setting-set-api-key-permissions"
+	InteractionIDSettingsSetExpiredLogChannel           = "setting-set-expired-log-channel"
+	InteractionIDSettingsSetAuditChannel                = "setting-set-audit-channel"
+)
+
+const (
+	// reconcileProgressInterval is how often the progress of re-evaluating members is updated in the settings message
+	reconcileProgressInterval = 3 * time.Second
+	// reconcileProgressTimeout stops updating the progress before the interaction token expires after 15 minutes
+	reconcileProgressTimeout = 14 * time.Minute
 )
 
 type SettingsCmd struct {
 	service *backend.Service
 	guilds  *guild.Guilds
+	// commandNames returns the names of the commands that can be disabled
+	commandNames func() []string
+	webhooks     *webhook.Dispatcher
+
+	m         sync.Mutex
+	imports   map[string]*settingsImport
+	importSeq int
+
+	worldSelect       *PagedSelect
+	verifyRolesSelect *PagedSelect
 }
 
-func NewSettingsCmd(service *backend.Service, guilds *guild.Guilds) *SettingsCmd {
-	return &SettingsCmd{
-		service: service,
-		guilds:  guilds,
+func NewSettingsCmd(service *backend.Service, guilds *guild.Guilds, webhooks *webhook.Dispatcher) *SettingsCmd {
+	c := &SettingsCmd{
+		service:  service,
+		guilds:   guilds,
+		webhooks: webhooks,
+		imports:  make(map[string]*settingsImport),
 	}
+	c.worldSelect = NewPagedSelect(InteractionIDSettingsSetWvWWorld, "settings.wvw_world.placeholder", true, false, c.loadWorldOptions, c.onSelectWvWWorld)
+	c.verifyRolesSelect = NewPagedSelect(InteractionIDSettingsSetGuildVerifyRoles, "settings.guild_verification.verify_roles_placeholder", true, true, c.loadGuildVerifyRoleOptions, c.onSelectGuildVerifyRoles)
+	return c
 }
 
 func (c *SettingsCmd) Register(i *Interactions) {
-	i.interactions[InteractionIDSettingsSetWvWWorldDisable] = c.InteractSetWvWWorld
-	i.interactions[InteractionIDSettingsSetWvWWorldEU] = c.InteractSetWvWWorld
-	i.interactions[InteractionIDSettingsSetWvWWorldEUNational] = c.InteractSetWvWWorld
-	i.interactions[InteractionIDSettingsSetWvWWorldNA] = c.InteractSetWvWWorld
-	i.interactions[InteractionIDSettingsSetPrimaryWorldRole] = c.InteractSetWorldRole
-	i.interactions[InteractionIDSettingsSetLinkedWorldRole] = c.InteractSetWorldRole
-	i.interactions[InteractionIDSettingsSetWvWAssociatedRoles] = c.InteractSetAssociatedRoles
-	i.interactions[InteractionIDSettingsSetAccRepEnable] = c.InteractSetAccRep
-	i.interactions[InteractionIDSettingsSetAccRepDisable] = c.InteractSetAccRep
-	i.interactions[InteractionIDSettingsSetGuildTagRepEnable] = c.InteractSetGuildTagRep
-	i.interactions[InteractionIDSettingsSetGuildTagRepDisable] = c.InteractSetGuildTagRep
-	i.interactions[InteractionIDSettingsSetEnforceGuildTagRepEnable] = c.InteractSetEnforceGuildTagRep
-	i.interactions[InteractionIDSettingsSetEnforceGuildTagRepDisable] = c.InteractSetEnforceGuildTagRep
-	i.interactions[InteractionIDSettingsSetGuildCommonRole] = c.InteractSetGuildCommonRole
-	i.interactions[InteractionIDSettingsSetGuildVerifyRoles] = c.InteractSetGuildVerifyRoles
-	i.interactions[InteractionIDSettingsSetRolesToRemoveWhenNotInGuild] = c.InteractSetRolesToRemoveWhenNotInGuild
-	i.interactions[InteractionIDSettingsSetAPIKeyPermissions] = c.InteractSetRequiredAPIKeyPermissions
+	i.router.HandleFunc(InteractionIDSettingsSetWvWWorldDisable, c.InteractSetWvWWorld)
+	c.worldSelect.Register(i)
+	i.router.HandleFunc(InteractionIDSettingsSetPrimaryWorldRole, c.InteractSetWorldRole)
+	i.router.HandleFunc(InteractionIDSettingsSetLinkedWorldRole, c.InteractSetWorldRole)
+	i.router.HandleFunc(InteractionIDSettingsSetWvWAssociatedRoles, c.InteractSetAssociatedRoles)
+	i.router.HandleFunc(InteractionIDSettingsSetAccRepEnable, c.InteractSetAccRep)
+	i.router.HandleFunc(InteractionIDSettingsSetAccRepDisable, c.InteractSetAccRep)
+	i.router.HandleFunc(InteractionIDSettingsSetGuildTagRepEnable, c.InteractSetGuildTagRep)
+	i.router.HandleFunc(InteractionIDSettingsSetGuildTagRepDisable, c.InteractSetGuildTagRep)
+	i.router.HandleFunc(InteractionIDSettingsSetEnforceGuildTagRepEnable, c.InteractSetEnforceGuildTagRep)
+	i.router.HandleFunc(InteractionIDSettingsSetEnforceGuildTagRepDisable, c.InteractSetEnforceGuildTagRep)
+	i.router.HandleFunc(InteractionIDSettingsSetGuildCommonRole, c.InteractSetGuildCommonRole)
+	c.verifyRolesSelect.Register(i)
+	i.router.HandleFunc(InteractionIDSettingsSetRolesToRemoveWhenNotInGuild, c.InteractSetRolesToRemoveWhenNotInGuild)
+	i.router.HandleFunc(InteractionIDSettingsSetAPIKeyPermissions, c.InteractSetRequiredAPIKeyPermissions)
+	i.router.HandleFunc(InteractionIDSettingsSetExpiredLogChannel, c.InteractSetExpiredLogChannel)
+	i.router.HandleFunc(InteractionIDSettingsSetAuditChannel, c.InteractSetAuditChannel)
+	i.router.Handle(routeSettingsImportConfirm, c.InteractImportConfirm)
+	i.router.Handle(routeSettingsImportCancel, c.InteractImportCancel)
+	i.router.Handle(routeSettingsHistoryPage, c.InteractHistoryPage)
+	i.router.HandleFunc(InteractionIDSettingsSetEnabledCommands, c.InteractSetEnabledCommands)
+	i.router.HandleFunc(InteractionIDSettingsSetCommandAdminRoles, c.InteractSetCommandAdminRoles)
+	c.commandNames = i.CommandNames
 
 	var permission int64 = discordgo.PermissionAdministrator
 	var permissionDM bool = false
+	var minHistoryEntry float64 = 1
 
 	// Settings command
 	i.addCommand(&Command{
@@ -105,138 +114,341 @@ func (c *SettingsCmd) Register(i *Interactions) {
 			DescriptionLocalizations: resources.GetLocalizations("cmd.settings.description"),
 			DefaultMemberPermissions: &permission,
 			DMPermission:             &permissionDM,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.settings.options.show.name"),
+					Description:              resources.T("cmd.settings.options.show.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.settings.options.show.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.settings.options.show.description"),
+				},
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.settings.options.export.name"),
+					Description:              resources.T("cmd.settings.options.export.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.settings.options.export.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.settings.options.export.description"),
+				},
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.settings.options.import.name"),
+					Description:              resources.T("cmd.settings.options.import.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.settings.options.import.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.settings.options.import.description"),
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:                     discordgo.ApplicationCommandOptionAttachment,
+							Name:                     resources.T("cmd.settings.options.import.file.name"),
+							Description:              resources.T("cmd.settings.options.import.file.description"),
+							NameLocalizations:        resources.GetOptionLocalizations("cmd.settings.options.import.file.name"),
+							DescriptionLocalizations: resources.GetOptionLocalizations("cmd.settings.options.import.file.description"),
+							Required:                 true,
+						},
+					},
+				},
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.settings.options.history.name"),
+					Description:              resources.T("cmd.settings.options.history.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.settings.options.history.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.settings.options.history.description"),
+				},
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.settings.options.rollback.name"),
+					Description:              resources.T("cmd.settings.options.rollback.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.settings.options.rollback.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.settings.options.rollback.description"),
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:                     discordgo.ApplicationCommandOptionInteger,
+							Name:                     resources.T("cmd.settings.options.rollback.entry.name"),
+							Description:              resources.T("cmd.settings.options.rollback.entry.description"),
+							NameLocalizations:        resources.GetOptionLocalizations("cmd.settings.options.rollback.entry.name"),
+							DescriptionLocalizations: resources.GetOptionLocalizations("cmd.settings.options.rollback.entry.description"),
+							MinValue:                 &minHistoryEntry,
+							Required:                 true,
+						},
+					},
+				},
+				{
+					Type:                     discordgo.ApplicationCommandOptionSubCommand,
+					Name:                     resources.T("cmd.settings.options.world.name"),
+					Description:              resources.T("cmd.settings.options.world.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.settings.options.world.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.settings.options.world.description"),
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:                     discordgo.ApplicationCommandOptionString,
+							Name:                     resources.T("cmd.settings.options.world.world.name"),
+							Description:              resources.T("cmd.settings.options.world.world.description"),
+							NameLocalizations:        resources.GetOptionLocalizations("cmd.settings.options.world.world.name"),
+							DescriptionLocalizations: resources.GetOptionLocalizations("cmd.settings.options.world.world.description"),
+							Required:                 true,
+							Autocomplete:             true,
+						},
+					},
+				},
+				buildWebhooksOption(),
+			},
 		},
-		handler: func(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
-			//ctx := context.Background()
-			locale := GetInteractionLocale(event)
-			currentWorld := c.service.GetSetting(event.GuildID, backend.SettingWvWWorld)
-			currentWorldID, _ := strconv.Atoi(currentWorld)
-			wvwWorldSelectComponents := buildWvWWorldSelectMenu(currentWorldID)
-
-			_, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
-				Content:    resources.TL(locale, "settings.wvw_world.title"),
-				Flags:      discordgo.MessageFlagsEphemeral,
-				Components: wvwWorldSelectComponents,
-			})
-			if err != nil {
-				onError(s, event, err)
-			}
-
-			currentPrimaryRole := c.service.GetSetting(event.GuildID, backend.SettingPrimaryRole)
-			currentLinkedRole := c.service.GetSetting(event.GuildID, backend.SettingLinkedRole)
-			worldRoleSelectComponents := buildWorldRoleSelectMenu(currentPrimaryRole, currentLinkedRole)
+		handler:      c.onCommandSettings,
+		autocomplete: c.onAutocompleteSettings,
+	})
+}
 
-			_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
-				Content:    resources.TL(locale, "settings.wvw_roles.title"),
-				Flags:      discordgo.MessageFlagsEphemeral,
-				Components: worldRoleSelectComponents,
-			})
-			if err != nil {
-				onError(s, event, err)
-			}
+// onAutocompleteSettings suggests worlds and WvW teams by name, as the select menus only list 25 worlds each
+func (c *SettingsCmd) onAutocompleteSettings(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	focused := focusedOption(event.ApplicationCommandData().Options)
+	if focused == nil || focused.Name != resources.T("cmd.settings.options.world.world.name") {
+		respondChoices(s, event, nil)
+		return
+	}
+	respondChoices(s, event, filterChoices(worldChoices(), focused.StringValue()))
+}
 
-			accRepComponents := c.buildAccountRepToggle(event.GuildID)
-			_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
-				Content:    resources.TL(locale, "settings.account_rep.title"),
-				Flags:      discordgo.MessageFlagsEphemeral,
-				Components: accRepComponents,
-			})
-			if err != nil {
-				onError(s, event, err)
-			}
+// onCommandWorld sets the world members are verified against
+func (c *SettingsCmd) onCommandWorld(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	options := event.ApplicationCommandData().Options[0].Options
+	if len(options) == 0 {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
 
-			guildTagRepComponents := c.buildGuildTagRepToggle(event.GuildID)
-			_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
-				Content:    resources.TL(locale, "settings.guild_rep.title"),
-				Flags:      discordgo.MessageFlagsEphemeral,
-				Components: guildTagRepComponents,
-			})
-			if err != nil {
-				onError(s, event, err)
-			}
+	// Values typed without picking a suggestion are not world ids
+	worldID, err := strconv.Atoi(options[0].StringValue())
+	selected, ok := world.WorldNames[worldID]
+	if err != nil || !ok {
+		onError(s, event, errors.New(resources.TL(locale, "settings.errors.unknown_world", resources.TData("world", options[0].StringValue()))))
+		return
+	}
 
-			currentCommonGuildRole := c.service.GetSetting(event.GuildID, backend.SettingGuildCommonRole)
-			currentRequiredPermissions := c.service.GetSettingSlice(event.GuildID, backend.SettingGuildRequiredPermissions)
-			currentGuildVerifyRoles := c.service.GetSettingSlice(event.GuildID, backend.SettingGuildVerifyRoles)
-			currentGuildRolesToRemove := c.service.GetSettingSlice(event.GuildID, backend.SettingRolesToRemoveWhenNotInGuild)
-			roles, err := s.GuildRoles(event.GuildID)
-			if err != nil {
-				onError(s, event, err)
-			}
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
+	err = c.service.SetSetting(ctx, event.GuildID, backend.SettingWvWWorld, strconv.Itoa(selected.ID))
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
 
-			guildCommonRoleComponents := c.buildGuildVerificationMenu(roles, currentCommonGuildRole, currentGuildVerifyRoles, currentGuildRolesToRemove, currentRequiredPermissions)
-			_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
-				Content:    resources.TL(locale, "settings.guild_verification.title"),
-				Flags:      discordgo.MessageFlagsEphemeral,
-				Components: guildCommonRoleComponents,
-			})
-			if err != nil {
-				onError(s, event, err)
-			}
-		},
+	message, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:   discordgo.MessageFlagsEphemeral,
+		Content: resources.TL(locale, "settings.wvw_world.updated", resources.TData("world", selected.Name)),
 	})
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+	c.reportReconcileProgress(s, event, message.ID, batch)
 }
 
-func buildWvWWorldSelectMenu(currentWorldID int) []discordgo.MessageComponent {
-	worlds := world.WorldsSorted()
+func (c *SettingsCmd) onCommandSettings(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	if event.GuildID == "" {
+		onError(s, event, errors.New(resources.TL(locale, "settings.errors.server_only")))
+		return
+	}
 
-	// Can only return 25 options, so we need to split them up somehow
-	euWorldOptions := make([]discordgo.SelectMenuOption, 0, len(worlds))
-	euNationalWorldOptions := make([]discordgo.SelectMenuOption, 0, len(worlds))
-	naWorldOptions := make([]discordgo.SelectMenuOption, 0, len(worlds))
-	disable := discordgo.Button{
-		Label:    resources.T("settings.wvw_world.button_disable"),
-		Style:    discordgo.DangerButton,
-		CustomID: InteractionIDSettingsSetWvWWorldDisable,
+	options := event.ApplicationCommandData().Options
+	if len(options) == 0 {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
 	}
-	for _, world := range worlds {
-		option := discordgo.SelectMenuOption{
-			Label: world.Name,
-			Value: strconv.Itoa(world.ID),
-		}
-		if currentWorldID == world.ID {
-			option.Default = true
-		}
-		if world.ID >= 2000 {
-			if strings.Contains(world.Name, "[") {
-				euNationalWorldOptions = append(euNationalWorldOptions, option)
-			} else {
-				euWorldOptions = append(euWorldOptions, option)
-			}
-		} else {
-			naWorldOptions = append(naWorldOptions, option)
+
+	switch options[0].Name {
+	case resources.T("cmd.settings.options.show.name"):
+		c.onCommandShow(s, event, user)
+	case resources.T("cmd.settings.options.export.name"):
+		c.onCommandExport(s, event, user)
+	case resources.T("cmd.settings.options.import.name"):
+		c.onCommandImport(s, event, user)
+	case resources.T("cmd.settings.options.history.name"):
+		c.onCommandHistory(s, event, user)
+	case resources.T("cmd.settings.options.rollback.name"):
+		c.onCommandRollback(s, event, user)
+	case resources.T("cmd.settings.options.world.name"):
+		c.onCommandWorld(s, event, user)
+	case resources.T("cmd.settings.options.webhooks.name"):
+		c.onCommandWebhooks(s, event, user)
+	default:
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+	}
+}
+
+// onCommandShow sends the messages used to change the settings of the server
+func (c *SettingsCmd) onCommandShow(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	currentWorldID, _ := c.service.GetWorld(event.GuildID)
+	wvwWorldSelectComponents, err := c.buildWvWWorldSelectMenu(currentWorldID, locale)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Content:    resources.TL(locale, "settings.wvw_world.title"),
+		Flags:      discordgo.MessageFlagsEphemeral,
+		Components: wvwWorldSelectComponents,
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+
+	currentPrimaryRole := c.service.GetSetting(event.GuildID, backend.SettingPrimaryRole)
+	currentLinkedRole := c.service.GetSetting(event.GuildID, backend.SettingLinkedRole)
+	worldRoleSelectComponents := buildWorldRoleSelectMenu(currentPrimaryRole, currentLinkedRole)
+
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Content:    resources.TL(locale, "settings.wvw_roles.title"),
+		Flags:      discordgo.MessageFlagsEphemeral,
+		Components: worldRoleSelectComponents,
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+
+	accRepComponents := c.buildAccountRepToggle(event.GuildID)
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Content:    resources.TL(locale, "settings.account_rep.title"),
+		Flags:      discordgo.MessageFlagsEphemeral,
+		Components: accRepComponents,
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+
+	guildTagRepComponents := c.buildGuildTagRepToggle(event.GuildID)
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Content:    resources.TL(locale, "settings.guild_rep.title"),
+		Flags:      discordgo.MessageFlagsEphemeral,
+		Components: guildTagRepComponents,
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+
+	currentCommonGuildRole := c.service.GetSetting(event.GuildID, backend.SettingGuildCommonRole)
+	currentRequiredPermissions := c.service.GetPermissions(event.GuildID, backend.SettingGuildRequiredPermissions)
+	currentGuildRolesToRemove := c.service.GetRoles(event.GuildID, backend.SettingRolesToRemoveWhenNotInGuild)
+	roles, err := s.GuildRoles(event.GuildID)
+	if err != nil {
+		onError(s, event, err)
+	}
+
+	guildCommonRoleComponents := c.buildGuildVerificationMenu(roles, currentCommonGuildRole, currentGuildRolesToRemove, currentRequiredPermissions)
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Content:    resources.TL(locale, "settings.guild_verification.title"),
+		Flags:      discordgo.MessageFlagsEphemeral,
+		Components: guildCommonRoleComponents,
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+
+	guildVerifyRolesComponents, err := c.verifyRolesSelect.Components(guildVerifyRoleOptions(roles, c.service.GetRoles(event.GuildID, backend.SettingGuildVerifyRoles)), 0, "", locale)
+	if err != nil {
+		onError(s, event, err)
+	} else {
+		_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+			Content:    resources.TL(locale, "settings.guild_verification.verify_roles_title"),
+			Flags:      discordgo.MessageFlagsEphemeral,
+			Components: guildVerifyRolesComponents,
+		})
+		if err != nil {
+			onError(s, event, err)
 		}
 	}
 
-	eu := discordgo.SelectMenu{
-		CustomID:    InteractionIDSettingsSetWvWWorldEU,
-		Placeholder: resources.T("settings.wvw_world.placeholder_eu"),
-		Options:     euWorldOptions,
+	currentExpiredLogChannel := c.service.GetSetting(event.GuildID, backend.SettingExpiredLogChannel)
+	currentAuditChannel := c.service.GetSetting(event.GuildID, backend.SettingAuditChannel)
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Content:    resources.TL(locale, "settings.notifications.title"),
+		Flags:      discordgo.MessageFlagsEphemeral,
+		Components: buildNotificationChannelSelectMenu(currentExpiredLogChannel, currentAuditChannel),
+	})
+	if err != nil {
+		onError(s, event, err)
 	}
-	euNational := discordgo.SelectMenu{
-		CustomID:    InteractionIDSettingsSetWvWWorldEUNational,
-		Placeholder: resources.T("settings.wvw_world.placeholder_eu_national"),
-		Options:     euNationalWorldOptions,
+
+	disabledCommands := c.service.GetCommands(event.GuildID, backend.SettingCommandsDisabled)
+	commandAdminRoles := c.service.GetRoles(event.GuildID, backend.SettingCommandsAdminRoles)
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Content:    resources.TL(locale, "settings.commands.title"),
+		Flags:      discordgo.MessageFlagsEphemeral,
+		Components: buildCommandsMenu(c.commandNames(), disabledCommands, commandAdminRoles),
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// buildWvWWorldSelectMenu builds the button disabling the world mapping, and the picker of worlds and WvW teams
+func (c *SettingsCmd) buildWvWWorldSelectMenu(currentWorldID int, locale discordgo.Locale) ([]discordgo.MessageComponent, error) {
+	disable := discordgo.Button{
+		Label:    resources.T("settings.wvw_world.button_disable"),
+		Style:    discordgo.DangerButton,
+		CustomID: InteractionIDSettingsSetWvWWorldDisable,
 	}
-	na := discordgo.SelectMenu{
-		CustomID:    InteractionIDSettingsSetWvWWorldNA,
-		Placeholder: resources.T("settings.wvw_world.placeholder_na"),
-		Options:     naWorldOptions,
+	worldComponents, err := c.worldSelect.Components(worldOptions(currentWorldID), 0, "", locale)
+	if err != nil {
+		return nil, err
 	}
-	return []discordgo.MessageComponent{
+	return append([]discordgo.MessageComponent{
 		discordgo.ActionsRow{
 			Components: []discordgo.MessageComponent{disable},
 		},
-		discordgo.ActionsRow{
-			Components: []discordgo.MessageComponent{eu},
-		},
-		discordgo.ActionsRow{
-			Components: []discordgo.MessageComponent{euNational},
-		},
-		discordgo.ActionsRow{
-			Components: []discordgo.MessageComponent{na},
-		},
+	}, worldComponents...), nil
+}
+
+// worldOptions returns an option for each world and WvW team, marking the current world
+func worldOptions(currentWorldID int) []discordgo.SelectMenuOption {
+	choices := worldChoices()
+	options := make([]discordgo.SelectMenuOption, len(choices))
+	for i, choice := range choices {
+		options[i] = discordgo.SelectMenuOption{
+			Label:   choice.Name,
+			Value:   choice.Value.(string),
+			Default: choice.Value == strconv.Itoa(currentWorldID),
+		}
 	}
+	return options
+}
+
+func (c *SettingsCmd) loadWorldOptions(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) ([]discordgo.SelectMenuOption, error) {
+	currentWorldID, _ := c.service.GetWorld(event.GuildID)
+	return worldOptions(currentWorldID), nil
+}
+
+func (c *SettingsCmd) onSelectWvWWorld(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, selection PagedSelection) {
+	c.InteractSetWvWWorld(s, event, user)
+}
+
+// guildVerifyRoleOptions returns an option for each guild role, sorted by name, marking the roles verified with the common role
+func guildVerifyRoleOptions(roles []*discordgo.Role, current []string) []discordgo.SelectMenuOption {
+	options := make([]discordgo.SelectMenuOption, 0, len(roles))
+	for _, role := range roles {
+		if !guild.RegexRoleNameMatcher.MatchString(role.Name) {
+			continue
+		}
+		options = append(options, discordgo.SelectMenuOption{
+			Label:   role.Name,
+			Value:   role.ID,
+			Default: slices.Contains(current, role.ID),
+		})
+	}
+	sort.SliceStable(options, func(i, j int) bool {
+		return strings.ToLower(options[i].Label) < strings.ToLower(options[j].Label)
+	})
+	return options
+}
+
+func (c *SettingsCmd) loadGuildVerifyRoleOptions(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) ([]discordgo.SelectMenuOption, error) {
+	roles, err := s.GuildRoles(event.GuildID)
+	if err != nil {
+		return nil, err
+	}
+	return guildVerifyRoleOptions(roles, c.service.GetRoles(event.GuildID, backend.SettingGuildVerifyRoles)), nil
 }
 
 func buildWorldRoleSelectMenu(currentPrimaryRoleID string, currentLinkedRoleID string) []discordgo.MessageComponent {
@@ -292,12 +504,46 @@ func buildWorldRoleSelectMenu(currentPrimaryRoleID string, currentLinkedRoleID s
 	}
 }
 
+func buildNotificationChannelSelectMenu(currentExpiredLogChannelID string, currentAuditChannelID string) []discordgo.MessageComponent {
+	channelSelectMenu := func(customID string, placeholder string, currentChannelID string) discordgo.SelectMenu {
+		minValues := 0
+		menu := discordgo.SelectMenu{
+			MenuType:     discordgo.ChannelSelectMenu,
+			CustomID:     customID,
+			Placeholder:  placeholder,
+			MinValues:    &minValues,
+			ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+		}
+		if currentChannelID != "" {
+			menu.DefaultValues = []discordgo.SelectMenuDefaultValue{
+				{
+					Type: discordgo.SelectMenuDefaultValueChannel,
+					ID:   currentChannelID,
+				},
+			}
+		}
+		return menu
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				channelSelectMenu(InteractionIDSettingsSetExpiredLogChannel, resources.T("settings.notifications.expired_placeholder"), currentExpiredLogChannelID),
+			},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				channelSelectMenu(InteractionIDSettingsSetAuditChannel, resources.T("settings.notifications.audit_placeholder"), currentAuditChannelID),
+			},
+		},
+	}
+}
+
 func (c *SettingsCmd) buildAccountRepToggle(guildID string) []discordgo.MessageComponent {
-	accRepEnabled := c.service.GetSetting(guildID, backend.SettingAccRepEnabled)
 	label := resources.T("settings.account_rep.button_enable")
 	customID := InteractionIDSettingsSetAccRepEnable
 	style := discordgo.SuccessButton
-	if accRepEnabled == "true" {
+	if c.service.GetBool(guildID, backend.SettingAccRepEnabled) {
 		label = resources.T("settings.account_rep.button_disable")
 		customID = InteractionIDSettingsSetAccRepDisable
 		style = discordgo.DangerButton
@@ -317,21 +563,19 @@ func (c *SettingsCmd) buildAccountRepToggle(guildID string) []discordgo.MessageC
 }
 
 func (c *SettingsCmd) buildGuildTagRepToggle(guildID string) []discordgo.MessageComponent {
-	guildRepEnabled := c.service.GetSetting(guildID, backend.SettingGuildTagRepEnabled)
 	label := resources.T("settings.guild_rep.button_enable")
 	customID := InteractionIDSettingsSetGuildTagRepEnable
 	style := discordgo.SuccessButton
-	if guildRepEnabled == "true" {
+	if c.service.GetBool(guildID, backend.SettingGuildTagRepEnabled) {
 		label = resources.T("settings.guild_rep.button_disable")
 		customID = InteractionIDSettingsSetGuildTagRepDisable
 		style = discordgo.DangerButton
 	}
 
-	guildRepEnforcement := c.service.GetSetting(guildID, backend.SettingEnforceGuildRep)
 	labelEnforcement := resources.T("settings.guild_rep.button_enforce_enable")
 	customIDEnforcement := InteractionIDSettingsSetEnforceGuildTagRepEnable
 	styleEnforcement := discordgo.SuccessButton
-	if guildRepEnforcement == "true" {
+	if c.service.GetBool(guildID, backend.SettingEnforceGuildRep) {
 		labelEnforcement = resources.T("settings.guild_rep.button_enforce_disable")
 		customIDEnforcement = InteractionIDSettingsSetEnforceGuildTagRepDisable
 		styleEnforcement = discordgo.DangerButton
@@ -359,7 +603,7 @@ func (c *SettingsCmd) buildGuildTagRepToggle(guildID string) []discordgo.Message
 	}
 }
 
-func (c *SettingsCmd) buildGuildVerificationMenu(roles []*discordgo.Role, currentCommonGuildRole string, currentGuildVerifyRoles []string, currentGuildRolesToRemove []string, currentAPIKeyPermissions []string) []discordgo.MessageComponent {
+func (c *SettingsCmd) buildGuildVerificationMenu(roles []*discordgo.Role, currentCommonGuildRole string, currentGuildRolesToRemove []string, currentAPIKeyPermissions []string) []discordgo.MessageComponent {
 	zero := 0
 	rolesSelect := discordgo.SelectMenu{
 		MenuType:    discordgo.RoleSelectMenu,
@@ -376,26 +620,8 @@ func (c *SettingsCmd) buildGuildVerificationMenu(roles []*discordgo.Role, curren
 		}
 	}
 
-	guildRolesSelect := discordgo.SelectMenu{
-		MenuType:    discordgo.RoleSelectMenu,
-		CustomID:    InteractionIDSettingsSetGuildVerifyRoles,
-		Placeholder: resources.T("settings.guild_verification.verify_roles_placeholder"),
-		MinValues:   &zero,
-		MaxValues:   25,
-	}
-
-	if len(currentGuildVerifyRoles) > 0 {
-		guildRolesSelect.DefaultValues = make([]discordgo.SelectMenuDefaultValue, len(currentGuildVerifyRoles))
-		for i, roleID := range currentGuildVerifyRoles {
-			guildRolesSelect.DefaultValues[i] = discordgo.SelectMenuDefaultValue{
-				Type: discordgo.SelectMenuDefaultValueRole,
-				ID:   roleID,
-			}
-		}
-	}
-
-	permissionsOptions := make([]discordgo.SelectMenuOption, 0, len(Permissions))
-	for _, permission := range Permissions {
+	permissionsOptions := make([]discordgo.SelectMenuOption, 0, len(backend.APIKeyPermissions))
+	for _, permission := range backend.APIKeyPermissions {
 		option := discordgo.SelectMenuOption{
 			Label: permission,
 			Value: permission,
@@ -441,9 +667,6 @@ func (c *SettingsCmd) buildGuildVerificationMenu(roles []*discordgo.Role, curren
 		discordgo.ActionsRow{
 			Components: []discordgo.MessageComponent{rolesSelect},
 		},
-		discordgo.ActionsRow{
-			Components: []discordgo.MessageComponent{guildRolesSelect},
-		},
 		discordgo.ActionsRow{
 			Components: []discordgo.MessageComponent{requiredAPIKeyPermissionsSelect},
 		},
@@ -472,11 +695,12 @@ func (c *SettingsCmd) InteractSetWvWWorld(s *discordgo.Session, event *discordgo
 		return
 	}
 	response := resources.T("settings.wvw_world.disabled")
-	ctx := context.Background()
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
 	if len(event.MessageComponentData().Values) == 0 {
 		// Disable
 		zap.L().Info("Disabling WvW world mapping")
-		err := c.service.SetSetting(ctx, event.GuildID, backend.SettingWvWWorld, "disabled")
+		err := c.service.SetSetting(ctx, event.GuildID, backend.SettingWvWWorld, backend.WorldDisabled)
 		if err != nil {
 			onError(s, event, err)
 			return
@@ -501,13 +725,14 @@ func (c *SettingsCmd) InteractSetWvWWorld(s *discordgo.Session, event *discordgo
 		response = world.Name
 	}
 
-	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+	message, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
 		Content: resources.T("settings.wvw_world.updated", resources.TData("world", response)),
 	})
 	if err != nil {
 		onError(s, event, err)
 		return
 	}
+	c.reportReconcileProgress(s, event, message.ID, batch)
 }
 
 func (c *SettingsCmd) InteractSetWorldRole(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
@@ -545,7 +770,8 @@ func (c *SettingsCmd) InteractSetWorldRole(s *discordgo.Session, event *discordg
 		return
 	}
 
-	ctx := context.Background()
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
 	var roleID string
 	if len(event.MessageComponentData().Values) == 0 {
 		// Disable
@@ -557,6 +783,10 @@ func (c *SettingsCmd) InteractSetWorldRole(s *discordgo.Session, event *discordg
 		}
 	} else {
 		roleID = event.MessageComponentData().Values[0]
+		if problems := diagnose.CheckSetting(s, event.GuildID, property, roleID); len(problems) > 0 {
+			reportProblems(s, event, problems)
+			return
+		}
 		zap.L().Info("Setting world role", zap.String("server_id", event.GuildID), zap.String("property", property), zap.String("role_id", roleID))
 	}
 
@@ -566,13 +796,14 @@ func (c *SettingsCmd) InteractSetWorldRole(s *discordgo.Session, event *discordg
 		return
 	}
 
-	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+	message, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
 		Content: resources.T(fmt.Sprintf("settings.wvw_roles.%s_updated", strings.ToLower(label)), resources.TData("roleId", roleID)),
 	})
 	if err != nil {
 		onError(s, event, err)
 		return
 	}
+	c.reportReconcileProgress(s, event, message.ID, batch)
 }
 
 func (c *SettingsCmd) InteractSetAssociatedRoles(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
@@ -594,12 +825,17 @@ func (c *SettingsCmd) InteractSetAssociatedRoles(s *discordgo.Session, event *di
 		return
 	}
 
-	ctx := context.Background()
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
 	roleIDs := make([]string, len(event.MessageComponentData().Values))
 
 	for i, roleID := range event.MessageComponentData().Values {
 		roleIDs[i] = roleID
 	}
+	if problems := diagnose.CheckSetting(s, event.GuildID, backend.SettingAssociatedRoles, strings.Join(roleIDs, ",")); len(problems) > 0 {
+		reportProblems(s, event, problems)
+		return
+	}
 
 	err = c.service.SetSetting(ctx, event.GuildID, backend.SettingAssociatedRoles, strings.Join(roleIDs, ","))
 	if err != nil {
@@ -607,13 +843,14 @@ func (c *SettingsCmd) InteractSetAssociatedRoles(s *discordgo.Session, event *di
 		return
 	}
 
-	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+	message, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
 		Content: resources.T("settings.wvw_roles.associated_updated", resources.TData("roleIds", strings.Join(roleIDs, ">, <@&"))),
 	})
 	if err != nil {
 		onError(s, event, err)
 		return
 	}
+	c.reportReconcileProgress(s, event, message.ID, batch)
 }
 
 func (c *SettingsCmd) InteractSetAccRep(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
@@ -624,12 +861,14 @@ func (c *SettingsCmd) InteractSetAccRep(s *discordgo.Session, event *discordgo.I
 		return
 	}
 
-	value := "false"
-	if event.MessageComponentData().CustomID == InteractionIDSettingsSetAccRepEnable {
-		value = "true"
+	value := strconv.FormatBool(event.MessageComponentData().CustomID == InteractionIDSettingsSetAccRepEnable)
+	if problems := diagnose.CheckSetting(s, event.GuildID, backend.SettingAccRepEnabled, value); len(problems) > 0 {
+		c.updateWithProblems(s, event, problems)
+		return
 	}
 
-	ctx := context.Background()
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
 	err := c.service.SetSetting(ctx, event.GuildID, backend.SettingAccRepEnabled, value)
 	if err != nil {
 		onError(s, event, err)
@@ -648,6 +887,7 @@ func (c *SettingsCmd) InteractSetAccRep(s *discordgo.Session, event *discordgo.I
 		onError(s, event, err)
 		return
 	}
+	c.reportReconcileProgress(s, event, "", batch)
 }
 
 func (c *SettingsCmd) InteractSetGuildTagRep(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
@@ -658,12 +898,14 @@ func (c *SettingsCmd) InteractSetGuildTagRep(s *discordgo.Session, event *discor
 		return
 	}
 
-	value := "false"
-	if event.MessageComponentData().CustomID == InteractionIDSettingsSetGuildTagRepEnable {
-		value = "true"
+	value := strconv.FormatBool(event.MessageComponentData().CustomID == InteractionIDSettingsSetGuildTagRepEnable)
+	if problems := diagnose.CheckSetting(s, event.GuildID, backend.SettingGuildTagRepEnabled, value); len(problems) > 0 {
+		c.updateWithProblems(s, event, problems)
+		return
 	}
 
-	ctx := context.Background()
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
 	err := c.service.SetSetting(ctx, event.GuildID, backend.SettingGuildTagRepEnabled, value)
 	if err != nil {
 		onError(s, event, err)
@@ -682,6 +924,7 @@ func (c *SettingsCmd) InteractSetGuildTagRep(s *discordgo.Session, event *discor
 		onError(s, event, err)
 		return
 	}
+	c.reportReconcileProgress(s, event, "", batch)
 }
 
 func (c *SettingsCmd) InteractSetEnforceGuildTagRep(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
@@ -692,12 +935,10 @@ func (c *SettingsCmd) InteractSetEnforceGuildTagRep(s *discordgo.Session, event
 		return
 	}
 
-	value := "false"
-	if event.MessageComponentData().CustomID == InteractionIDSettingsSetEnforceGuildTagRepEnable {
-		value = "true"
-	}
+	value := strconv.FormatBool(event.MessageComponentData().CustomID == InteractionIDSettingsSetEnforceGuildTagRepEnable)
 
-	ctx := context.Background()
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
 	err := c.service.SetSetting(ctx, event.GuildID, backend.SettingEnforceGuildRep, value)
 	if err != nil {
 		onError(s, event, err)
@@ -716,6 +957,7 @@ func (c *SettingsCmd) InteractSetEnforceGuildTagRep(s *discordgo.Session, event
 		onError(s, event, err)
 		return
 	}
+	c.reportReconcileProgress(s, event, "", batch)
 }
 
 func (c *SettingsCmd) InteractSetGuildCommonRole(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
@@ -734,7 +976,13 @@ func (c *SettingsCmd) InteractSetGuildCommonRole(s *discordgo.Session, event *di
 	}
 
 	roleID := event.MessageComponentData().Values[0]
-	ctx := context.Background()
+	if problems := diagnose.CheckSetting(s, event.GuildID, backend.SettingGuildCommonRole, roleID); len(problems) > 0 {
+		c.updateWithProblems(s, event, problems)
+		return
+	}
+
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
 	err := c.service.SetSetting(ctx, event.GuildID, backend.SettingGuildCommonRole, roleID)
 	if err != nil {
 		onError(s, event, err)
@@ -760,9 +1008,11 @@ func (c *SettingsCmd) InteractSetGuildCommonRole(s *discordgo.Session, event *di
 		onError(s, event, err)
 		return
 	}
+	c.reportReconcileProgress(s, event, "", batch)
 }
 
-func (c *SettingsCmd) InteractSetGuildVerifyRoles(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+// onSelectGuildVerifyRoles sets the guild roles verified with the common role. Roles picked on other pages of the picker are kept
+func (c *SettingsCmd) onSelectGuildVerifyRoles(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, selection PagedSelection) {
 	if event.GuildID == "" {
 		s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
 			Content: resources.T("settings.errors.server_only"),
@@ -770,7 +1020,7 @@ func (c *SettingsCmd) InteractSetGuildVerifyRoles(s *discordgo.Session, event *d
 		return
 	}
 
-	selectedRoleIDs := event.MessageComponentData().Values
+	selectedRoleIDs := selection.Merge(c.service.GetRoles(event.GuildID, backend.SettingGuildVerifyRoles))
 	roles, err := s.GuildRoles(event.GuildID)
 	if err != nil {
 		onError(s, event, err)
@@ -792,41 +1042,32 @@ func (c *SettingsCmd) InteractSetGuildVerifyRoles(s *discordgo.Session, event *d
 		}
 		validatedRoleIDs = append(validatedRoleIDs, roleID)
 	}
-
 	rolesStr := strings.Join(validatedRoleIDs, ",")
-	ctx := context.Background()
+	if problems := diagnose.CheckSetting(s, event.GuildID, backend.SettingGuildVerifyRoles, rolesStr); len(problems) > 0 {
+		c.updateWithProblems(s, event, problems)
+		return
+	}
+
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
 	err = c.service.SetSetting(ctx, event.GuildID, backend.SettingGuildVerifyRoles, rolesStr)
 	if err != nil {
 		onError(s, event, err)
 		return
 	}
 
-	menu := event.Message.Components[1].(*discordgo.ActionsRow).Components[0].(*discordgo.SelectMenu)
-	menu.DefaultValues = make([]discordgo.SelectMenuDefaultValue, len(validatedRoleIDs))
-	for i, roleID := range validatedRoleIDs {
-		menu.DefaultValues[i] = discordgo.SelectMenuDefaultValue{
-			Type: discordgo.SelectMenuDefaultValueRole,
-			ID:   roleID,
-		}
-	}
-
-	content := event.Message.Content
+	// Drop roles reported earlier, keeping the title of the message
+	content, _, _ := strings.Cut(event.Message.Content, "\n\n")
 	if len(rejectedRoles) > 0 {
-		content = fmt.Sprintf("%s\n\nIgnored roles that do not match guild naming convention ([TAG] Name): %s", event.Message.Content, strings.Join(rejectedRoles, ", "))
+		content = fmt.Sprintf("%s\n\nIgnored roles that do not match guild naming convention ([TAG] Name): %s", content, strings.Join(rejectedRoles, ", "))
 	}
 
-	err = s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseUpdateMessage,
-		Data: &discordgo.InteractionResponseData{
-			Content:    content,
-			Flags:      discordgo.MessageFlagsEphemeral,
-			Components: event.Message.Components,
-		},
-	})
+	err = c.verifyRolesSelect.Update(s, event, user, selection.Page, selection.Query, content)
 	if err != nil {
 		onError(s, event, err)
 		return
 	}
+	c.reportReconcileProgress(s, event, "", batch)
 }
 
 func (c *SettingsCmd) InteractSetRolesToRemoveWhenNotInGuild(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
@@ -839,14 +1080,20 @@ func (c *SettingsCmd) InteractSetRolesToRemoveWhenNotInGuild(s *discordgo.Sessio
 
 	roleIds := event.MessageComponentData().Values
 	rolesStr := strings.Join(roleIds, ",")
-	ctx := context.Background()
+	if problems := diagnose.CheckSetting(s, event.GuildID, backend.SettingRolesToRemoveWhenNotInGuild, rolesStr); len(problems) > 0 {
+		c.updateWithProblems(s, event, problems)
+		return
+	}
+
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
 	err := c.service.SetSetting(ctx, event.GuildID, backend.SettingRolesToRemoveWhenNotInGuild, rolesStr)
 	if err != nil {
 		onError(s, event, err)
 		return
 	}
 
-	menu := event.Message.Components[3].(*discordgo.ActionsRow).Components[0].(*discordgo.SelectMenu)
+	menu := event.Message.Components[2].(*discordgo.ActionsRow).Components[0].(*discordgo.SelectMenu)
 	menu.DefaultValues = make([]discordgo.SelectMenuDefaultValue, len(roleIds))
 	for i, roleID := range roleIds {
 		menu.DefaultValues[i] = discordgo.SelectMenuDefaultValue{
@@ -866,6 +1113,7 @@ func (c *SettingsCmd) InteractSetRolesToRemoveWhenNotInGuild(s *discordgo.Sessio
 		onError(s, event, err)
 		return
 	}
+	c.reportReconcileProgress(s, event, "", batch)
 }
 
 func (c *SettingsCmd) InteractSetRequiredAPIKeyPermissions(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
@@ -878,16 +1126,17 @@ func (c *SettingsCmd) InteractSetRequiredAPIKeyPermissions(s *discordgo.Session,
 
 	permissions := event.MessageComponentData().Values
 	permissionsStr := strings.Join(permissions, ",")
-	ctx := context.Background()
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
 	err := c.service.SetSetting(ctx, event.GuildID, backend.SettingGuildRequiredPermissions, permissionsStr)
 	if err != nil {
 		onError(s, event, err)
 		return
 	}
 
-	menu := event.Message.Components[2].(*discordgo.ActionsRow).Components[0].(*discordgo.SelectMenu)
+	menu := event.Message.Components[1].(*discordgo.ActionsRow).Components[0].(*discordgo.SelectMenu)
 	menu.Options = []discordgo.SelectMenuOption{}
-	for _, permission := range Permissions {
+	for _, permission := range backend.APIKeyPermissions {
 		option := discordgo.SelectMenuOption{
 			Label: permission,
 			Value: permission,
@@ -913,4 +1162,138 @@ func (c *SettingsCmd) InteractSetRequiredAPIKeyPermissions(s *discordgo.Session,
 		onError(s, event, err)
 		return
 	}
+	c.reportReconcileProgress(s, event, "", batch)
+}
+
+func (c *SettingsCmd) InteractSetExpiredLogChannel(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	c.setChannelSetting(s, event, user, backend.SettingExpiredLogChannel, "settings.notifications.expired_updated", "settings.notifications.expired_disabled")
+}
+
+func (c *SettingsCmd) InteractSetAuditChannel(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	c.setChannelSetting(s, event, user, backend.SettingAuditChannel, "settings.notifications.audit_updated", "settings.notifications.audit_disabled")
+}
+
+// setChannelSetting stores the channel picked in a channel select menu, or clears the setting if no channel was picked
+func (c *SettingsCmd) setChannelSetting(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, name string, updatedKey string, disabledKey string) {
+	err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	if event.GuildID == "" {
+		s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+			Content: resources.T("settings.errors.server_only"),
+		})
+		return
+	}
+
+	var channelID string
+	if len(event.MessageComponentData().Values) > 0 {
+		channelID = event.MessageComponentData().Values[0]
+	}
+	if problems := diagnose.CheckSetting(s, event.GuildID, name, channelID); len(problems) > 0 {
+		reportProblems(s, event, problems)
+		return
+	}
+	zap.L().Info("Setting channel", zap.String("server_id", event.GuildID), zap.String("setting", name), zap.String("channel_id", channelID))
+
+	ctx := backend.WithActor(context.Background(), user.ID)
+	err = c.service.SetSetting(ctx, event.GuildID, name, channelID)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	content := resources.T(disabledKey)
+	if channelID != "" {
+		content = resources.T(updatedKey, resources.TData("channelId", channelID))
+	}
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Content: content,
+	})
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+}
+
+// reportProblems tells the user the settings were not saved, as a followup to a deferred response
+func reportProblems(s *discordgo.Session, event *discordgo.InteractionCreate, problems []diagnose.Problem) {
+	locale := GetInteractionLocale(event)
+	_, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:           discordgo.MessageFlagsEphemeral,
+		Content:         resources.TL(locale, "settings.errors.not_saved") + "\n" + formatProblems(problems, locale),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// updateWithProblems tells the user the setting was not saved in the settings message, which is otherwise left as it was
+func (c *SettingsCmd) updateWithProblems(s *discordgo.Session, event *discordgo.InteractionCreate, problems []diagnose.Problem) {
+	locale := GetInteractionLocale(event)
+	// Drop problems reported earlier, keeping the title of the message
+	title, _, _ := strings.Cut(event.Message.Content, "\n\n")
+	err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:         title + "\n\n" + resources.TL(locale, "settings.errors.not_saved") + "\n" + formatProblems(problems, locale),
+			Flags:           discordgo.MessageFlagsEphemeral,
+			Components:      event.Message.Components,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// reportReconcileProgress shows how many of the members affected by a setting change have been re-evaluated, until all
+// of them are. Only the members of the batch of the change are counted, not other members waiting to be re-evaluated.
+// messageID is the followup message to show the progress in, or empty to show it in the message of the component
+func (c *SettingsCmd) reportReconcileProgress(s *discordgo.Session, event *discordgo.InteractionCreate, messageID string, batch *reconcile.Batch) {
+	if _, total := batch.Progress(); total == 0 {
+		return
+	}
+
+	go func() {
+		deadline := time.Now().Add(reconcileProgressTimeout)
+		for {
+			done, total := batch.Progress()
+			left := total - done
+
+			embed := &discordgo.MessageEmbed{
+				Description: resources.T("settings.reconcile.progress", resources.TData("done", total-left, "total", total)),
+				Color:       0x3498DB, // blue
+			}
+			if left == 0 {
+				embed.Description = resources.T("settings.reconcile.done", resources.TData("total", total))
+				embed.Color = 0x57F287 // green
+			}
+
+			embeds := []*discordgo.MessageEmbed{embed}
+			var err error
+			if messageID == "" {
+				_, err = s.InteractionResponseEdit(event.Interaction, &discordgo.WebhookEdit{Embeds: &embeds})
+			} else {
+				_, err = s.FollowupMessageEdit(event.Interaction, messageID, &discordgo.WebhookEdit{Embeds: &embeds})
+			}
+			if err != nil {
+				zap.L().Warn("unable to report reconciliation progress", zap.String("guild id", event.GuildID), zap.Error(err))
+				return
+			}
+
+			if left == 0 || time.Now().After(deadline) {
+				return
+			}
+			time.Sleep(reconcileProgressInterval)
+		}
+	}()
 }
@@ -0,0 +1,132 @@
+package interaction
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+)
+
+const (
+	InteractionIDSettingsSetEnabledCommands   = "setting-set-enabled-commands"
+	InteractionIDSettingsSetCommandAdminRoles = "setting-set-command-admin-roles"
+)
+
+// buildCommandsMenu builds the menus used to pick which commands are enabled on the server, and which roles may use the admin commands
+func buildCommandsMenu(commandNames []string, disabled []string, adminRoles []string) []discordgo.MessageComponent {
+	zero := 0
+	options := make([]discordgo.SelectMenuOption, len(commandNames))
+	for i, name := range commandNames {
+		options[i] = discordgo.SelectMenuOption{
+			Label:   "/" + name,
+			Value:   name,
+			Default: !slices.Contains(disabled, name),
+		}
+	}
+	enabledSelect := discordgo.SelectMenu{
+		MenuType:    discordgo.StringSelectMenu,
+		CustomID:    InteractionIDSettingsSetEnabledCommands,
+		Placeholder: resources.T("settings.commands.enabled_placeholder"),
+		MinValues:   &zero,
+		MaxValues:   len(options),
+		Options:     options,
+	}
+
+	adminRolesSelect := discordgo.SelectMenu{
+		MenuType:    discordgo.RoleSelectMenu,
+		CustomID:    InteractionIDSettingsSetCommandAdminRoles,
+		Placeholder: resources.T("settings.commands.admin_roles_placeholder"),
+		MinValues:   &zero,
+		MaxValues:   25,
+	}
+	if len(adminRoles) > 0 {
+		adminRolesSelect.DefaultValues = make([]discordgo.SelectMenuDefaultValue, len(adminRoles))
+		for i, roleID := range adminRoles {
+			adminRolesSelect.DefaultValues[i] = discordgo.SelectMenuDefaultValue{
+				Type: discordgo.SelectMenuDefaultValueRole,
+				ID:   roleID,
+			}
+		}
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{enabledSelect},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{adminRolesSelect},
+		},
+	}
+}
+
+// InteractSetEnabledCommands disables the commands that were not selected. Commands are registered on the server again once saved
+func (c *SettingsCmd) InteractSetEnabledCommands(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	if event.GuildID == "" {
+		s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+			Content: resources.T("settings.errors.server_only"),
+		})
+		return
+	}
+
+	enabled := event.MessageComponentData().Values
+	var disabled []string
+	for _, name := range c.commandNames() {
+		if !slices.Contains(enabled, name) {
+			disabled = append(disabled, name)
+		}
+	}
+
+	ctx := backend.WithActor(context.Background(), user.ID)
+	err := c.service.SetSetting(ctx, event.GuildID, backend.SettingCommandsDisabled, strings.Join(disabled, ","))
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	adminRoles := c.service.GetRoles(event.GuildID, backend.SettingCommandsAdminRoles)
+	err = s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    event.Message.Content,
+			Flags:      discordgo.MessageFlagsEphemeral,
+			Components: buildCommandsMenu(c.commandNames(), disabled, adminRoles),
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// InteractSetCommandAdminRoles sets the roles that may use the admin commands, besides administrators
+func (c *SettingsCmd) InteractSetCommandAdminRoles(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	if event.GuildID == "" {
+		s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+			Content: resources.T("settings.errors.server_only"),
+		})
+		return
+	}
+
+	roleIDs := event.MessageComponentData().Values
+	ctx := backend.WithActor(context.Background(), user.ID)
+	err := c.service.SetSetting(ctx, event.GuildID, backend.SettingCommandsAdminRoles, strings.Join(roleIDs, ","))
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	disabled := c.service.GetCommands(event.GuildID, backend.SettingCommandsDisabled)
+	err = s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    event.Message.Content,
+			Flags:      discordgo.MessageFlagsEphemeral,
+			Components: buildCommandsMenu(c.commandNames(), disabled, roleIDs),
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
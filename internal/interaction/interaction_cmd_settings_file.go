@@ -0,0 +1,333 @@
+package interaction
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	InteractionIDSettingsImportConfirm = "setting-import-confirm"
+	InteractionIDSettingsImportCancel  = "setting-import-cancel"
+)
+
+// Pending imports are only kept in memory, so the buttons are signed to detect them being pressed after a restart
+var (
+	routeSettingsImportConfirm = NewSignedRoute(InteractionIDSettingsImportConfirm, IntParam("import"))
+	routeSettingsImportCancel  = NewSignedRoute(InteractionIDSettingsImportCancel, IntParam("import"))
+)
+
+const (
+	// settingsFileMaxSize is the largest settings file accepted by /settings import
+	settingsFileMaxSize = 64 * 1024
+	// settingsImportTimeout is how long an import can be confirmed, before the interaction token expires after 15 minutes
+	settingsImportTimeout = 14 * time.Minute
+	// settingsFileDownloadTimeout is how long downloading the attached settings file may take
+	settingsFileDownloadTimeout = 10 * time.Second
+)
+
+var settingsFileClient = &http.Client{Timeout: settingsFileDownloadTimeout}
+
+// settingsImport is an import waiting to be confirmed
+type settingsImport struct {
+	guildID string
+	userID  string
+	values  map[string]string
+	created time.Time
+}
+
+func (c *SettingsCmd) onCommandExport(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	roles, err := s.GuildRoles(event.GuildID)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	channels, err := s.GuildChannels(event.GuildID)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	file := ExportSettings(c.service.GetSettings(event.GuildID), roles, channels)
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:   discordgo.MessageFlagsEphemeral,
+		Content: resources.TL(locale, "settings.export.content"),
+		Files: []*discordgo.File{
+			{
+				Name:        fmt.Sprintf("settings-%s.yaml", event.GuildID),
+				ContentType: "application/yaml",
+				Reader:      bytes.NewReader(data),
+			},
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+func (c *SettingsCmd) onCommandImport(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	options := event.ApplicationCommandData().Options[0].Options
+	if len(options) == 0 || event.ApplicationCommandData().Resolved == nil {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+	attachment, ok := event.ApplicationCommandData().Resolved.Attachments[options[0].Value.(string)]
+	if !ok {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+
+	data, err := downloadSettingsFile(attachment, locale)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	file, err := ParseSettingsFile(data, locale)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	roles, err := s.GuildRoles(event.GuildID)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+	channels, err := s.GuildChannels(event.GuildID)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+	values, err := file.Resolve(roles, channels, locale)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	changes := DiffSettings(c.service.GetSettings(event.GuildID), values)
+	if len(changes) == 0 {
+		_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Content: resources.TL(locale, "settings.import.no_changes"),
+		})
+		if err != nil {
+			onError(s, event, err)
+		}
+		return
+	}
+
+	// Only the changed settings are applied, so settings changed by someone else in the meantime are not reverted
+	changed := make(map[string]string, len(changes))
+	for _, change := range changes {
+		changed[change.Name] = change.NewValue
+	}
+	if problems := checkSettings(s, event.GuildID, changed); len(problems) > 0 {
+		reportProblems(s, event, problems)
+		return
+	}
+	importID := c.addImport(&settingsImport{
+		guildID: event.GuildID,
+		userID:  user.ID,
+		values:  changed,
+		created: time.Now(),
+	})
+	confirmID, err := routeSettingsImportConfirm.CustomID(importID)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+	cancelID, err := routeSettingsImportCancel.CustomID(importID)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:           discordgo.MessageFlagsEphemeral,
+		Embeds:          []*discordgo.MessageEmbed{buildSettingsImportEmbed(changes, locale)},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    resources.TL(locale, "settings.import.confirm"),
+						Style:    discordgo.SuccessButton,
+						CustomID: confirmID,
+					},
+					discordgo.Button{
+						Label:    resources.TL(locale, "settings.import.cancel"),
+						Style:    discordgo.SecondaryButton,
+						CustomID: cancelID,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// downloadSettingsFile fetches the content of the attached settings file
+func downloadSettingsFile(attachment *discordgo.MessageAttachment, locale discordgo.Locale) ([]byte, error) {
+	if attachment.Size > settingsFileMaxSize {
+		return nil, errors.New(resources.TL(locale, "settings.import.errors.too_large"))
+	}
+
+	resp, err := settingsFileClient.Get(attachment.URL)
+	if err != nil {
+		zap.L().Warn("unable to download settings file", zap.String("url", attachment.URL), zap.Error(err))
+		return nil, errors.New(resources.TL(locale, "settings.import.errors.download"))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		zap.L().Warn("unable to download settings file", zap.String("url", attachment.URL), zap.String("status", resp.Status))
+		return nil, errors.New(resources.TL(locale, "settings.import.errors.download"))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, settingsFileMaxSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(data) > settingsFileMaxSize {
+		return nil, errors.New(resources.TL(locale, "settings.import.errors.too_large"))
+	}
+	return data, nil
+}
+
+func buildSettingsImportEmbed(changes []SettingChange, locale discordgo.Locale) *discordgo.MessageEmbed {
+	var sb strings.Builder
+	for _, change := range changes {
+		line := fmt.Sprintf("**%s**: %s → %s\n", change.Name, formatSettingValue(change.Name, change.OldValue), formatSettingValue(change.Name, change.NewValue))
+		// Embed descriptions are limited to 4096 characters
+		if sb.Len()+len(line) > 4000 {
+			sb.WriteString("…")
+			break
+		}
+		sb.WriteString(line)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       resources.TL(locale, "settings.import.title"),
+		Description: sb.String(),
+		Color:       0x3498DB, // blue
+	}
+}
+
+// addImport stores the import until it is confirmed or cancelled, and returns its id
+func (c *SettingsCmd) addImport(pending *settingsImport) string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// Forget imports that can no longer be confirmed
+	for id, existing := range c.imports {
+		if time.Since(existing.created) > settingsImportTimeout {
+			delete(c.imports, id)
+		}
+	}
+
+	c.importSeq++
+	id := fmt.Sprintf("%d", c.importSeq)
+	c.imports[id] = pending
+	return id
+}
+
+// takeImport removes the import from the pending imports, and returns it if it can still be confirmed by the user
+func (c *SettingsCmd) takeImport(id string, guildID string, userID string) *settingsImport {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	pending, ok := c.imports[id]
+	if !ok || pending.guildID != guildID || pending.userID != userID {
+		return nil
+	}
+	delete(c.imports, id)
+	if time.Since(pending.created) > settingsImportTimeout {
+		return nil
+	}
+	return pending
+}
+
+func (c *SettingsCmd) InteractImportConfirm(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, params Params) {
+	locale := GetInteractionLocale(event)
+	importID := params.String("import")
+	pending := c.takeImport(importID, event.GuildID, user.ID)
+	if pending == nil {
+		c.closeImport(s, event, resources.TL(locale, "settings.import.expired"))
+		return
+	}
+
+	err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	zap.L().Info("importing settings", zap.String("guild id", pending.guildID), zap.String("user id", user.ID), zap.Any("settings", pending.values))
+	batch := reconcile.NewBatch()
+	ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
+	err = c.service.SetSettings(ctx, pending.guildID, pending.values)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	// Affected members are re-evaluated, and the progress is shown in place of the changes
+	content := resources.TL(locale, "settings.import.applied", resources.TData("count", len(pending.values)))
+	_, err = s.InteractionResponseEdit(event.Interaction, &discordgo.WebhookEdit{
+		Content:    &content,
+		Embeds:     &[]*discordgo.MessageEmbed{},
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+	c.reportReconcileProgress(s, event, "", batch)
+}
+
+func (c *SettingsCmd) InteractImportCancel(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, params Params) {
+	locale := GetInteractionLocale(event)
+	importID := params.String("import")
+	c.takeImport(importID, event.GuildID, user.ID)
+	c.closeImport(s, event, resources.TL(locale, "settings.import.cancelled"))
+}
+
+// closeImport replaces the import message with the content, removing the buttons
+func (c *SettingsCmd) closeImport(s *discordgo.Session, event *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Flags:      discordgo.MessageFlagsEphemeral,
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
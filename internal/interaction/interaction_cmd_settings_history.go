@@ -0,0 +1,159 @@
+package interaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/diagnose"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+const (
+	InteractionIDSettingsHistoryPage = "setting-history-page"
+)
+
+var routeSettingsHistoryPage = NewRoute(InteractionIDSettingsHistoryPage, IntParam("page"))
+
+// settingsHistoryPageSize is the number of changes shown per page of /settings history
+const settingsHistoryPageSize = 10
+
+func (c *SettingsCmd) onCommandHistory(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	embed, components := buildSettingsHistoryPage(c.service.History().Entries(event.GuildID), 0, locale)
+	_, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:           discordgo.MessageFlagsEphemeral,
+		Embeds:          []*discordgo.MessageEmbed{embed},
+		Components:      components,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+func (c *SettingsCmd) InteractHistoryPage(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, params Params) {
+	locale := GetInteractionLocale(event)
+	embed, components := buildSettingsHistoryPage(c.service.History().Entries(event.GuildID), params.Int("page"), locale)
+	err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Flags:           discordgo.MessageFlagsEphemeral,
+			Embeds:          []*discordgo.MessageEmbed{embed},
+			Components:      components,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+func (c *SettingsCmd) onCommandRollback(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	options := event.ApplicationCommandData().Options[0].Options
+	if len(options) == 0 {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+
+	entryID := int(options[0].IntValue())
+	entry, ok := c.service.History().Entry(event.GuildID, entryID)
+	if !ok {
+		onError(s, event, errors.New(resources.TL(locale, "settings.history.errors.not_found", resources.TData("id", entryID))))
+		return
+	}
+
+	content := resources.TL(locale, "settings.rollback.unchanged", resources.TData("name", entry.Name, "id", entry.ID))
+	current := c.service.GetSettings(event.GuildID)[entry.Name]
+	batch := reconcile.NewBatch()
+	if current != entry.OldValue {
+		// The old value may no longer be valid, e.g. if a role it refers to has been deleted since
+		if problems := diagnose.CheckSetting(s, event.GuildID, entry.Name, entry.OldValue); len(problems) > 0 {
+			reportProblems(s, event, problems)
+			return
+		}
+		zap.L().Info("rolling back setting", zap.String("guild id", event.GuildID), zap.String("user id", user.ID), zap.Int("entry", entry.ID), zap.String("setting", entry.Name), zap.String("value", entry.OldValue))
+		ctx := reconcile.WithBatch(backend.WithActor(context.Background(), user.ID), batch)
+		err := c.service.SetSetting(ctx, event.GuildID, entry.Name, entry.OldValue)
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
+		content = resources.TL(locale, "settings.rollback.done", resources.TData("name", entry.Name, "id", entry.ID, "value", formatSettingValue(entry.Name, entry.OldValue)))
+	}
+
+	message, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:           discordgo.MessageFlagsEphemeral,
+		Content:         content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+	c.reportReconcileProgress(s, event, message.ID, batch)
+}
+
+// buildSettingsHistoryPage renders a page of the settings history, newest changes first, with buttons to the previous and next page
+func buildSettingsHistoryPage(entries []backend.HistoryEntry, page int, locale discordgo.Locale) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	pages := max((len(entries)+settingsHistoryPageSize-1)/settingsHistoryPageSize, 1)
+	page = min(max(page, 0), pages-1)
+
+	embed := &discordgo.MessageEmbed{
+		Title:       resources.TL(locale, "settings.history.title"),
+		Description: resources.TL(locale, "settings.history.empty"),
+		Color:       0x3498DB, // blue
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: resources.TL(locale, "settings.history.page", resources.TData("page", page+1, "pages", pages)),
+		},
+	}
+
+	start := page * settingsHistoryPageSize
+	end := min(start+settingsHistoryPageSize, len(entries))
+	if start < end {
+		var sb strings.Builder
+		for _, entry := range entries[start:end] {
+			actor := resources.TL(locale, "settings.history.unknown_actor")
+			if entry.Actor != "" {
+				actor = fmt.Sprintf("<@%s>", entry.Actor)
+			}
+			line := fmt.Sprintf("`#%d` <t:%d:R> %s **%s**: %s → %s\n", entry.ID, entry.Time.Unix(), actor, entry.Name, formatSettingValue(entry.Name, entry.OldValue), formatSettingValue(entry.Name, entry.NewValue))
+			// Embed descriptions are limited to 4096 characters
+			if sb.Len()+len(line) > 4000 {
+				sb.WriteString("…")
+				break
+			}
+			sb.WriteString(line)
+		}
+		embed.Description = sb.String()
+	}
+
+	// Page numbers always fit in a custom id
+	previousID, _ := routeSettingsHistoryPage.CustomID(page - 1)
+	nextID, _ := routeSettingsHistoryPage.CustomID(page + 1)
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    resources.TL(locale, "settings.history.previous"),
+					Style:    discordgo.SecondaryButton,
+					CustomID: previousID,
+					Disabled: page == 0,
+				},
+				discordgo.Button{
+					Label:    resources.TL(locale, "settings.history.next"),
+					Style:    discordgo.SecondaryButton,
+					CustomID: nextID,
+					Disabled: page >= pages-1,
+				},
+			},
+		},
+	}
+	return embed, components
+}
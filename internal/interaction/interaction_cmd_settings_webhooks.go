@@ -0,0 +1,129 @@
+package interaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+// webhookURLsNone clears the webhook urls when given as the urls option
+const webhookURLsNone = "none"
+
+func buildWebhooksOption() *discordgo.ApplicationCommandOption {
+	const key = "cmd.settings.options.webhooks."
+
+	return &discordgo.ApplicationCommandOption{
+		Type:                     discordgo.ApplicationCommandOptionSubCommand,
+		Name:                     resources.T("cmd.settings.options.webhooks.name"),
+		Description:              resources.T("cmd.settings.options.webhooks.description"),
+		NameLocalizations:        resources.GetOptionLocalizations("cmd.settings.options.webhooks.name"),
+		DescriptionLocalizations: resources.GetOptionLocalizations("cmd.settings.options.webhooks.description"),
+		Options: []*discordgo.ApplicationCommandOption{
+			commandOption(discordgo.ApplicationCommandOptionString, key+"urls"),
+			commandOption(discordgo.ApplicationCommandOptionBoolean, key+"new_secret"),
+		},
+	}
+}
+
+// onCommandWebhooks sets the urls webhook events are sent to, and shows the secret they are signed with.
+// Options that are left out are not changed
+func (c *SettingsCmd) onCommandWebhooks(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	ctx := backend.WithActor(context.Background(), user.ID)
+	rotated := false
+	for _, option := range event.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case resources.T("cmd.settings.options.webhooks.urls.name"):
+			urls := parseWebhookURLs(option.StringValue())
+			err := backend.ValidateSetting(backend.SettingWebhookURLs, urls)
+			if err != nil {
+				onError(s, event, errors.New(resources.TL(locale, "settings.webhooks.errors.invalid_urls", resources.TData("error", err.Error()))))
+				return
+			}
+			zap.L().Info("updating webhook urls", zap.String("guild id", event.GuildID), zap.String("urls", urls))
+			err = c.service.SetSetting(ctx, event.GuildID, backend.SettingWebhookURLs, urls)
+			if err != nil {
+				onError(s, event, err)
+				return
+			}
+		case resources.T("cmd.settings.options.webhooks.new_secret.name"):
+			if !option.BoolValue() {
+				continue
+			}
+			zap.L().Info("rotating webhook secret", zap.String("guild id", event.GuildID))
+			_, err := c.webhooks.RotateSecret(ctx, event.GuildID)
+			if err != nil {
+				onError(s, event, err)
+				return
+			}
+			rotated = true
+		}
+	}
+
+	embed, err := c.buildWebhooksEmbed(event.GuildID, locale, rotated)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:  discordgo.MessageFlagsEphemeral,
+		Embeds: []*discordgo.MessageEmbed{embed},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// parseWebhookURLs turns the urls typed by the user, separated by commas or spaces, into the value of the webhook urls setting
+func parseWebhookURLs(value string) string {
+	if strings.EqualFold(strings.TrimSpace(value), webhookURLsNone) {
+		return ""
+	}
+	urls := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	return strings.Join(urls, ",")
+}
+
+func (c *SettingsCmd) buildWebhooksEmbed(guildID string, locale discordgo.Locale, rotated bool) (*discordgo.MessageEmbed, error) {
+	urls := c.service.GetURLs(guildID, backend.SettingWebhookURLs)
+	description := resources.TL(locale, "settings.webhooks.none")
+	if len(urls) > 0 {
+		description = resources.TL(locale, "settings.webhooks.urls") + "\n- " + strings.Join(urls, "\n- ")
+	}
+
+	secret, err := c.webhooks.Secret(guildID)
+	if err != nil {
+		return nil, err
+	}
+	secretText := fmt.Sprintf("||`%s`||", secret)
+	if rotated {
+		secretText += "\n" + resources.TL(locale, "settings.webhooks.secret_rotated")
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       resources.TL(locale, "settings.webhooks.title"),
+		Description: description,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: resources.TL(locale, "settings.webhooks.secret"), Value: secretText},
+		},
+	}
+	if deadLetters := c.webhooks.DeadLetters(guildID); len(deadLetters) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: resources.TL(locale, "settings.webhooks.failed"),
+			Value: resources.TL(locale, "settings.webhooks.failed_value", resources.TData(
+				"count", len(deadLetters),
+				"time", fmt.Sprintf("<t:%d:R>", deadLetters[0].Time.Unix()),
+				"url", deadLetters[0].URL,
+				"error", deadLetters[0].Error,
+			)),
+		})
+	}
+	return embed, nil
+}
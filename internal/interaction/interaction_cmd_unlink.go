@@ -0,0 +1,220 @@
+package interaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+const (
+	InteractionIDUnlink = "unlink"
+)
+
+const (
+	unlinkValueAccount = "account"
+	unlinkValueAPIKey  = "apikey"
+)
+
+type UnlinkCmd struct {
+	backend         *api.ClientWithResponses
+	cache           *discord.Cache
+	reconcileMember func(guildID string, userID string)
+	accountSelect   *PagedSelect
+}
+
+func NewUnlinkCmd(backend *api.ClientWithResponses, cache *discord.Cache, reconcileMember func(guildID string, userID string)) *UnlinkCmd {
+	c := &UnlinkCmd{
+		backend:         backend,
+		cache:           cache,
+		reconcileMember: reconcileMember,
+	}
+	c.accountSelect = NewPagedSelect(InteractionIDUnlink, "unlink.placeholder", true, false, c.loadOptions, c.onUnlink)
+	return c
+}
+
+func (c *UnlinkCmd) Register(i *Interactions) {
+	c.accountSelect.Register(i)
+
+	// Unlink cmd
+	i.addCommand(&Command{
+		command: &discordgo.ApplicationCommand{
+			Name:                     resources.T("cmd.unlink.name"),
+			Description:              resources.T("cmd.unlink.description"),
+			NameLocalizations:        resources.GetLocalizations("cmd.unlink.name"),
+			DescriptionLocalizations: resources.GetLocalizations("cmd.unlink.description"),
+		},
+		handler: c.onCommandUnlink,
+	})
+}
+
+func (c *UnlinkCmd) onCommandUnlink(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	accounts, err := c.fetchAccounts(user.ID, locale)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	components, err := c.accountSelect.Components(unlinkOptions(accounts, locale), 0, "", locale)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:      discordgo.MessageFlagsEphemeral,
+		Content:    resources.TL(locale, "unlink.content"),
+		Components: components,
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// fetchAccounts returns the accounts linked with the user
+func (c *UnlinkCmd) fetchAccounts(userID string, locale discordgo.Locale) ([]api.Account, error) {
+	resp, err := c.backend.GetPlatformUserWithResponse(context.Background(), backend.PlatformID, userID, &api.GetPlatformUserParams{})
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode() == http.StatusNotFound {
+		return nil, errors.New(resources.TL(locale, "errors.not_verified"))
+	} else if resp.JSON200 == nil {
+		return nil, errors.New(resources.TL(locale, "errors.unexpected_response"))
+	}
+
+	if len(resp.JSON200.Accounts) == 0 {
+		return nil, errors.New(resources.TL(locale, "unlink.errors.nothing_linked"))
+	}
+	return resp.JSON200.Accounts, nil
+}
+
+func (c *UnlinkCmd) loadOptions(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) ([]discordgo.SelectMenuOption, error) {
+	locale := GetInteractionLocale(event)
+	accounts, err := c.fetchAccounts(user.ID, locale)
+	if err != nil {
+		return nil, err
+	}
+	return unlinkOptions(accounts, locale), nil
+}
+
+// unlinkOptions returns an option for each linked account, followed by each API key of the account.
+// The options are paged, as users may have more accounts and API keys than fit in a single select menu
+func unlinkOptions(accounts []api.Account, locale discordgo.Locale) []discordgo.SelectMenuOption {
+	options := make([]discordgo.SelectMenuOption, 0, len(accounts))
+	for _, account := range accounts {
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       resources.TL(locale, "unlink.options.account.label", resources.TData("account", account.Name)),
+			Description: resources.TL(locale, "unlink.options.account.description"),
+			Value:       fmt.Sprintf("%s:%s", unlinkValueAccount, account.ID),
+		})
+		for _, token := range account.ApiKeys {
+			options = append(options, discordgo.SelectMenuOption{
+				Label:       resources.TL(locale, "unlink.options.apikey.label", resources.TData("name", token.Name, "account", account.Name)),
+				Description: resources.TL(locale, "unlink.options.apikey.description"),
+				Value:       fmt.Sprintf("%s:%s", unlinkValueAPIKey, token.Id),
+			})
+		}
+	}
+	return options
+}
+
+func (c *UnlinkCmd) onUnlink(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, selection PagedSelection) {
+	locale := GetInteractionLocale(event)
+	err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	values := selection.Values
+	if len(values) == 0 {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+	kind, id, found := strings.Cut(values[0], ":")
+	if !found || id == "" {
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+
+	ctx := context.Background()
+	var statusCode int
+	var errResp *api.TraitErrorResp
+	switch kind {
+	case unlinkValueAccount:
+		zap.L().Info("unlinking account", zap.String("user id", user.ID), zap.String("account id", id))
+		resp, err := c.backend.DeletePlatformUserAccountWithResponse(ctx, backend.PlatformID, user.ID, id)
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
+		statusCode = resp.StatusCode()
+		errResp = resp.JSON500
+	case unlinkValueAPIKey:
+		zap.L().Info("removing api key", zap.String("user id", user.ID), zap.String("token id", id))
+		resp, err := c.backend.DeletePlatformUserAPIKeyWithResponse(ctx, backend.PlatformID, user.ID, id)
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
+		statusCode = resp.StatusCode()
+		errResp = resp.JSON500
+	default:
+		onError(s, event, errors.New(resources.TL(locale, "rep.errors.invalid_command")))
+		return
+	}
+
+	switch statusCode {
+	case http.StatusOK, http.StatusNoContent:
+		// skip default handler
+	case http.StatusNotFound:
+		onError(s, event, errors.New(resources.TL(locale, "unlink.errors.not_found")))
+		return
+	default:
+		if errResp != nil {
+			onError(s, event, errors.New(errResp.SafeDisplayError))
+		} else {
+			onError(s, event, errors.New(resources.TL(locale, "errors.unexpected_response")))
+		}
+		return
+	}
+
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags: discordgo.MessageFlagsEphemeral,
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       resources.TL(locale, "unlink.success.title"),
+				Description: resources.TL(locale, "unlink.success.description"),
+				Color:       0x57F287, // green
+			},
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+
+	c.reconcile(s, user)
+}
+
+// reconcile ensures the roles of the user reflect the accounts that are still linked, on every server the user shares
+// with the bot. The command may be used in DMs, so the server it was used on is not enough
+func (c *UnlinkCmd) reconcile(s *discordgo.Session, user *discordgo.User) {
+	for _, guild := range discord.Guilds(s) {
+		if c.cache.MightBeMember(guild.ID, user.ID) {
+			c.reconcileMember(guild.ID, user.ID)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/bwmarrin/discordgo"
 	"github.com/vennekilde/gw2-alliance-bot/internal/api"
 	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
 	"github.com/vennekilde/gw2-alliance-bot/resources"
 )
 
@@ -40,8 +41,8 @@ func NewVerifyCmd(backend *api.ClientWithResponses, ui *UIBuilder, repCmd *RepCm
 }
 
 func (c *VerifyCmd) Register(i *Interactions) {
-	i.interactions[InteractionIDModalAPIKey] = c.openAPIKeyModal
-	i.interactions[InteractionIDSetAPIKey] = c.setAPIKeyModal
+	i.router.HandleFunc(InteractionIDModalAPIKey, c.openAPIKeyModal)
+	i.router.HandleFunc(InteractionIDSetAPIKey, c.setAPIKeyModal)
 
 	// Verify
 	i.addCommand(&Command{
@@ -59,67 +60,78 @@ func (c *VerifyCmd) Register(i *Interactions) {
 				},
 			},*/
 		},
-		handler: func(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
-			locale := GetInteractionLocale(event)
-			if len(event.ApplicationCommandData().Options) > 0 {
-				apiKey := event.ApplicationCommandData().Options[0].StringValue()
-				c.setAPIKey(s, event, user, apiKey)
-				return
-			}
-			code := GetAPIKeyCode(2, user.ID)
-
-			var apiKeyNamePrefix string
-			for _, guild := range s.State.Guilds {
-				if guild.ID == event.GuildID {
-					apiKeyNamePrefix = fmt.Sprintf("%s - ", guild.Name)
-					break
-				}
-			}
-
-			embeds := []*discordgo.MessageEmbed{
+		handler: c.onCommandVerify,
+	})
+}
+
+func (c *VerifyCmd) onCommandVerify(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	// The verify button of the onboarding message shares this handler, but carries no command data
+	if event.Type == discordgo.InteractionApplicationCommand && len(event.ApplicationCommandData().Options) > 0 {
+		apiKey := event.ApplicationCommandData().Options[0].StringValue()
+		c.setAPIKey(s, event, user, apiKey)
+		return
+	}
+	embeds, components := BuildVerifyInstructions(locale, APIKeyNamePrefix(s, event.GuildID), user.ID)
+	_, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:      discordgo.MessageFlagsEphemeral,
+		Embeds:     embeds,
+		Components: components,
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// APIKeyNamePrefix returns the prefix users must give their api key name when verifying on the given server
+func APIKeyNamePrefix(s *discordgo.Session, guildID string) string {
+	for _, guild := range discord.Guilds(s) {
+		if guild.ID == guildID {
+			return fmt.Sprintf("%s - ", guild.Name)
+		}
+	}
+	return ""
+}
+
+// BuildVerifyInstructions creates the instructions for how to create and set an api key, along with the buttons to do so
+func BuildVerifyInstructions(locale discordgo.Locale, apiKeyNamePrefix string, userID string) ([]*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	code := GetAPIKeyCode(backend.PlatformID, userID)
+	embeds := []*discordgo.MessageEmbed{
+		{
+			Title: resources.TL(locale, "verify.instructions.title"),
+			Fields: []*discordgo.MessageEmbedField{
 				{
-					Title: resources.TL(locale, "verify.instructions.title"),
-					Fields: []*discordgo.MessageEmbedField{
-						{
-							Name:  resources.TL(locale, "verify.instructions.step1.title"),
-							Value: resources.TL(locale, "verify.instructions.step1.content", resources.TData("apiKeyPrefix", apiKeyNamePrefix, "code", code)),
-						},
-						{
-							Name:  resources.TL(locale, "verify.instructions.step2.title"),
-							Value: resources.TL(locale, "verify.instructions.step2.content"),
-						},
-					},
-					Image: &discordgo.MessageEmbedImage{
-						URL: "https://i.imgur.com/Ukgu7KK.png",
-					},
+					Name:  resources.TL(locale, "verify.instructions.step1.title"),
+					Value: resources.TL(locale, "verify.instructions.step1.content", resources.TData("apiKeyPrefix", apiKeyNamePrefix, "code", code)),
 				},
-			}
-
-			_, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
-				Flags:  discordgo.MessageFlagsEphemeral,
-				Embeds: embeds,
-				Components: []discordgo.MessageComponent{
-					discordgo.ActionsRow{
-						Components: []discordgo.MessageComponent{
-							discordgo.Button{
-								Style: discordgo.LinkButton,
-								Label: resources.TL(locale, "verify.buttons.create_api_key"),
-								URL:   "https://account.arena.net/applications/create",
-							},
-							discordgo.Button{
-								Style:    discordgo.PrimaryButton,
-								Label:    resources.TL(locale, "verify.buttons.set_api_key"),
-								CustomID: InteractionIDModalAPIKey,
-							},
-						},
-					},
+				{
+					Name:  resources.TL(locale, "verify.instructions.step2.title"),
+					Value: resources.TL(locale, "verify.instructions.step2.content"),
 				},
-			})
-			if err != nil {
-				onError(s, event, err)
-			}
+			},
+			Image: &discordgo.MessageEmbedImage{
+				URL: "https://i.imgur.com/Ukgu7KK.png",
+			},
 		},
-	})
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Style: discordgo.LinkButton,
+					Label: resources.TL(locale, "verify.buttons.create_api_key"),
+					URL:   "https://account.arena.net/applications/create",
+				},
+				discordgo.Button{
+					Style:    discordgo.PrimaryButton,
+					Label:    resources.TL(locale, "verify.buttons.set_api_key"),
+					CustomID: InteractionIDModalAPIKey,
+				},
+			},
+		},
+	}
+	return embeds, components
 }
 
 func (c *VerifyCmd) openAPIKeyModal(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
@@ -179,14 +191,7 @@ func (c *VerifyCmd) setAPIKey(s *discordgo.Session, event *discordgo.Interaction
 	case 500:
 		// Quick fix for proper apikey name error
 		code := GetAPIKeyCode(2, user.ID)
-
-		var apiKeyNamePrefix string
-		for _, guild := range s.State.Guilds {
-			if guild.ID == event.GuildID {
-				apiKeyNamePrefix = fmt.Sprintf("%s - ", guild.Name)
-				break
-			}
-		}
+		apiKeyNamePrefix := APIKeyNamePrefix(s, event.GuildID)
 
 		apiErr := errors.New(APIKeyErrorRegex.ReplaceAllString(resp.JSON500.SafeDisplayError, fmt.Sprintf("${1}\n${2}%s%s${3}", apiKeyNamePrefix, code)))
 		onError(s, event, apiErr)
@@ -214,6 +219,12 @@ func (c *VerifyCmd) setAPIKey(s *discordgo.Session, event *discordgo.Interaction
 		return
 	}
 
+	// The api key can also be set from a direct message, in which case the roles are updated
+	// once the backend announces the new api key
+	if event.Member == nil {
+		return
+	}
+
 	// Check roles
 	resp2, err := c.backend.GetPlatformUserWithResponse(ctx, backend.PlatformID, user.ID, &api.GetPlatformUserParams{})
 	if err != nil {
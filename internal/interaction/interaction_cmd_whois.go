@@ -0,0 +1,112 @@
+package interaction
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+type WhoisCmd struct {
+	backend *api.ClientWithResponses
+	ui      *UIBuilder
+}
+
+func NewWhoisCmd(backend *api.ClientWithResponses, ui *UIBuilder) *WhoisCmd {
+	return &WhoisCmd{
+		backend: backend,
+		ui:      ui,
+	}
+}
+
+func (c *WhoisCmd) Register(i *Interactions) {
+	var permission int64 = discordgo.PermissionAdministrator
+	var permissionDM bool = false
+
+	// Whois cmd
+	i.addCommand(&Command{
+		command: &discordgo.ApplicationCommand{
+			Name:                     resources.T("cmd.whois.name"),
+			Description:              resources.T("cmd.whois.description"),
+			NameLocalizations:        resources.GetLocalizations("cmd.whois.name"),
+			DescriptionLocalizations: resources.GetLocalizations("cmd.whois.description"),
+			DefaultMemberPermissions: &permission,
+			DMPermission:             &permissionDM,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:                     discordgo.ApplicationCommandOptionString,
+					Name:                     resources.T("cmd.whois.options.account.name"),
+					Description:              resources.T("cmd.whois.options.account.description"),
+					NameLocalizations:        resources.GetOptionLocalizations("cmd.whois.options.account.name"),
+					DescriptionLocalizations: resources.GetOptionLocalizations("cmd.whois.options.account.description"),
+					Required:                 true,
+				},
+			},
+		},
+		handler: c.onCommandWhois,
+	})
+}
+
+func (c *WhoisCmd) onCommandWhois(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	if event.GuildID == "" {
+		onError(s, event, errors.New(resources.TL(locale, "settings.errors.server_only")))
+		return
+	}
+
+	accountName := event.ApplicationCommandData().Options[0].StringValue()
+
+	ctx := context.Background()
+	resp, err := c.backend.GetAccountUserWithResponse(ctx, accountName)
+	if err != nil {
+		onError(s, event, err)
+		return
+	} else if resp.StatusCode() == http.StatusNotFound {
+		onError(s, event, errors.New(resources.TL(locale, "whois.errors.not_linked", resources.TData("account", accountName))))
+		return
+	} else if resp.JSON200 == nil {
+		onError(s, event, errors.New(resources.TL(locale, "errors.unexpected_response")))
+		return
+	}
+
+	linkedUser := resp.JSON200
+	embeds := make([]*discordgo.MessageEmbed, 0, 1)
+	for _, platformLink := range linkedUser.PlatformLinks {
+		if platformLink.PlatformID != backend.PlatformID {
+			continue
+		}
+
+		member, err := s.GuildMember(event.GuildID, platformLink.PlatformUserID)
+		if err != nil {
+			// Linked discord user is not a member of this server
+			zap.L().Debug("linked user not found on server", zap.String("guild id", event.GuildID), zap.String("user id", platformLink.PlatformUserID), zap.Error(err))
+			continue
+		}
+		member.GuildID = event.GuildID
+
+		embeds = append(embeds, c.ui.buildWhoisEmbed(member, linkedUser, locale))
+	}
+
+	if len(embeds) == 0 {
+		onError(s, event, errors.New(resources.TL(locale, "whois.errors.not_on_server", resources.TData("account", accountName))))
+		return
+	}
+
+	// Discord allows at most 10 embeds per message
+	if len(embeds) > 10 {
+		embeds = embeds[:10]
+	}
+
+	_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+		Flags:  discordgo.MessageFlagsEphemeral,
+		Embeds: embeds,
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
@@ -0,0 +1,165 @@
+package interaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/guild"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+	"github.com/vennekilde/gw2-alliance-bot/internal/world"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+)
+
+type WhyCmd struct {
+	backend          *api.ClientWithResponses
+	guildRoleHandler *guild.GuildRoleHandler
+	wvw              *world.WvW
+}
+
+func NewWhyCmd(backend *api.ClientWithResponses, guildRoleHandler *guild.GuildRoleHandler, wvw *world.WvW) *WhyCmd {
+	return &WhyCmd{
+		backend:          backend,
+		guildRoleHandler: guildRoleHandler,
+		wvw:              wvw,
+	}
+}
+
+func (c *WhyCmd) Register(i *Interactions) {
+	var permissionDM bool = false
+
+	// Why cmd
+	i.addCommand(&Command{
+		command: &discordgo.ApplicationCommand{
+			Name:                     resources.T("cmd.why.name"),
+			Description:              resources.T("cmd.why.description"),
+			NameLocalizations:        resources.GetLocalizations("cmd.why.name"),
+			DescriptionLocalizations: resources.GetLocalizations("cmd.why.description"),
+			DMPermission:             &permissionDM,
+		},
+		handler: c.onCommandWhy,
+	})
+
+	var whyPermission int64 = discordgo.PermissionAdministrator
+
+	// Why menu
+	i.addCommand(&Command{
+		command: &discordgo.ApplicationCommand{
+			Name:                     "Why",
+			Type:                     discordgo.UserApplicationCommand,
+			DefaultMemberPermissions: &whyPermission,
+			DMPermission:             &permissionDM,
+		},
+		handler: c.onCommandWhy,
+	})
+}
+
+func (c *WhyCmd) onCommandWhy(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	locale := GetInteractionLocale(event)
+	if event.GuildID == "" {
+		onError(s, event, errors.New(resources.TL(locale, "settings.errors.server_only")))
+		return
+	}
+
+	members := resolveMembersFromApplicationCommandData(event)
+	for memberID, member := range members {
+		member.GuildID = event.GuildID
+
+		ctx := context.Background()
+		resp, err := c.backend.GetPlatformUserWithResponse(ctx, backend.PlatformID, memberID, &api.GetPlatformUserParams{})
+		if err != nil {
+			onError(s, event, err)
+			return
+		} else if resp.JSON200 == nil && resp.StatusCode() != http.StatusNotFound {
+			onError(s, event, errors.New(resources.TL(locale, "errors.unexpected_response")))
+			return
+		}
+
+		// Members without a linked account are explained as such
+		var accounts []api.Account
+		var bans []api.Ban
+		if resp.JSON200 != nil {
+			accounts = resp.JSON200.Accounts
+			bans = resp.JSON200.Bans
+		}
+
+		guildDecisions, err := c.guildRoleHandler.PlanRoles(event.GuildID, member, member.Roles, accounts, "")
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
+		worldDecisions, err := c.wvw.PlanWvWWorldRoles(event.GuildID, member, accounts, bans)
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
+
+		_, err = s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
+			Flags:           discordgo.MessageFlagsEphemeral,
+			Embeds:          []*discordgo.MessageEmbed{buildWhyEmbed(memberID, guildDecisions, worldDecisions, locale)},
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
+	}
+}
+
+func buildWhyEmbed(memberID string, guildDecisions []reconcile.Decision, worldDecisions []reconcile.Decision, locale discordgo.Locale) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: resources.TL(locale, "why.title"),
+		Color: 0x3498DB, // blue
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: resources.TL(locale, "why.footer"),
+		},
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<@%s>\n", memberID))
+	if len(guildDecisions) == 0 && len(worldDecisions) == 0 {
+		sb.WriteString(resources.TL(locale, "why.none"))
+	}
+
+	writeSection := func(titleKey string, decisions []reconcile.Decision) {
+		if len(decisions) == 0 {
+			return
+		}
+		sb.WriteString(fmt.Sprintf("\n**%s**\n", resources.TL(locale, titleKey)))
+		for _, decision := range decisions {
+			line := buildWhyLine(decision, locale)
+			// Embed descriptions are limited to 4096 characters
+			if sb.Len()+len(line) > 4000 {
+				return
+			}
+			sb.WriteString(line)
+		}
+	}
+	writeSection("why.sections.guild", guildDecisions)
+	writeSection("why.sections.world", worldDecisions)
+
+	embed.Description = sb.String()
+	return embed
+}
+
+func buildWhyLine(decision reconcile.Decision, locale discordgo.Locale) string {
+	icon := "❌"
+	if decision.Want {
+		icon = "✅"
+	}
+
+	line := fmt.Sprintf("%s <@&%s> - %s", icon, decision.RoleID, resources.TL(locale, decision.Reason, decision.ReasonData))
+	if decision.Changed() {
+		changeKey := "why.will_remove"
+		if decision.Want {
+			changeKey = "why.will_add"
+		}
+		line += fmt.Sprintf(" *(%s)*", resources.TL(locale, changeKey))
+	}
+	return line + "\n"
+}
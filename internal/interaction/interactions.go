@@ -1,15 +1,25 @@
 package interaction
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
 	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/diagnose"
 	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
 	"github.com/vennekilde/gw2-alliance-bot/internal/guild"
+	"github.com/vennekilde/gw2-alliance-bot/internal/policy"
+	"github.com/vennekilde/gw2-alliance-bot/internal/webhook"
 	"github.com/vennekilde/gw2-alliance-bot/internal/world"
 	"github.com/vennekilde/gw2-alliance-bot/resources"
 	"go.uber.org/zap"
@@ -38,6 +48,18 @@ func GetInteractionLocale(event *discordgo.InteractionCreate) discordgo.Locale {
 type Command struct {
 	command *discordgo.ApplicationCommand
 	handler InteractionHandler
+	// autocomplete suggests values for the option the user is typing in, if set
+	autocomplete InteractionHandler
+}
+
+// admin checks if the command is limited to members with certain permissions, by default administrators
+func (c *Command) admin() bool {
+	return c.command.DefaultMemberPermissions != nil
+}
+
+// global checks if the command is usable in DMs. These commands are registered globally, so they cannot be configured per server
+func (c *Command) global() bool {
+	return c.command.DMPermission == nil || *c.command.DMPermission
 }
 
 type Interactions struct {
@@ -48,23 +70,30 @@ type Interactions struct {
 	guilds           *guild.Guilds
 	guildRoleHandler *guild.GuildRoleHandler
 	commands         map[string]*Command
-	interactions     map[string]InteractionHandler
+	router           *Router
 	ui               *UIBuilder
 
-	activeForUser func(userID string) bool
+	activeForUser   func(userID string) bool
+	reconcileMember func(guildID string, userID string)
+
+	registeredM sync.Mutex
+	// registered is a signature of the commands last registered on each server
+	registered map[string]string
 }
 
-func NewInteractions(discord *discordgo.Session, cache *discord.Cache, service *backend.Service, backend *api.ClientWithResponses, guilds *guild.Guilds, guildRoleHandler *guild.GuildRoleHandler, wvw *world.WvW, activeForUser func(userID string) bool) *Interactions {
+func NewInteractions(discord *discordgo.Session, cache *discord.Cache, service *backend.Service, backend *api.ClientWithResponses, guilds *guild.Guilds, guildRoleHandler *guild.GuildRoleHandler, wvw *world.WvW, policy *policy.Policy, auditLog *audit.Log, activeForUser func(userID string) bool, reconcileMember func(guildID string, userID string), diagnoser *diagnose.Diagnoser, webhooks *webhook.Dispatcher) *Interactions {
 	c := &Interactions{
 		discord:          discord,
 		cache:            cache,
 		commands:         make(map[string]*Command),
-		interactions:     make(map[string]InteractionHandler),
+		router:           NewRouter(),
 		backend:          backend,
 		service:          service,
 		guilds:           guilds,
 		guildRoleHandler: guildRoleHandler,
 		activeForUser:    activeForUser,
+		reconcileMember:  reconcileMember,
+		registered:       make(map[string]string),
 		ui: &UIBuilder{
 			guilds: guilds,
 		},
@@ -79,18 +108,40 @@ func NewInteractions(discord *discordgo.Session, cache *discord.Cache, service *
 	refreshHandler := NewRefreshCmd(backend, statusHandler, wvw)
 	refreshHandler.Register(c)
 
-	repHandler := NewRepCmd(backend, cache, c.guilds, c.guildRoleHandler, service, wvw)
+	repHandler := NewRepCmd(backend, cache, c.guilds, c.guildRoleHandler, service, wvw, auditLog)
 	repHandler.Register(c)
 
 	verifyHandler := NewVerifyCmd(backend, c.ui, repHandler)
 	verifyHandler.Register(c)
 
-	settingsHandler := NewSettingsCmd(service, c.guilds)
+	settingsHandler := NewSettingsCmd(service, c.guilds, webhooks)
 	settingsHandler.Register(c)
 
+	whoisHandler := NewWhoisCmd(backend, c.ui)
+	whoisHandler.Register(c)
+
+	unlinkHandler := NewUnlinkCmd(backend, cache, reconcileMember)
+	unlinkHandler.Register(c)
+
+	onboardingHandler := NewOnboardingCmd(service, verifyHandler, statusHandler, repHandler)
+	onboardingHandler.Register(c)
+
+	policyHandler := NewPolicyCmd(service, policy)
+	policyHandler.Register(c)
+
+	whyHandler := NewWhyCmd(backend, guildRoleHandler, wvw)
+	whyHandler.Register(c)
+
+	diagnoseHandler := NewDiagnoseCmd(diagnoser)
+	diagnoseHandler.Register(c)
+
 	discord.AddHandler(func(s *discordgo.Session, event *discordgo.Ready) {
 		c.register(s)
 	})
+	discord.AddHandler(func(s *discordgo.Session, event *discordgo.GuildCreate) {
+		c.registerGuild(s, event.ID)
+	})
+	service.OnChange(c.onSettingChanged)
 
 	// Command handler
 	discord.AddHandler(c.onInteraction)
@@ -117,6 +168,7 @@ func (c *Interactions) onInteraction(s *discordgo.Session, event *discordgo.Inte
 	case discordgo.InteractionMessageComponent:
 		c.onMessageComponent(s, event, user)
 	case discordgo.InteractionApplicationCommandAutocomplete:
+		c.onAutocomplete(s, event, user)
 	case discordgo.InteractionModalSubmit:
 		c.onModalSubmit(s, event, user)
 	}
@@ -169,11 +221,99 @@ func (c *Interactions) onCommand(s *discordgo.Session, event *discordgo.Interact
 	}
 
 	// Handle command
-	if command, ok := c.commands[commandKey]; ok {
-		command.handler(s, event, user)
-	} else {
+	command, ok := c.commands[commandKey]
+	if !ok {
 		onError(s, event, fmt.Errorf("unknown command name: %s", commandKey))
+		return
 	}
+	if err := c.checkAllowed(event, command); err != nil {
+		onError(s, event, err)
+		return
+	}
+	command.handler(s, event, user)
+}
+
+func (c *Interactions) onAutocomplete(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+	// Handle panics
+	defer func() {
+		r := recover()
+		if r != nil {
+			zap.L().Error("panicked while handling autocomplete",
+				zap.String("command", event.ApplicationCommandData().Name),
+				zap.Any("user", user.String()),
+				zap.Any("recover", r),
+			)
+		}
+	}()
+
+	command, ok := c.commands[fmt.Sprintf("0:%s", event.ApplicationCommandData().Name)]
+	if !ok || command.autocomplete == nil || c.checkAllowed(event, command) != nil {
+		respondChoices(s, event, nil)
+		return
+	}
+	command.autocomplete(s, event, user)
+}
+
+// checkAllowed checks if the command is enabled on the server, and if admin roles are set, if the member may use admin commands.
+// Discord only enforces the default permissions of commands, which are not set when admin roles are
+func (c *Interactions) checkAllowed(event *discordgo.InteractionCreate, command *Command) error {
+	if event.GuildID == "" || event.Member == nil {
+		return nil
+	}
+	locale := GetInteractionLocale(event)
+	if !c.commandEnabled(event.GuildID, command.command.Name) {
+		return errors.New(resources.TL(locale, "errors.command_disabled"))
+	}
+	adminRoles := c.service.GetRoles(event.GuildID, backend.SettingCommandsAdminRoles)
+	if command.admin() && len(adminRoles) > 0 && !canUseAdminCommands(event.Member, adminRoles) {
+		return errors.New(resources.TL(locale, "errors.command_not_allowed"))
+	}
+	return nil
+}
+
+// canUseAdminCommands checks if the member is an administrator or has one of the admin roles
+func canUseAdminCommands(member *discordgo.Member, adminRoles []string) bool {
+	if member.Permissions&discordgo.PermissionAdministrator != 0 {
+		return true
+	}
+	for _, roleID := range member.Roles {
+		if slices.Contains(adminRoles, roleID) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandEnabled checks if the command is enabled on the server. Commands that cannot be configured are always enabled
+func (c *Interactions) commandEnabled(guildID string, name string) bool {
+	return !c.configurable(name) || !slices.Contains(c.service.GetCommands(guildID, backend.SettingCommandsDisabled), name)
+}
+
+// configurable checks if the command can be disabled on a server. The settings command cannot be disabled,
+// as it is needed to enable commands again, and global commands are not registered per server
+func (c *Interactions) configurable(name string) bool {
+	if name == resources.T("cmd.settings.name") {
+		return false
+	}
+	for _, command := range c.commands {
+		if command.command.Name == name && !command.global() {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandNames returns the sorted names of the commands that can be disabled
+func (c *Interactions) CommandNames() []string {
+	names := make([]string, 0, len(c.commands))
+	for _, command := range c.commands {
+		name := command.command.Name
+		if c.configurable(name) && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (c *Interactions) onMessageComponent(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
@@ -205,34 +345,32 @@ func (c *Interactions) onMessageComponent(s *discordgo.Session, event *discordgo
 		zap.String("id", id),
 		zap.Any("user", user.String()),
 	)
-	// Handle handler
-	if handler, ok := c.interactions[id]; ok {
-		handler(s, event, user)
-	} else {
-		// ID might have data in the suffix, so check if it matches as a prefix
-		for interactionID, handler := range c.interactions {
-			if strings.HasPrefix(id, interactionID) {
-				handler(s, event, user)
-				return
-			}
+	handler, params, err := c.router.Route(id)
+	if err != nil {
+		if errors.Is(err, ErrStaleCustomID) {
+			err = errors.New(resources.TL(GetInteractionLocale(event), "errors.stale_component"))
 		}
-		onError(s, event, fmt.Errorf("unknown interaction id: %s", id))
+		onError(s, event, err)
+		return
 	}
+	handler(s, event, user, params)
 }
 
 func (c *Interactions) onModalSubmit(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
-	err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Flags: discordgo.MessageFlagsEphemeral,
-		},
-	})
-	if err != nil {
-		onError(s, event, err)
-		return
+	id := event.ModalSubmitData().CustomID
+	if !c.router.Responding(id) {
+		err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags: discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			onError(s, event, err)
+			return
+		}
 	}
 
-	id := event.ModalSubmitData().CustomID
 	// Handle panics
 	defer func() {
 		r := recover()
@@ -258,9 +396,10 @@ func (c *Interactions) onModalSubmit(s *discordgo.Session, event *discordgo.Inte
 		zap.Any("user", user.String()),
 	)
 	// Handle handler
-	if handler, ok := c.interactions[id]; ok {
-		handler(s, event, user)
+	if handler, params, err := c.router.Route(id); err == nil {
+		handler(s, event, user, params)
 	} else {
+		zap.L().Warn("unable to route modal submit", zap.String("id", id), zap.Error(err))
 		locale := GetInteractionLocale(event)
 		_, err := s.FollowupMessageCreate(event.Interaction, false, &discordgo.WebhookParams{
 			Content: resources.TL(locale, "errors.command_execution"),
@@ -272,31 +411,117 @@ func (c *Interactions) onModalSubmit(s *discordgo.Session, event *discordgo.Inte
 	}
 }
 
+// commandOption returns an option of a command, named and described by the translations below the key
+func commandOption(optionType discordgo.ApplicationCommandOptionType, key string) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:                     optionType,
+		Name:                     resources.T(key + ".name"),
+		Description:              resources.T(key + ".description"),
+		NameLocalizations:        resources.GetOptionLocalizations(key + ".name"),
+		DescriptionLocalizations: resources.GetOptionLocalizations(key + ".description"),
+	}
+}
+
 func (c *Interactions) addCommand(command *Command) {
 	c.commands[fmt.Sprintf("%d:%s", command.command.Type, command.command.Name)] = command
 }
 
+// register registers the commands usable in DMs globally. The other commands are registered per server,
+// so they can be configured per server
 func (c *Interactions) register(s *discordgo.Session) {
-	zap.L().Info("registering command handlers")
+	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", globalCommands(c.commands))
+	if err != nil {
+		log.Panicf("Cannot register global commands: %v", err)
+	}
+}
 
-	appCommands := make([]*discordgo.ApplicationCommand, 0, len(c.commands))
-	for _, command := range c.commands {
-		appCommands = append(appCommands, command.command)
+// onSettingChanged registers the commands of the server again, when which commands are enabled, or who may use them, changed
+func (c *Interactions) onSettingChanged(ctx context.Context, subject string, name string, oldValue string, newValue string) {
+	if name == backend.SettingCommandsDisabled || name == backend.SettingCommandsAdminRoles {
+		go c.registerGuild(c.discord, subject)
+	}
+}
+
+// RegisterCommands registers the commands of every server the bot is on, if they changed since they were last registered.
+// Settings can be changed outside the bot, so this is called whenever they are synchronized
+func (c *Interactions) RegisterCommands() {
+	if c.discord.State.User == nil {
+		return
 	}
+	for _, guild := range discord.Guilds(c.discord) {
+		c.registerGuild(c.discord, guild.ID)
+	}
+}
 
-	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", appCommands)
+// registerGuild registers the commands enabled on the server, unless they are already registered
+func (c *Interactions) registerGuild(s *discordgo.Session, guildID string) {
+	var disabled []string
+	for _, name := range c.service.GetCommands(guildID, backend.SettingCommandsDisabled) {
+		if !c.commandEnabled(guildID, name) {
+			disabled = append(disabled, name)
+		}
+	}
+	adminRoles := len(c.service.GetRoles(guildID, backend.SettingCommandsAdminRoles)) > 0
+	signature := strings.Join(disabled, ",") + "|" + strconv.FormatBool(adminRoles)
+
+	c.registeredM.Lock()
+	if c.registered[guildID] == signature {
+		c.registeredM.Unlock()
+		return
+	}
+	c.registeredM.Unlock()
+
+	commands := guildCommands(c.commands, disabled, adminRoles)
+	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, guildID, commands)
 	if err != nil {
-		log.Panicf("Cannot create commands: %v", err)
+		zap.L().Error("unable to register commands", zap.String("guildID", guildID), zap.Error(err))
+		return
 	}
-	zap.L().Info("registered command handlers")
 
-	//c.discord.ApplicationCommandDelete(s.State.User.ID, "", "1028039574452178985")
+	c.registeredM.Lock()
+	c.registered[guildID] = signature
+	c.registeredM.Unlock()
+	zap.L().Info("registered commands", zap.String("guildID", guildID), zap.Int("commands", len(commands)), zap.Strings("disabled", disabled))
+}
 
-	// Print registered commands
-	registersCommands, _ := c.discord.ApplicationCommands(s.State.User.ID, "")
-	for _, cmd := range registersCommands {
-		zap.L().Info("currently registered command", zap.String("id", cmd.ID), zap.String("name", cmd.Name), zap.Uint8("type", uint8(cmd.Type)))
+// globalCommands returns the sorted commands to register globally
+func globalCommands(commands map[string]*Command) []*discordgo.ApplicationCommand {
+	appCommands := make([]*discordgo.ApplicationCommand, 0, len(commands))
+	for _, key := range sortedKeys(commands) {
+		if commands[key].global() {
+			appCommands = append(appCommands, commands[key].command)
+		}
 	}
+	return appCommands
+}
+
+// guildCommands returns the commands to register on a server, sorted and without the global and the disabled commands.
+// If admin roles are set, admin commands are shown to everyone, and checkAllowed checks the roles instead
+func guildCommands(commands map[string]*Command, disabled []string, adminRoles bool) []*discordgo.ApplicationCommand {
+	appCommands := make([]*discordgo.ApplicationCommand, 0, len(commands))
+	for _, key := range sortedKeys(commands) {
+		command := commands[key]
+		if command.global() || slices.Contains(disabled, command.command.Name) {
+			continue
+		}
+		appCommand := command.command
+		if adminRoles && command.admin() {
+			copied := *command.command
+			copied.DefaultMemberPermissions = nil
+			appCommand = &copied
+		}
+		appCommands = append(appCommands, appCommand)
+	}
+	return appCommands
+}
+
+func sortedKeys(commands map[string]*Command) []string {
+	keys := make([]string, 0, len(commands))
+	for key := range commands {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func determineUser(event *discordgo.InteractionCreate) *discordgo.User {
@@ -345,7 +570,11 @@ func onError(s *discordgo.Session, event *discordgo.InteractionCreate, err error
 
 func resolveMembersFromApplicationCommandData(event *discordgo.InteractionCreate) map[string]*discordgo.Member {
 	var members map[string]*discordgo.Member
-	appComData := event.ApplicationCommandData()
+	var appComData discordgo.ApplicationCommandInteractionData
+	// Message components, such as the onboarding buttons, carry no command data
+	if event.Type == discordgo.InteractionApplicationCommand {
+		appComData = event.ApplicationCommandData()
+	}
 	if appComData.Resolved != nil {
 		members = appComData.Resolved.Members
 		for id, user := range appComData.Resolved.Users {
@@ -0,0 +1,52 @@
+package interaction
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestGuildCommands(t *testing.T) {
+	g := NewGomegaWithT(t)
+	var admin int64 = discordgo.PermissionAdministrator
+	dm := false
+	commands := map[string]*Command{
+		"1:verify":   {command: &discordgo.ApplicationCommand{Name: "verify", Type: discordgo.ChatApplicationCommand}},
+		"1:settings": {command: &discordgo.ApplicationCommand{Name: "settings", Type: discordgo.ChatApplicationCommand, DefaultMemberPermissions: &admin, DMPermission: &dm}},
+		"2:status":   {command: &discordgo.ApplicationCommand{Name: "status", Type: discordgo.UserApplicationCommand, DefaultMemberPermissions: &admin, DMPermission: &dm}},
+		"1:status":   {command: &discordgo.ApplicationCommand{Name: "status", Type: discordgo.ChatApplicationCommand, DMPermission: &dm}},
+	}
+
+	// Commands usable in DMs are registered globally instead
+	registered := guildCommands(commands, nil, false)
+	g.Expect(registered).To(HaveLen(3))
+	g.Expect(registered[0].Name).To(Equal("settings"))
+	g.Expect(registered[0].DefaultMemberPermissions).To(Equal(&admin))
+	global := globalCommands(commands)
+	g.Expect(global).To(HaveLen(1))
+	g.Expect(global[0].Name).To(Equal("verify"))
+
+	// Disabling a command disables both the slash command and the context menu
+	registered = guildCommands(commands, []string{"status"}, true)
+	g.Expect(registered).To(HaveLen(1))
+	g.Expect(registered[0].Name).To(Equal("settings"))
+	g.Expect(registered[0].DefaultMemberPermissions).To(BeNil())
+
+	// The registered commands are copied, not changed
+	g.Expect(commands["1:settings"].command.DefaultMemberPermissions).To(Equal(&admin))
+}
+
+func TestCanUseAdminCommands(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(canUseAdminCommands(&discordgo.Member{Permissions: discordgo.PermissionAdministrator}, []string{"1"})).To(BeTrue())
+	g.Expect(canUseAdminCommands(&discordgo.Member{Roles: []string{"2", "1"}}, []string{"1"})).To(BeTrue())
+	g.Expect(canUseAdminCommands(&discordgo.Member{Roles: []string{"2"}}, []string{"1"})).To(BeFalse())
+}
+
+func TestParseWebhookURLs(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(parseWebhookURLs("https://a.example/hook, https://b.example/hook")).To(Equal("https://a.example/hook,https://b.example/hook"))
+	g.Expect(parseWebhookURLs("https://a.example/hook https://b.example/hook,")).To(Equal("https://a.example/hook,https://b.example/hook"))
+	g.Expect(parseWebhookURLs(" None ")).To(BeEmpty())
+}
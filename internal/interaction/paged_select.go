@@ -0,0 +1,349 @@
+package interaction
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+)
+
+// pagedSelectPageSize is the most options discord accepts in a select menu
+const pagedSelectPageSize = 25
+
+// pagedSelectQueryLimit is the longest search query carried in the custom ids of a paged select menu
+const pagedSelectQueryLimit = 40
+
+// pagedSelectQueryInput is the custom id of the text input of the search modal
+const pagedSelectQueryInput = "query"
+
+// OptionsFunc loads the options of a paged select menu, in the order they are listed
+type OptionsFunc func(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) ([]discordgo.SelectMenuOption, error)
+
+// SelectFunc handles the options picked on a page of a paged select menu
+type SelectFunc func(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, selection PagedSelection)
+
+// PagedSelection is what was picked on a page of a paged select menu
+type PagedSelection struct {
+	// Values are the values of the options picked
+	Values []string
+	// PageValues are the values of every option shown on the page, picked or not
+	PageValues []string
+	Page       int
+	Query      string
+}
+
+// Merge returns the values picked across all pages. Values of current shown on the page are replaced by the values picked on it
+func (p PagedSelection) Merge(current []string) []string {
+	merged := make([]string, 0, len(current)+len(p.Values))
+	for _, value := range current {
+		if !slices.Contains(p.PageValues, value) {
+			merged = append(merged, value)
+		}
+	}
+	return append(merged, p.Values...)
+}
+
+// PagedSelect is a string select menu for more options than discord shows at once.
+// Options are split into pages with buttons to go to the previous and next page, and may be searched using a modal.
+// The page and search query are carried in the custom ids of the components, so no state is kept
+type PagedSelect struct {
+	placeholder string
+	searchable  bool
+	multiple    bool
+	options     OptionsFunc
+	onSelect    SelectFunc
+
+	selectRoute *Route
+	pageRoute   *Route
+	searchRoute *Route
+	queryRoute  *Route
+}
+
+// NewPagedSelect declares a paged select menu. placeholder is the key of its localized placeholder.
+// If multiple is set, any number of options may be picked on each page
+func NewPagedSelect(id string, placeholder string, searchable bool, multiple bool, options OptionsFunc, onSelect SelectFunc) *PagedSelect {
+	return &PagedSelect{
+		placeholder: placeholder,
+		searchable:  searchable,
+		multiple:    multiple,
+		options:     options,
+		onSelect:    onSelect,
+		selectRoute: NewRoute(id, IntParam("page"), StringParam("query", pagedSelectQueryLimit)),
+		pageRoute:   NewRoute(id+"-page", IntParam("page"), StringParam("query", pagedSelectQueryLimit)),
+		searchRoute: NewRoute(id+"-search", StringParam("query", pagedSelectQueryLimit)),
+		queryRoute:  NewRoute(id + "-query").Responding(),
+	}
+}
+
+func (p *PagedSelect) Register(i *Interactions) {
+	i.router.Handle(p.selectRoute, p.interactSelect)
+	i.router.Handle(p.pageRoute, p.interactPage)
+	i.router.Handle(p.searchRoute, p.interactSearch)
+	i.router.Handle(p.queryRoute, p.interactQuery)
+}
+
+// Components returns the rows showing the page of the options matching query, labelled in the locale.
+// The buttons to change page or search are only added when needed
+func (p *PagedSelect) Components(options []discordgo.SelectMenuOption, page int, query string, locale discordgo.Locale) ([]discordgo.MessageComponent, error) {
+	query = truncateQuery(query)
+	options = filterOptions(options, query)
+	pages := max(1, (len(options)+pagedSelectPageSize-1)/pagedSelectPageSize)
+	page = min(max(page, 0), pages-1)
+
+	selectID, err := p.selectRoute.CustomID(page, query)
+	if err != nil {
+		return nil, err
+	}
+	placeholder := resources.TL(locale, p.placeholder)
+	if pages > 1 {
+		placeholder = resources.TL(locale, "paged_select.placeholder", resources.TData("placeholder", placeholder, "page", page+1, "pages", pages))
+	}
+	menu := discordgo.SelectMenu{
+		MenuType:    discordgo.StringSelectMenu,
+		CustomID:    selectID,
+		Placeholder: placeholder,
+		Options:     pageOptions(options, page),
+	}
+	if len(menu.Options) == 0 {
+		// Discord rejects select menus without options
+		menu.Disabled = true
+		menu.Options = []discordgo.SelectMenuOption{
+			{Label: resources.TL(locale, "paged_select.no_results"), Value: "-"},
+		}
+	} else if p.multiple {
+		zero := 0
+		menu.MinValues = &zero
+		menu.MaxValues = len(menu.Options)
+	}
+	rows := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{menu},
+		},
+	}
+	if pages == 1 && !p.searchable {
+		return rows, nil
+	}
+
+	previousID, err := p.pageRoute.CustomID(page-1, query)
+	if err != nil {
+		return nil, err
+	}
+	nextID, err := p.pageRoute.CustomID(page+1, query)
+	if err != nil {
+		return nil, err
+	}
+	buttons := []discordgo.MessageComponent{
+		discordgo.Button{
+			Label:    resources.TL(locale, "paged_select.previous"),
+			Style:    discordgo.SecondaryButton,
+			CustomID: previousID,
+			Disabled: page == 0,
+		},
+		discordgo.Button{
+			Label:    resources.TL(locale, "paged_select.next"),
+			Style:    discordgo.SecondaryButton,
+			CustomID: nextID,
+			Disabled: page == pages-1,
+		},
+	}
+	if p.searchable {
+		searchID, err := p.searchRoute.CustomID(query)
+		if err != nil {
+			return nil, err
+		}
+		buttons = append(buttons, discordgo.Button{
+			Label:    resources.TL(locale, "paged_select.search"),
+			Style:    discordgo.PrimaryButton,
+			CustomID: searchID,
+		})
+	}
+	return append(rows, discordgo.ActionsRow{Components: buttons}), nil
+}
+
+// Update responds to the interaction by showing the page of the options matching query in the message of the interaction.
+// Other components of the message are kept
+func (p *PagedSelect) Update(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, page int, query string, content string) error {
+	options, err := p.options(s, event, user)
+	if err != nil {
+		return err
+	}
+	rows, err := p.Components(options, page, query, GetInteractionLocale(event))
+	if err != nil {
+		return err
+	}
+	return s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Flags:      discordgo.MessageFlagsEphemeral,
+			Components: p.replaceRows(event.Message.Components, rows),
+		},
+	})
+}
+
+// replaceRows replaces the rows of the paged select menu in components, keeping their position
+func (p *PagedSelect) replaceRows(components []discordgo.MessageComponent, rows []discordgo.MessageComponent) []discordgo.MessageComponent {
+	replaced := make([]discordgo.MessageComponent, 0, len(components)+len(rows))
+	inserted := false
+	for _, component := range components {
+		if !p.ownsRow(component) {
+			replaced = append(replaced, component)
+			continue
+		}
+		if !inserted {
+			replaced = append(replaced, rows...)
+			inserted = true
+		}
+	}
+	if !inserted {
+		replaced = append(replaced, rows...)
+	}
+	return replaced
+}
+
+// ownsRow checks if the row contains a component of the paged select menu
+func (p *PagedSelect) ownsRow(component discordgo.MessageComponent) bool {
+	var components []discordgo.MessageComponent
+	switch row := component.(type) {
+	case *discordgo.ActionsRow:
+		components = row.Components
+	case discordgo.ActionsRow:
+		components = row.Components
+	}
+	for _, component := range components {
+		var customID string
+		switch c := component.(type) {
+		case *discordgo.Button:
+			customID = c.CustomID
+		case discordgo.Button:
+			customID = c.CustomID
+		case *discordgo.SelectMenu:
+			customID = c.CustomID
+		case discordgo.SelectMenu:
+			customID = c.CustomID
+		}
+		id, _, _ := strings.Cut(customID, customIDSeparator)
+		if id == p.selectRoute.ID() || id == p.pageRoute.ID() || id == p.searchRoute.ID() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PagedSelect) interactSelect(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, params Params) {
+	options, err := p.options(s, event, user)
+	if err != nil {
+		onError(s, event, err)
+		return
+	}
+
+	page, query := params.Int("page"), params.String("query")
+	shown := pageOptions(filterOptions(options, query), page)
+	pageValues := make([]string, len(shown))
+	for i, option := range shown {
+		pageValues[i] = option.Value
+	}
+	p.onSelect(s, event, user, PagedSelection{
+		Values:     event.MessageComponentData().Values,
+		PageValues: pageValues,
+		Page:       page,
+		Query:      query,
+	})
+}
+
+func (p *PagedSelect) interactPage(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, params Params) {
+	err := p.Update(s, event, user, params.Int("page"), params.String("query"), event.Message.Content)
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// interactSearch opens the search modal, filled with the current search query
+func (p *PagedSelect) interactSearch(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, params Params) {
+	locale := GetInteractionLocale(event)
+	err := s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: p.queryRoute.ID(),
+			Title:    resources.TL(locale, "paged_select.search_modal.title"),
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    pagedSelectQueryInput,
+							Label:       resources.TL(locale, "paged_select.search_modal.label"),
+							Style:       discordgo.TextInputShort,
+							Value:       params.String("query"),
+							MaxLength:   pagedSelectQueryLimit,
+							Required:    false,
+							Placeholder: resources.TL(locale, "paged_select.search_modal.placeholder"),
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// interactQuery shows the first page of the options matching the submitted search query
+func (p *PagedSelect) interactQuery(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, params Params) {
+	var query string
+	for _, row := range event.ModalSubmitData().Components {
+		actionsRow, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, component := range actionsRow.Components {
+			if input, ok := component.(*discordgo.TextInput); ok && input.CustomID == pagedSelectQueryInput {
+				query = strings.TrimSpace(input.Value)
+			}
+		}
+	}
+	if event.Message == nil {
+		onError(s, event, ErrMalformedCustomID)
+		return
+	}
+
+	err := p.Update(s, event, user, 0, query, event.Message.Content)
+	if err != nil {
+		onError(s, event, err)
+	}
+}
+
+// truncateQuery shortens the search query until it fits in a custom id once escaped, without splitting characters
+func truncateQuery(query string) string {
+	for len(customIDEscaper.Replace(query)) > pagedSelectQueryLimit {
+		_, size := utf8.DecodeLastRuneInString(query)
+		query = query[:len(query)-size]
+	}
+	return query
+}
+
+// filterOptions returns the options with a label or description containing query, ignoring case
+func filterOptions(options []discordgo.SelectMenuOption, query string) []discordgo.SelectMenuOption {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return options
+	}
+	filtered := make([]discordgo.SelectMenuOption, 0, len(options))
+	for _, option := range options {
+		if strings.Contains(strings.ToLower(option.Label), query) || strings.Contains(strings.ToLower(option.Description), query) {
+			filtered = append(filtered, option)
+		}
+	}
+	return filtered
+}
+
+// pageOptions returns the options shown on the page
+func pageOptions(options []discordgo.SelectMenuOption, page int) []discordgo.SelectMenuOption {
+	start := page * pagedSelectPageSize
+	if start < 0 || start >= len(options) {
+		return nil
+	}
+	return options[start:min(start+pagedSelectPageSize, len(options))]
+}
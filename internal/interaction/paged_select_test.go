@@ -0,0 +1,121 @@
+package interaction
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+)
+
+func testOptions(count int) []discordgo.SelectMenuOption {
+	options := make([]discordgo.SelectMenuOption, count)
+	for i := range options {
+		options[i] = discordgo.SelectMenuOption{Label: fmt.Sprintf("Option %d", i), Value: fmt.Sprint(i)}
+	}
+	return options
+}
+
+func rowComponents(row discordgo.MessageComponent) []discordgo.MessageComponent {
+	return row.(discordgo.ActionsRow).Components
+}
+
+func TestPagedSelectComponents(t *testing.T) {
+	g := NewGomegaWithT(t)
+	paged := NewPagedSelect("test", "test.placeholder", false, true, nil, nil)
+
+	// A single page without search needs no buttons
+	rows, err := paged.Components(testOptions(25), 0, "", discordgo.EnglishUS)
+	g.Expect(err).To(BeNil())
+	g.Expect(rows).To(HaveLen(1))
+	menu := rowComponents(rows[0])[0].(discordgo.SelectMenu)
+	g.Expect(menu.Options).To(HaveLen(25))
+	g.Expect(menu.MaxValues).To(Equal(25))
+
+	rows, err = paged.Components(testOptions(60), 2, "", discordgo.EnglishUS)
+	g.Expect(err).To(BeNil())
+	g.Expect(rows).To(HaveLen(2))
+	menu = rowComponents(rows[0])[0].(discordgo.SelectMenu)
+	g.Expect(menu.CustomID).To(Equal("test:2:"))
+	g.Expect(menu.Options).To(HaveLen(10))
+	g.Expect(menu.Options[0].Value).To(Equal("50"))
+	buttons := rowComponents(rows[1])
+	g.Expect(buttons).To(HaveLen(2))
+	g.Expect(buttons[0].(discordgo.Button).CustomID).To(Equal("test-page:1:"))
+	g.Expect(buttons[0].(discordgo.Button).Disabled).To(BeFalse())
+	g.Expect(buttons[1].(discordgo.Button).Disabled).To(BeTrue())
+
+	// Pages past the last page show the last page
+	rows, err = paged.Components(testOptions(60), 5, "", discordgo.EnglishUS)
+	g.Expect(err).To(BeNil())
+	g.Expect(rowComponents(rows[0])[0].(discordgo.SelectMenu).CustomID).To(Equal("test:2:"))
+}
+
+func TestPagedSelectSearch(t *testing.T) {
+	g := NewGomegaWithT(t)
+	paged := NewPagedSelect("test", "test.placeholder", true, false, nil, nil)
+
+	rows, err := paged.Components(testOptions(60), 0, "option 1", discordgo.EnglishUS)
+	g.Expect(err).To(BeNil())
+	menu := rowComponents(rows[0])[0].(discordgo.SelectMenu)
+	g.Expect(menu.CustomID).To(Equal("test:0:option 1"))
+	// Option 1 and Option 10 to Option 19
+	g.Expect(menu.Options).To(HaveLen(11))
+	buttons := rowComponents(rows[1])
+	g.Expect(buttons).To(HaveLen(3))
+	g.Expect(buttons[2].(discordgo.Button).CustomID).To(Equal("test-search:option 1"))
+
+	// Searches matching nothing show a disabled select menu
+	rows, err = paged.Components(testOptions(60), 0, "nothing", discordgo.EnglishUS)
+	g.Expect(err).To(BeNil())
+	menu = rowComponents(rows[0])[0].(discordgo.SelectMenu)
+	g.Expect(menu.Disabled).To(BeTrue())
+	g.Expect(menu.Options).To(HaveLen(1))
+
+	// Queries are truncated to fit in the custom ids once escaped
+	rows, err = paged.Components(testOptions(60), 0, strings.Repeat(":", pagedSelectQueryLimit), discordgo.EnglishUS)
+	g.Expect(err).To(BeNil())
+	menu = rowComponents(rows[0])[0].(discordgo.SelectMenu)
+	g.Expect(menu.CustomID).To(Equal("test:0:" + strings.Repeat("%3A", pagedSelectQueryLimit/3)))
+}
+
+func TestPagedSelectLocale(t *testing.T) {
+	g := NewGomegaWithT(t)
+	paged := NewPagedSelect("test", "test.placeholder", true, false, nil, nil)
+
+	rows, err := paged.Components(testOptions(60), 0, "", discordgo.German)
+	g.Expect(err).To(BeNil())
+	buttons := rowComponents(rows[1])
+	g.Expect(buttons[0].(discordgo.Button).Label).To(Equal(resources.TL(discordgo.German, "paged_select.previous")))
+	g.Expect(buttons[0].(discordgo.Button).Label).ToNot(Equal(resources.T("paged_select.previous")))
+}
+
+func TestPagedSelectionMerge(t *testing.T) {
+	g := NewGomegaWithT(t)
+	selection := PagedSelection{
+		Values:     []string{"3"},
+		PageValues: []string{"2", "3", "4"},
+	}
+	g.Expect(selection.Merge([]string{"1", "2", "5"})).To(Equal([]string{"1", "5", "3"}))
+}
+
+func TestPagedSelectReplaceRows(t *testing.T) {
+	g := NewGomegaWithT(t)
+	paged := NewPagedSelect("test", "test.placeholder", true, false, nil, nil)
+	other := &discordgo.ActionsRow{Components: []discordgo.MessageComponent{&discordgo.Button{CustomID: "test-other"}}}
+	components := []discordgo.MessageComponent{
+		other,
+		&discordgo.ActionsRow{Components: []discordgo.MessageComponent{&discordgo.SelectMenu{CustomID: "test:1:"}}},
+		&discordgo.ActionsRow{Components: []discordgo.MessageComponent{&discordgo.Button{CustomID: "test-page:0:"}}},
+	}
+
+	rows, err := paged.Components(testOptions(5), 0, "", discordgo.EnglishUS)
+	g.Expect(err).To(BeNil())
+	replaced := paged.replaceRows(components, rows)
+	g.Expect(replaced).To(HaveLen(3))
+	g.Expect(replaced[0]).To(Equal(other))
+	g.Expect(replaced[1]).To(Equal(rows[0]))
+	g.Expect(replaced[2]).To(Equal(rows[1]))
+}
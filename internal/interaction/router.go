@@ -0,0 +1,290 @@
+package interaction
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+)
+
+// customIDLimit is the longest custom id discord accepts for message components and modals
+const customIDLimit = 100
+
+// customIDSeparator separates the id of a route from its parameters in a custom id, e.g. "rep-acc:Account.1234"
+const customIDSeparator = ":"
+
+// signatureLength is the length of the signature of signed custom ids, once encoded
+const signatureLength = 11
+
+var (
+	ErrUnknownCustomID   = errors.New("unknown custom id")
+	ErrMalformedCustomID = errors.New("malformed custom id")
+	ErrStaleCustomID     = errors.New("stale custom id")
+)
+
+// customIDSecret signs custom ids. It changes every time the bot starts, so signed custom ids from before a restart are detected as stale
+var customIDSecret = func() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Errorf("unable to generate custom id secret: %w", err))
+	}
+	return secret
+}()
+
+// customIDEscaper escapes the separator in parameters, so parameters may contain it
+var (
+	customIDEscaper   = strings.NewReplacer("%", "%25", customIDSeparator, "%3A")
+	customIDUnescaper = strings.NewReplacer("%25", "%", "%3A", customIDSeparator)
+)
+
+// ParamType is the kind of value a parameter of a custom id holds
+type ParamType int
+
+const (
+	// ParamTypeString is any text, no longer than the MaxLength of the parameter
+	ParamTypeString ParamType = iota
+	// ParamTypeInt is a whole number
+	ParamTypeInt
+	// ParamTypeSnowflake is the id of a discord entity, such as a role
+	ParamTypeSnowflake
+)
+
+// Param is a parameter carried in the custom id of a route
+type Param struct {
+	Name      string
+	Type      ParamType
+	MaxLength int
+}
+
+// StringParam declares a text parameter, no longer than maxLength
+func StringParam(name string, maxLength int) Param {
+	return Param{Name: name, Type: ParamTypeString, MaxLength: maxLength}
+}
+
+// IntParam declares a whole number parameter
+func IntParam(name string) Param {
+	return Param{Name: name, Type: ParamTypeInt, MaxLength: 20}
+}
+
+// SnowflakeParam declares a discord id parameter
+func SnowflakeParam(name string) Param {
+	return Param{Name: name, Type: ParamTypeSnowflake, MaxLength: 20}
+}
+
+// validate checks if the value is accepted by the parameter
+func (p Param) validate(value string) error {
+	switch {
+	case len(value) > p.MaxLength:
+		return fmt.Errorf("%w: %s is longer than %d characters", ErrMalformedCustomID, p.Name, p.MaxLength)
+	case p.Type == ParamTypeInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%w: %s is not a number", ErrMalformedCustomID, p.Name)
+		}
+	case p.Type == ParamTypeSnowflake:
+		if !discord.IsSnowflake(value) {
+			return fmt.Errorf("%w: %s is not an id", ErrMalformedCustomID, p.Name)
+		}
+	}
+	return nil
+}
+
+// Params are the decoded parameters of a custom id, by name
+type Params map[string]string
+
+// String returns the value of the parameter
+func (p Params) String(name string) string {
+	return p[name]
+}
+
+// Int returns the value of a whole number parameter
+func (p Params) Int(name string) int {
+	value, _ := strconv.Atoi(p[name])
+	return value
+}
+
+// Route is the id of message components or modals handled the same way, and the parameters their custom ids carry
+type Route struct {
+	id     string
+	params []Param
+	signed bool
+	// responding is set if the handler of a modal submit responds itself, instead of the response being deferred
+	responding bool
+}
+
+// NewRoute declares a route. It panics if the id contains the separator, or the parameters may not fit in a custom id
+func NewRoute(id string, params ...Param) *Route {
+	return newRoute(id, false, params)
+}
+
+// NewSignedRoute declares a route whose custom ids are signed, rejecting custom ids created before the bot was restarted.
+// Use it for components referring to state only kept in memory
+func NewSignedRoute(id string, params ...Param) *Route {
+	return newRoute(id, true, params)
+}
+
+func newRoute(id string, signed bool, params []Param) *Route {
+	if id == "" || strings.Contains(id, customIDSeparator) {
+		panic(fmt.Sprintf("invalid route id %q", id))
+	}
+	length := len(id)
+	for _, param := range params {
+		length += len(customIDSeparator) + param.MaxLength
+	}
+	if signed {
+		length += len(customIDSeparator) + signatureLength
+	}
+	if length > customIDLimit {
+		panic(fmt.Sprintf("custom ids of route %q may be %d characters long, more than discord accepts", id, length))
+	}
+	return &Route{id: id, params: params, signed: signed}
+}
+
+// Responding marks the route as responding to modal submits itself, so the response is not deferred before it is handled.
+// Modals opened from a message component may then update the message
+func (r *Route) Responding() *Route {
+	r.responding = true
+	return r
+}
+
+// ID returns the id of the route
+func (r *Route) ID() string {
+	return r.id
+}
+
+// CustomID returns a custom id of the route, carrying the values of its parameters in order.
+// Values may be strings or ints, matching the type of their parameter
+func (r *Route) CustomID(values ...any) (string, error) {
+	if len(values) != len(r.params) {
+		return "", fmt.Errorf("route %s takes %d parameters, got %d", r.id, len(r.params), len(values))
+	}
+
+	parts := make([]string, 0, len(values)+2)
+	parts = append(parts, r.id)
+	for i, param := range r.params {
+		var value string
+		switch v := values[i].(type) {
+		case string:
+			value = v
+		case int:
+			value = strconv.Itoa(v)
+		default:
+			return "", fmt.Errorf("parameter %s of route %s cannot be %T", param.Name, r.id, v)
+		}
+		if err := param.validate(value); err != nil {
+			return "", err
+		}
+		// Escaping may lengthen the value, which has to fit in the length reserved for the parameter
+		escaped := customIDEscaper.Replace(value)
+		if len(escaped) > param.MaxLength {
+			return "", fmt.Errorf("%w: %s is longer than %d characters once escaped", ErrMalformedCustomID, param.Name, param.MaxLength)
+		}
+		parts = append(parts, escaped)
+	}
+	if r.signed {
+		parts = append(parts, sign(strings.Join(parts, customIDSeparator)))
+	}
+
+	customID := strings.Join(parts, customIDSeparator)
+	if len(customID) > customIDLimit {
+		return "", fmt.Errorf("custom id of route %s is longer than %d characters", r.id, customIDLimit)
+	}
+	return customID, nil
+}
+
+// decode returns the parameters of a custom id of the route
+func (r *Route) decode(customID string) (Params, error) {
+	parts := strings.Split(customID, customIDSeparator)
+	expected := 1 + len(r.params)
+	if r.signed {
+		expected++
+	}
+	if len(parts) != expected {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedCustomID, customID)
+	}
+	if r.signed {
+		signature := parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+		if !hmac.Equal([]byte(signature), []byte(sign(strings.Join(parts, customIDSeparator)))) {
+			return nil, fmt.Errorf("%w: %s", ErrStaleCustomID, customID)
+		}
+	}
+
+	params := make(Params, len(r.params))
+	for i, param := range r.params {
+		value := customIDUnescaper.Replace(parts[i+1])
+		if err := param.validate(value); err != nil {
+			return nil, err
+		}
+		params[param.Name] = value
+	}
+	return params, nil
+}
+
+// sign returns a signature of the value, using customIDSecret
+func sign(value string) string {
+	mac := hmac.New(sha256.New, customIDSecret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:signatureLength]
+}
+
+// RouteHandler handles a message component or modal, with the parameters of its custom id
+type RouteHandler func(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, params Params)
+
+type routeEntry struct {
+	route   *Route
+	handler RouteHandler
+}
+
+// Router finds the handler of message components and modals by their custom id
+type Router struct {
+	routes map[string]routeEntry
+}
+
+func NewRouter() *Router {
+	return &Router{
+		routes: make(map[string]routeEntry),
+	}
+}
+
+// Handle registers the handler of the route. It panics if the id of the route is already handled
+func (r *Router) Handle(route *Route, handler RouteHandler) {
+	if _, ok := r.routes[route.id]; ok {
+		panic(fmt.Sprintf("route %q is already handled", route.id))
+	}
+	r.routes[route.id] = routeEntry{route: route, handler: handler}
+}
+
+// HandleFunc registers the handler of components with the id, carrying no parameters
+func (r *Router) HandleFunc(id string, handler InteractionHandler) {
+	r.Handle(NewRoute(id), func(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, params Params) {
+		handler(s, event, user)
+	})
+}
+
+// Route returns the handler of the custom id, and the parameters it carries
+func (r *Router) Route(customID string) (RouteHandler, Params, error) {
+	id, _, _ := strings.Cut(customID, customIDSeparator)
+	entry, ok := r.routes[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownCustomID, customID)
+	}
+	params, err := entry.route.decode(customID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry.handler, params, nil
+}
+
+// Responding checks if the handler of the custom id responds to modal submits itself
+func (r *Router) Responding(customID string) bool {
+	id, _, _ := strings.Cut(customID, customIDSeparator)
+	entry, ok := r.routes[id]
+	return ok && entry.route.responding
+}
@@ -0,0 +1,85 @@
+package interaction
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRouteCustomID(t *testing.T) {
+	g := NewGomegaWithT(t)
+	route := NewRoute("test", StringParam("name", 20), SnowflakeParam("role"), IntParam("page"))
+
+	customID, err := route.CustomID("Name.1234:%", "123456789", 2)
+	g.Expect(err).To(BeNil())
+	g.Expect(customID).To(Equal("test:Name.1234%3A%25:123456789:2"))
+
+	params, err := route.decode(customID)
+	g.Expect(err).To(BeNil())
+	g.Expect(params.String("name")).To(Equal("Name.1234:%"))
+	g.Expect(params.String("role")).To(Equal("123456789"))
+	g.Expect(params.Int("page")).To(Equal(2))
+
+	// Values are validated by their parameter
+	_, err = route.CustomID(strings.Repeat("a", 21), "123456789", 2)
+	g.Expect(err).To(MatchError(ErrMalformedCustomID))
+	_, err = route.CustomID("name", "role", 2)
+	g.Expect(err).To(MatchError(ErrMalformedCustomID))
+	_, err = route.CustomID("name", "123456789")
+	g.Expect(err).ToNot(BeNil())
+
+	_, err = route.decode("test:name:123456789:two")
+	g.Expect(err).To(MatchError(ErrMalformedCustomID))
+	_, err = route.decode("test:name:123456789")
+	g.Expect(err).To(MatchError(ErrMalformedCustomID))
+
+	// Routes whose custom ids may be too long are rejected when declared
+	g.Expect(func() { NewRoute("test", StringParam("name", customIDLimit)) }).To(Panic())
+	g.Expect(func() { NewRoute("te:st") }).To(Panic())
+}
+
+func TestSignedRoute(t *testing.T) {
+	g := NewGomegaWithT(t)
+	route := NewSignedRoute("test", IntParam("import"))
+
+	customID, err := route.CustomID(42)
+	g.Expect(err).To(BeNil())
+	params, err := route.decode(customID)
+	g.Expect(err).To(BeNil())
+	g.Expect(params.Int("import")).To(Equal(42))
+
+	// Changing the parameters invalidates the signature
+	_, err = route.decode(strings.Replace(customID, ":42:", ":43:", 1))
+	g.Expect(err).To(MatchError(ErrStaleCustomID))
+}
+
+func TestRouter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	router := NewRouter()
+	route := NewRoute("test", StringParam("name", 20))
+	var handled string
+	router.Handle(route, func(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User, params Params) {
+		handled = params.String("name")
+	})
+	router.HandleFunc("test-plain", func(s *discordgo.Session, event *discordgo.InteractionCreate, user *discordgo.User) {
+		handled = "plain"
+	})
+
+	handler, _, err := router.Route("test-plain")
+	g.Expect(err).To(BeNil())
+	handler(nil, nil, nil, nil)
+	g.Expect(handled).To(Equal("plain"))
+
+	handler, params, err := router.Route("test:name")
+	g.Expect(err).To(BeNil())
+	handler(nil, nil, nil, params)
+	g.Expect(handled).To(Equal("name"))
+
+	// Routes are matched by their exact id, not a prefix of it
+	_, _, err = router.Route("test-other")
+	g.Expect(err).To(MatchError(ErrUnknownCustomID))
+
+	g.Expect(func() { router.HandleFunc("test", nil) }).To(Panic())
+}
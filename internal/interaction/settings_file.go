@@ -0,0 +1,322 @@
+package interaction
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"gopkg.in/yaml.v3"
+)
+
+// settingsFileVersion is the version of the settings file format written by ExportSettings
+const settingsFileVersion = 1
+
+// isExportedSetting checks if the setting is included in a settings file.
+// Internal settings, like the onboarding message posted with /onboarding, are left out
+func isExportedSetting(name string) bool {
+	definition, ok := backend.LookupSetting(name)
+	return ok && !definition.Internal
+}
+
+// isRoleSetting checks if the setting holds role ids, which are written with the names of the roles
+func isRoleSetting(name string) bool {
+	definition, _ := backend.LookupSetting(name)
+	return definition.HoldsRoles()
+}
+
+// isChannelSetting checks if the setting holds a channel id, which is written with the name of the channel
+func isChannelSetting(name string) bool {
+	definition, _ := backend.LookupSetting(name)
+	return definition.Type == backend.SettingTypeChannel
+}
+
+// SettingsFile is the YAML representation of the settings of a server, used to copy settings between servers
+type SettingsFile struct {
+	Version  int                          `yaml:"version"`
+	Settings map[string]SettingsFileValue `yaml:"settings"`
+}
+
+// SettingsFileValue is the value of a setting, the roles of a setting holding roles or the channel of a setting holding a channel
+type SettingsFileValue struct {
+	Value   string
+	Roles   []SettingsFileRole
+	Channel *SettingsFileChannel
+}
+
+// SettingsFileRole refers to a role by id, falling back to its name if the id does not exist on the server
+type SettingsFileRole struct {
+	ID   string `yaml:"id,omitempty"`
+	Name string `yaml:"name,omitempty"`
+}
+
+// SettingsFileChannel refers to a channel by id, falling back to its name if the id does not exist on the server
+type SettingsFileChannel struct {
+	ID   string `yaml:"id,omitempty"`
+	Name string `yaml:"name,omitempty"`
+}
+
+func (v SettingsFileValue) MarshalYAML() (interface{}, error) {
+	if v.Roles != nil {
+		return v.Roles, nil
+	}
+	if v.Channel != nil {
+		return v.Channel, nil
+	}
+	return v.Value, nil
+}
+
+func (v *SettingsFileValue) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		v.Roles = []SettingsFileRole{}
+		return node.Decode(&v.Roles)
+	case yaml.MappingNode:
+		v.Channel = &SettingsFileChannel{}
+		return node.Decode(v.Channel)
+	case yaml.ScalarNode:
+		return node.Decode(&v.Value)
+	default:
+		return fmt.Errorf("line %d: expected a value, a channel or a list of roles", node.Line)
+	}
+}
+
+// SettingChange is a setting that is changed by an import
+type SettingChange struct {
+	Name     string
+	OldValue string
+	NewValue string
+}
+
+// ExportSettings builds the settings file of a server, with the names of the roles and channels alongside their ids
+func ExportSettings(settings map[string]string, roles []*discordgo.Role, channels []*discordgo.Channel) *SettingsFile {
+	rolesByID := make(map[string]*discordgo.Role, len(roles))
+	for _, role := range roles {
+		rolesByID[role.ID] = role
+	}
+	channelsByID := make(map[string]*discordgo.Channel, len(channels))
+	for _, channel := range channels {
+		channelsByID[channel.ID] = channel
+	}
+
+	file := &SettingsFile{
+		Version:  settingsFileVersion,
+		Settings: make(map[string]SettingsFileValue),
+	}
+	for _, definition := range backend.SettingDefinitions() {
+		name := definition.Name
+		value, ok := settings[name]
+		if !ok || definition.Internal {
+			continue
+		}
+
+		if definition.Type == backend.SettingTypeChannel && value != "" {
+			ref := &SettingsFileChannel{ID: value}
+			if channel, ok := channelsByID[value]; ok {
+				ref.Name = channel.Name
+			}
+			file.Settings[name] = SettingsFileValue{Channel: ref}
+			continue
+		}
+		if !definition.HoldsRoles() {
+			file.Settings[name] = SettingsFileValue{Value: value}
+			continue
+		}
+
+		refs := []SettingsFileRole{}
+		for _, roleID := range splitSetting(value) {
+			ref := SettingsFileRole{ID: roleID}
+			if role, ok := rolesByID[roleID]; ok {
+				ref.Name = role.Name
+			}
+			refs = append(refs, ref)
+		}
+		file.Settings[name] = SettingsFileValue{Roles: refs}
+	}
+	return file
+}
+
+// ParseSettingsFile reads a settings file, rejecting files written by a newer version of the bot
+func ParseSettingsFile(data []byte, locale discordgo.Locale) (*SettingsFile, error) {
+	var file SettingsFile
+	err := yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, errors.New(resources.TL(locale, "settings.import.errors.invalid_file", resources.TData("error", err.Error())))
+	}
+	if file.Version < 1 || file.Version > settingsFileVersion {
+		return nil, errors.New(resources.TL(locale, "settings.import.errors.version", resources.TData("version", file.Version)))
+	}
+	return &file, nil
+}
+
+// Resolve returns the values to store for the settings in the file.
+// Roles and channels are looked up by id, or by name if the id does not exist on the server, e.g. when the file was exported from another server
+func (f *SettingsFile) Resolve(roles []*discordgo.Role, channels []*discordgo.Channel, locale discordgo.Locale) (map[string]string, error) {
+	var errs []error
+	values := make(map[string]string, len(f.Settings))
+	for _, name := range slices.Sorted(maps.Keys(f.Settings)) {
+		value := f.Settings[name]
+		if !isExportedSetting(name) {
+			errs = append(errs, errors.New(resources.TL(locale, "settings.import.errors.unknown_setting", resources.TData("name", name))))
+			continue
+		}
+
+		if isChannelSetting(name) {
+			if value.Roles != nil {
+				errs = append(errs, errors.New(resources.TL(locale, "settings.import.errors.not_roles", resources.TData("name", name))))
+				continue
+			}
+			ref := value.Channel
+			if ref == nil {
+				if value.Value == "" {
+					values[name] = ""
+					continue
+				}
+				// Channels written as a plain id
+				ref = &SettingsFileChannel{ID: value.Value}
+			}
+			channelID, err := resolveChannel(*ref, channels, locale)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			values[name] = channelID
+			continue
+		}
+		if value.Channel != nil {
+			errs = append(errs, errors.New(resources.TL(locale, "settings.import.errors.not_channel", resources.TData("name", name))))
+			continue
+		}
+
+		if !isRoleSetting(name) {
+			if value.Roles != nil {
+				errs = append(errs, errors.New(resources.TL(locale, "settings.import.errors.not_roles", resources.TData("name", name))))
+				continue
+			}
+			if err := backend.ValidateSetting(name, value.Value); err != nil {
+				errs = append(errs, errors.New(resources.TL(locale, "settings.import.errors.invalid_value", resources.TData("name", name, "value", value.Value))))
+				continue
+			}
+			values[name] = value.Value
+			continue
+		}
+
+		if value.Roles == nil && value.Value != "" {
+			errs = append(errs, errors.New(resources.TL(locale, "settings.import.errors.roles_expected", resources.TData("name", name))))
+			continue
+		}
+		roleIDs := make([]string, 0, len(value.Roles))
+		for _, ref := range value.Roles {
+			roleID, err := resolveRole(ref, roles, locale)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			roleIDs = append(roleIDs, roleID)
+		}
+		values[name] = strings.Join(roleIDs, ",")
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return values, nil
+}
+
+func resolveRole(ref SettingsFileRole, roles []*discordgo.Role, locale discordgo.Locale) (string, error) {
+	if ref.ID != "" {
+		for _, role := range roles {
+			if role.ID == ref.ID {
+				return role.ID, nil
+			}
+		}
+	}
+
+	var matches []*discordgo.Role
+	for _, role := range roles {
+		if ref.Name != "" && role.Name == ref.Name {
+			matches = append(matches, role)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0].ID, nil
+	case 0:
+		return "", errors.New(resources.TL(locale, "settings.import.errors.role_not_found", resources.TData("id", ref.ID, "name", ref.Name)))
+	default:
+		return "", errors.New(resources.TL(locale, "settings.import.errors.ambiguous_role", resources.TData("name", ref.Name)))
+	}
+}
+
+func resolveChannel(ref SettingsFileChannel, channels []*discordgo.Channel, locale discordgo.Locale) (string, error) {
+	if ref.ID != "" {
+		for _, channel := range channels {
+			if channel.ID == ref.ID {
+				return channel.ID, nil
+			}
+		}
+	}
+
+	var matches []*discordgo.Channel
+	for _, channel := range channels {
+		if ref.Name != "" && channel.Name == ref.Name && (channel.Type == discordgo.ChannelTypeGuildText || channel.Type == discordgo.ChannelTypeGuildNews) {
+			matches = append(matches, channel)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0].ID, nil
+	case 0:
+		return "", errors.New(resources.TL(locale, "settings.import.errors.channel_not_found", resources.TData("id", ref.ID, "name", ref.Name)))
+	default:
+		return "", errors.New(resources.TL(locale, "settings.import.errors.ambiguous_channel", resources.TData("name", ref.Name)))
+	}
+}
+
+// DiffSettings returns the settings that differ between current and values, in the order of the settings definitions
+func DiffSettings(current map[string]string, values map[string]string) []SettingChange {
+	var changes []SettingChange
+	for _, definition := range backend.SettingDefinitions() {
+		name := definition.Name
+		value, ok := values[name]
+		if !ok || current[name] == value {
+			continue
+		}
+		changes = append(changes, SettingChange{
+			Name:     name,
+			OldValue: current[name],
+			NewValue: value,
+		})
+	}
+	return changes
+}
+
+// formatSettingValue renders the value of a setting for display, mentioning roles and channels instead of showing their ids
+func formatSettingValue(name string, value string) string {
+	if value == "" {
+		return "-"
+	}
+	if isChannelSetting(name) {
+		return fmt.Sprintf("<#%s>", value)
+	}
+	if !isRoleSetting(name) {
+		return fmt.Sprintf("`%s`", value)
+	}
+
+	mentions := make([]string, 0)
+	for _, roleID := range splitSetting(value) {
+		mentions = append(mentions, fmt.Sprintf("<@&%s>", roleID))
+	}
+	return strings.Join(mentions, ", ")
+}
+
+func splitSetting(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
@@ -0,0 +1,97 @@
+package interaction
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSettingsFileRoundTrip(t *testing.T) {
+	g := NewGomegaWithT(t)
+	source := []*discordgo.Role{
+		{ID: "1", Name: "Verified"},
+		{ID: "2", Name: "[TAG] Guild"},
+	}
+	sourceChannels := []*discordgo.Channel{
+		{ID: "5", Name: "audit", Type: discordgo.ChannelTypeGuildText},
+	}
+	settings := map[string]string{
+		backend.SettingWvWWorld:          "2301",
+		backend.SettingGuildCommonRole:   "1",
+		backend.SettingGuildVerifyRoles:  "2",
+		backend.SettingOnboardingMessage: "message",
+		backend.SettingAuditChannel:      "5",
+	}
+
+	data, err := yaml.Marshal(ExportSettings(settings, source, sourceChannels))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(data)).To(ContainSubstring("name: Verified"))
+	g.Expect(string(data)).To(ContainSubstring("name: audit"))
+	g.Expect(string(data)).ToNot(ContainSubstring(backend.SettingOnboardingMessage))
+
+	file, err := ParseSettingsFile(data, discordgo.EnglishUS)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Roles and channels are mapped by name on a server with other ids
+	target := []*discordgo.Role{
+		{ID: "10", Name: "Verified"},
+		{ID: "20", Name: "[TAG] Guild"},
+	}
+	targetChannels := []*discordgo.Channel{
+		{ID: "50", Name: "audit", Type: discordgo.ChannelTypeGuildVoice},
+		{ID: "51", Name: "audit", Type: discordgo.ChannelTypeGuildText},
+	}
+	values, err := file.Resolve(target, targetChannels, discordgo.EnglishUS)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(values).To(Equal(map[string]string{
+		backend.SettingWvWWorld:         "2301",
+		backend.SettingGuildCommonRole:  "10",
+		backend.SettingGuildVerifyRoles: "20",
+		backend.SettingAuditChannel:     "51",
+	}))
+
+	changes := DiffSettings(map[string]string{backend.SettingWvWWorld: "2301"}, values)
+	g.Expect(changes).To(Equal([]SettingChange{
+		{Name: backend.SettingGuildCommonRole, OldValue: "", NewValue: "10"},
+		{Name: backend.SettingGuildVerifyRoles, OldValue: "", NewValue: "20"},
+		{Name: backend.SettingAuditChannel, OldValue: "", NewValue: "51"},
+	}))
+}
+
+func TestSettingsFileResolveErrors(t *testing.T) {
+	g := NewGomegaWithT(t)
+	roles := []*discordgo.Role{
+		{ID: "1", Name: "Duplicate"},
+		{ID: "2", Name: "Duplicate"},
+	}
+
+	file, err := ParseSettingsFile([]byte(`
+version: 1
+settings:
+  unknown: "value"
+  verification_role:
+    - name: Duplicate
+  guild_verify_roles:
+    - id: "3"
+      name: Missing
+  audit_channel: "4"
+`), discordgo.EnglishUS)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Channels of other servers are rejected, even when written as a plain id
+	channels := []*discordgo.Channel{
+		{ID: "5", Name: "audit", Type: discordgo.ChannelTypeGuildText},
+	}
+	_, err = file.Resolve(roles, channels, discordgo.EnglishUS)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("unknown"))
+	g.Expect(err.Error()).To(ContainSubstring("Duplicate"))
+	g.Expect(err.Error()).To(ContainSubstring("Missing"))
+	g.Expect(err.Error()).To(ContainSubstring(backend.SettingAuditChannel))
+
+	_, err = ParseSettingsFile([]byte("version: 2\n"), discordgo.EnglishUS)
+	g.Expect(err).To(HaveOccurred())
+}
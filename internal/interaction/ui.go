@@ -52,6 +52,78 @@ func (ui *UIBuilder) buildStatusFields(user *api.User, locale discordgo.Locale)
 	return fields
 }
 
+// buildWhoisEmbed creates an embed describing a server member, their roles and the accounts linked to them
+func (ui *UIBuilder) buildWhoisEmbed(member *discordgo.Member, user *api.User, locale discordgo.Locale) *discordgo.MessageEmbed {
+	status, color := whoisStatus(user, locale)
+	fields := []*discordgo.MessageEmbedField{
+		{
+			Name:   resources.TL(locale, "whois.fields.discord_user"),
+			Value:  member.Mention(),
+			Inline: true,
+		},
+		{
+			Name:   resources.TL(locale, "status.fields.status"),
+			Value:  status,
+			Inline: true,
+		},
+		ui.buildRolesField(member, locale),
+	}
+	fields = append(fields, ui.buildStatusFields(user, locale)...)
+
+	var author discordgo.MessageEmbedAuthor
+	if member.Nick != "" {
+		author.Name = member.Nick
+	} else {
+		author.Name = member.User.Username
+	}
+	author.IconURL = member.AvatarURL("")
+
+	return &discordgo.MessageEmbed{
+		Color:  color,
+		Title:  resources.TL(locale, "whois.title"),
+		Fields: fields,
+		Author: &author,
+	}
+}
+
+// whoisStatus returns the status of the user, and the color it is shown in.
+// A user is only expired if they have linked accounts, and all of them have expired
+func whoisStatus(user *api.User, locale discordgo.Locale) (string, int) {
+	const green, red, lightgrey = 0x57F287, 0xED4245, 0x95A5A6
+	switch {
+	case api.ActiveBan(user.Bans) != nil:
+		return resources.TL(locale, "status.status_values.banned"), red
+	case len(user.Accounts) == 0:
+		return resources.TL(locale, "status.status_values.not_linked"), lightgrey
+	}
+	for _, account := range user.Accounts {
+		if account.Expired == nil || !*account.Expired {
+			return resources.TL(locale, "status.status_values.active"), green
+		}
+	}
+	return resources.TL(locale, "status.status_values.expired"), red
+}
+
+// buildRolesField creates an embed field listing the roles of a server member
+func (ui *UIBuilder) buildRolesField(member *discordgo.Member, locale discordgo.Locale) *discordgo.MessageEmbedField {
+	field := &discordgo.MessageEmbedField{
+		Name:   resources.TL(locale, "whois.fields.roles"),
+		Inline: false,
+	}
+
+	for _, roleID := range member.Roles {
+		if field.Value == "" {
+			field.Value = fmt.Sprintf("<@&%s>", roleID)
+		} else {
+			field.Value += " " + fmt.Sprintf("<@&%s>", roleID)
+		}
+	}
+	if field.Value == "" {
+		field.Value = resources.TL(locale, "whois.no_roles")
+	}
+	return field
+}
+
 // buildAccountTableFields creates an embed field table of the basic account details
 // Example markdown
 // Account | World | Status
@@ -0,0 +1,33 @@
+package interaction
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+)
+
+func TestWhoisStatus(t *testing.T) {
+	g := NewGomegaWithT(t)
+	expired := true
+	active := false
+	locale := discordgo.EnglishUS
+
+	status, _ := whoisStatus(&api.User{}, locale)
+	g.Expect(status).To(Equal(resources.TL(locale, "status.status_values.not_linked")))
+
+	status, _ = whoisStatus(&api.User{Accounts: []api.Account{{Expired: &expired}}}, locale)
+	g.Expect(status).To(Equal(resources.TL(locale, "status.status_values.expired")))
+
+	status, _ = whoisStatus(&api.User{Accounts: []api.Account{{Expired: &expired}, {Expired: &active}}}, locale)
+	g.Expect(status).To(Equal(resources.TL(locale, "status.status_values.active")))
+
+	status, _ = whoisStatus(&api.User{
+		Accounts: []api.Account{{Expired: &active}},
+		Bans:     []api.Ban{{Until: time.Now().Add(time.Hour)}},
+	}, locale)
+	g.Expect(status).To(Equal(resources.TL(locale, "status.status_values.banned")))
+}
@@ -0,0 +1,5 @@
+package api
+
+// Generate openapi code using generator https://github.com/deepmap/oapi-codegen
+
+//go:generate oapi-codegen --config=config.yaml ../../../api/management.yaml
@@ -0,0 +1,371 @@
+// Package management serves the management API described in api/management.yaml, used by tooling to manage the servers of the bot.
+// The routes and models are generated into the api package
+package management
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/diagnose"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+	"github.com/vennekilde/gw2-alliance-bot/internal/guild"
+	"github.com/vennekilde/gw2-alliance-bot/internal/management/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+// maxBodySize is the largest request body accepted
+const maxBodySize = 64 << 10
+
+// Config configures the management API
+type Config struct {
+	// Addr is the address the API listens on, e.g. ":8081". The API is disabled if Addr or Token is empty
+	Addr string
+	// Token is the bearer token requests have to be authenticated with
+	Token string
+}
+
+// Enabled checks if the API should be served
+func (c Config) Enabled() bool {
+	return c.Addr != "" && c.Token != ""
+}
+
+// API serves the management API
+type API struct {
+	config    Config
+	discord   *discordgo.Session
+	service   *backend.Service
+	cache     *discord.Cache
+	guilds    *guild.Guilds
+	reconcile func(guildID string) error
+	enqueue   func(guildID string, userID string)
+	pending   func(guildID string) int
+	plan      func(member *discordgo.Member) ([]reconcile.Decision, error)
+
+	httpServer *http.Server
+}
+
+var _ api.ServerInterface = (*API)(nil)
+
+// NewAPI creates the management API. reconcileServer schedules every member of a server to be reconciled, enqueue schedules a single member,
+// pending returns the number of members of a server waiting to be reconciled, and plan decides the roles of a member without changing them
+func NewAPI(config Config, discord *discordgo.Session, service *backend.Service, cache *discord.Cache, guilds *guild.Guilds, reconcileServer func(guildID string) error, enqueue func(guildID string, userID string), pending func(guildID string) int, plan func(member *discordgo.Member) ([]reconcile.Decision, error)) *API {
+	a := &API{
+		config:    config,
+		discord:   discord,
+		service:   service,
+		cache:     cache,
+		guilds:    guilds,
+		reconcile: reconcileServer,
+		enqueue:   enqueue,
+		pending:   pending,
+		plan:      plan,
+	}
+
+	handler := api.HandlerWithOptions(a, api.StdHTTPServerOptions{
+		ErrorHandlerFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+			writeError(w, http.StatusBadRequest, err.Error(), nil)
+		},
+	})
+
+	a.httpServer = &http.Server{
+		Addr:              config.Addr,
+		Handler:           a.authenticate(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return a
+}
+
+// Start serves the API in the background
+func (a *API) Start() {
+	go func() {
+		zap.L().Info("serving management api", zap.String("addr", a.config.Addr))
+		err := a.httpServer.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Error("unable to serve management api", zap.Error(err))
+		}
+	}()
+}
+
+// Close stops serving the API, waiting shortly for requests being handled
+func (a *API) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return a.httpServer.Shutdown(ctx)
+}
+
+// authenticate rejects requests without the bearer token of the API
+func (a *API) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.config.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *API) ListServers(w http.ResponseWriter, r *http.Request) {
+	guilds := discord.Guilds(a.discord)
+	servers := make([]api.Server, 0, len(guilds))
+	for _, server := range guilds {
+		servers = append(servers, api.Server{
+			Id:          server.ID,
+			Name:        server.Name,
+			MemberCount: server.MemberCount,
+			Pending:     a.pending(server.ID),
+		})
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Name < servers[j].Name
+	})
+	writeJSON(w, http.StatusOK, servers)
+}
+
+func (a *API) GetSettings(w http.ResponseWriter, r *http.Request, serverID api.ServerId) {
+	server, ok := a.server(w, serverID)
+	if !ok {
+		return
+	}
+	values := a.service.GetSettings(server.ID)
+	definitions := backend.SettingDefinitions()
+	settings := make([]api.Setting, len(definitions))
+	for i, definition := range definitions {
+		settings[i] = newSetting(definition, values[definition.Name])
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+func (a *API) GetSetting(w http.ResponseWriter, r *http.Request, serverID api.ServerId, name string) {
+	server, ok := a.server(w, serverID)
+	if !ok {
+		return
+	}
+	definition, ok := backend.LookupSetting(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown setting", nil)
+		return
+	}
+	// The default is returned separately, so the stored value is returned as is
+	writeJSON(w, http.StatusOK, newSetting(definition, a.service.GetSettings(server.ID)[definition.Name]))
+}
+
+// SetSetting sets a setting of the server, after the same checks as the settings command
+func (a *API) SetSetting(w http.ResponseWriter, r *http.Request, serverID api.ServerId, name string) {
+	server, ok := a.server(w, serverID)
+	if !ok {
+		return
+	}
+	definition, ok := backend.LookupSetting(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown setting", nil)
+		return
+	}
+	if definition.Internal {
+		writeError(w, http.StatusBadRequest, "internal settings are maintained by the bot, and cannot be set", nil)
+		return
+	}
+
+	var update api.SetSettingJSONRequestBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error(), nil)
+		return
+	}
+	var actor string
+	if update.Actor != nil {
+		actor = *update.Actor
+	}
+	if _, err := strconv.ParseUint(actor, 10, 64); actor != "" && err != nil {
+		writeError(w, http.StatusBadRequest, "actor is not a discord user id", nil)
+		return
+	}
+	if err := definition.Validate(update.Value); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if problems := diagnose.CheckSetting(a.discord, server.ID, definition.Name, update.Value); len(problems) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, "the bot is unable to manage the roles or nicks of the setting", newProblems(problems))
+		return
+	}
+
+	ctx := backend.WithActor(r.Context(), actor)
+	if err := a.service.SetSetting(ctx, server.ID, definition.Name, update.Value); err != nil {
+		zap.L().Error("unable to set setting from management api", zap.String("guild id", server.ID), zap.String("setting", definition.Name), zap.Error(err))
+		writeError(w, http.StatusBadGateway, "unable to save the setting", nil)
+		return
+	}
+	zap.L().Info("setting changed from management api", zap.String("guild id", server.ID), zap.String("actor", actor), zap.String("setting", definition.Name), zap.String("value", update.Value))
+	writeJSON(w, http.StatusOK, newSetting(definition, update.Value))
+}
+
+func (a *API) ReconcileServer(w http.ResponseWriter, r *http.Request, serverID api.ServerId) {
+	server, ok := a.server(w, serverID)
+	if !ok {
+		return
+	}
+	if err := a.reconcile(server.ID); err != nil {
+		zap.L().Error("unable to reconcile server from management api", zap.String("guild id", server.ID), zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "unable to reconcile the members of the server", nil)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, api.ReconcileStatus{Pending: a.pending(server.ID)})
+}
+
+func (a *API) ReconcileMember(w http.ResponseWriter, r *http.Request, serverID api.ServerId, userID api.UserId) {
+	member, ok := a.member(w, serverID, userID)
+	if !ok {
+		return
+	}
+	a.enqueue(member.GuildID, member.User.ID)
+	writeJSON(w, http.StatusAccepted, api.ReconcileStatus{Pending: a.pending(member.GuildID)})
+}
+
+// PlanMember returns the roles the member should have, and why, like /why
+func (a *API) PlanMember(w http.ResponseWriter, r *http.Request, serverID api.ServerId, userID api.UserId) {
+	member, ok := a.member(w, serverID, userID)
+	if !ok {
+		return
+	}
+	decisions, err := a.plan(member)
+	if err != nil {
+		zap.L().Error("unable to plan member from management api", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.Error(err))
+		writeError(w, http.StatusBadGateway, "unable to look up the member in the backend", nil)
+		return
+	}
+
+	planned := make([]api.Decision, len(decisions))
+	for i, decision := range decisions {
+		planned[i] = newDecision(decision, a.cache.GetRole(member.GuildID, decision.RoleID))
+	}
+	writeJSON(w, http.StatusOK, planned)
+}
+
+func (a *API) ListGuildRoles(w http.ResponseWriter, r *http.Request, serverID api.ServerId) {
+	server, ok := a.server(w, serverID)
+	if !ok {
+		return
+	}
+	mappings := diagnose.GuildRoleMappings(a.service, a.guilds, server.ID, server.Roles)
+	roles := make([]api.GuildRoleMapping, len(mappings))
+	for i, mapping := range mappings {
+		roles[i] = api.GuildRoleMapping{
+			RoleId:   mapping.RoleID,
+			RoleName: mapping.RoleName,
+			Verifies: mapping.Verifies,
+		}
+		if mapping.Guild != nil {
+			roles[i].GuildId, roles[i].GuildName, roles[i].GuildTag = &mapping.Guild.ID, &mapping.Guild.Name, &mapping.Guild.Tag
+		}
+	}
+	writeJSON(w, http.StatusOK, roles)
+}
+
+// server returns the server of the request. If the bot is not a member of it, an error is written and ok is false
+func (a *API) server(w http.ResponseWriter, serverID api.ServerId) (*discordgo.Guild, bool) {
+	server, err := a.discord.State.Guild(serverID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "the bot is not a member of the server", nil)
+		return nil, false
+	}
+	return server, true
+}
+
+// member returns the member of the request. If they are not a member of the server, an error is written and ok is false
+func (a *API) member(w http.ResponseWriter, serverID api.ServerId, userID api.UserId) (*discordgo.Member, bool) {
+	server, ok := a.server(w, serverID)
+	if !ok {
+		return nil, false
+	}
+	member, err := a.cache.GetMember(server.ID, userID)
+	if err != nil || member == nil {
+		writeError(w, http.StatusNotFound, "the user is not a member of the server", nil)
+		return nil, false
+	}
+	// Cache guildID in member struct, as it is not by default
+	member.GuildID = server.ID
+	return member, true
+}
+
+func newSetting(definition backend.SettingDefinition, value string) api.Setting {
+	// Secrets are shown in discord and the dashboard only
+	if definition.Type == backend.SettingTypeSecret {
+		value = ""
+	}
+	setting := api.Setting{
+		Name:        definition.Name,
+		Type:        api.SettingType(definition.Type.String()),
+		Description: definition.Description,
+		Value:       value,
+		Default:     definition.Default,
+		Internal:    definition.Internal,
+	}
+	if definition.Values != nil {
+		setting.Values = &definition.Values
+	}
+	if definition.Min != 0 {
+		setting.Min = &definition.Min
+	}
+	return setting
+}
+
+// newDecision returns the decision as returned by the API. role is nil if the role no longer exists
+func newDecision(decision reconcile.Decision, role *discordgo.Role) api.Decision {
+	planned := api.Decision{
+		RoleId:    decision.RoleID,
+		Has:       decision.Has,
+		Want:      decision.Want,
+		Change:    api.DecisionChangeNone,
+		ReasonKey: decision.Reason,
+	}
+	if role != nil {
+		planned.RoleName = role.Name
+	}
+	if decision.Changed() {
+		planned.Change = api.DecisionChangeRemove
+		if decision.Want {
+			planned.Change = api.DecisionChangeAdd
+		}
+	}
+	if decision.Reason != "" {
+		planned.Reason = resources.T(decision.Reason, decision.ReasonData)
+	}
+	return planned
+}
+
+func newProblems(problems []diagnose.Problem) []api.Problem {
+	converted := make([]api.Problem, len(problems))
+	for i, problem := range problems {
+		converted[i] = api.Problem{
+			Reason: resources.T(problem.Reason, problem.Data),
+			Fix:    resources.T(problem.Fix, problem.Data),
+		}
+	}
+	return converted
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		zap.L().Warn("unable to write management api response", zap.Error(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string, problems []api.Problem) {
+	body := api.Error{Message: message}
+	if len(problems) > 0 {
+		body.Problems = &problems
+	}
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,105 @@
+package management
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/management/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+)
+
+func testAPI() *API {
+	session := &discordgo.Session{State: discordgo.NewState()}
+	_ = session.State.GuildAdd(&discordgo.Guild{ID: "2", Name: "B Server", MemberCount: 20})
+	_ = session.State.GuildAdd(&discordgo.Guild{ID: "1", Name: "A Server", MemberCount: 10})
+	return NewAPI(Config{Addr: ":0", Token: "secret"}, session, backend.NewService(nil, "", nil), nil, nil,
+		func(guildID string) error { return nil },
+		func(guildID string, userID string) {},
+		func(guildID string) int { return 3 },
+		nil,
+	)
+}
+
+func request(a *API, method string, path string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	a.httpServer.Handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestAuthenticate(t *testing.T) {
+	g := NewGomegaWithT(t)
+	a := testAPI()
+
+	g.Expect(request(a, http.MethodGet, "/v1/servers", "", "").Code).To(Equal(http.StatusUnauthorized))
+	g.Expect(request(a, http.MethodGet, "/v1/servers", "", "wrong").Code).To(Equal(http.StatusUnauthorized))
+	g.Expect(request(a, http.MethodGet, "/v1/servers", "", "secret").Code).To(Equal(http.StatusOK))
+	g.Expect(Config{Addr: ":8081"}.Enabled()).To(BeFalse())
+}
+
+func TestListServers(t *testing.T) {
+	g := NewGomegaWithT(t)
+	resp := request(testAPI(), http.MethodGet, "/v1/servers", "", "secret")
+	g.Expect(resp.Code).To(Equal(http.StatusOK))
+
+	var servers []api.Server
+	g.Expect(json.Unmarshal(resp.Body.Bytes(), &servers)).To(Succeed())
+	g.Expect(servers).To(Equal([]api.Server{
+		{Id: "1", Name: "A Server", MemberCount: 10, Pending: 3},
+		{Id: "2", Name: "B Server", MemberCount: 20, Pending: 3},
+	}))
+}
+
+func TestSettings(t *testing.T) {
+	g := NewGomegaWithT(t)
+	a := testAPI()
+
+	resp := request(a, http.MethodGet, "/v1/servers/1/settings/"+backend.SettingPolicyGraceHours, "", "secret")
+	g.Expect(resp.Code).To(Equal(http.StatusOK))
+	var setting api.Setting
+	g.Expect(json.Unmarshal(resp.Body.Bytes(), &setting)).To(Succeed())
+	g.Expect(setting.Type).To(Equal(api.SettingTypeInt))
+	g.Expect(setting.Value).To(BeEmpty())
+
+	// Every type of setting is listed in the spec
+	types := []api.SettingType{
+		api.SettingTypeBool, api.SettingTypeChannel, api.SettingTypeCommandList, api.SettingTypeEnum,
+		api.SettingTypeInt, api.SettingTypeMessage, api.SettingTypePermissionList, api.SettingTypeRole,
+		api.SettingTypeRoleList, api.SettingTypeSecret, api.SettingTypeUrlList, api.SettingTypeWorld,
+	}
+	for _, definition := range backend.SettingDefinitions() {
+		g.Expect(types).To(ContainElement(newSetting(definition, "").Type), definition.Name)
+	}
+
+	// Secrets are not returned
+	g.Expect(newSetting(backend.SettingDefinition{Type: backend.SettingTypeSecret}, "value").Value).To(BeEmpty())
+
+	g.Expect(request(a, http.MethodGet, "/v1/servers/3/settings", "", "secret").Code).To(Equal(http.StatusNotFound))
+	g.Expect(request(a, http.MethodGet, "/v1/servers/1/settings/unknown", "", "secret").Code).To(Equal(http.StatusNotFound))
+
+	// Values are validated like with the settings command
+	g.Expect(request(a, http.MethodPut, "/v1/servers/1/settings/"+backend.SettingPolicyGraceHours, `{"value":"soon"}`, "secret").Code).To(Equal(http.StatusBadRequest))
+	g.Expect(request(a, http.MethodPut, "/v1/servers/1/settings/"+backend.SettingPolicyGraceHours, `{"value":"12","actor":"bot"}`, "secret").Code).To(Equal(http.StatusBadRequest))
+	g.Expect(request(a, http.MethodPut, "/v1/servers/1/settings/"+backend.SettingOnboardingMessage, `{"value":"1"}`, "secret").Code).To(Equal(http.StatusBadRequest))
+}
+
+func TestNewDecision(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	decision := newDecision(reconcile.Decision{RoleID: "1", Has: false, Want: true, Reason: "audit.reasons.linked_account"}, &discordgo.Role{ID: "1", Name: "Verified"})
+	g.Expect(decision.Change).To(Equal(api.DecisionChangeAdd))
+	g.Expect(decision.RoleName).To(Equal("Verified"))
+	g.Expect(decision.Reason).To(Equal("the member has linked a Guild Wars 2 account"))
+
+	g.Expect(newDecision(reconcile.Decision{RoleID: "1", Has: true}, nil).Change).To(Equal(api.DecisionChangeRemove))
+	g.Expect(newDecision(reconcile.Decision{RoleID: "1", Has: true, Want: true}, nil).Change).To(Equal(api.DecisionChangeNone))
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
 	"go.uber.org/zap"
 )
 
@@ -19,18 +20,11 @@ var (
 	RegexGuildTagNickName = regexp.MustCompile(`^!?(\[\S{2,4}\])? ?(.*)`)
 )
 
-func SetAccAsNick(discord *discordgo.Session, member *discordgo.Member, accName string) error {
-	origNick, err := GetNickname(discord, member)
-	if err != nil {
-		return err
-	}
+func SetAccAsNick(discord *discordgo.Session, auditLog *audit.Log, member *discordgo.Member, accName string, reason string) error {
+	origNick := GetNickname(member)
 
 	newNick := AppendAccName(origNick, accName)
-	if newNick != member.Nick {
-		zap.L().Info("set nickname", zap.String("guildID", member.GuildID), zap.String("nick", newNick), zap.String("old nick", origNick), zap.Int("length", utf8.RuneCountInString(newNick)))
-		return discord.GuildMemberNickname(member.GuildID, member.User.ID, newNick)
-	}
-	return nil
+	return setNick(discord, auditLog, member, origNick, newNick, reason)
 }
 
 func AppendAccName(origName string, accName string) string {
@@ -87,31 +81,32 @@ func minInt(a, b int) int {
 	return b
 }
 
-func RemoveGuildTagFromNick(discord *discordgo.Session, member *discordgo.Member) (err error) {
-	origNick, err := GetNickname(discord, member)
-	if err != nil {
-		return err
-	}
+func RemoveGuildTagFromNick(discord *discordgo.Session, auditLog *audit.Log, member *discordgo.Member, reason string) (err error) {
+	origNick := GetNickname(member)
 
 	newNick := RemoveGuildTag(origNick)
-	if newNick != member.Nick {
-		zap.L().Info("set nickname", zap.String("guildID", member.GuildID), zap.String("nick", newNick), zap.String("old nick", origNick), zap.Int("length", utf8.RuneCountInString(newNick)))
-		return discord.GuildMemberNickname(member.GuildID, member.User.ID, newNick)
-	}
-	return nil
+	return setNick(discord, auditLog, member, origNick, newNick, reason)
 }
 
-func SetGuildTagAsNick(discord *discordgo.Session, member *discordgo.Member, guildTag string) (err error) {
-	origNick, err := GetNickname(discord, member)
-	if err != nil {
-		return err
-	}
+func SetGuildTagAsNick(discord *discordgo.Session, auditLog *audit.Log, member *discordgo.Member, guildTag string, reason string) (err error) {
+	origNick := GetNickname(member)
 
 	newNick := PrependGuildTag(origNick, guildTag)
-	if newNick != member.Nick {
-		zap.L().Info("set nickname", zap.String("guildID", member.GuildID), zap.String("nick", newNick), zap.String("old nick", origNick), zap.Int("length", utf8.RuneCountInString(newNick)))
-		return discord.GuildMemberNickname(member.GuildID, member.User.ID, newNick)
+	return setNick(discord, auditLog, member, origNick, newNick, reason)
+}
+
+// setNick changes the nickname of the member, if it differs from the current one, and records the change in the audit log
+func setNick(discord *discordgo.Session, auditLog *audit.Log, member *discordgo.Member, origNick string, newNick string, reason string) error {
+	if newNick == member.Nick || newNick == origNick {
+		return nil
 	}
+
+	zap.L().Info("set nickname", zap.String("guildID", member.GuildID), zap.String("nick", newNick), zap.String("old nick", origNick), zap.Int("length", utf8.RuneCountInString(newNick)))
+	err := discord.GuildMemberNickname(member.GuildID, member.User.ID, newNick)
+	if err != nil {
+		return err
+	}
+	auditLog.NickChanged(member.GuildID, member.User.ID, origNick, newNick, reason)
 	return nil
 }
 
@@ -146,19 +141,11 @@ func RemoveGuildTag(origName string) string {
 	return origName
 }
 
-func GetNickname(discord *discordgo.Session, member *discordgo.Member) (nick string, err error) {
-	if member.Nick == "" {
-		// Attempt to ensure nickname is actually fetched
-		member, err = discord.GuildMember(member.GuildID, member.User.ID)
-		if err != nil {
-			return "", err
-		}
-	}
-
+// GetNickname returns the name the member is shown with on the server.
+// The member is expected to be up to date, e.g. from the member cache or an event
+func GetNickname(member *discordgo.Member) string {
 	if member.Nick != "" {
-		nick = member.Nick
-	} else {
-		nick = member.User.Username
+		return member.Nick
 	}
-	return nick, nil
+	return member.User.Username
 }
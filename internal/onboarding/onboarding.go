@@ -0,0 +1,274 @@
+package onboarding
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+	"github.com/vennekilde/gw2-alliance-bot/internal/interaction"
+	"github.com/vennekilde/gw2-alliance-bot/internal/store"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+// Onboarding welcomes new members with instructions on how to verify, and reminds them if they have yet to do so
+type Onboarding struct {
+	m             sync.Mutex
+	discord       *discordgo.Session
+	service       *backend.Service
+	backend       *api.ClientWithResponses
+	activeForUser func(userID string) bool
+	audit         *audit.Log
+
+	// reminders keeps track of the last reminder sent to each unverified member, so reminders are not sent again
+	// after a restart
+	reminders *store.Store[int]
+}
+
+// NewOnboarding creates the onboarding of new members, with the reminders sent persisted in dataDir.
+// If dataDir is empty, the reminders sent are only kept in memory
+func NewOnboarding(discord *discordgo.Session, service *backend.Service, backend *api.ClientWithResponses, activeForUser func(userID string) bool, auditLog *audit.Log, dataDir string) *Onboarding {
+	path := ""
+	if dataDir != "" {
+		path = filepath.Join(dataDir, "onboarding_reminders.json")
+	}
+	reminders, err := store.Open[int](path, 0)
+	if err != nil {
+		zap.L().Error("unable to load onboarding reminders, starting without any", zap.String("path", path), zap.Error(err))
+		reminders, _ = store.Open[int]("", 0)
+	}
+
+	o := &Onboarding{
+		discord:       discord,
+		service:       service,
+		backend:       backend,
+		activeForUser: activeForUser,
+		audit:         auditLog,
+		reminders:     reminders,
+	}
+
+	discord.AddHandler(o.onGuildMemberAdd)
+	discord.AddHandler(o.onGuildMemberRemove)
+
+	return o
+}
+
+// IsVerified checks if the user has at least one linked account that has not expired
+func IsVerified(user *api.User) bool {
+	return user != nil && len(api.ActiveAccounts(user.Accounts)) > 0
+}
+
+func (o *Onboarding) onGuildMemberAdd(s *discordgo.Session, event *discordgo.GuildMemberAdd) {
+	member := event.Member
+	if member.User == nil || member.User.Bot || !o.activeForUser(member.User.ID) {
+		return
+	}
+	zap.L().Info("member joined", zap.String("guild id", event.GuildID), zap.String("user id", member.User.ID))
+
+	// Start over, in case the member has been on the server before
+	o.forget(event.GuildID, member.User.ID)
+
+	ctx := context.Background()
+	resp, err := o.backend.GetPlatformUserWithResponse(ctx, backend.PlatformID, member.User.ID, &api.GetPlatformUserParams{})
+	if err != nil {
+		zap.L().Error("unable to get verification status for member", zap.Any("member", member), zap.Error(err))
+		return
+	} else if resp.JSON200 == nil && resp.StatusCode() != http.StatusNotFound {
+		zap.L().Error("unexpected response from server", zap.Any("member", member), zap.Any("resp", resp))
+		return
+	}
+
+	if IsVerified(resp.JSON200) {
+		return
+	}
+
+	member.GuildID = event.GuildID
+	o.setUnverifiedRole(member, true)
+	o.welcome(member)
+}
+
+func (o *Onboarding) onGuildMemberRemove(s *discordgo.Session, event *discordgo.GuildMemberRemove) {
+	if event.Member == nil || event.Member.User == nil {
+		return
+	}
+	o.forget(event.GuildID, event.Member.User.ID)
+}
+
+// forget removes the reminders sent to the member
+func (o *Onboarding) forget(guildID string, userID string) {
+	key := reminderKey(guildID, userID)
+	if _, ok, _ := o.reminders.Get(key); !ok {
+		return
+	}
+	o.reminders.Delete(key)
+	o.saveReminders()
+}
+
+func (o *Onboarding) saveReminders() {
+	err := o.reminders.Save()
+	if err != nil {
+		zap.L().Error("unable to save onboarding reminders", zap.Error(err))
+	}
+}
+
+// CheckMember ensures the unverified role reflects the verification status of the member, and reminds
+// unverified members to verify, if they have been on the server long enough
+func (o *Onboarding) CheckMember(member *discordgo.Member, user *api.User) {
+	verified := IsVerified(user)
+	o.setUnverifiedRole(member, !verified)
+
+	if verified {
+		o.forget(member.GuildID, member.User.ID)
+		return
+	}
+
+	interval := o.service.GetInt(member.GuildID, backend.SettingOnboardingReminderInterval)
+	maxReminders := o.service.GetInt(member.GuildID, backend.SettingOnboardingReminderCount)
+	due := dueReminder(member.JoinedAt, time.Now(), time.Duration(interval)*time.Hour, maxReminders)
+	if due == 0 {
+		// The reminders are over, or have been disabled, so what was sent no longer matters
+		o.forget(member.GuildID, member.User.ID)
+		return
+	}
+
+	key := reminderKey(member.GuildID, member.User.ID)
+	o.m.Lock()
+	sent, _, _ := o.reminders.Get(key)
+	if due <= sent {
+		o.m.Unlock()
+		return
+	}
+	o.reminders.Set(key, due)
+	o.m.Unlock()
+	o.saveReminders()
+
+	locale := discord.GuildLocale(o.discord, member.GuildID)
+	err := o.sendInstructions(member, resources.TL(locale, "onboarding.reminder", resources.TData("server", discord.GuildName(o.discord, member.GuildID))))
+	if err != nil {
+		zap.L().Warn("unable to send onboarding reminder", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.Error(err))
+	}
+}
+
+func (o *Onboarding) welcome(member *discordgo.Member) {
+	locale := discord.GuildLocale(o.discord, member.GuildID)
+	switch o.service.GetSetting(member.GuildID, backend.SettingOnboardingWelcome) {
+	case backend.OnboardingWelcomeDM:
+		err := o.sendInstructions(member, resources.TL(locale, "onboarding.welcome.dm", resources.TData("server", discord.GuildName(o.discord, member.GuildID))))
+		if err == nil {
+			return
+		}
+		// The member might not accept direct messages, so fall back to the welcome channel, if there is one
+		zap.L().Warn("unable to send welcome message", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.Error(err))
+		fallthrough
+	case backend.OnboardingWelcomeChannel:
+		err := o.sendChannelWelcome(member, locale)
+		if err != nil {
+			zap.L().Warn("unable to post welcome message", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.Error(err))
+		}
+	}
+}
+
+// sendInstructions sends the verify instructions to the member in a direct message
+func (o *Onboarding) sendInstructions(member *discordgo.Member, content string) error {
+	channel, err := o.discord.UserChannelCreate(member.User.ID)
+	if err != nil {
+		return err
+	}
+
+	locale := discord.GuildLocale(o.discord, member.GuildID)
+	embeds, components := interaction.BuildVerifyInstructions(locale, interaction.APIKeyNamePrefix(o.discord, member.GuildID), member.User.ID)
+	_, err = o.discord.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+		Content:    content,
+		Embeds:     embeds,
+		Components: components,
+	})
+	return err
+}
+
+func (o *Onboarding) sendChannelWelcome(member *discordgo.Member, locale discordgo.Locale) error {
+	channelID := o.service.GetSetting(member.GuildID, backend.SettingOnboardingWelcomeChannel)
+	if channelID == "" {
+		return nil
+	}
+
+	_, err := o.discord.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("<@%s>", member.User.ID),
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       resources.TL(locale, "onboarding.welcome.title", resources.TData("server", discord.GuildName(o.discord, member.GuildID))),
+				Description: resources.TL(locale, "onboarding.welcome.channel"),
+				Color:       0x3498DB, // blue
+			},
+		},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Style:    discordgo.SuccessButton,
+						Label:    resources.TL(locale, "onboarding.buttons.verify"),
+						CustomID: interaction.InteractionIDOnboardingVerify,
+					},
+				},
+			},
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Users: []string{member.User.ID},
+		},
+	})
+	return err
+}
+
+// setUnverifiedRole adds or removes the configured unverified role, if the member does not already reflect it
+func (o *Onboarding) setUnverifiedRole(member *discordgo.Member, unverified bool) {
+	roleID := o.service.GetSetting(member.GuildID, backend.SettingOnboardingUnverifiedRole)
+	if roleID == "" {
+		return
+	}
+
+	hasRole := slices.Contains(member.Roles, roleID)
+	var err error
+	if unverified && !hasRole {
+		zap.L().Info("adding unverified role", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.String("role id", roleID))
+		err = o.discord.GuildMemberRoleAdd(member.GuildID, member.User.ID, roleID)
+		if err == nil {
+			o.audit.RoleAdded(member.GuildID, member.User.ID, roleID, "audit.reasons.no_linked_account")
+		}
+	} else if !unverified && hasRole {
+		zap.L().Info("removing unverified role", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.String("role id", roleID))
+		err = o.discord.GuildMemberRoleRemove(member.GuildID, member.User.ID, roleID)
+		if err == nil {
+			o.audit.RoleRemoved(member.GuildID, member.User.ID, roleID, "audit.reasons.linked_account")
+		}
+	}
+	if err != nil {
+		zap.L().Error("unable to update unverified role", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.String("role id", roleID), zap.Error(err))
+	}
+}
+
+// dueReminder returns the number of the reminder due for a member who joined at joinedAt, counting from 1, or 0 if no
+// reminder is due. Only the reminder of the current interval is due, so members who have been on the server for longer
+// than all the reminders, e.g. when reminders are enabled, are not reminded, and reminders missed while the bot was
+// offline are not caught up on
+func dueReminder(joinedAt time.Time, now time.Time, interval time.Duration, maxReminders int) int {
+	if interval <= 0 || maxReminders <= 0 || joinedAt.IsZero() {
+		return 0
+	}
+	due := int(now.Sub(joinedAt) / interval)
+	if due > maxReminders {
+		return 0
+	}
+	return due
+}
+
+func reminderKey(guildID string, userID string) string {
+	return guildID + ":" + userID
+}
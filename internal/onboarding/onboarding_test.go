@@ -0,0 +1,34 @@
+package onboarding
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDueReminder(t *testing.T) {
+	g := NewGomegaWithT(t)
+	now := time.Now()
+	interval := 24 * time.Hour
+
+	tests := []struct {
+		name         string
+		joinedAt     time.Time
+		interval     time.Duration
+		maxReminders int
+		expected     int
+	}{
+		{name: "just joined", joinedAt: now.Add(-time.Hour), interval: interval, maxReminders: 3, expected: 0},
+		{name: "first interval", joinedAt: now.Add(-25 * time.Hour), interval: interval, maxReminders: 3, expected: 1},
+		{name: "current interval only", joinedAt: now.Add(-73 * time.Hour), interval: interval, maxReminders: 3, expected: 3},
+		{name: "past all reminders", joinedAt: now.Add(-97 * time.Hour), interval: interval, maxReminders: 3, expected: 0},
+		{name: "long standing member", joinedAt: now.Add(-365 * 24 * time.Hour), interval: interval, maxReminders: 3, expected: 0},
+		{name: "reminders disabled", joinedAt: now.Add(-25 * time.Hour), interval: interval, maxReminders: 0, expected: 0},
+		{name: "no interval", joinedAt: now.Add(-25 * time.Hour), interval: 0, maxReminders: 3, expected: 0},
+		{name: "unknown join time", interval: interval, maxReminders: 3, expected: 0},
+	}
+	for _, test := range tests {
+		g.Expect(dueReminder(test.joinedAt, now, test.interval, test.maxReminders)).To(Equal(test.expected), test.name)
+	}
+}
@@ -0,0 +1,394 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/discord"
+	"github.com/vennekilde/gw2-alliance-bot/internal/store"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+	"go.uber.org/zap"
+)
+
+// Values of backend.SettingPolicyAction
+const (
+	ActionOff        = backend.PolicyActionOff
+	ActionQuarantine = backend.PolicyActionQuarantine
+	ActionKick       = backend.PolicyActionKick
+)
+
+// DefaultGraceHours is the time between warning a member and acting on them, if not configured
+const DefaultGraceHours = backend.DefaultPolicyGraceHours
+
+type Reason int
+
+const (
+	ReasonNone Reason = iota
+	// ReasonUnverified means the member has not linked an account within the allowed number of days
+	ReasonUnverified
+	// ReasonExpired means all accounts linked by the member have expired
+	ReasonExpired
+)
+
+// VerifyInstructionsFunc builds the instructions sent to members, explaining how to verify on the server
+type VerifyInstructionsFunc func(guildID string, userID string) ([]*discordgo.MessageEmbed, []discordgo.MessageComponent)
+
+// Rules are the policy settings of a server
+type Rules struct {
+	Action         string
+	UnverifiedDays int
+	Expired        bool
+	QuarantineRole string
+	ExemptRoles    []string
+	GraceHours     int
+}
+
+// Enabled checks if the rules can affect any members
+func (r Rules) Enabled() bool {
+	if r.Action != ActionQuarantine && r.Action != ActionKick {
+		return false
+	}
+	if r.Action == ActionQuarantine && r.QuarantineRole == "" {
+		return false
+	}
+	return r.UnverifiedDays > 0 || r.Expired
+}
+
+// Evaluate determines if the member violates the rules
+func (r Rules) Evaluate(member *discordgo.Member, user *api.User, now time.Time) Reason {
+	if !r.Enabled() || (member.User != nil && member.User.Bot) {
+		return ReasonNone
+	}
+	for _, roleID := range r.ExemptRoles {
+		if slices.Contains(member.Roles, roleID) {
+			return ReasonNone
+		}
+	}
+
+	if user == nil || len(user.Accounts) == 0 {
+		if r.UnverifiedDays > 0 && !member.JoinedAt.IsZero() && now.Sub(member.JoinedAt) >= time.Duration(r.UnverifiedDays)*24*time.Hour {
+			return ReasonUnverified
+		}
+		return ReasonNone
+	}
+
+	if r.Expired && len(api.ActiveAccounts(user.Accounts)) == 0 {
+		return ReasonExpired
+	}
+	return ReasonNone
+}
+
+// Violation is a member affected by the rules of a server
+type Violation struct {
+	Member *discordgo.Member
+	Reason Reason
+}
+
+// step is what Enforce does with a member
+type step int
+
+const (
+	stepNothing step = iota
+	// stepRelease removes the quarantine role from the member
+	stepRelease
+	// stepWarn warns the member about the action that will be taken
+	stepWarn
+	// stepEnforce quarantines or kicks the member
+	stepEnforce
+)
+
+// warning is sent to members violating the rules, before they are acted on
+type warning struct {
+	At time.Time
+	// Undeliverable is set if the member does not accept direct messages from the bot. The member is still acted on
+	// once the grace period is over, as there is no way to reach them
+	Undeliverable bool
+}
+
+// nextStep determines what to do with a member violating the rules for the reason, given whether the member is in
+// quarantine and the warning sent to the member, if any. Members are only acted on once a warning has been sent, or
+// found to be undeliverable, and the grace period since has passed
+func nextStep(rules Rules, reason Reason, quarantined bool, warned *warning, now time.Time) step {
+	if reason == ReasonNone {
+		if quarantined {
+			return stepRelease
+		}
+		return stepNothing
+	}
+	if rules.Action == ActionQuarantine && quarantined {
+		return stepNothing
+	}
+	if warned == nil {
+		return stepWarn
+	}
+	if now.Sub(warned.At) < time.Duration(rules.GraceHours)*time.Hour {
+		return stepNothing
+	}
+	return stepEnforce
+}
+
+// releaseReason returns the audit reason for removing the quarantine role from a member
+func releaseReason(rules Rules) string {
+	if !rules.Enabled() {
+		return "audit.reasons.policy_disabled"
+	}
+	return "audit.reasons.policy_compliant"
+}
+
+// evaluation is the member and linked accounts the policy was last enforced with
+type evaluation struct {
+	member *discordgo.Member
+	user   *api.User
+}
+
+// Policy quarantines or kicks members who stay unverified, after warning them
+type Policy struct {
+	m                  sync.Mutex
+	discord            *discordgo.Session
+	service            *backend.Service
+	verifyInstructions VerifyInstructionsFunc
+	audit              *audit.Log
+
+	// warned keeps track of the warnings sent to members about violating the rules, so the grace period is not
+	// restarted after a restart
+	warned *store.Store[warning]
+	// evaluated keeps the members the policy was last enforced with, by server, so they can be reported on
+	evaluated map[string]map[string]evaluation
+}
+
+// NewPolicy creates the policy of the servers, with the warnings sent persisted in dataDir.
+// If dataDir is empty, the warnings sent are only kept in memory
+func NewPolicy(discord *discordgo.Session, service *backend.Service, verifyInstructions VerifyInstructionsFunc, auditLog *audit.Log, dataDir string) *Policy {
+	path := ""
+	if dataDir != "" {
+		path = filepath.Join(dataDir, "policy_warnings.json")
+	}
+	warned, err := store.Open[warning](path, 0)
+	if err != nil {
+		zap.L().Error("unable to load policy warnings, starting without any", zap.String("path", path), zap.Error(err))
+		warned, _ = store.Open[warning]("", 0)
+	}
+
+	p := &Policy{
+		discord:            discord,
+		service:            service,
+		verifyInstructions: verifyInstructions,
+		audit:              auditLog,
+		warned:             warned,
+		evaluated:          make(map[string]map[string]evaluation),
+	}
+	if discord != nil {
+		discord.AddHandler(p.onGuildMemberRemove)
+	}
+	return p
+}
+
+func (p *Policy) onGuildMemberRemove(s *discordgo.Session, event *discordgo.GuildMemberRemove) {
+	if event.Member == nil || event.Member.User == nil {
+		return
+	}
+	p.forget(event.GuildID, event.Member.User.ID)
+	p.m.Lock()
+	defer p.m.Unlock()
+	delete(p.evaluated[event.GuildID], event.Member.User.ID)
+}
+
+// forget removes the warning sent to the member
+func (p *Policy) forget(guildID string, userID string) {
+	key := warningKey(guildID, userID)
+	if _, ok, _ := p.warned.Get(key); !ok {
+		return
+	}
+	p.warned.Delete(key)
+	p.saveWarnings()
+}
+
+func (p *Policy) saveWarnings() {
+	err := p.warned.Save()
+	if err != nil {
+		zap.L().Error("unable to save policy warnings", zap.Error(err))
+	}
+}
+
+// Rules returns the policy settings of the server
+func (p *Policy) Rules(guildID string) Rules {
+	return Rules{
+		Action:         p.service.GetSetting(guildID, backend.SettingPolicyAction),
+		UnverifiedDays: p.service.GetInt(guildID, backend.SettingPolicyUnverifiedDays),
+		Expired:        p.service.GetBool(guildID, backend.SettingPolicyExpired),
+		QuarantineRole: p.service.GetSetting(guildID, backend.SettingPolicyQuarantineRole),
+		ExemptRoles:    p.service.GetRoles(guildID, backend.SettingPolicyExemptRoles),
+		GraceHours:     p.service.GetInt(guildID, backend.SettingPolicyGraceHours),
+	}
+}
+
+// Enforce warns members who violate the rules of the server, and quarantines or kicks them if they still do once the grace period is over.
+// Members who no longer violate the rules, or are on a server that no longer has a policy, are released from quarantine
+func (p *Policy) Enforce(member *discordgo.Member, user *api.User) {
+	rules := p.Rules(member.GuildID)
+	now := time.Now()
+	reason := rules.Evaluate(member, user, now)
+	quarantined := rules.QuarantineRole != "" && slices.Contains(member.Roles, rules.QuarantineRole)
+
+	p.m.Lock()
+	if p.evaluated[member.GuildID] == nil {
+		p.evaluated[member.GuildID] = make(map[string]evaluation)
+	}
+	p.evaluated[member.GuildID][member.User.ID] = evaluation{member: member, user: user}
+	p.m.Unlock()
+
+	if reason == ReasonNone {
+		p.forget(member.GuildID, member.User.ID)
+	}
+	var warned *warning
+	if w, ok, _ := p.warned.Get(warningKey(member.GuildID, member.User.ID)); ok {
+		warned = &w
+	}
+
+	var err error
+	switch nextStep(rules, reason, quarantined, warned, now) {
+	case stepRelease:
+		auditReason := releaseReason(rules)
+		zap.L().Info("releasing member from quarantine", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.String("reason", auditReason))
+		err = p.discord.GuildMemberRoleRemove(member.GuildID, member.User.ID, rules.QuarantineRole, discordgo.WithAuditLogReason(resources.T(auditReason)))
+		if err == nil {
+			p.audit.RoleRemoved(member.GuildID, member.User.ID, rules.QuarantineRole, auditReason)
+		}
+	case stepWarn:
+		p.sendWarning(member, reason, rules, now)
+	case stepEnforce:
+		err = p.act(member, reason, rules)
+		if err == nil && rules.Action == ActionKick {
+			p.forget(member.GuildID, member.User.ID)
+		}
+	}
+	if err != nil {
+		zap.L().Error("unable to enforce policy", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.String("action", rules.Action), zap.Error(err))
+	}
+}
+
+// sendWarning warns the member, and records the warning if it was delivered, or can never be delivered.
+// Warnings that fail for other reasons are sent again the next time the member is checked
+func (p *Policy) sendWarning(member *discordgo.Member, reason Reason, rules Rules, now time.Time) {
+	err := p.warn(member, reason, rules, now.Add(time.Duration(rules.GraceHours)*time.Hour))
+	if err != nil && !isUndeliverable(err) {
+		zap.L().Warn("unable to warn member, retrying later", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.Error(err))
+		return
+	}
+	if err != nil {
+		zap.L().Info("member does not accept direct messages, acting without a warning once the grace period is over",
+			zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.Error(err))
+	}
+
+	p.warned.Set(warningKey(member.GuildID, member.User.ID), warning{At: now, Undeliverable: err != nil})
+	p.saveWarnings()
+}
+
+func warningKey(guildID string, userID string) string {
+	return guildID + ":" + userID
+}
+
+// isUndeliverable checks if the error means the user does not accept direct messages from the bot
+func isUndeliverable(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeCannotSendMessagesToThisUser
+}
+
+// act quarantines or kicks the member, as configured by the rules
+func (p *Policy) act(member *discordgo.Member, reason Reason, rules Rules) error {
+	auditReason := discordgo.WithAuditLogReason(resources.T(ReasonKey(reason)))
+	switch rules.Action {
+	case ActionQuarantine:
+		zap.L().Info("quarantining member", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.Int("reason", int(reason)))
+		err := p.discord.GuildMemberRoleAdd(member.GuildID, member.User.ID, rules.QuarantineRole, auditReason)
+		if err != nil {
+			return err
+		}
+		p.audit.RoleAdded(member.GuildID, member.User.ID, rules.QuarantineRole, ReasonKey(reason))
+	case ActionKick:
+		zap.L().Info("kicking member", zap.String("guild id", member.GuildID), zap.String("user id", member.User.ID), zap.Int("reason", int(reason)))
+		err := p.discord.GuildMemberDeleteWithReason(member.GuildID, member.User.ID, resources.T(ReasonKey(reason)))
+		if err != nil {
+			return err
+		}
+		p.audit.Kicked(member.GuildID, member.User.ID, ReasonKey(reason))
+	}
+	return nil
+}
+
+func (p *Policy) warn(member *discordgo.Member, reason Reason, rules Rules, deadline time.Time) error {
+	channel, err := p.discord.UserChannelCreate(member.User.ID)
+	if err != nil {
+		return err
+	}
+
+	// Direct messages are not sent in response to an interaction, so use the server locale
+	locale := discord.GuildLocale(p.discord, member.GuildID)
+	serverName := discord.GuildName(p.discord, member.GuildID)
+
+	actionKey := "policy.warning.action_quarantine"
+	if rules.Action == ActionKick {
+		actionKey = "policy.warning.action_kick"
+	}
+
+	content := resources.TL(locale, "policy.warning.content", resources.TData(
+		"server", serverName,
+		"reason", resources.TL(locale, ReasonKey(reason)),
+		"action", resources.TL(locale, actionKey, resources.TData("deadline", fmt.Sprintf("<t:%d:R>", deadline.Unix()))),
+	))
+
+	embeds, components := p.verifyInstructions(member.GuildID, member.User.ID)
+	_, err = p.discord.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+		Content:    content,
+		Embeds:     embeds,
+		Components: components,
+	})
+	return err
+}
+
+// Report lists the members of the server that currently violate the rules, without acting on them.
+// Members are evaluated with the accounts they had when they were last checked, so no requests are made to the backend.
+// Checked is the number of members that have been checked, as members are only known once the bot has checked them
+func (p *Policy) Report(guildID string) (violations []Violation, checked int) {
+	rules := p.Rules(guildID)
+	p.m.Lock()
+	defer p.m.Unlock()
+	evaluated := p.evaluated[guildID]
+	if !rules.Enabled() {
+		return nil, len(evaluated)
+	}
+
+	now := time.Now()
+	violations = []Violation{}
+	for _, evaluation := range evaluated {
+		reason := rules.Evaluate(evaluation.member, evaluation.user, now)
+		if reason != ReasonNone {
+			violations = append(violations, Violation{Member: evaluation.member, Reason: reason})
+		}
+	}
+	slices.SortFunc(violations, func(a, b Violation) int {
+		return strings.Compare(a.Member.User.ID, b.Member.User.ID)
+	})
+	return violations, len(evaluated)
+}
+
+// ReasonKey returns the translation key describing why a member violates the rules
+func ReasonKey(reason Reason) string {
+	switch reason {
+	case ReasonUnverified:
+		return "policy.reasons.unverified"
+	case ReasonExpired:
+		return "policy.reasons.expired"
+	default:
+		return "policy.reasons.none"
+	}
+}
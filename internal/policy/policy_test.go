@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+)
+
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func testRules() Rules {
+	return Rules{
+		Action:         ActionKick,
+		UnverifiedDays: 7,
+		Expired:        true,
+		ExemptRoles:    []string{"exempt"},
+		GraceHours:     DefaultGraceHours,
+	}
+}
+
+func testMember(joinedDaysAgo int, roles ...string) *discordgo.Member {
+	return &discordgo.Member{
+		User:     &discordgo.User{ID: "1"},
+		JoinedAt: now.Add(-time.Duration(joinedDaysAgo) * 24 * time.Hour),
+		Roles:    roles,
+	}
+}
+
+func TestEvaluateUnverified(t *testing.T) {
+	g := NewGomegaWithT(t)
+	rules := testRules()
+	g.Expect(rules.Evaluate(testMember(8), nil, now)).To(Equal(ReasonUnverified))
+	g.Expect(rules.Evaluate(testMember(8), &api.User{}, now)).To(Equal(ReasonUnverified))
+}
+
+func TestEvaluateUnverifiedWithinDays(t *testing.T) {
+	g := NewGomegaWithT(t)
+	rules := testRules()
+	g.Expect(rules.Evaluate(testMember(6), nil, now)).To(Equal(ReasonNone))
+}
+
+func TestEvaluateExpired(t *testing.T) {
+	g := NewGomegaWithT(t)
+	rules := testRules()
+	expired := true
+	user := &api.User{
+		Accounts: []api.Account{
+			{Name: "Expired.1234", Expired: &expired},
+		},
+	}
+	g.Expect(rules.Evaluate(testMember(1), user, now)).To(Equal(ReasonExpired))
+
+	rules.Expired = false
+	g.Expect(rules.Evaluate(testMember(1), user, now)).To(Equal(ReasonNone))
+}
+
+func TestEvaluateActiveAccount(t *testing.T) {
+	g := NewGomegaWithT(t)
+	rules := testRules()
+	expired := true
+	user := &api.User{
+		Accounts: []api.Account{
+			{Name: "Expired.1234", Expired: &expired},
+			{Name: "Active.1234"},
+		},
+	}
+	g.Expect(rules.Evaluate(testMember(30), user, now)).To(Equal(ReasonNone))
+}
+
+func TestEvaluateExempt(t *testing.T) {
+	g := NewGomegaWithT(t)
+	rules := testRules()
+	g.Expect(rules.Evaluate(testMember(30, "exempt"), nil, now)).To(Equal(ReasonNone))
+}
+
+func TestEvaluateDisabled(t *testing.T) {
+	g := NewGomegaWithT(t)
+	rules := testRules()
+	rules.Action = ActionOff
+	g.Expect(rules.Evaluate(testMember(30), nil, now)).To(Equal(ReasonNone))
+
+	// Quarantine is not possible without a role
+	rules.Action = ActionQuarantine
+	g.Expect(rules.Evaluate(testMember(30), nil, now)).To(Equal(ReasonNone))
+}
+
+func TestNextStep(t *testing.T) {
+	g := NewGomegaWithT(t)
+	grace := time.Duration(DefaultGraceHours) * time.Hour
+	quarantine := testRules()
+	quarantine.Action = ActionQuarantine
+	quarantine.QuarantineRole = "quarantine"
+
+	tests := []struct {
+		name        string
+		rules       Rules
+		reason      Reason
+		quarantined bool
+		warned      *warning
+		expected    step
+	}{
+		{name: "compliant", rules: testRules(), reason: ReasonNone, expected: stepNothing},
+		{name: "violation is warned first", rules: testRules(), reason: ReasonUnverified, expected: stepWarn},
+		{name: "waits for the grace period", rules: testRules(), reason: ReasonUnverified, warned: &warning{At: now.Add(-grace + time.Minute)}, expected: stepNothing},
+		{name: "enforced after the grace period", rules: testRules(), reason: ReasonUnverified, warned: &warning{At: now.Add(-grace)}, expected: stepEnforce},
+		{name: "undeliverable warning is enforced after the grace period", rules: testRules(), reason: ReasonExpired, warned: &warning{At: now.Add(-grace), Undeliverable: true}, expected: stepEnforce},
+		{name: "undeliverable warning waits for the grace period", rules: testRules(), reason: ReasonExpired, warned: &warning{At: now, Undeliverable: true}, expected: stepNothing},
+		{name: "already quarantined", rules: quarantine, reason: ReasonUnverified, quarantined: true, expected: stepNothing},
+		{name: "quarantined after the grace period", rules: quarantine, reason: ReasonUnverified, warned: &warning{At: now.Add(-grace)}, expected: stepEnforce},
+		{name: "released when compliant", rules: quarantine, reason: ReasonNone, quarantined: true, expected: stepRelease},
+	}
+	for _, test := range tests {
+		g.Expect(nextStep(test.rules, test.reason, test.quarantined, test.warned, now)).To(Equal(test.expected), test.name)
+	}
+}
+
+func TestNextStepDisabled(t *testing.T) {
+	g := NewGomegaWithT(t)
+	rules := testRules()
+	rules.Action = ActionOff
+	rules.QuarantineRole = "quarantine"
+	member := testMember(30, "quarantine")
+
+	// Disabled rules are never violated, so quarantined members are released with a reason saying why
+	reason := rules.Evaluate(member, nil, now)
+	g.Expect(reason).To(Equal(ReasonNone))
+	g.Expect(nextStep(rules, reason, true, nil, now)).To(Equal(stepRelease))
+	g.Expect(releaseReason(rules)).To(Equal("audit.reasons.policy_disabled"))
+	g.Expect(nextStep(rules, reason, false, nil, now)).To(Equal(stepNothing))
+
+	rules.Action = ActionQuarantine
+	g.Expect(releaseReason(rules)).To(Equal("audit.reasons.policy_compliant"))
+}
+
+func TestReport(t *testing.T) {
+	g := NewGomegaWithT(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client, err := api.NewClientWithResponses(server.URL)
+	g.Expect(err).ToNot(HaveOccurred())
+	service := backend.NewService(client, "service", nil)
+
+	p := NewPolicy(nil, service, nil, nil, "")
+	p.evaluated["guild"] = map[string]evaluation{
+		"1": {member: &discordgo.Member{User: &discordgo.User{ID: "1"}, JoinedAt: time.Now().Add(-30 * 24 * time.Hour)}},
+		"2": {member: &discordgo.Member{User: &discordgo.User{ID: "2"}, JoinedAt: time.Now().Add(-30 * 24 * time.Hour)}, user: &api.User{Accounts: []api.Account{{Name: "Active.1234"}}}},
+	}
+
+	// Nothing is reported while the policy is disabled
+	violations, checked := p.Report("guild")
+	g.Expect(violations).To(BeEmpty())
+	g.Expect(checked).To(Equal(2))
+
+	ctx := context.Background()
+	g.Expect(service.SetSetting(ctx, "guild", backend.SettingPolicyAction, ActionKick)).To(Succeed())
+	g.Expect(service.SetSetting(ctx, "guild", backend.SettingPolicyUnverifiedDays, "7")).To(Succeed())
+	violations, checked = p.Report("guild")
+	g.Expect(checked).To(Equal(2))
+	g.Expect(violations).To(HaveLen(1))
+	g.Expect(violations[0].Member.User.ID).To(Equal("1"))
+	g.Expect(violations[0].Reason).To(Equal(ReasonUnverified))
+
+	// Members who leave are no longer reported
+	p.onGuildMemberRemove(nil, &discordgo.GuildMemberRemove{Member: &discordgo.Member{GuildID: "guild", User: &discordgo.User{ID: "1"}}})
+	violations, checked = p.Report("guild")
+	g.Expect(violations).To(BeEmpty())
+	g.Expect(checked).To(Equal(1))
+}
+
+func TestWarningsPersisted(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := t.TempDir()
+
+	p := NewPolicy(nil, nil, nil, nil, dir)
+	p.warned.Set(warningKey("guild", "1"), warning{At: now, Undeliverable: true})
+	p.saveWarnings()
+
+	// The grace period continues after a restart
+	p = NewPolicy(nil, nil, nil, nil, dir)
+	warned, ok, _ := p.warned.Get(warningKey("guild", "1"))
+	g.Expect(ok).To(BeTrue())
+	g.Expect(warned.At.Equal(now)).To(BeTrue())
+	g.Expect(warned.Undeliverable).To(BeTrue())
+
+	// Members who leave start over when they join again
+	p.onGuildMemberRemove(nil, &discordgo.GuildMemberRemove{Member: &discordgo.Member{GuildID: "guild", User: &discordgo.User{ID: "1"}}})
+	p = NewPolicy(nil, nil, nil, nil, dir)
+	_, ok, _ = p.warned.Get(warningKey("guild", "1"))
+	g.Expect(ok).To(BeFalse())
+}
@@ -0,0 +1,195 @@
+package reconcile
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Task is a request to reconcile the roles, nick and onboarding state of a member
+type Task struct {
+	GuildID string
+	UserID  string
+	// PreferredRole is a guild role the member picked themselves, which is kept if only one guild role can be represented
+	PreferredRole string
+	// batches are the batches waiting for the member to be processed
+	batches []*Batch
+}
+
+// Batch tracks the members enqueued together, e.g. after a setting changed, so progress can be reported on those
+// members alone, rather than on every member of the server waiting to be processed
+type Batch struct {
+	m     sync.Mutex
+	total int
+	done  int
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Progress returns the number of members of the batch that have been processed, and the number of members in the batch
+func (b *Batch) Progress() (done int, total int) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.done, b.total
+}
+
+func (b *Batch) add() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.total++
+}
+
+func (b *Batch) finish() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.done++
+}
+
+type batchKey struct{}
+
+// WithBatch returns a context carrying the batch that members enqueued because of a change made with the context are added to
+func WithBatch(ctx context.Context, batch *Batch) context.Context {
+	return context.WithValue(ctx, batchKey{}, batch)
+}
+
+// BatchFrom returns the batch carried by the context, if any
+func BatchFrom(ctx context.Context) *Batch {
+	batch, _ := ctx.Value(batchKey{}).(*Batch)
+	return batch
+}
+
+func (t Task) key() string {
+	return t.GuildID + ":" + t.UserID
+}
+
+// Queue is a work queue keyed by member.
+// Enqueuing a member that is already pending does not add more work, and a member is never processed by two workers at once.
+// A member enqueued while being processed is processed again afterwards, so changes made in the meantime are not missed
+type Queue struct {
+	m       sync.Mutex
+	cond    *sync.Cond
+	order   []string
+	pending map[string]Task
+	running map[string]bool
+	// guilds counts the pending and running members of each guild
+	guilds  map[string]int
+	process func(task Task)
+}
+
+func NewQueue(process func(task Task)) *Queue {
+	q := &Queue{
+		pending: make(map[string]Task),
+		running: make(map[string]bool),
+		guilds:  make(map[string]int),
+		process: process,
+	}
+	q.cond = sync.NewCond(&q.m)
+	return q
+}
+
+// Start begins processing the queue with the given number of workers
+func (q *Queue) Start(workers int) {
+	for range workers {
+		go q.work()
+	}
+}
+
+// Enqueue schedules the member to be processed, unless it is already pending
+func (q *Queue) Enqueue(task Task) {
+	q.EnqueueBatch(nil, task)
+}
+
+// EnqueueBatch schedules the member to be processed as part of the batch, unless it is already pending.
+// A member that is already pending is added to the batch, and the batch is done with it once it has been processed
+func (q *Queue) EnqueueBatch(batch *Batch, task Task) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	key := task.key()
+	existing, ok := q.pending[key]
+	task.batches = existing.batches
+	if batch != nil && !slices.Contains(task.batches, batch) {
+		task.batches = append(slices.Clone(task.batches), batch)
+		batch.add()
+	}
+	if ok {
+		// Keep the role the member picked, unless they picked another one since
+		if task.PreferredRole == "" {
+			task.PreferredRole = existing.PreferredRole
+		}
+		q.pending[key] = task
+		return
+	}
+
+	q.pending[key] = task
+	q.order = append(q.order, key)
+	q.guilds[task.GuildID]++
+	q.cond.Signal()
+}
+
+// Len returns the number of pending members
+func (q *Queue) Len() int {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return len(q.pending)
+}
+
+// Pending returns the number of members of the guild that are pending or being processed
+func (q *Queue) Pending(guildID string) int {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return q.guilds[guildID]
+}
+
+func (q *Queue) work() {
+	for {
+		task := q.next()
+		q.process(task)
+		q.done(task)
+	}
+}
+
+// next blocks until a pending member, which is not being processed by another worker, is available
+func (q *Queue) next() Task {
+	q.m.Lock()
+	defer q.m.Unlock()
+	for {
+		task, ok := q.take()
+		if ok {
+			return task
+		}
+		q.cond.Wait()
+	}
+}
+
+// take removes the first pending member, which is not being processed, from the queue
+func (q *Queue) take() (Task, bool) {
+	for i, key := range q.order {
+		if q.running[key] {
+			continue
+		}
+		task := q.pending[key]
+		delete(q.pending, key)
+		q.order = append(q.order[:i], q.order[i+1:]...)
+		q.running[key] = true
+		return task, true
+	}
+	return Task{}, false
+}
+
+func (q *Queue) done(task Task) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	delete(q.running, task.key())
+	for _, batch := range task.batches {
+		batch.finish()
+	}
+	q.guilds[task.GuildID]--
+	if q.guilds[task.GuildID] == 0 {
+		delete(q.guilds, task.GuildID)
+	}
+	// The member may have been enqueued again while it was processed
+	q.cond.Broadcast()
+}
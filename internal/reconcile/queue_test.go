@@ -0,0 +1,106 @@
+package reconcile
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestQueueDeduplicates(t *testing.T) {
+	g := NewGomegaWithT(t)
+	q := NewQueue(nil)
+
+	q.Enqueue(Task{GuildID: "1", UserID: "a", PreferredRole: "role"})
+	q.Enqueue(Task{GuildID: "1", UserID: "a"})
+	q.Enqueue(Task{GuildID: "1", UserID: "b"})
+	q.Enqueue(Task{GuildID: "2", UserID: "a"})
+	g.Expect(q.Len()).To(Equal(3))
+	g.Expect(q.Pending("1")).To(Equal(2))
+
+	task, ok := q.take()
+	g.Expect(ok).To(BeTrue())
+	g.Expect(task).To(Equal(Task{GuildID: "1", UserID: "a", PreferredRole: "role"}))
+	g.Expect(q.Len()).To(Equal(2))
+}
+
+func TestQueueSkipsRunningMembers(t *testing.T) {
+	g := NewGomegaWithT(t)
+	q := NewQueue(nil)
+
+	q.Enqueue(Task{GuildID: "1", UserID: "a"})
+	first, _ := q.take()
+
+	// Enqueued again while being processed, so it must wait for the first run to finish
+	q.Enqueue(Task{GuildID: "1", UserID: "a"})
+	q.Enqueue(Task{GuildID: "1", UserID: "b"})
+
+	task, ok := q.take()
+	g.Expect(ok).To(BeTrue())
+	g.Expect(task.UserID).To(Equal("b"))
+	_, ok = q.take()
+	g.Expect(ok).To(BeFalse())
+
+	// Counts the run in progress and the pending run of the same member
+	g.Expect(q.Pending("1")).To(Equal(3))
+
+	q.done(first)
+	task, ok = q.take()
+	g.Expect(ok).To(BeTrue())
+	g.Expect(task.UserID).To(Equal("a"))
+	g.Expect(q.Pending("1")).To(Equal(2))
+}
+
+func TestQueueProcessesEnqueuedMembers(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var wg sync.WaitGroup
+	var processed []string
+	var m sync.Mutex
+	q := NewQueue(func(task Task) {
+		m.Lock()
+		processed = append(processed, task.UserID)
+		m.Unlock()
+		wg.Done()
+	})
+	q.Start(2)
+
+	wg.Add(2)
+	q.Enqueue(Task{GuildID: "1", UserID: "a"})
+	q.Enqueue(Task{GuildID: "1", UserID: "b"})
+	wg.Wait()
+
+	g.Expect(processed).To(ConsistOf("a", "b"))
+	g.Expect(q.Len()).To(BeZero())
+}
+
+func TestQueueBatch(t *testing.T) {
+	g := NewGomegaWithT(t)
+	q := NewQueue(nil)
+	batch := NewBatch()
+
+	// Members enqueued by other work are not part of the batch
+	q.Enqueue(Task{GuildID: "1", UserID: "sweep"})
+	q.EnqueueBatch(batch, Task{GuildID: "1", UserID: "a"})
+	q.EnqueueBatch(batch, Task{GuildID: "1", UserID: "a"})
+	q.EnqueueBatch(batch, Task{GuildID: "1", UserID: "b"})
+	// A pending member joins the batch
+	q.EnqueueBatch(batch, Task{GuildID: "1", UserID: "sweep"})
+	done, total := batch.Progress()
+	g.Expect(done).To(Equal(0))
+	g.Expect(total).To(Equal(3))
+	g.Expect(q.Pending("1")).To(Equal(3))
+
+	for range 3 {
+		task, ok := q.take()
+		g.Expect(ok).To(BeTrue())
+		q.done(task)
+	}
+	done, total = batch.Progress()
+	g.Expect(done).To(Equal(3))
+	g.Expect(total).To(Equal(3))
+
+	g.Expect(BatchFrom(WithBatch(context.Background(), batch))).To(BeIdenticalTo(batch))
+	g.Expect(BatchFrom(context.Background())).To(BeNil())
+}
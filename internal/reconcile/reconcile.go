@@ -0,0 +1,56 @@
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
+)
+
+// Decision is the outcome of the rules for a single role managed by the bot
+type Decision struct {
+	RoleID string
+	// Has is true if the member currently has the role
+	Has bool
+	// Want is true if the member should have the role
+	Want bool
+	// Reason is the translation key explaining the decision, with ReasonData as template data
+	Reason     string
+	ReasonData map[string]interface{}
+}
+
+// Changed reports if the role has to be added or removed
+func (d Decision) Changed() bool {
+	return d.Has != d.Want
+}
+
+// Apply adds and removes roles, so the member has the roles the decisions want them to have, and returns the decisions
+// that changed a role. All decisions are attempted, even if some of them fail
+func Apply(discord *discordgo.Session, auditLog *audit.Log, guildID string, userID string, decisions []Decision) ([]Decision, error) {
+	var applied []Decision
+	var errs []error
+	for _, decision := range decisions {
+		if !decision.Changed() {
+			continue
+		}
+
+		if decision.Want {
+			err := discord.GuildMemberRoleAdd(guildID, userID, decision.RoleID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to add role %s: %w", decision.RoleID, err))
+				continue
+			}
+			auditLog.RoleAdded(guildID, userID, decision.RoleID, decision.Reason, decision.ReasonData)
+		} else {
+			err := discord.GuildMemberRoleRemove(guildID, userID, decision.RoleID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to remove role %s: %w", decision.RoleID, err))
+				continue
+			}
+			auditLog.RoleRemoved(guildID, userID, decision.RoleID, decision.Reason, decision.ReasonData)
+		}
+		applied = append(applied, decision)
+	}
+	return applied, errors.Join(errs...)
+}
@@ -0,0 +1,62 @@
+package reconcile
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+)
+
+// Targets returns the ids of the members that have to be re-evaluated, after the setting changed from oldValue to newValue.
+// setting returns the current value of another setting of the server
+func Targets(members []*discordgo.Member, name string, oldValue string, newValue string, setting func(name string) string) []string {
+	definition, ok := backend.LookupSetting(name)
+	if oldValue == newValue || !ok || !definition.AffectsMembers {
+		return nil
+	}
+
+	switch {
+	case definition.Type == backend.SettingTypeRole && oldValue != "":
+		// Everyone entitled to a single role already has it, so only the members holding the old role have to move to the new one
+		return membersWithAnyRole(members, []string{oldValue})
+	case name == backend.SettingGuildVerifyRoles && oldValue != "" && newValue != "":
+		// Members in guild roles that were allowed or disallowed, and members that may lose the verification role.
+		// An empty list allows every guild, in which case every member may be affected
+		oldRoles := strings.Split(oldValue, ",")
+		newRoles := strings.Split(newValue, ",")
+		var roles []string
+		for _, roleID := range oldRoles {
+			if !slices.Contains(newRoles, roleID) {
+				roles = append(roles, roleID)
+			}
+		}
+		for _, roleID := range newRoles {
+			if !slices.Contains(oldRoles, roleID) {
+				roles = append(roles, roleID)
+			}
+		}
+		if verificationRole := setting(backend.SettingGuildCommonRole); verificationRole != "" {
+			roles = append(roles, verificationRole)
+		}
+		return membersWithAnyRole(members, roles)
+	default:
+		userIDs := make([]string, len(members))
+		for i, member := range members {
+			userIDs[i] = member.User.ID
+		}
+		return userIDs
+	}
+}
+
+func membersWithAnyRole(members []*discordgo.Member, roles []string) []string {
+	var userIDs []string
+	for _, member := range members {
+		if slices.ContainsFunc(member.Roles, func(roleID string) bool {
+			return slices.Contains(roles, roleID)
+		}) {
+			userIDs = append(userIDs, member.User.ID)
+		}
+	}
+	return userIDs
+}
@@ -0,0 +1,45 @@
+package reconcile
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+)
+
+func testMembers() []*discordgo.Member {
+	member := func(id string, roles ...string) *discordgo.Member {
+		return &discordgo.Member{User: &discordgo.User{ID: id}, Roles: roles}
+	}
+	return []*discordgo.Member{
+		member("1", "verified", "guildA"),
+		member("2", "guildB"),
+		member("3", "primary"),
+		member("4"),
+	}
+}
+
+func TestTargets(t *testing.T) {
+	g := NewGomegaWithT(t)
+	settings := map[string]string{
+		backend.SettingGuildCommonRole: "verified",
+	}
+	setting := func(name string) string {
+		return settings[name]
+	}
+
+	// Unchanged or unrelated settings affect no one
+	g.Expect(Targets(testMembers(), backend.SettingPrimaryRole, "primary", "primary", setting)).To(BeEmpty())
+	g.Expect(Targets(testMembers(), backend.SettingAuditChannel, "", "channel", setting)).To(BeEmpty())
+
+	// Replacing a role affects its holders, while configuring it for the first time affects everyone
+	g.Expect(Targets(testMembers(), backend.SettingPrimaryRole, "primary", "other", setting)).To(Equal([]string{"3"}))
+	g.Expect(Targets(testMembers(), backend.SettingPrimaryRole, "", "primary", setting)).To(HaveLen(4))
+
+	// Changed guild roles affect their members and the verified members
+	g.Expect(Targets(testMembers(), backend.SettingGuildVerifyRoles, "guildA", "guildA,guildB", setting)).To(Equal([]string{"1", "2"}))
+	g.Expect(Targets(testMembers(), backend.SettingGuildVerifyRoles, "", "guildA", setting)).To(HaveLen(4))
+
+	g.Expect(Targets(testMembers(), backend.SettingEnforceGuildRep, "false", "true", setting)).To(HaveLen(4))
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is a value in the store, along with when it was last updated
+type Entry[V any] struct {
+	Value     V         `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store is a key value store kept in memory and persisted to a JSON file, where every entry becomes stale after a while.
+// Stale entries are still returned, so callers can decide if they would rather use a stale value than none at all.
+// A Store without a path is only kept in memory
+type Store[V any] struct {
+	m       sync.RWMutex
+	path    string
+	ttl     time.Duration
+	entries map[string]Entry[V]
+	dirty   bool
+}
+
+// Open loads the store from the file at path, if it exists. If path is empty, the store is only kept in memory
+func Open[V any](path string, ttl time.Duration) (*Store[V], error) {
+	s := &Store[V]{
+		path:    path,
+		ttl:     ttl,
+		entries: make(map[string]Entry[V]),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &s.entries)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the value stored for the key, if any, and whether it is stale
+func (s *Store[V]) Get(key string) (value V, ok bool, stale bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return value, false, false
+	}
+	return entry.Value, true, s.isStale(entry, time.Now())
+}
+
+// Set stores the value for the key
+func (s *Store[V]) Set(key string, value V) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.entries[key] = Entry[V]{
+		Value:     value,
+		UpdatedAt: time.Now(),
+	}
+	s.dirty = true
+}
+
+// Delete removes the key from the store
+func (s *Store[V]) Delete(key string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.entries[key]; ok {
+		delete(s.entries, key)
+		s.dirty = true
+	}
+}
+
+// Range calls fn for every entry in the store, until fn returns false.
+// The store is locked while iterating, so fn must not modify the store
+func (s *Store[V]) Range(fn func(key string, entry Entry[V]) bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	for key, entry := range s.entries {
+		if !fn(key, entry) {
+			return
+		}
+	}
+}
+
+// Stale returns the keys of all stale entries
+func (s *Store[V]) Stale() []string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	now := time.Now()
+	var keys []string
+	for key, entry := range s.entries {
+		if s.isStale(entry, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of entries in the store
+func (s *Store[V]) Len() int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return len(s.entries)
+}
+
+// Save writes the store to its file, if anything changed since it was last saved
+func (s *Store[V]) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !s.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so a crash while writing does not corrupt the store
+	tmp := s.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0o644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		return err
+	}
+
+	s.dirty = false
+	return nil
+}
+
+func (s *Store[V]) isStale(entry Entry[V], now time.Time) bool {
+	return s.ttl > 0 && now.Sub(entry.UpdatedAt) > s.ttl
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestGetSet(t *testing.T) {
+	g := NewGomegaWithT(t)
+	s, err := Open[string]("", time.Hour)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, ok, _ := s.Get("key")
+	g.Expect(ok).To(BeFalse())
+
+	s.Set("key", "value")
+	value, ok, stale := s.Get("key")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(stale).To(BeFalse())
+	g.Expect(value).To(Equal("value"))
+
+	s.Delete("key")
+	_, ok, _ = s.Get("key")
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestStale(t *testing.T) {
+	g := NewGomegaWithT(t)
+	s, err := Open[string]("", time.Hour)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	s.Set("fresh", "value")
+	s.entries["old"] = Entry[string]{Value: "value", UpdatedAt: time.Now().Add(-2 * time.Hour)}
+
+	value, ok, stale := s.Get("old")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(stale).To(BeTrue())
+	g.Expect(value).To(Equal("value"))
+	g.Expect(s.Stale()).To(ConsistOf("old"))
+}
+
+func TestSaveAndOpen(t *testing.T) {
+	g := NewGomegaWithT(t)
+	path := filepath.Join(t.TempDir(), "data", "store.json")
+	s, err := Open[int](path, time.Hour)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	s.Set("a", 1)
+	s.Set("b", 2)
+	g.Expect(s.Save()).To(Succeed())
+
+	reopened, err := Open[int](path, time.Hour)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(reopened.Len()).To(Equal(2))
+	value, ok, stale := reopened.Get("b")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(stale).To(BeFalse())
+	g.Expect(value).To(Equal(2))
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
+)
+
+// EventType is the kind of event, sent in the type field and the X-Webhook-Event header
+type EventType string
+
+const (
+	// EventMemberVerified is sent when a member links an account, or an expired account of theirs works again
+	EventMemberVerified EventType = "member.verified"
+	// EventAccountExpired is sent when the api keys of a linked account stop working
+	EventAccountExpired EventType = "account.expired"
+	// EventGuildRoleGranted and EventGuildRoleRemoved are sent when the guild rules add or remove a role,
+	// i.e. guild roles, the guild verification role and roles removed from members not in a guild
+	EventGuildRoleGranted EventType = "guild_role.granted"
+	EventGuildRoleRemoved EventType = "guild_role.removed"
+	// EventWvWRoleGranted and EventWvWRoleRemoved are sent when the world rules add or remove a role
+	EventWvWRoleGranted EventType = "wvw_role.granted"
+	EventWvWRoleRemoved EventType = "wvw_role.removed"
+	// EventBanApplied is sent when a world role is removed because the account on the world is banned
+	EventBanApplied EventType = "ban.applied"
+	// EventNickChanged is sent when the bot changes the nick of a member
+	EventNickChanged EventType = "nick.changed"
+)
+
+// Event is sent to the webhooks of the server it happened on, as JSON
+type Event struct {
+	ID       string    `json:"id"`
+	Type     EventType `json:"type"`
+	ServerID string    `json:"server_id"`
+	UserID   string    `json:"user_id"`
+	Time     time.Time `json:"time"`
+	// Role is set for role events
+	Role *Role `json:"role,omitempty"`
+	// Accounts are the Guild Wars 2 accounts the event is about, e.g. the expired account
+	Accounts []string    `json:"accounts,omitempty"`
+	Nick     *NickChange `json:"nick,omitempty"`
+	Ban      *Ban        `json:"ban,omitempty"`
+	// Reason explains why the bot made the change
+	Reason *Reason `json:"reason,omitempty"`
+}
+
+type Role struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type NickChange struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type Ban struct {
+	Account string    `json:"account"`
+	Until   time.Time `json:"until"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// Reason is the translation key explaining a change, along with its English text
+type Reason struct {
+	Key  string `json:"key"`
+	Text string `json:"text"`
+}
+
+func newReason(key string, data map[string]interface{}) *Reason {
+	if key == "" {
+		return nil
+	}
+	return &Reason{Key: key, Text: resources.T(key, data)}
+}
+
+// MemberVerified returns the event sent when the member becomes verified with the accounts
+func MemberVerified(guildID string, userID string, accounts []api.Account) Event {
+	event := Event{Type: EventMemberVerified, ServerID: guildID, UserID: userID}
+	for _, account := range accounts {
+		if account.Expired == nil || !*account.Expired {
+			event.Accounts = append(event.Accounts, account.Name)
+		}
+	}
+	return event
+}
+
+// AccountExpired returns the event sent when the account of the member expires
+func AccountExpired(guildID string, userID string, account api.Account) Event {
+	return Event{Type: EventAccountExpired, ServerID: guildID, UserID: userID, Accounts: []string{account.Name}}
+}
+
+// RoleEvents returns the events sent for the roles added or removed by the applied decisions, using granted and removed as event types
+func RoleEvents(granted EventType, removed EventType, guildID string, userID string, applied []reconcile.Decision) []Event {
+	events := make([]Event, 0, len(applied))
+	for _, decision := range applied {
+		eventType := removed
+		if decision.Want {
+			eventType = granted
+		}
+		events = append(events, Event{
+			Type:     eventType,
+			ServerID: guildID,
+			UserID:   userID,
+			Role:     &Role{ID: decision.RoleID},
+			Reason:   newReason(decision.Reason, decision.ReasonData),
+		})
+	}
+	return events
+}
+
+// BanApplied returns the event sent when a world role is removed from the member, because the account is banned
+func BanApplied(guildID string, userID string, roleID string, account api.Account, ban api.Ban) Event {
+	return Event{
+		Type:     EventBanApplied,
+		ServerID: guildID,
+		UserID:   userID,
+		Role:     &Role{ID: roleID},
+		Accounts: []string{account.Name},
+		Ban: &Ban{
+			Account: account.Name,
+			Until:   ban.Until,
+			Reason:  ban.Reason,
+		},
+	}
+}
+
+// NickChanged returns the event sent when the nick of the member is changed
+func NickChanged(guildID string, userID string, before string, after string, reason string, reasonData map[string]interface{}) Event {
+	return Event{
+		Type:     EventNickChanged,
+		ServerID: guildID,
+		UserID:   userID,
+		Nick:     &NickChange{Before: before, After: after},
+		Reason:   newReason(reason, reasonData),
+	}
+}
@@ -0,0 +1,357 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/store"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderID        = "X-Webhook-ID"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	// signaturePrefix names the algorithm of the signature, like GitHub does
+	signaturePrefix = "sha256="
+	// queueSize is the number of deliveries waiting to be sent, before new deliveries are dead lettered
+	queueSize = 1000
+	// deliveryTimeout is how long a webhook has to respond
+	deliveryTimeout = 10 * time.Second
+	// maxDeadLetters is the number of failed deliveries kept per server. Older ones are forgotten
+	maxDeadLetters = 100
+)
+
+// retryDelays are the delays before each retry of a failed delivery. A delivery is given up after the last retry
+var retryDelays = []time.Duration{5 * time.Second, 30 * time.Second, 2 * time.Minute, 10 * time.Minute}
+
+// DeadLetter is a delivery that was given up
+type DeadLetter struct {
+	EventID   string    `json:"event_id"`
+	EventType EventType `json:"event_type"`
+	URL       string    `json:"url"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	Time      time.Time `json:"time"`
+	// Payload is the body of the delivery, so it can be replayed by hand
+	Payload string `json:"payload"`
+}
+
+type delivery struct {
+	event   Event
+	url     string
+	payload []byte
+	// attempts is the number of times the delivery has been sent
+	attempts int
+}
+
+// Dispatcher sends events to the webhooks configured on the server they happened on.
+// Deliveries are signed with the webhook secret of the server, retried if they fail, and dead lettered when given up
+type Dispatcher struct {
+	discord *discordgo.Session
+	service *backend.Service
+	client  *http.Client
+	queue   chan delivery
+	delays  []time.Duration
+
+	// secretM keeps two secrets from being generated for a server at once
+	secretM sync.Mutex
+	// m guards recording dead letters
+	m           sync.Mutex
+	deadLetters *store.Store[[]DeadLetter]
+}
+
+// NewDispatcher creates a webhook dispatcher, with dead letters persisted in dataDir.
+// If dataDir is empty, dead letters are only kept in memory
+func NewDispatcher(discord *discordgo.Session, service *backend.Service, dataDir string) *Dispatcher {
+	path := ""
+	if dataDir != "" {
+		path = filepath.Join(dataDir, "webhook_dead_letters.json")
+	}
+	deadLetters, err := store.Open[[]DeadLetter](path, 0)
+	if err != nil {
+		zap.L().Error("unable to load webhook dead letters, starting without any", zap.String("path", path), zap.Error(err))
+		deadLetters, _ = store.Open[[]DeadLetter]("", 0)
+	}
+
+	return &Dispatcher{
+		discord:     discord,
+		service:     service,
+		client:      newClient(),
+		queue:       make(chan delivery, queueSize),
+		delays:      retryDelays,
+		deadLetters: deadLetters,
+	}
+}
+
+// newClient returns a http client that refuses to connect to private addresses, so webhooks cannot be used to reach
+// services on the network of the bot. Redirects are not followed, as they could lead anywhere
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: deliveryTimeout,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublic(ip) {
+				return fmt.Errorf("webhooks may not be sent to %s", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   deliveryTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPublic(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsUnspecified() && !ip.IsMulticast()
+}
+
+// Start starts the workers sending deliveries
+func (d *Dispatcher) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for delivery := range d.queue {
+				d.deliver(delivery)
+			}
+		}()
+	}
+}
+
+// Send queues the event for every webhook of its server. Sending to a nil dispatcher does nothing, so callers need
+// not check whether webhooks are set up
+func (d *Dispatcher) Send(event Event) {
+	if d == nil {
+		return
+	}
+	urls := d.service.GetURLs(event.ServerID, backend.SettingWebhookURLs)
+	if len(urls) == 0 {
+		return
+	}
+
+	event.ID = newID()
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Role != nil && event.Role.Name == "" && d.discord != nil && d.discord.State != nil {
+		if role, err := d.discord.State.Role(event.ServerID, event.Role.ID); err == nil {
+			event.Role.Name = role.Name
+		}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		zap.L().Error("unable to encode webhook event", zap.String("type", string(event.Type)), zap.Error(err))
+		return
+	}
+	for _, url := range urls {
+		d.enqueue(delivery{event: event, url: url, payload: payload})
+	}
+}
+
+// SendAll queues every event, see Send
+func (d *Dispatcher) SendAll(events []Event) {
+	for _, event := range events {
+		d.Send(event)
+	}
+}
+
+func (d *Dispatcher) enqueue(delivery delivery) {
+	select {
+	case d.queue <- delivery:
+	default:
+		d.deadLetter(delivery, errors.New("too many deliveries waiting to be sent"))
+	}
+}
+
+// deliver sends the delivery, and schedules a retry if it failed and may succeed later
+func (d *Dispatcher) deliver(delivery delivery) {
+	delivery.attempts++
+	retry, err := d.post(delivery)
+	if err == nil {
+		return
+	}
+
+	if !retry || delivery.attempts > len(d.delays) {
+		d.deadLetter(delivery, err)
+		return
+	}
+	zap.L().Debug("webhook delivery failed, retrying",
+		zap.String("guildID", delivery.event.ServerID),
+		zap.String("url", delivery.url),
+		zap.Int("attempts", delivery.attempts),
+		zap.Error(err))
+	time.AfterFunc(d.delays[delivery.attempts-1], func() {
+		d.enqueue(delivery)
+	})
+}
+
+// post sends the delivery once, and returns whether it should be retried if it failed
+func (d *Dispatcher) post(delivery delivery) (retry bool, err error) {
+	secret, err := d.Secret(delivery.event.ServerID)
+	if err != nil {
+		return true, fmt.Errorf("unable to get webhook secret: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.url, bytes.NewReader(delivery.payload))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gw2-alliance-bot")
+	req.Header.Set(HeaderID, delivery.event.ID)
+	req.Header.Set(HeaderEvent, string(delivery.event.Type))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, delivery.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return shouldRetry(resp.StatusCode), fmt.Errorf("webhook responded with %s", resp.Status)
+}
+
+// shouldRetry returns whether a delivery answered with the status may succeed if sent again
+func shouldRetry(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+func (d *Dispatcher) deadLetter(delivery delivery, err error) {
+	zap.L().Warn("giving up webhook delivery",
+		zap.String("guildID", delivery.event.ServerID),
+		zap.String("url", delivery.url),
+		zap.String("eventID", delivery.event.ID),
+		zap.String("type", string(delivery.event.Type)),
+		zap.Int("attempts", delivery.attempts),
+		zap.Error(err))
+
+	d.m.Lock()
+	letters, _, _ := d.deadLetters.Get(delivery.event.ServerID)
+	letters = append(slices.Clone(letters), DeadLetter{
+		EventID:   delivery.event.ID,
+		EventType: delivery.event.Type,
+		URL:       delivery.url,
+		Attempts:  delivery.attempts,
+		Error:     err.Error(),
+		Time:      time.Now(),
+		Payload:   string(delivery.payload),
+	})
+	if len(letters) > maxDeadLetters {
+		letters = letters[len(letters)-maxDeadLetters:]
+	}
+	d.deadLetters.Set(delivery.event.ServerID, letters)
+	d.m.Unlock()
+
+	if err := d.deadLetters.Save(); err != nil {
+		zap.L().Error("unable to save webhook dead letters", zap.Error(err))
+	}
+}
+
+// DeadLetters returns the deliveries to webhooks of the server that were given up, newest first
+func (d *Dispatcher) DeadLetters(guildID string) []DeadLetter {
+	letters, _, _ := d.deadLetters.Get(guildID)
+	letters = slices.Clone(letters)
+	slices.Reverse(letters)
+	return letters
+}
+
+// Secret returns the secret webhook events of the server are signed with, generating one if the server has none yet
+func (d *Dispatcher) Secret(guildID string) (string, error) {
+	d.secretM.Lock()
+	defer d.secretM.Unlock()
+	secret := d.service.GetSetting(guildID, backend.SettingWebhookSecret)
+	if secret != "" {
+		return secret, nil
+	}
+	return d.setSecret(context.Background(), guildID)
+}
+
+// RotateSecret replaces the webhook secret of the server with a new one, and returns it.
+// Events already waiting to be sent are signed with the new secret
+func (d *Dispatcher) RotateSecret(ctx context.Context, guildID string) (string, error) {
+	d.secretM.Lock()
+	defer d.secretM.Unlock()
+	return d.setSecret(ctx, guildID)
+}
+
+func (d *Dispatcher) setSecret(ctx context.Context, guildID string) (string, error) {
+	secret := newSecret()
+	err := d.service.SetSetting(ctx, guildID, backend.SettingWebhookSecret, secret)
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Sign returns the signature of the payload sent at timestamp, as sent in the X-Webhook-Signature header.
+// The signature is the hex encoded HMAC-SHA256 of the timestamp, a dot and the payload
+func Sign(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns whether the signature of the payload sent at timestamp was made with the secret.
+// Receivers should also reject timestamps too far in the past, so deliveries cannot be replayed
+func Verify(secret string, timestamp string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, payload)), []byte(signature))
+}
+
+func newSecret() string {
+	return randomString(backend.MinSecretLength)
+}
+
+func newID() string {
+	return randomString(16)
+}
+
+// randomString returns a random, url safe string encoding n random bytes
+func randomString(n int) string {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+)
+
+// testService returns a service backed by a backend accepting every setting
+func testService(t *testing.T) *backend.Service {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+	client, err := api.NewClientWithResponses(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend.NewService(client, "service", nil)
+}
+
+// receiver records the deliveries it receives, answering with the statuses in turn
+type receiver struct {
+	m        sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.m.Lock()
+	defer rc.m.Unlock()
+	status := http.StatusOK
+	if len(rc.requests) < len(rc.statuses) {
+		status = rc.statuses[len(rc.requests)]
+	}
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() int {
+	rc.m.Lock()
+	defer rc.m.Unlock()
+	return len(rc.requests)
+}
+
+func testDispatcher(t *testing.T, rc *receiver) (*Dispatcher, string) {
+	server := httptest.NewTLSServer(rc)
+	t.Cleanup(server.Close)
+
+	service := testService(t)
+	err := service.SetSetting(context.Background(), "1", backend.SettingWebhookURLs, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(nil, service, "")
+	// The test server listens on loopback, which the default client refuses
+	d.client = server.Client()
+	d.delays = []time.Duration{time.Millisecond, time.Millisecond}
+	d.Start(1)
+	return d, server.URL
+}
+
+func TestSignVerify(t *testing.T) {
+	g := NewGomegaWithT(t)
+	payload := []byte(`{"type":"member.verified"}`)
+	signature := Sign("secret", "1700000000", payload)
+
+	g.Expect(signature).To(HavePrefix("sha256="))
+	g.Expect(Verify("secret", "1700000000", payload, signature)).To(BeTrue())
+	g.Expect(Verify("other", "1700000000", payload, signature)).To(BeFalse())
+	g.Expect(Verify("secret", "1700000001", payload, signature)).To(BeFalse())
+	g.Expect(Verify("secret", "1700000000", []byte(`{}`), signature)).To(BeFalse())
+}
+
+func TestShouldRetry(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(shouldRetry(http.StatusInternalServerError)).To(BeTrue())
+	g.Expect(shouldRetry(http.StatusBadGateway)).To(BeTrue())
+	g.Expect(shouldRetry(http.StatusTooManyRequests)).To(BeTrue())
+	g.Expect(shouldRetry(http.StatusRequestTimeout)).To(BeTrue())
+	g.Expect(shouldRetry(http.StatusBadRequest)).To(BeFalse())
+	g.Expect(shouldRetry(http.StatusNotFound)).To(BeFalse())
+}
+
+func TestIsPublic(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(isPublic(net.ParseIP("1.1.1.1"))).To(BeTrue())
+	g.Expect(isPublic(net.ParseIP("2606:4700::1111"))).To(BeTrue())
+	for _, ip := range []string{"127.0.0.1", "::1", "10.0.0.1", "192.168.1.1", "172.16.0.1", "169.254.169.254", "fe80::1", "0.0.0.0", "fd00::1"} {
+		g.Expect(isPublic(net.ParseIP(ip))).To(BeFalse(), ip)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	g := NewGomegaWithT(t)
+	rc := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	d, _ := testDispatcher(t, rc)
+
+	d.Send(NickChanged("1", "2", "Cinder", "Cinder.1234", "audit.reasons.account_rep", nil))
+	// Servers without webhooks are skipped
+	d.Send(NickChanged("other", "2", "Cinder", "Cinder.1234", "audit.reasons.account_rep", nil))
+
+	// The first attempt fails, and is retried
+	g.Eventually(rc.received).Should(Equal(2))
+	g.Consistently(rc.received, 50*time.Millisecond).Should(Equal(2))
+	g.Expect(d.DeadLetters("1")).To(BeEmpty())
+
+	rc.m.Lock()
+	defer rc.m.Unlock()
+	req, body := rc.requests[1], rc.bodies[1]
+	secret := d.service.GetSetting("1", backend.SettingWebhookSecret)
+	g.Expect(secret).To(HaveLen(43))
+	g.Expect(backend.ValidateSetting(backend.SettingWebhookSecret, secret)).To(Succeed())
+	g.Expect(Verify(secret, req.Header.Get(HeaderTimestamp), body, req.Header.Get(HeaderSignature))).To(BeTrue())
+	g.Expect(req.Header.Get(HeaderEvent)).To(Equal(string(EventNickChanged)))
+
+	var event Event
+	g.Expect(json.Unmarshal(body, &event)).To(Succeed())
+	g.Expect(event.ID).To(Equal(req.Header.Get(HeaderID)))
+	g.Expect(event.ServerID).To(Equal("1"))
+	g.Expect(event.Nick).To(Equal(&NickChange{Before: "Cinder", After: "Cinder.1234"}))
+	g.Expect(event.Reason.Key).To(Equal("audit.reasons.account_rep"))
+	// Retries are the same delivery
+	g.Expect(rc.bodies[0]).To(Equal(body))
+}
+
+func TestDeadLetters(t *testing.T) {
+	g := NewGomegaWithT(t)
+	rc := &receiver{statuses: []int{http.StatusBadRequest, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}}
+	d, url := testDispatcher(t, rc)
+
+	// Deliveries refused by the webhook are not retried
+	d.Send(AccountExpired("1", "2", api.Account{Name: "Cinder.1234"}))
+	g.Eventually(func() []DeadLetter { return d.DeadLetters("1") }).Should(HaveLen(1))
+	g.Expect(d.DeadLetters("1")[0].Attempts).To(Equal(1))
+	g.Expect(d.DeadLetters("1")[0].URL).To(Equal(url))
+
+	// Deliveries are given up after the last retry
+	d.Send(AccountExpired("1", "2", api.Account{Name: "Cinder.1234"}))
+	g.Eventually(func() []DeadLetter { return d.DeadLetters("1") }).Should(HaveLen(2))
+	g.Expect(d.DeadLetters("1")[0].Attempts).To(Equal(3))
+	g.Expect(rc.received()).To(Equal(4))
+}
+
+func TestDeadLetterLimit(t *testing.T) {
+	g := NewGomegaWithT(t)
+	d := NewDispatcher(nil, nil, "")
+	for i := 0; i < maxDeadLetters+5; i++ {
+		d.deadLetter(delivery{event: Event{ID: string(rune('a' + i%26)), ServerID: "1"}, attempts: i}, errors.New("failed"))
+	}
+
+	letters := d.DeadLetters("1")
+	g.Expect(letters).To(HaveLen(maxDeadLetters))
+	g.Expect(letters[0].Attempts).To(Equal(maxDeadLetters + 4))
+	g.Expect(d.DeadLetters("other")).To(BeEmpty())
+}
+
+func TestRoleEvents(t *testing.T) {
+	g := NewGomegaWithT(t)
+	events := RoleEvents(EventWvWRoleGranted, EventWvWRoleRemoved, "1", "2", []reconcile.Decision{
+		{RoleID: "3", Want: true, Reason: "audit.reasons.primary_world", ReasonData: map[string]interface{}{"account": "Cinder.1234"}},
+		{RoleID: "4", Has: true},
+	})
+
+	g.Expect(events).To(HaveLen(2))
+	g.Expect(events[0].Type).To(Equal(EventWvWRoleGranted))
+	g.Expect(events[0].Role.ID).To(Equal("3"))
+	g.Expect(events[0].Reason.Text).To(ContainSubstring("Cinder.1234"))
+	g.Expect(events[1].Type).To(Equal(EventWvWRoleRemoved))
+	g.Expect(events[1].Reason).To(BeNil())
+}
+
+func TestMemberVerified(t *testing.T) {
+	g := NewGomegaWithT(t)
+	expired := true
+	event := MemberVerified("1", "2", []api.Account{{Name: "Cinder.1234"}, {Name: "Old.5678", Expired: &expired}})
+	g.Expect(event.Accounts).To(Equal([]string{"Cinder.1234"}))
+}
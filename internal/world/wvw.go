@@ -1,119 +1,152 @@
 package world
 
 import (
+	"fmt"
 	"slices"
-	"strconv"
-	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/vennekilde/gw2-alliance-bot/internal/api"
+	"github.com/vennekilde/gw2-alliance-bot/internal/audit"
 	"github.com/vennekilde/gw2-alliance-bot/internal/backend"
+	"github.com/vennekilde/gw2-alliance-bot/internal/reconcile"
+	"github.com/vennekilde/gw2-alliance-bot/internal/webhook"
+	"github.com/vennekilde/gw2-alliance-bot/resources"
 )
 
 type WvW struct {
-	discord *discordgo.Session
-	service *backend.Service
-	worlds  *Worlds
+	discord  *discordgo.Session
+	service  *backend.Service
+	worlds   *Worlds
+	audit    *audit.Log
+	webhooks *webhook.Dispatcher
 }
 
-func NewWvW(discord *discordgo.Session, service *backend.Service, worlds *Worlds) *WvW {
+func NewWvW(discord *discordgo.Session, service *backend.Service, worlds *Worlds, auditLog *audit.Log, webhooks *webhook.Dispatcher) *WvW {
 	return &WvW{
-		discord: discord,
-		service: service,
-		worlds:  worlds,
+		discord:  discord,
+		service:  service,
+		worlds:   worlds,
+		audit:    auditLog,
+		webhooks: webhooks,
 	}
 }
 
 // Check if a platform user is in the correct role for their world
 func (w *WvW) VerifyWvWWorldRoles(guildID string, member *discordgo.Member, accounts []api.Account, bans []api.Ban) error {
-	primaryWorld := w.service.GetSetting(guildID, backend.SettingWvWWorld)
-	if primaryWorld == "disabled" || primaryWorld == "" {
-		return nil
-	}
-	primaryWorldID, err := strconv.Atoi(primaryWorld)
+	decisions, err := w.PlanWvWWorldRoles(guildID, member, accounts, bans)
 	if err != nil {
 		return err
 	}
+	applied, err := reconcile.Apply(w.discord, w.audit, guildID, member.User.ID, decisions)
+	w.webhooks.SendAll(webhook.RoleEvents(webhook.EventWvWRoleGranted, webhook.EventWvWRoleRemoved, guildID, member.User.ID, applied))
+	w.webhooks.SendAll(banEvents(guildID, member.User.ID, applied, accounts, bans))
+	return err
+}
+
+// banEvents returns the events sent for world roles removed from the member, because their account is banned
+func banEvents(guildID string, userID string, applied []reconcile.Decision, accounts []api.Account, bans []api.Ban) []webhook.Event {
+	var events []webhook.Event
+	for _, decision := range applied {
+		if decision.Want || decision.Reason != "audit.reasons.banned" {
+			continue
+		}
+		accountIdx := slices.IndexFunc(accounts, func(a api.Account) bool {
+			return a.Name == decision.ReasonData["account"]
+		})
+		if accountIdx < 0 {
+			continue
+		}
+		account := accounts[accountIdx]
+		banIdx := slices.IndexFunc(bans, func(b api.Ban) bool {
+			return b.UserID == account.UserID
+		})
+		if banIdx < 0 {
+			continue
+		}
+		events = append(events, webhook.BanApplied(guildID, userID, decision.RoleID, account, bans[banIdx]))
+	}
+	return events
+}
+
+// PlanWvWWorldRoles decides which world roles the member should have, and why, without changing anything
+func (w *WvW) PlanWvWWorldRoles(guildID string, member *discordgo.Member, accounts []api.Account, bans []api.Ban) ([]reconcile.Decision, error) {
+	primaryWorldID, ok := w.service.GetWorld(guildID)
+	if !ok {
+		return nil, nil
+	}
 	LinkedWorlds, err := w.worlds.GetWorldLinks(primaryWorldID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	primaryRoleID := w.service.GetSetting(guildID, backend.SettingPrimaryRole)
 	linkedRoleID := w.service.GetSetting(guildID, backend.SettingLinkedRole)
 
-	hasPrimaryRole := slices.Contains(member.Roles, primaryRoleID)
-	hasLinkedRole := slices.Contains(member.Roles, linkedRoleID)
-
-	shouldHavePrimaryRole := false
-	shouldHaveLinkedRole := false
+	primary := reconcile.Decision{
+		RoleID: primaryRoleID,
+		Has:    slices.Contains(member.Roles, primaryRoleID),
+		Reason: "audit.reasons.not_primary_world",
+	}
+	linked := reconcile.Decision{
+		RoleID: linkedRoleID,
+		Has:    slices.Contains(member.Roles, linkedRoleID),
+		Reason: "audit.reasons.not_linked_world",
+	}
+	if len(accounts) == 0 {
+		primary.Reason = "audit.reasons.no_linked_account"
+		linked.Reason = "audit.reasons.no_linked_account"
+	}
 
 	for _, account := range accounts {
-		isBanned := slices.ContainsFunc(bans, func(b api.Ban) bool {
+		onPrimaryWorld := account.World == primaryWorldID
+		onLinkedWorld := slices.Contains(LinkedWorlds, account.World)
+
+		banIdx := slices.IndexFunc(bans, func(b api.Ban) bool {
 			return b.UserID == account.UserID
 		})
-		if isBanned {
+		if banIdx >= 0 {
+			// Banned accounts do not count, but explain why they were ignored
+			reasonData := resources.TData("account", account.Name, "until", fmt.Sprintf("<t:%d:f>", bans[banIdx].Until.Unix()), "reason", bans[banIdx].Reason)
+			if onPrimaryWorld && !primary.Want {
+				primary.Reason, primary.ReasonData = "audit.reasons.banned", reasonData
+			}
+			if onLinkedWorld && !linked.Want {
+				linked.Reason, linked.ReasonData = "audit.reasons.banned", reasonData
+			}
 			continue
 		}
-		if account.World == primaryWorldID {
-			shouldHavePrimaryRole = true
-			// Check if user has the primary role
-			if !hasPrimaryRole {
-				// Add primary role
-				err = w.discord.GuildMemberRoleAdd(guildID, member.User.ID, primaryRoleID)
-				if err != nil {
-					return err
-				}
-			}
+		if onPrimaryWorld && !primary.Want {
+			primary.Want = true
+			primary.Reason, primary.ReasonData = "audit.reasons.primary_world", resources.TData("account", account.Name)
 		}
-		if slices.Contains(LinkedWorlds, account.World) {
-			shouldHaveLinkedRole = true
-			// Check if user has the linked role
-			if !hasLinkedRole {
-				// Add linked role
-				err = w.discord.GuildMemberRoleAdd(guildID, member.User.ID, linkedRoleID)
-				if err != nil {
-					return err
-				}
-			}
+		if onLinkedWorld && !linked.Want {
+			linked.Want = true
+			linked.Reason, linked.ReasonData = "audit.reasons.linked_world", resources.TData("account", account.Name)
 		}
 	}
 
-	// Check if user should have primary role
-	if !shouldHavePrimaryRole && hasPrimaryRole {
-		// Remove primary role
-		err = w.discord.GuildMemberRoleRemove(guildID, member.User.ID, primaryRoleID)
-		if err != nil {
-			return err
-		}
+	decisions := []reconcile.Decision{}
+	if primaryRoleID != "" {
+		decisions = append(decisions, primary)
 	}
-
-	// Check if user should have linked role
-	if !shouldHaveLinkedRole && hasLinkedRole {
-		// Remove linked role
-		err = w.discord.GuildMemberRoleRemove(guildID, member.User.ID, linkedRoleID)
-		if err != nil {
-			return err
-		}
+	if linkedRoleID != "" {
+		decisions = append(decisions, linked)
 	}
 
-	// Check if user should have associated roles
-	if !shouldHavePrimaryRole && !shouldHaveLinkedRole {
-		associatedRoles := w.service.GetSetting(guildID, backend.SettingAssociatedRoles)
-		if associatedRoles != "" {
-			associatedRoleIDs := strings.Split(associatedRoles, ",")
-			for _, roleID := range associatedRoleIDs {
-				hasRole := slices.Contains(member.Roles, roleID)
-				if hasRole {
-					// Remove role
-					err = w.discord.GuildMemberRoleRemove(guildID, member.User.ID, roleID)
-					if err != nil {
-						return err
-					}
-				}
-			}
+	// Associated roles are removed if the member is on neither the primary world nor a linked world
+	for _, roleID := range w.service.GetRoles(guildID, backend.SettingAssociatedRoles) {
+		hasRole := slices.Contains(member.Roles, roleID)
+		decision := reconcile.Decision{
+			RoleID: roleID,
+			Has:    hasRole,
+			Want:   hasRole,
+			Reason: "audit.reasons.on_world",
 		}
+		if !primary.Want && !linked.Want {
+			decision.Want = false
+			decision.Reason = "audit.reasons.not_on_world"
+		}
+		decisions = append(decisions, decision)
 	}
-
-	return nil
+	return decisions, nil
 }
@@ -164,3 +164,12 @@ func TL(locale discordgo.Locale, key string, data ...map[string]interface{}) str
 	lang := LocaleToLanguage(locale)
 	return Translate(lang, key, data...)
 }
+
+// GetOptionLocalizations returns a map of Discord locale codes to translations for a given key, in the form expected by command options
+func GetOptionLocalizations(key string) map[discordgo.Locale]string {
+	localizations := GetLocalizations(key)
+	if localizations == nil {
+		return nil
+	}
+	return *localizations
+}